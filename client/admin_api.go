@@ -0,0 +1,311 @@
+package client
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gk7790/gk-zap/client/proxy"
+	"github.com/gk7790/gk-zap/pkg/config"
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+	"github.com/gk7790/gk-zap/pkg/config/validation"
+	"github.com/gk7790/gk-zap/pkg/utils/web"
+	"github.com/gk7790/gk-zap/pkg/utils/xlog"
+)
+
+type GeneralResponse struct {
+	Code int
+	Msg  string
+}
+
+func (svr *Service) registerRouteHandlers(ws *web.Server) {
+	ws.HandleFunc("POST /api/reload", svr.apiReload)
+	ws.HandleFunc("POST /api/stop", svr.apiStop)
+	ws.HandleFunc("GET /api/status", svr.apiStatus)
+	ws.HandleFunc("GET /api/config", svr.apiGetConfig)
+	ws.HandleFunc("PUT /api/config", svr.apiPutConfig)
+}
+
+func writeResponse(xl *xlog.Logger, w http.ResponseWriter, res GeneralResponse) {
+	xl.Infof("http response [%s]: code [%d]", res.Msg, res.Code)
+	w.WriteHeader(res.Code)
+	if len(res.Msg) > 0 {
+		_, _ = w.Write([]byte(res.Msg))
+	}
+}
+
+// POST /api/reload
+func (svr *Service) apiReload(w http.ResponseWriter, r *http.Request) {
+	xl := xlog.FromContextSafe(svr.ctx)
+	res := GeneralResponse{Code: 200}
+	strictConfigMode := svr.strictConfigMode(r)
+
+	xl.Infof("api request [/api/reload]")
+	defer func() {
+		writeResponse(xl, w, res)
+	}()
+
+	if svr.configFilePath == "" {
+		res.Code = 400
+		res.Msg = "gkc has no config file path"
+		return
+	}
+
+	_, proxyCfgs, visitorCfgs, err := loadAndValidateClientConfig(xl, svr.configFilePath, strictConfigMode)
+	if err != nil {
+		res.Code = 400
+		res.Msg = err.Error()
+		xl.Warnf("reload gkc proxy config error: %s", res.Msg)
+		return
+	}
+
+	if err := svr.UpdateAllConfigurer(proxyCfgs, visitorCfgs); err != nil {
+		res.Code = 500
+		res.Msg = err.Error()
+		xl.Warnf("reload gkc proxy config error: %s", res.Msg)
+		return
+	}
+	xl.Infof("success reload conf")
+}
+
+// strictConfigMode returns the strictConfig query parameter of r, or the mode
+// the config file was loaded with.
+func (svr *Service) strictConfigMode(r *http.Request) bool {
+	if v := r.URL.Query().Get("strictConfig"); v != "" {
+		if strict, err := strconv.ParseBool(v); err == nil {
+			return strict
+		}
+	}
+	return svr.strictConfig
+}
+
+func loadAndValidateClientConfig(xl *xlog.Logger, path string, strict bool) (
+	*m.ClientCommonConfig,
+	[]m.ProxyConfigurer,
+	[]m.VisitorConfigurer,
+	error,
+) {
+	cliCfg, proxyCfgs, visitorCfgs, err := config.LoadClientConfig(path, strict)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	warning, err := validation.ValidateClientConfig(cliCfg, proxyCfgs, visitorCfgs)
+	if warning != nil {
+		xl.Warnf("%v", warning)
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return cliCfg, proxyCfgs, visitorCfgs, nil
+}
+
+// POST /api/stop
+func (svr *Service) apiStop(w http.ResponseWriter, _ *http.Request) {
+	xl := xlog.FromContextSafe(svr.ctx)
+	res := GeneralResponse{Code: 200}
+
+	xl.Infof("api request [/api/stop]")
+	defer func() {
+		writeResponse(xl, w, res)
+	}()
+
+	go func() {
+		// give the response a chance to be sent before the service stops
+		time.Sleep(100 * time.Millisecond)
+		svr.Close()
+	}()
+}
+
+type StatusResp map[string][]ProxyStatusResp
+
+type ProxyStatusResp struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Status     string `json:"status"`
+	Err        string `json:"err"`
+	LocalAddr  string `json:"local_addr"`
+	Plugin     string `json:"plugin"`
+	RemoteAddr string `json:"remote_addr"`
+}
+
+func newProxyStatusResp(status *proxy.WorkingStatus, serverAddr string) ProxyStatusResp {
+	psr := ProxyStatusResp{
+		Name:   status.Name,
+		Type:   status.Type,
+		Status: status.Phase,
+		Err:    status.Err,
+	}
+	baseCfg := status.Cfg.GetBaseConfig()
+	if baseCfg.LocalPort != 0 {
+		psr.LocalAddr = net.JoinHostPort(baseCfg.LocalIP, strconv.Itoa(baseCfg.LocalPort))
+	}
+	psr.Plugin = baseCfg.Plugin.Type
+
+	if status.Err == "" {
+		psr.RemoteAddr = status.RemoteAddr
+		if slices.Contains([]string{"tcp", "udp"}, status.Type) {
+			psr.RemoteAddr = serverAddr + psr.RemoteAddr
+		}
+	}
+	return psr
+}
+
+// GET /api/status
+func (svr *Service) apiStatus(w http.ResponseWriter, _ *http.Request) {
+	xl := xlog.FromContextSafe(svr.ctx)
+	var (
+		buf []byte
+		res StatusResp = make(map[string][]ProxyStatusResp)
+	)
+
+	xl.Infof("http request [/api/status]")
+	defer func() {
+		xl.Infof("http response [/api/status]")
+		w.Header().Set("Content-Type", "application/json")
+		buf, _ = json.Marshal(&res)
+		_, _ = w.Write(buf)
+	}()
+
+	svr.ctlMu.RLock()
+	ctl := svr.ctl
+	svr.ctlMu.RUnlock()
+	if ctl == nil {
+		return
+	}
+
+	ps := ctl.pm.GetAllProxyStatus()
+	for _, status := range ps {
+		res[status.Type] = append(res[status.Type], newProxyStatusResp(status, svr.common.ServerAddr))
+	}
+
+	for _, arrs := range res {
+		if len(arrs) <= 1 {
+			continue
+		}
+		slices.SortFunc(arrs, func(a, b ProxyStatusResp) int {
+			return cmp.Compare(a.Name, b.Name)
+		})
+	}
+}
+
+// GET /api/config
+func (svr *Service) apiGetConfig(w http.ResponseWriter, _ *http.Request) {
+	xl := xlog.FromContextSafe(svr.ctx)
+	res := GeneralResponse{Code: 200}
+
+	xl.Infof("http get request [/api/config]")
+	defer func() {
+		xl.Infof("http get response [/api/config], code [%d]", res.Code)
+		w.WriteHeader(res.Code)
+		if len(res.Msg) > 0 {
+			_, _ = w.Write([]byte(res.Msg))
+		}
+	}()
+
+	if svr.configFilePath == "" {
+		res.Code = 400
+		res.Msg = "gkc has no config file path"
+		xl.Warnf("%s", res.Msg)
+		return
+	}
+
+	content, err := os.ReadFile(svr.configFilePath)
+	if err != nil {
+		res.Code = 400
+		res.Msg = err.Error()
+		xl.Warnf("load gkc config file error: %s", res.Msg)
+		return
+	}
+	res.Msg = string(content)
+}
+
+// PUT /api/config
+func (svr *Service) apiPutConfig(w http.ResponseWriter, r *http.Request) {
+	xl := xlog.FromContextSafe(svr.ctx)
+	res := GeneralResponse{Code: 200}
+
+	xl.Infof("http put request [/api/config]")
+	defer func() {
+		xl.Infof("http put response [/api/config], code [%d]", res.Code)
+		w.WriteHeader(res.Code)
+		if len(res.Msg) > 0 {
+			_, _ = w.Write([]byte(res.Msg))
+		}
+	}()
+
+	// get new config content
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		res.Code = 400
+		res.Msg = fmt.Sprintf("read request body error: %v", err)
+		xl.Warnf("%s", res.Msg)
+		return
+	}
+
+	if len(strings.TrimSpace(string(body))) == 0 {
+		res.Code = 400
+		res.Msg = "body can't be empty"
+		xl.Warnf("%s", res.Msg)
+		return
+	}
+
+	if svr.configFilePath == "" {
+		res.Code = 400
+		res.Msg = "gkc has no config file path"
+		xl.Warnf("%s", res.Msg)
+		return
+	}
+
+	// The content is written next to the config file with the same extension,
+	// so it's parsed in the same format and includes resolve the same way,
+	// and only replaces the config file if it's valid.
+	tmpFile, err := os.CreateTemp(filepath.Dir(svr.configFilePath), ".gkc-*"+filepath.Ext(svr.configFilePath))
+	if err != nil {
+		res.Code = 500
+		res.Msg = fmt.Sprintf("create temporary config file error: %v", err)
+		xl.Warnf("%s", res.Msg)
+		return
+	}
+	tmpPath := tmpFile.Name()
+	defer os.Remove(tmpPath)
+
+	_, err = tmpFile.Write(body)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		if info, statErr := os.Stat(svr.configFilePath); statErr == nil {
+			err = os.Chmod(tmpPath, info.Mode().Perm())
+		}
+	}
+	if err != nil {
+		res.Code = 500
+		res.Msg = fmt.Sprintf("write content to gkc config file error: %v", err)
+		xl.Warnf("%s", res.Msg)
+		return
+	}
+
+	if _, _, _, err := loadAndValidateClientConfig(xl, tmpPath, svr.strictConfigMode(r)); err != nil {
+		res.Code = 400
+		// report the errors against the config file, not the temporary one
+		res.Msg = "invalid config: " + strings.ReplaceAll(err.Error(), tmpPath, svr.configFilePath)
+		xl.Warnf("%s", res.Msg)
+		return
+	}
+
+	if err := os.Rename(tmpPath, svr.configFilePath); err != nil {
+		res.Code = 500
+		res.Msg = fmt.Sprintf("write content to gkc config file error: %v", err)
+		xl.Warnf("%s", res.Msg)
+		return
+	}
+}
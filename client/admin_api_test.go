@@ -0,0 +1,132 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gk7790/gk-zap/pkg/utils/log"
+)
+
+func TestMain(tm *testing.M) {
+	log.Init(false, "", log.LevelError)
+	os.Exit(tm.Run())
+}
+
+const testClientConfig = "serverAddr: 10.0.0.1\nproxies:\n  - name: ssh\n    type: tcp\n    localPort: 22\n"
+
+func TestAPIPutConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		strict bool
+		query  string
+		// wantErr is empty if the config file is replaced with the body
+		wantErr string
+	}{
+		{name: "valid", body: "serverAddr: 10.0.0.2\n"},
+		{name: "empty body", body: "  \n", wantErr: "body can't be empty"},
+		{
+			// the error names the config file, not the temporary one
+			name:    "parse error",
+			body:    "serverAddr: 10.0.0.2\nserverPort: abc\n",
+			wantErr: "invalid config: CONFIG:2: serverPort: ",
+		},
+		{
+			name:    "validation error",
+			body:    "proxies:\n  - name: ssh\n    type: tcp\n    localPort: 0\n",
+			wantErr: "invalid config: proxy [ssh]: localPort",
+		},
+		{
+			name:    "unknown field in strict mode",
+			body:    "serverAddrr: 10.0.0.2\n",
+			strict:  true,
+			wantErr: `invalid config: CONFIG:1: unknown field "serverAddrr"`,
+		},
+		{name: "unknown field not strict", body: "serverAddrr: 10.0.0.2\n"},
+		{
+			// the request overrides the mode of the service
+			name:   "strict mode overridden",
+			body:   "serverAddrr: 10.0.0.2\n",
+			strict: true,
+			query:  "?strictConfig=false",
+		},
+		{
+			name:    "strict mode requested",
+			body:    "serverAddrr: 10.0.0.2\n",
+			query:   "?strictConfig=true",
+			wantErr: `unknown field "serverAddrr"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "gkc.yaml")
+			if err := os.WriteFile(path, []byte(testClientConfig), 0o640); err != nil {
+				t.Fatal(err)
+			}
+			svr, err := NewService(ServiceOptions{ConfigFilePath: path, StrictConfig: tt.strict})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest(http.MethodPut, "/api/config"+tt.query, strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			svr.apiPutConfig(rec, req)
+
+			content, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantErr != "" {
+				if rec.Code != http.StatusBadRequest {
+					t.Errorf("expected code 400, got %d", rec.Code)
+				}
+				if got := strings.ReplaceAll(rec.Body.String(), path, "CONFIG"); !strings.Contains(got, tt.wantErr) {
+					t.Errorf("expected error containing %q, got %q", tt.wantErr, got)
+				}
+				if string(content) != testClientConfig {
+					t.Errorf("expected the config file to be untouched, got %q", content)
+				}
+			} else {
+				if rec.Code != http.StatusOK {
+					t.Fatalf("expected code 200, got %d: %s", rec.Code, rec.Body.String())
+				}
+				if string(content) != tt.body {
+					t.Errorf("expected the config file to be replaced, got %q", content)
+				}
+				info, err := os.Stat(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if info.Mode().Perm() != 0o640 {
+					t.Errorf("expected mode 0640 to be kept, got %o", info.Mode().Perm())
+				}
+			}
+
+			// the temporary file is removed in any case
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 {
+				t.Errorf("expected only the config file to be left, got %d files", len(entries))
+			}
+		})
+	}
+}
+
+func TestAPIPutConfigWithoutConfigFile(t *testing.T) {
+	svr, err := NewService(ServiceOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	svr.apiPutConfig(rec, httptest.NewRequest(http.MethodPut, "/api/config", strings.NewReader(testClientConfig)))
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "no config file path") {
+		t.Fatalf("unexpected response %d: %s", rec.Code, rec.Body.String())
+	}
+}
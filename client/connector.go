@@ -3,25 +3,30 @@ package client
 import (
 	"context"
 	"crypto/tls"
+	"io"
+	"net"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	m "github.com/gk7790/gk-zap/pkg/config/model"
+	pkgNet "github.com/gk7790/gk-zap/pkg/net"
+	"github.com/gk7790/gk-zap/pkg/transport"
+	"github.com/gk7790/gk-zap/pkg/utils/xlog"
 	fmux "github.com/hashicorp/yamux"
 	quic "github.com/quic-go/quic-go"
 	"github.com/samber/lo"
-
-	"net"
-	"strings"
-	"sync"
-	"time"
 )
 
+// Connector is an interface for establishing connections to the server.
 type Connector interface {
 	Open() error
 	Connect() (net.Conn, error)
 	Close() error
 }
 
+// simpleConnector is the default implementation of Connector for normal clients.
 type simpleConnector struct {
 	ctx        context.Context
 	cfg        *m.ClientCommonConfig
@@ -37,7 +42,14 @@ func NewConnector(ctx context.Context, cfg *m.ClientCommonConfig) Connector {
 	}
 }
 
+// Open opens an underlying connection to the server.
+// The underlying connection is either a TCP connection or a QUIC connection.
+// After the underlying connection is established, you can call Connect() to get a stream.
+// If TCPMux isn't enabled, the underlying connection is nil, you will get a new real TCP connection every time you call Connect().
 func (c *simpleConnector) Open() error {
+	xl := xlog.FromContextSafe(c.ctx)
+
+	// special for quic
 	if strings.EqualFold(c.cfg.Transport.Protocol, "quic") {
 		var tlsConfig *tls.Config
 		var err error
@@ -45,6 +57,20 @@ func (c *simpleConnector) Open() error {
 		if sn == "" {
 			sn = c.cfg.ServerAddr
 		}
+		if lo.FromPtr(c.cfg.Transport.TLS.Enable) {
+			tlsConfig, err = transport.NewClientTLSConfig(
+				c.cfg.Transport.TLS.CertFile,
+				c.cfg.Transport.TLS.KeyFile,
+				c.cfg.Transport.TLS.TrustedCaFile,
+				sn)
+		} else {
+			tlsConfig, err = transport.NewClientTLSConfig("", "", "", sn)
+		}
+		if err != nil {
+			xl.Warnf("fail to build tls configuration, err: %v", err)
+			return err
+		}
+		tlsConfig.NextProtos = []string{"gk-zap"}
 
 		conn, err := quic.DialAddr(
 			c.ctx,
@@ -58,24 +84,96 @@ func (c *simpleConnector) Open() error {
 			return err
 		}
 		c.quicConn = conn
+		return nil
 	}
+
 	if !lo.FromPtr(c.cfg.Transport.TCPMux) {
 		return nil
 	}
 
+	conn, err := c.realConnect()
+	if err != nil {
+		return err
+	}
+
+	fmuxCfg := fmux.DefaultConfig()
+	fmuxCfg.KeepAliveInterval = time.Duration(c.cfg.Transport.TCPMuxKeepaliveInterval) * time.Second
+	fmuxCfg.LogOutput = io.Discard
+	fmuxCfg.MaxStreamWindowSize = 6 * 1024 * 1024
+	session, err := fmux.Client(conn, fmuxCfg)
+	if err != nil {
+		return err
+	}
+	c.muxSession = session
 	return nil
 }
 
+// Connect returns a stream from the underlying connection, or a new TCP connection if TCPMux isn't enabled.
 func (c *simpleConnector) Connect() (net.Conn, error) {
-	d := net.Dialer{Timeout: 5 * time.Second}
-	conn, err := d.DialContext(c.ctx, "tcp", "")
+	if c.quicConn != nil {
+		stream, err := c.quicConn.OpenStreamSync(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		return pkgNet.QuicStreamToNetConn(stream, c.quicConn), nil
+	} else if c.muxSession != nil {
+		stream, err := c.muxSession.OpenStream()
+		if err != nil {
+			return nil, err
+		}
+		return stream, nil
+	}
+
+	return c.realConnect()
+}
+
+func (c *simpleConnector) realConnect() (net.Conn, error) {
+	xl := xlog.FromContextSafe(c.ctx)
+	var tlsConfig *tls.Config
+	var err error
+	tlsEnable := lo.FromPtr(c.cfg.Transport.TLS.Enable)
+	if tlsEnable {
+		sn := c.cfg.Transport.TLS.ServerName
+		if sn == "" {
+			sn = c.cfg.ServerAddr
+		}
+
+		tlsConfig, err = transport.NewClientTLSConfig(
+			c.cfg.Transport.TLS.CertFile,
+			c.cfg.Transport.TLS.KeyFile,
+			c.cfg.Transport.TLS.TrustedCaFile,
+			sn)
+		if err != nil {
+			xl.Warnf("fail to build tls configuration, err: %v", err)
+			return nil, err
+		}
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   time.Duration(c.cfg.Transport.DialServerTimeout) * time.Second,
+		KeepAlive: time.Duration(c.cfg.Transport.DialServerKeepAlive) * time.Second,
+	}
+	if c.cfg.Transport.ConnectServerLocalIP != "" {
+		dialer.LocalAddr = &net.TCPAddr{IP: net.ParseIP(c.cfg.Transport.ConnectServerLocalIP)}
+	}
+	conn, err := dialer.DialContext(c.ctx, "tcp", net.JoinHostPort(c.cfg.ServerAddr, strconv.Itoa(c.cfg.ServerPort)))
 	if err != nil {
 		return nil, err
 	}
 
+	if tlsConfig != nil {
+		if !lo.FromPtr(c.cfg.Transport.TLS.DisableCustomTLSFirstByte) {
+			if _, err = conn.Write([]byte{byte(pkgNet.TLSHeadByte)}); err != nil {
+				conn.Close()
+				return nil, err
+			}
+		}
+		conn = tls.Client(conn, tlsConfig)
+	}
 	return conn, nil
 }
 
+// Close closes the underlying connection.
 func (c *simpleConnector) Close() error {
 	c.closeOnce.Do(func() {
 		if c.quicConn != nil {
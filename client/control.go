@@ -0,0 +1,233 @@
+package client
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/gk7790/gk-zap/client/proxy"
+	"github.com/gk7790/gk-zap/client/visitor"
+	"github.com/gk7790/gk-zap/pkg/auth"
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+	"github.com/gk7790/gk-zap/pkg/msg"
+	"github.com/gk7790/gk-zap/pkg/utils/wait"
+	"github.com/gk7790/gk-zap/pkg/utils/xlog"
+)
+
+type SessionContext struct {
+	// The client common configuration.
+	Common *m.ClientCommonConfig
+
+	// Unique ID obtained from the server, used to identify this client.
+	RunID string
+	// Underlying control connection. Once conn is closed, the msgDispatcher and the entire Control will exit.
+	Conn net.Conn
+	// Sets authentication based on selected method
+	AuthSetter auth.Setter
+	// SessionKey encrypts the work connections, it's fixed at login.
+	SessionKey []byte
+	// Connector is used to create new connections, which could be real TCP connections or virtual streams.
+	Connector Connector
+}
+
+type Control struct {
+	ctx context.Context
+	xl  *xlog.Logger
+
+	// session context
+	sessionCtx *SessionContext
+
+	// manage all proxies
+	pm *proxy.Manager
+
+	// manage all visitors
+	vm *visitor.Manager
+
+	doneCh chan struct{}
+
+	// of time.Time, last time got the Pong message
+	lastPong atomic.Value
+
+	// The role of msgTransporter is similar to HTTP2.
+	// It allows multiple messages to be sent simultaneously on the same control connection.
+	msgDispatcher *msg.Dispatcher
+}
+
+func NewControl(ctx context.Context, sessionCtx *SessionContext) (*Control, error) {
+	ctl := &Control{
+		ctx:        ctx,
+		xl:         xlog.FromContextSafe(ctx),
+		sessionCtx: sessionCtx,
+		doneCh:     make(chan struct{}),
+	}
+	ctl.lastPong.Store(time.Now())
+
+	ctl.msgDispatcher = msg.NewDispatcher(sessionCtx.Conn)
+	ctl.registerMsgHandlers()
+
+	ctl.pm = proxy.NewManager(ctl.ctx, sessionCtx.Common, sessionCtx.SessionKey, ctl.msgDispatcher.Send)
+	ctl.vm = visitor.NewManager(ctx, sessionCtx.RunID, sessionCtx.Common, ctl.connectServer)
+	return ctl, nil
+}
+
+func (ctl *Control) Run(proxyCfgs []m.ProxyConfigurer, visitorCfgs []m.VisitorConfigurer) {
+	go ctl.worker()
+
+	// start all proxies
+	ctl.pm.UpdateAll(proxyCfgs)
+
+	// start all visitors
+	ctl.vm.UpdateAll(visitorCfgs)
+}
+
+func (ctl *Control) registerMsgHandlers() {
+	ctl.msgDispatcher.RegisterHandler(&msg.ReqWorkConn{}, msg.AsyncHandler(ctl.handleReqWorkConn))
+	ctl.msgDispatcher.RegisterHandler(&msg.NewProxyResp{}, ctl.handleNewProxyResp)
+	ctl.msgDispatcher.RegisterHandler(&msg.Pong{}, ctl.handlePong)
+}
+
+func (ctl *Control) handleReqWorkConn(_ msg.Message) {
+	xl := ctl.xl
+	workConn, err := ctl.connectServer()
+	if err != nil {
+		xl.Warnf("start new connection to server error: %v", err)
+		return
+	}
+
+	m := &msg.NewWorkConn{
+		RunID: ctl.sessionCtx.RunID,
+	}
+	if err = ctl.sessionCtx.AuthSetter.SetNewWorkConn(m); err != nil {
+		xl.Warnf("error during NewWorkConn authentication: %v", err)
+		workConn.Close()
+		return
+	}
+	if err = msg.WriteMsg(workConn, m); err != nil {
+		xl.Warnf("work connection write to server error: %v", err)
+		workConn.Close()
+		return
+	}
+
+	var startMsg msg.StartWorkConn
+	if err = msg.ReadMsgInto(workConn, &startMsg); err != nil {
+		xl.Debugf("work connection closed before response StartWorkConn message: %v", err)
+		workConn.Close()
+		return
+	}
+	if startMsg.Error != "" {
+		xl.Errorf("StartWorkConn contains error: %s", startMsg.Error)
+		workConn.Close()
+		return
+	}
+
+	// dispatch this work connection to related proxy
+	ctl.pm.HandleWorkConn(startMsg.ProxyName, workConn, &startMsg)
+}
+
+func (ctl *Control) handleNewProxyResp(m msg.Message) {
+	xl := ctl.xl
+	inMsg := m.(*msg.NewProxyResp)
+	// Server will return NewProxyResp message to each NewProxy message.
+	// Start a new proxy handler if no error got
+	err := ctl.pm.StartProxy(inMsg.ProxyName, inMsg.RemoteAddr, inMsg.Error)
+	if err != nil {
+		xl.Warnf("[%s] start error: %v", inMsg.ProxyName, err)
+	} else {
+		xl.Infof("[%s] start proxy success", inMsg.ProxyName)
+	}
+}
+
+func (ctl *Control) handlePong(m msg.Message) {
+	xl := ctl.xl
+	inMsg := m.(*msg.Pong)
+
+	if inMsg.Error != "" {
+		xl.Errorf("pong message contains error: %s", inMsg.Error)
+		ctl.closeSession()
+		return
+	}
+	ctl.lastPong.Store(time.Now())
+	xl.Debugf("receive heartbeat from server")
+}
+
+// closeSession closes the control connection.
+func (ctl *Control) closeSession() {
+	ctl.sessionCtx.Conn.Close()
+	ctl.sessionCtx.Connector.Close()
+}
+
+func (ctl *Control) Close() error {
+	ctl.closeSession()
+	return nil
+}
+
+// Done returns a channel that will be closed after all resources are released
+func (ctl *Control) Done() <-chan struct{} {
+	return ctl.doneCh
+}
+
+func (ctl *Control) UpdateAllConfigurer(proxyCfgs []m.ProxyConfigurer, visitorCfgs []m.VisitorConfigurer) error {
+	ctl.vm.UpdateAll(visitorCfgs)
+	ctl.pm.UpdateAll(proxyCfgs)
+	return nil
+}
+
+// connectServer return a new connection to the server
+func (ctl *Control) connectServer() (net.Conn, error) {
+	return ctl.sessionCtx.Connector.Connect()
+}
+
+func (ctl *Control) heartbeatWorker() {
+	xl := ctl.xl
+	interval := time.Duration(ctl.sessionCtx.Common.Transport.HeartbeatInterval) * time.Second
+	timeout := time.Duration(ctl.sessionCtx.Common.Transport.HeartbeatTimeout) * time.Second
+
+	if interval > 0 {
+		// Send heartbeat to server.
+		sendHeartBeat := func() (bool, error) {
+			xl.Debugf("send heartbeat to server")
+			pingMsg := &msg.Ping{RunID: ctl.sessionCtx.RunID}
+			if err := ctl.sessionCtx.AuthSetter.SetPing(pingMsg); err != nil {
+				xl.Warnf("error during ping authentication: %v, skip sending ping message", err)
+				return false, err
+			}
+			_ = ctl.msgDispatcher.Send(pingMsg)
+			return false, nil
+		}
+
+		go wait.BackoffUntil(sendHeartBeat,
+			wait.NewFastBackoffManager(wait.FastBackoffOptions{
+				Duration:           interval,
+				InitDurationIfFail: time.Second,
+				Factor:             2.0,
+				Jitter:             0.1,
+				MaxDuration:        interval,
+			}),
+			true, ctl.doneCh,
+		)
+	}
+
+	// Check heartbeat timeout.
+	if interval > 0 && timeout > 0 {
+		go wait.Until(func() {
+			if time.Since(ctl.lastPong.Load().(time.Time)) > timeout {
+				xl.Warnf("heartbeat timeout")
+				ctl.closeSession()
+				return
+			}
+		}, time.Second, ctl.doneCh)
+	}
+}
+
+func (ctl *Control) worker() {
+	go ctl.heartbeatWorker()
+	go ctl.msgDispatcher.Run()
+
+	<-ctl.msgDispatcher.Done()
+	ctl.closeSession()
+
+	ctl.pm.Close()
+	ctl.vm.Close()
+	close(ctl.doneCh)
+}
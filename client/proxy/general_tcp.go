@@ -0,0 +1,33 @@
+package proxy
+
+import (
+	"reflect"
+
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+)
+
+func init() {
+	pxyConfs := []m.ProxyConfigurer{
+		&m.TCPProxyConfig{},
+		&m.HTTPProxyConfig{},
+		&m.HTTPSProxyConfig{},
+		&m.STCPProxyConfig{},
+		&m.TCPMuxProxyConfig{},
+	}
+	for _, cfg := range pxyConfs {
+		RegisterProxyFactory(reflect.TypeOf(cfg), NewGeneralTCPProxy)
+	}
+}
+
+// GeneralTCPProxy is a general implementation of Proxy interface for TCP protocol.
+// If the default GeneralTCPProxy cannot meet the requirements, you can customize
+// the implementation of the Proxy interface.
+type GeneralTCPProxy struct {
+	*BaseProxy
+}
+
+func NewGeneralTCPProxy(baseProxy *BaseProxy, _ m.ProxyConfigurer) Proxy {
+	return &GeneralTCPProxy{
+		BaseProxy: baseProxy,
+	}
+}
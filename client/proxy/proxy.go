@@ -0,0 +1,147 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+	"time"
+
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+	"github.com/gk7790/gk-zap/pkg/msg"
+	pkgNet "github.com/gk7790/gk-zap/pkg/net"
+	plugin "github.com/gk7790/gk-zap/pkg/plugin/client"
+	"github.com/gk7790/gk-zap/pkg/utils/xlog"
+)
+
+var proxyFactoryRegistry = map[reflect.Type]func(*BaseProxy, m.ProxyConfigurer) Proxy{}
+
+func RegisterProxyFactory(proxyConfType reflect.Type, factory func(*BaseProxy, m.ProxyConfigurer) Proxy) {
+	proxyFactoryRegistry[proxyConfType] = factory
+}
+
+// Proxy defines how to handle work connections for different proxy type.
+type Proxy interface {
+	Run() error
+	// InWorkConn accept work connections registered to server.
+	InWorkConn(net.Conn, *msg.StartWorkConn)
+	Close()
+}
+
+// NewProxy returns nil if the proxy type is not supported by the client.
+func NewProxy(
+	ctx context.Context,
+	pxyConf m.ProxyConfigurer,
+	clientCfg *m.ClientCommonConfig,
+	encKey []byte,
+) (pxy Proxy) {
+	baseProxy := BaseProxy{
+		baseCfg:   pxyConf.GetBaseConfig(),
+		clientCfg: clientCfg,
+		encKey:    encKey,
+		xl:        xlog.FromContextSafe(ctx),
+		ctx:       ctx,
+	}
+
+	factory := proxyFactoryRegistry[reflect.TypeOf(pxyConf)]
+	if factory == nil {
+		return nil
+	}
+	return factory(&baseProxy, pxyConf)
+}
+
+type BaseProxy struct {
+	baseCfg   *m.ProxyBaseConfig
+	clientCfg *m.ClientCommonConfig
+	// encKey is the key of the session the proxy belongs to
+	encKey      []byte
+	proxyPlugin plugin.Plugin
+
+	xl  *xlog.Logger
+	ctx context.Context
+}
+
+func (pxy *BaseProxy) Run() error {
+	if pxy.baseCfg.Plugin.Type != "" {
+		p, err := plugin.Create(pxy.baseCfg.Plugin.Type, pxy.baseCfg.Plugin.ClientPluginOptions)
+		if err != nil {
+			return err
+		}
+		pxy.proxyPlugin = p
+	}
+	return nil
+}
+
+func (pxy *BaseProxy) Close() {
+	if pxy.proxyPlugin != nil {
+		pxy.proxyPlugin.Close()
+	}
+}
+
+func (pxy *BaseProxy) InWorkConn(conn net.Conn, m *msg.StartWorkConn) {
+	pxy.HandleTCPWorkConnection(conn, m, pxy.encKey)
+}
+
+// HandleTCPWorkConnection is the common handler for tcp work connections.
+// The connection is handed to the plugin if one is configured, otherwise it
+// is joined with a new connection to LocalIP:LocalPort.
+func (pxy *BaseProxy) HandleTCPWorkConnection(workConn net.Conn, m *msg.StartWorkConn, encKey []byte) {
+	xl := pxy.xl
+	baseCfg := pxy.baseCfg
+	var (
+		remote io.ReadWriteCloser
+		err    error
+	)
+	remote = workConn
+
+	xl.Debugf("handle tcp work connection, useEncryption: %t, useCompression: %t",
+		baseCfg.Transport.UseEncryption, baseCfg.Transport.UseCompression)
+	if baseCfg.Transport.UseEncryption {
+		remote, err = pkgNet.WithEncryption(remote, encKey)
+		if err != nil {
+			workConn.Close()
+			xl.Errorf("create encryption stream error: %v", err)
+			return
+		}
+	}
+	if baseCfg.Transport.UseCompression {
+		remote = pkgNet.WithCompression(remote)
+	}
+
+	connInfo := &plugin.ConnectionInfo{
+		Conn:           remote,
+		UnderlyingConn: workConn,
+	}
+	if m.SrcAddr != "" && m.SrcPort != 0 {
+		connInfo.SrcAddr = &net.TCPAddr{IP: net.ParseIP(m.SrcAddr), Port: int(m.SrcPort)}
+	}
+	if m.DstAddr != "" && m.DstPort != 0 {
+		connInfo.DstAddr = &net.TCPAddr{IP: net.ParseIP(m.DstAddr), Port: int(m.DstPort)}
+	}
+
+	if pxy.proxyPlugin != nil {
+		// if plugin is set, let plugin handle connection first
+		xl.Debugf("handle by plugin: %s", pxy.proxyPlugin.Name())
+		pxy.proxyPlugin.Handle(pxy.ctx, connInfo)
+		xl.Debugf("handle by plugin finished")
+		return
+	}
+
+	localConn, err := net.DialTimeout("tcp",
+		net.JoinHostPort(baseCfg.LocalIP, strconv.Itoa(baseCfg.LocalPort)), 10*time.Second)
+	if err != nil {
+		workConn.Close()
+		xl.Errorf("connect to local service [%s:%d] error: %v", baseCfg.LocalIP, baseCfg.LocalPort, err)
+		return
+	}
+
+	xl.Debugf("join connections, localConn(l[%s] r[%s]) workConn(l[%s] r[%s])", localConn.LocalAddr().String(),
+		localConn.RemoteAddr().String(), workConn.LocalAddr().String(), workConn.RemoteAddr().String())
+
+	_, _, errs := pkgNet.Join(localConn, remote)
+	xl.Debugf("join connections closed")
+	if len(errs) > 0 {
+		xl.Debugf("join connections errors: %v", errs)
+	}
+}
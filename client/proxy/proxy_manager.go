@@ -0,0 +1,157 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"sync"
+
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+	"github.com/gk7790/gk-zap/pkg/msg"
+	"github.com/gk7790/gk-zap/pkg/utils/xlog"
+	"github.com/samber/lo"
+)
+
+type Manager struct {
+	proxies map[string]*Wrapper
+	sendMsg func(msg.Message) error
+
+	closed bool
+	mu     sync.RWMutex
+
+	clientCfg *m.ClientCommonConfig
+	encKey    []byte
+
+	ctx context.Context
+}
+
+func NewManager(
+	ctx context.Context,
+	clientCfg *m.ClientCommonConfig,
+	encKey []byte,
+	sendMsg func(msg.Message) error,
+) *Manager {
+	return &Manager{
+		proxies:   make(map[string]*Wrapper),
+		sendMsg:   sendMsg,
+		closed:    false,
+		clientCfg: clientCfg,
+		encKey:    encKey,
+		ctx:       ctx,
+	}
+}
+
+// StartProxy handles the NewProxyResp of proxy name.
+func (pm *Manager) StartProxy(name string, remoteAddr string, serverRespErr string) error {
+	pm.mu.RLock()
+	pxy, ok := pm.proxies[name]
+	pm.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("proxy [%s] not found", name)
+	}
+
+	err := pxy.SetRunningStatus(remoteAddr, serverRespErr)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (pm *Manager) Close() {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	for _, pxy := range pm.proxies {
+		pxy.Stop()
+	}
+	pm.proxies = make(map[string]*Wrapper)
+	pm.closed = true
+}
+
+func (pm *Manager) HandleWorkConn(name string, workConn net.Conn, m *msg.StartWorkConn) {
+	pm.mu.RLock()
+	pw, ok := pm.proxies[name]
+	pm.mu.RUnlock()
+	if ok {
+		pw.InWorkConn(workConn, m)
+	} else {
+		workConn.Close()
+	}
+}
+
+func (pm *Manager) HandleEvent(payload any) error {
+	var m msg.Message
+	switch e := payload.(type) {
+	case *StartProxyPayload:
+		m = e.NewProxyMsg
+	case *CloseProxyPayload:
+		m = e.CloseProxyMsg
+	default:
+		return fmt.Errorf("unknown event payload %T", payload)
+	}
+
+	return pm.sendMsg(m)
+}
+
+func (pm *Manager) GetAllProxyStatus() []*WorkingStatus {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	ps := make([]*WorkingStatus, 0, len(pm.proxies))
+	for _, pxy := range pm.proxies {
+		ps = append(ps, pxy.GetStatus())
+	}
+	return ps
+}
+
+func (pm *Manager) GetProxyStatus(name string) (*WorkingStatus, bool) {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	if pw, ok := pm.proxies[name]; ok {
+		return pw.GetStatus(), true
+	}
+	return nil, false
+}
+
+// UpdateAll replaces the running proxies with proxyCfgs. Proxies whose config
+// did not change keep running.
+func (pm *Manager) UpdateAll(proxyCfgs []m.ProxyConfigurer) {
+	xl := xlog.FromContextSafe(pm.ctx)
+	proxyCfgsMap := lo.KeyBy(proxyCfgs, func(c m.ProxyConfigurer) string {
+		return c.GetBaseConfig().Name
+	})
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	delPxyNames := make([]string, 0)
+	for name, pxy := range pm.proxies {
+		del := false
+		cfg, ok := proxyCfgsMap[name]
+		if !ok || !reflect.DeepEqual(pxy.Cfg, cfg) {
+			del = true
+		}
+
+		if del {
+			delPxyNames = append(delPxyNames, name)
+			delete(pm.proxies, name)
+			pxy.Stop()
+		}
+	}
+	if len(delPxyNames) > 0 {
+		xl.Infof("proxy removed: %s", delPxyNames)
+	}
+
+	addPxyNames := make([]string, 0)
+	for _, cfg := range proxyCfgs {
+		name := cfg.GetBaseConfig().Name
+		if _, ok := pm.proxies[name]; !ok {
+			pxy := NewWrapper(pm.ctx, cfg, pm.clientCfg, pm.encKey, pm.HandleEvent)
+			pm.proxies[name] = pxy
+			addPxyNames = append(addPxyNames, name)
+
+			pxy.Start()
+		}
+	}
+	if len(addPxyNames) > 0 {
+		xl.Infof("proxy added: %s", addPxyNames)
+	}
+}
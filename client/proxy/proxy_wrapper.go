@@ -0,0 +1,217 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+	"github.com/gk7790/gk-zap/pkg/msg"
+	"github.com/gk7790/gk-zap/pkg/utils/xlog"
+)
+
+const (
+	ProxyPhaseNew       = "new"
+	ProxyPhaseWaitStart = "wait start"
+	ProxyPhaseStartErr  = "start error"
+	ProxyPhaseRunning   = "running"
+	ProxyPhaseClosed    = "closed"
+)
+
+var (
+	proxyStartTimeout = 10 * time.Second
+	startErrTimeout   = 30 * time.Second
+)
+
+// EventHandler is called by a proxy wrapper to send messages to the server.
+type EventHandler func(payload any) error
+
+type StartProxyPayload struct {
+	NewProxyMsg *msg.NewProxy
+}
+
+type CloseProxyPayload struct {
+	CloseProxyMsg *msg.CloseProxy
+}
+
+type WorkingStatus struct {
+	Name  string            `json:"name"`
+	Type  string            `json:"type"`
+	Phase string            `json:"status"`
+	Err   string            `json:"err"`
+	Cfg   m.ProxyConfigurer `json:"cfg"`
+
+	// Got from server.
+	RemoteAddr string `json:"remote_addr"`
+}
+
+// Wrapper keeps a proxy registered on the server and tracks its state.
+type Wrapper struct {
+	WorkingStatus
+
+	// underlying proxy
+	pxy Proxy
+
+	// event handler
+	handler EventHandler
+
+	closeCh   chan struct{}
+	closeOnce sync.Once
+	mu        sync.RWMutex
+
+	lastSendStartMsg time.Time
+	lastStartErr     time.Time
+
+	xl  *xlog.Logger
+	ctx context.Context
+}
+
+func NewWrapper(
+	ctx context.Context,
+	cfg m.ProxyConfigurer,
+	clientCfg *m.ClientCommonConfig,
+	encKey []byte,
+	eventHandler EventHandler,
+) *Wrapper {
+	baseInfo := cfg.GetBaseConfig()
+	xl := xlog.FromContextSafe(ctx).Spawn().AppendPrefix(baseInfo.Name)
+	pw := &Wrapper{
+		WorkingStatus: WorkingStatus{
+			Name:  baseInfo.Name,
+			Type:  baseInfo.Type,
+			Phase: ProxyPhaseNew,
+			Cfg:   cfg,
+		},
+		closeCh: make(chan struct{}),
+		handler: eventHandler,
+		xl:      xl,
+		ctx:     xlog.NewContext(ctx, xl),
+	}
+
+	pw.pxy = NewProxy(pw.ctx, cfg, clientCfg, encKey)
+	if pw.pxy == nil {
+		pw.Phase = ProxyPhaseStartErr
+		pw.Err = fmt.Sprintf("proxy type [%s] is not supported by the client", baseInfo.Type)
+	}
+	return pw
+}
+
+// SetRunningStatus is called when the server responds to NewProxy.
+func (pw *Wrapper) SetRunningStatus(remoteAddr string, respErr string) error {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	if pw.Phase != ProxyPhaseWaitStart {
+		return fmt.Errorf("status not wait start, ignore start message")
+	}
+
+	pw.RemoteAddr = remoteAddr
+	if respErr != "" {
+		pw.Phase = ProxyPhaseStartErr
+		pw.Err = respErr
+		pw.lastStartErr = time.Now()
+		return fmt.Errorf("%s", pw.Err)
+	}
+
+	if err := pw.pxy.Run(); err != nil {
+		pw.close()
+		pw.Phase = ProxyPhaseStartErr
+		pw.Err = err.Error()
+		pw.lastStartErr = time.Now()
+		return err
+	}
+
+	pw.Phase = ProxyPhaseRunning
+	pw.Err = ""
+	return nil
+}
+
+func (pw *Wrapper) Start() {
+	if pw.pxy == nil {
+		return
+	}
+	go pw.checkWorker()
+}
+
+func (pw *Wrapper) Stop() {
+	pw.closeOnce.Do(func() {
+		close(pw.closeCh)
+	})
+
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	// A proxy which failed to start is either not registered on the server
+	// or was already closed when Run failed.
+	if pw.pxy != nil && pw.Phase != ProxyPhaseStartErr && pw.Phase != ProxyPhaseClosed {
+		pw.close()
+	}
+	pw.Phase = ProxyPhaseClosed
+}
+
+// close tells the server to close this proxy and releases local resources.
+func (pw *Wrapper) close() {
+	_ = pw.handler(&CloseProxyPayload{
+		CloseProxyMsg: &msg.CloseProxy{
+			ProxyName: pw.Name,
+		},
+	})
+	pw.pxy.Close()
+}
+
+func (pw *Wrapper) checkWorker() {
+	xl := pw.xl
+	for {
+		now := time.Now()
+		pw.mu.Lock()
+		if pw.Phase == ProxyPhaseNew ||
+			(pw.Phase == ProxyPhaseWaitStart && now.After(pw.lastSendStartMsg.Add(proxyStartTimeout))) ||
+			(pw.Phase == ProxyPhaseStartErr && now.After(pw.lastStartErr.Add(startErrTimeout))) {
+
+			xl.Debugf("change status from [%s] to [%s]", pw.Phase, ProxyPhaseWaitStart)
+			pw.Phase = ProxyPhaseWaitStart
+
+			var newProxyMsg msg.NewProxy
+			pw.Cfg.MarshalToMsg(&newProxyMsg)
+			pw.lastSendStartMsg = now
+			_ = pw.handler(&StartProxyPayload{
+				NewProxyMsg: &newProxyMsg,
+			})
+		}
+		pw.mu.Unlock()
+
+		select {
+		case <-pw.closeCh:
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (pw *Wrapper) InWorkConn(workConn net.Conn, m *msg.StartWorkConn) {
+	xl := pw.xl
+	pw.mu.RLock()
+	pxy := pw.pxy
+	running := pw.Phase == ProxyPhaseRunning
+	pw.mu.RUnlock()
+	if pxy != nil && running {
+		xl.Debugf("start a new work connection, localAddr: %s remoteAddr: %s", workConn.LocalAddr().String(), workConn.RemoteAddr().String())
+		go pxy.InWorkConn(workConn, m)
+	} else {
+		workConn.Close()
+	}
+}
+
+func (pw *Wrapper) GetStatus() *WorkingStatus {
+	pw.mu.RLock()
+	defer pw.mu.RUnlock()
+	ps := &WorkingStatus{
+		Name:       pw.Name,
+		Type:       pw.Type,
+		Phase:      pw.Phase,
+		Err:        pw.Err,
+		Cfg:        pw.Cfg,
+		RemoteAddr: pw.RemoteAddr,
+	}
+	return ps
+}
@@ -2,7 +2,10 @@ package client
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net"
+	"os"
 	"runtime"
 	"sync"
 	"time"
@@ -11,6 +14,10 @@ import (
 	m "github.com/gk7790/gk-zap/pkg/config/model"
 	"github.com/gk7790/gk-zap/pkg/msg"
 	"github.com/gk7790/gk-zap/pkg/utils/version"
+	"github.com/gk7790/gk-zap/pkg/utils/wait"
+	"github.com/gk7790/gk-zap/pkg/utils/web"
+	"github.com/gk7790/gk-zap/pkg/utils/xlog"
+	"github.com/samber/lo"
 )
 
 type cancelErr struct {
@@ -22,39 +29,35 @@ func (e cancelErr) Error() string {
 }
 
 type ServiceOptions struct {
-	Common           *m.ClientCommonConfig
-	ConfigFilePath   string
-	ClientSpec       *msg.ClientSpec
-	ConnectorCreator func(context.Context, *m.ClientCommonConfig) Connector
-}
+	Common      *m.ClientCommonConfig
+	ProxyCfgs   []m.ProxyConfigurer
+	VisitorCfgs []m.VisitorConfigurer
 
-type SessionContext struct {
-	Common *m.ClientCommonConfig
-}
+	// ConfigFilePath is the path to the configuration file used to initialize.
+	// If it is empty, it means that the configuration file is not used for initialization.
+	// It may be initialized using command line parameters or called directly.
+	ConfigFilePath string
+	// StrictConfig is whether the config file was loaded in strict mode, the
+	// admin api uses it when the request doesn't specify one.
+	StrictConfig bool
 
-type Control struct {
-	ctx context.Context
-	// session context
-	sessionCtx *SessionContext
+	// ClientSpec is the client specification that control the client behavior.
+	ClientSpec *msg.ClientSpec
 
-	doneCh chan struct{}
-}
-
-func NewControl(ctx context.Context, sessionCtx *SessionContext) (*Control, error) {
-	ctl := &Control{
-		ctx:        ctx,
-		sessionCtx: sessionCtx,
-		doneCh:     make(chan struct{}),
-	}
-
-	return ctl, nil
+	// ConnectorCreator is a function that creates a new connector to make connections to the server.
+	// The Connector shields the underlying connection details, whether it is through TCP or QUIC connection,
+	// and regardless of whether multiplexing is used.
+	//
+	// If it is not set, the default connector will be used.
+	ConnectorCreator func(context.Context, *m.ClientCommonConfig) Connector
 }
 
 func setServiceOptionsDefault(options *ServiceOptions) error {
-	if options.Common != nil {
-		if err := options.Common.Complete(); err != nil {
-			return err
-		}
+	if options.Common == nil {
+		options.Common = &m.ClientCommonConfig{}
+	}
+	if err := options.Common.Complete(); err != nil {
+		return err
 	}
 	if options.ConnectorCreator == nil {
 		options.ConnectorCreator = NewConnector
@@ -62,6 +65,7 @@ func setServiceOptionsDefault(options *ServiceOptions) error {
 	return nil
 }
 
+// Service is the client service that connects to the server and provides NAT traversal services.
 type Service struct {
 	// Uniq id got from frps, it will be attached to loginMsg.
 	runID string
@@ -75,65 +79,286 @@ type Service struct {
 	ctl              *Control
 	cfgMu            sync.RWMutex
 	common           *m.ClientCommonConfig
+	proxyCfgs        []m.ProxyConfigurer
+	visitorCfgs      []m.VisitorConfigurer
 	clientSpec       *msg.ClientSpec
 	connectorCreator func(context.Context, *m.ClientCommonConfig) Connector
 
+	// The configuration file used to initialize this client, or an empty
+	// string if no configuration file was used.
+	configFilePath string
+	strictConfig   bool
+
+	// admin web server, nil if WebServer.Port is not set
+	webServer *web.Server
+
 	cancel context.CancelCauseFunc
 }
 
 func NewService(options ServiceOptions) (*Service, error) {
-	ccc := &m.ClientCommonConfig{
-		ServerAddr: "127.0.0.1",
-		ServerPort: 7000,
+	if err := setServiceOptionsDefault(&options); err != nil {
+		return nil, err
+	}
+
+	authSetter, err := auth.NewAuthSetter(options.Common.Auth)
+	if err != nil {
+		return nil, err
 	}
 
 	s := &Service{
-		ctx:    context.Background(),
-		common: ccc,
+		ctx:              context.Background(),
+		authSetter:       authSetter,
+		common:           options.Common,
+		proxyCfgs:        options.ProxyCfgs,
+		visitorCfgs:      options.VisitorCfgs,
+		clientSpec:       options.ClientSpec,
+		connectorCreator: options.ConnectorCreator,
+		configFilePath:   options.ConfigFilePath,
+		strictConfig:     options.StrictConfig,
 	}
 
+	if options.Common.WebServer.Port > 0 {
+		ws, err := web.NewServer(options.Common.WebServer)
+		if err != nil {
+			return nil, fmt.Errorf("create admin web server error: %v", err)
+		}
+		s.webServer = ws
+		s.registerRouteHandlers(ws)
+	}
 	return s, nil
 }
 
 func (svr *Service) Run(ctx context.Context) error {
 	ctx, cancel := context.WithCancelCause(ctx)
+	svr.ctx = xlog.NewContext(ctx, xlog.FromContextSafe(ctx))
 	svr.cancel = cancel
-	//connector := svr.connectorCreator(svr.ctx, svr.common)
-	//conn, err := connector.Connect()
-	//if err != nil {
-	//	return nil
-	//}
-
-	// 1️⃣ 连接服务器
-	conn, err := net.Dial("tcp", "127.0.0.1:7000")
+
+	if r, ok := svr.authSetter.(auth.Refresher); ok {
+		go r.RunRefresh(svr.ctx)
+	}
+
+	if svr.webServer != nil {
+		xl := xlog.FromContextSafe(svr.ctx)
+		go func() {
+			xl.Infof("admin server listen on %s, tls [%v]", svr.webServer.Address(), svr.webServer.TLS())
+			if err := svr.webServer.Run(); err != nil {
+				xl.Warnf("admin server exit with error: %v", err)
+			}
+		}()
+	}
+
+	// first login to the server
+	svr.loopLoginUntilSuccess(10*time.Second, lo.FromPtr(svr.common.LoginFailExit))
+	if svr.ctl == nil {
+		cancelCause := cancelErr{}
+		if !errors.As(context.Cause(svr.ctx), &cancelCause) {
+			// the service is closed before the first login succeeds
+			svr.stop()
+			return nil
+		}
+		svr.stop()
+		return fmt.Errorf("login to the server failed: %v. With loginFailExit enabled, no additional retries will be attempted", cancelCause.Err)
+	}
+
+	go svr.keepControllerWorking()
+
+	<-svr.ctx.Done()
+	svr.stop()
+	return nil
+}
+
+func (svr *Service) keepControllerWorking() {
+	<-svr.ctl.Done()
+
+	// There is a situation where the login is successful but due to certain reasons,
+	// the control immediately exits. It is necessary to limit the frequency of reconnection in this case.
+	// The interval for the first three retries in 1 minute will be very short, and then it will increase exponentially.
+	// The maximum interval is 20 seconds.
+	wait.BackoffUntil(func() (bool, error) {
+		// loopLoginUntilSuccess is another layer of loop that will continuously attempt to
+		// login to the server until successful.
+		svr.loopLoginUntilSuccess(20*time.Second, false)
+		if svr.ctl != nil {
+			<-svr.ctl.Done()
+			return false, errors.New("control is closed and try another loop")
+		}
+		// If the control is nil, it means that the login failed and the service is also closed.
+		return false, nil
+	}, wait.NewFastBackoffManager(
+		wait.FastBackoffOptions{
+			Duration:        time.Second,
+			Factor:          2,
+			Jitter:          0.1,
+			MaxDuration:     20 * time.Second,
+			FastRetryCount:  3,
+			FastRetryDelay:  200 * time.Millisecond,
+			FastRetryWindow: time.Minute,
+			FastRetryJitter: 0.5,
+		},
+	), true, svr.ctx.Done())
+}
+
+// login creates a connection to the server and registers it as a control connection.
+// If login succeeds, returns the connection and the connector.
+// Otherwise, returns an error.
+func (svr *Service) login() (conn net.Conn, connector Connector, sessionKey []byte, err error) {
+	xl := xlog.FromContextSafe(svr.ctx)
+	connector = svr.connectorCreator(svr.ctx, svr.common)
+	if err = connector.Open(); err != nil {
+		return nil, nil, nil, err
+	}
+
+	defer func() {
+		if err != nil {
+			connector.Close()
+		}
+	}()
+
+	conn, err = connector.Connect()
 	if err != nil {
-		panic(err)
+		return
 	}
-	defer conn.Close()
 
+	hostname, _ := os.Hostname()
 	loginMsg := &msg.Login{
-		Arch:         runtime.GOARCH,
-		Os:           runtime.GOOS,
-		PoolCount:    1,
-		User:         svr.common.User,
-		Version:      version.Full(),
-		Timestamp:    time.Now().Unix(),
-		RunID:        svr.runID,
-		PrivilegeKey: "94b1c59dae033669a7bdce57cccc6a99",
+		Arch:      runtime.GOARCH,
+		Os:        runtime.GOOS,
+		Hostname:  hostname,
+		PoolCount: svr.common.Transport.PoolCount,
+		User:      svr.common.User,
+		Version:   version.Full(),
+		Timestamp: time.Now().Unix(),
+		RunID:     svr.runID,
+		Metas:     svr.common.Metadatas,
 	}
+	if svr.clientSpec != nil {
+		loginMsg.ClientSpec = *svr.clientSpec
+	}
+
+	// Add auth, the work connections of the session are encrypted with the
+	// token the login is signed with even if it's refreshed later
+	if setter, ok := svr.authSetter.(auth.SessionKeySetter); ok {
+		sessionKey, err = setter.SetLoginWithSessionKey(loginMsg)
+	} else {
+		sessionKey = []byte(svr.common.Auth.Token)
+		err = svr.authSetter.SetLogin(loginMsg)
+	}
+	if err != nil {
+		return
+	}
+
 	if err = msg.WriteMsg(conn, loginMsg); err != nil {
-		return nil
+		return
 	}
 
-	//<-svr.ctx.Done()
-	//svr.stop()
+	var loginRespMsg msg.LoginResp
+	_ = conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	if err = msg.ReadMsgInto(conn, &loginRespMsg); err != nil {
+		return
+	}
+	_ = conn.SetReadDeadline(time.Time{})
+
+	if loginRespMsg.Error != "" {
+		err = fmt.Errorf("%s", loginRespMsg.Error)
+		xl.Errorf("login to server failed: %s", loginRespMsg.Error)
+		return
+	}
+
+	svr.runID = loginRespMsg.RunID
+	xl.AddPrefix(xlog.LogPrefix{Name: "runID", Value: svr.runID})
+
+	xl.Infof("login to server success, get run id [%s]", loginRespMsg.RunID)
+	return
+}
+
+func (svr *Service) loopLoginUntilSuccess(maxInterval time.Duration, firstLoginExit bool) {
+	xl := xlog.FromContextSafe(svr.ctx)
+
+	loginFunc := func() (bool, error) {
+		xl.Infof("try to connect to server...")
+		conn, connector, sessionKey, err := svr.login()
+		if err != nil {
+			xl.Warnf("connect to server error: %v", err)
+			if firstLoginExit {
+				svr.cancel(cancelErr{Err: err})
+			}
+			return false, err
+		}
+
+		svr.cfgMu.RLock()
+		proxyCfgs := svr.proxyCfgs
+		visitorCfgs := svr.visitorCfgs
+		svr.cfgMu.RUnlock()
+
+		sessionCtx := &SessionContext{
+			Common:     svr.common,
+			RunID:      svr.runID,
+			Conn:       conn,
+			AuthSetter: svr.authSetter,
+			SessionKey: sessionKey,
+			Connector:  connector,
+		}
+		ctl, err := NewControl(svr.ctx, sessionCtx)
+		if err != nil {
+			conn.Close()
+			xl.Errorf("new control error: %v", err)
+			return false, err
+		}
+
+		ctl.Run(proxyCfgs, visitorCfgs)
+		// close and replace previous control
+		svr.ctlMu.Lock()
+		if svr.ctl != nil {
+			svr.ctl.Close()
+		}
+		svr.ctl = ctl
+		svr.ctlMu.Unlock()
+		return true, nil
+	}
+
+	// try to reconnect to server until success
+	wait.BackoffUntil(loginFunc, wait.NewFastBackoffManager(
+		wait.FastBackoffOptions{
+			Duration:    time.Second,
+			Factor:      2,
+			Jitter:      0.1,
+			MaxDuration: maxInterval,
+		}), true, svr.ctx.Done())
+}
+
+// UpdateAllConfigurer replaces all proxies and visitors, unchanged ones keep
+// running.
+func (svr *Service) UpdateAllConfigurer(proxyCfgs []m.ProxyConfigurer, visitorCfgs []m.VisitorConfigurer) error {
+	svr.cfgMu.Lock()
+	svr.proxyCfgs = proxyCfgs
+	svr.visitorCfgs = visitorCfgs
+	svr.cfgMu.Unlock()
+
+	svr.ctlMu.RLock()
+	ctl := svr.ctl
+	svr.ctlMu.RUnlock()
+
+	if ctl != nil {
+		return ctl.UpdateAllConfigurer(proxyCfgs, visitorCfgs)
+	}
 	return nil
 }
 
+// Close stops the service and closes the connection to the server.
+func (svr *Service) Close() {
+	if svr.cancel != nil {
+		svr.cancel(nil)
+	}
+}
+
 func (svr *Service) stop() {
 	svr.ctlMu.Lock()
 	defer svr.ctlMu.Unlock()
 	if svr.ctl != nil {
+		_ = svr.ctl.Close()
 		svr.ctl = nil
 	}
+	if svr.webServer != nil {
+		_ = svr.webServer.Close()
+	}
 }
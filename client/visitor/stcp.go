@@ -0,0 +1,135 @@
+package visitor
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+	"github.com/gk7790/gk-zap/pkg/msg"
+	pkgNet "github.com/gk7790/gk-zap/pkg/net"
+	"github.com/gk7790/gk-zap/pkg/utils/util"
+	"github.com/gk7790/gk-zap/pkg/utils/xlog"
+)
+
+type STCPVisitor struct {
+	*BaseVisitor
+
+	cfg *m.STCPVisitorConfig
+}
+
+func (sv *STCPVisitor) Run() (err error) {
+	// A negative BindPort means the visitor only receives connections
+	// transferred from other visitors.
+	if sv.cfg.BindPort > 0 {
+		sv.l, err = net.Listen("tcp", net.JoinHostPort(sv.cfg.BindAddr, strconv.Itoa(sv.cfg.BindPort)))
+		if err != nil {
+			return
+		}
+		go sv.worker()
+	}
+
+	go sv.internalConnWorker()
+	return
+}
+
+func (sv *STCPVisitor) worker() {
+	xl := xlog.FromContextSafe(sv.ctx)
+	for {
+		conn, err := sv.l.Accept()
+		if err != nil {
+			xl.Warnf("stcp local listener closed")
+			return
+		}
+		go sv.handleConn(conn, true)
+	}
+}
+
+func (sv *STCPVisitor) internalConnWorker() {
+	xl := xlog.FromContextSafe(sv.ctx)
+	for {
+		conn, err := sv.internalLn.Accept()
+		if err != nil {
+			xl.Warnf("stcp internal listener closed")
+			return
+		}
+		// connections transferred from other visitors are not redirected
+		// again, so visitors falling back to each other can't loop
+		go sv.handleConn(conn, false)
+	}
+}
+
+func (sv *STCPVisitor) handleConn(userConn net.Conn, canFallback bool) {
+	xl := xlog.FromContextSafe(sv.ctx)
+	xl.Debugf("get a new stcp user connection")
+
+	remote, err := sv.openTunnel()
+	if err != nil {
+		// nothing is read from the user connection before the tunnel is
+		// open, so the fallback visitor gets it untouched
+		if canFallback && sv.cfg.FallbackTo != "" {
+			xl.Infof("stcp visitor connection error: %v, redirect it to visitor [%s]", err, sv.cfg.FallbackTo)
+			if err = sv.helper.TransferConn(sv.cfg.FallbackTo, userConn); err == nil {
+				return
+			}
+		}
+		xl.Warnf("stcp visitor connection error: %v", err)
+		userConn.Close()
+		return
+	}
+	pkgNet.Join(userConn, remote)
+}
+
+// openTunnel connects to the server and asks it to join the connection with
+// the proxy named ServerName.
+func (sv *STCPVisitor) openTunnel() (io.ReadWriteCloser, error) {
+	visitorConn, err := sv.helper.ConnectServer()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	newVisitorConnMsg := &msg.NewVisitorConn{
+		RunID:          sv.helper.RunID(),
+		ProxyName:      sv.cfg.ServerName,
+		SignKey:        util.GetAuthKey(sv.cfg.SecretKey, now),
+		Timestamp:      now,
+		UseEncryption:  sv.cfg.Transport.UseEncryption,
+		UseCompression: sv.cfg.Transport.UseCompression,
+	}
+	err = msg.WriteMsg(visitorConn, newVisitorConnMsg)
+	if err != nil {
+		visitorConn.Close()
+		return nil, fmt.Errorf("send newVisitorConnMsg to server error: %v", err)
+	}
+
+	var newVisitorConnRespMsg msg.NewVisitorConnResp
+	_ = visitorConn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	err = msg.ReadMsgInto(visitorConn, &newVisitorConnRespMsg)
+	if err != nil {
+		visitorConn.Close()
+		return nil, fmt.Errorf("get newVisitorConnRespMsg error: %v", err)
+	}
+	_ = visitorConn.SetReadDeadline(time.Time{})
+
+	if newVisitorConnRespMsg.Error != "" {
+		visitorConn.Close()
+		return nil, fmt.Errorf("start new visitor connection error: %s", newVisitorConnRespMsg.Error)
+	}
+
+	var remote io.ReadWriteCloser
+	remote = visitorConn
+	if sv.cfg.Transport.UseEncryption {
+		remote, err = pkgNet.WithEncryption(remote, []byte(sv.cfg.SecretKey))
+		if err != nil {
+			visitorConn.Close()
+			return nil, fmt.Errorf("create encryption stream error: %v", err)
+		}
+	}
+	if sv.cfg.Transport.UseCompression {
+		remote = pkgNet.WithCompression(remote)
+	}
+	return remote, nil
+}
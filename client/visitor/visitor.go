@@ -0,0 +1,79 @@
+package visitor
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+	pkgNet "github.com/gk7790/gk-zap/pkg/net"
+	"github.com/gk7790/gk-zap/pkg/utils/xlog"
+)
+
+// Helper wrapper some functions for visitor to use.
+type Helper interface {
+	// ConnectServer directly connects to the server.
+	ConnectServer() (net.Conn, error)
+	// TransferConn transfers the connection to another visitor.
+	TransferConn(string, net.Conn) error
+	// RunID returns the run id of current controller.
+	RunID() string
+}
+
+// Visitor is used for forward traffics from local port tot remote service.
+type Visitor interface {
+	Run() error
+	AcceptConn(conn net.Conn) error
+	Close()
+}
+
+func NewVisitor(
+	ctx context.Context,
+	cfg m.VisitorConfigurer,
+	clientCfg *m.ClientCommonConfig,
+	helper Helper,
+) (Visitor, error) {
+	xl := xlog.FromContextSafe(ctx).Spawn().AppendPrefix(cfg.GetBaseConfig().Name)
+	ctx = xlog.NewContext(ctx, xl)
+	baseVisitor := BaseVisitor{
+		clientCfg:  clientCfg,
+		helper:     helper,
+		ctx:        ctx,
+		internalLn: pkgNet.NewInternalListener(),
+	}
+	switch cfg := cfg.(type) {
+	case *m.STCPVisitorConfig:
+		return &STCPVisitor{
+			BaseVisitor: &baseVisitor,
+			cfg:         cfg,
+		}, nil
+	default:
+		return nil, fmt.Errorf("visitor type [%s] is not supported", cfg.GetBaseConfig().Type)
+	}
+}
+
+type BaseVisitor struct {
+	clientCfg *m.ClientCommonConfig
+	helper    Helper
+	// l listens on BindAddr:BindPort, it is nil if BindPort is not positive.
+	l net.Listener
+	// internalLn receives connections transferred from other visitors.
+	internalLn *pkgNet.InternalListener
+
+	mu  sync.RWMutex
+	ctx context.Context
+}
+
+func (v *BaseVisitor) AcceptConn(conn net.Conn) error {
+	return v.internalLn.PutConn(conn)
+}
+
+func (v *BaseVisitor) Close() {
+	if v.l != nil {
+		v.l.Close()
+	}
+	if v.internalLn != nil {
+		v.internalLn.Close()
+	}
+}
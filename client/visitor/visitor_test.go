@@ -0,0 +1,182 @@
+package visitor
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+	"github.com/gk7790/gk-zap/pkg/msg"
+	"github.com/gk7790/gk-zap/pkg/utils/log"
+)
+
+func TestMain(tm *testing.M) {
+	log.Init(false, "", log.LevelError)
+	os.Exit(tm.Run())
+}
+
+// echoServer plays gks for one visitor connection: it answers the
+// NewVisitorConn message and echoes the data of the user connection. The
+// proxies in offline are refused.
+func echoServer(t *testing.T, conn net.Conn, proxyNameCh chan<- string, offline ...string) {
+	defer conn.Close()
+	var in msg.NewVisitorConn
+	if err := msg.ReadMsgInto(conn, &in); err != nil {
+		t.Errorf("read NewVisitorConn error: %v", err)
+		return
+	}
+	proxyNameCh <- in.ProxyName
+	if slices.Contains(offline, in.ProxyName) {
+		_ = msg.WriteMsg(conn, &msg.NewVisitorConnResp{ProxyName: in.ProxyName, Error: "proxy not found"})
+		return
+	}
+	if err := msg.WriteMsg(conn, &msg.NewVisitorConnResp{ProxyName: in.ProxyName}); err != nil {
+		t.Errorf("write NewVisitorConnResp error: %v", err)
+		return
+	}
+	_, _ = io.Copy(conn, conn)
+}
+
+func TestTransferConnToInternalVisitor(t *testing.T) {
+	proxyNameCh := make(chan string, 1)
+	connectServer := func() (net.Conn, error) {
+		visitorConn, serverConn := net.Pipe()
+		go echoServer(t, serverConn, proxyNameCh)
+		return visitorConn, nil
+	}
+	clientCfg := &m.ClientCommonConfig{}
+	vm := NewManager(context.Background(), "run-id", clientCfg, connectServer)
+	defer vm.Close()
+
+	// a negative bindPort doesn't listen, the visitor only gets the
+	// connections redirected from other visitors
+	cfg := &m.STCPVisitorConfig{VisitorBaseConfig: m.VisitorBaseConfig{
+		Name:       "internal",
+		Type:       "stcp",
+		ServerName: "alice.ssh",
+		SecretKey:  "secret",
+		BindPort:   -1,
+	}}
+	vm.UpdateAll([]m.VisitorConfigurer{cfg})
+	if v, ok := vm.visitors["internal"]; !ok {
+		t.Fatal("expected the visitor to run")
+	} else if v.(*STCPVisitor).l != nil {
+		t.Fatal("expected the visitor not to listen")
+	}
+
+	if err := vm.TransferConn("missing", nil); err == nil {
+		t.Fatal("expected an error for an unknown visitor")
+	}
+
+	userConn, visitorSide := net.Pipe()
+	defer userConn.Close()
+	if err := vm.helper.TransferConn("internal", visitorSide); err != nil {
+		t.Fatalf("transfer conn error: %v", err)
+	}
+
+	select {
+	case name := <-proxyNameCh:
+		if name != "alice.ssh" {
+			t.Fatalf("expected the visitor to connect to alice.ssh, got %s", name)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the visitor didn't handle the redirected connection")
+	}
+
+	_ = userConn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := userConn.Write([]byte("ping")); err != nil {
+		t.Fatalf("write error: %v", err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(userConn, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("expected the echo through the visitor, got %q %v", buf, err)
+	}
+}
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestFallbackToInternalVisitor(t *testing.T) {
+	tests := []struct {
+		name     string
+		offline  []string
+		wantEcho bool
+	}{
+		{name: "fallback", offline: []string{"alice.primary"}, wantEcho: true},
+		// the fallback visitor doesn't redirect the connection back
+		{name: "fallback fails too", offline: []string{"alice.primary", "alice.standby"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxyNameCh := make(chan string, 10)
+			connectServer := func() (net.Conn, error) {
+				visitorConn, serverConn := net.Pipe()
+				go echoServer(t, serverConn, proxyNameCh, tt.offline...)
+				return visitorConn, nil
+			}
+			clientCfg := &m.ClientCommonConfig{User: "alice"}
+			vm := NewManager(context.Background(), "run-id", clientCfg, connectServer)
+			defer vm.Close()
+
+			primary := &m.STCPVisitorConfig{
+				VisitorBaseConfig: m.VisitorBaseConfig{Name: "primary", Type: "stcp", ServerName: "primary", BindPort: freePort(t)},
+				FallbackTo:        "standby",
+			}
+			standby := &m.STCPVisitorConfig{
+				VisitorBaseConfig: m.VisitorBaseConfig{Name: "standby", Type: "stcp", ServerName: "standby", BindPort: -1},
+				FallbackTo:        "primary",
+			}
+			primary.Complete(clientCfg)
+			standby.Complete(clientCfg)
+			vm.UpdateAll([]m.VisitorConfigurer{primary, standby})
+
+			userConn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(primary.BindPort)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer userConn.Close()
+			_ = userConn.SetDeadline(time.Now().Add(5 * time.Second))
+
+			buf := make([]byte, 4)
+			if tt.wantEcho {
+				if _, err := userConn.Write([]byte("ping")); err != nil {
+					t.Fatalf("write error: %v", err)
+				}
+				if _, err := io.ReadFull(userConn, buf); err != nil || string(buf) != "ping" {
+					t.Fatalf("expected the echo through the fallback visitor, got %q %v", buf, err)
+				}
+			} else if _, err := userConn.Read(buf); err != io.EOF {
+				t.Fatalf("expected the user connection to be closed, got %v", err)
+			}
+
+			// the primary proxy is tried first, then the standby one once
+			for _, want := range []string{"alice.primary", "alice.standby"} {
+				select {
+				case name := <-proxyNameCh:
+					if name != want {
+						t.Fatalf("expected a connection to %s, got %s", want, name)
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatalf("timeout waiting for a connection to %s", want)
+				}
+			}
+			select {
+			case name := <-proxyNameCh:
+				t.Fatalf("unexpected connection to %s", name)
+			case <-time.After(100 * time.Millisecond):
+			}
+		})
+	}
+}
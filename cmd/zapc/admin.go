@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/gk7790/gk-zap/pkg/config"
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+	clientsdk "github.com/gk7790/gk-zap/pkg/sdk/client"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCli.AddCommand(NewAdminCommand(
+		"reload",
+		"Hot-Reload gkc configuration",
+		ReloadHandler,
+	))
+
+	rootCli.AddCommand(NewAdminCommand(
+		"status",
+		"Overview of all proxies status",
+		StatusHandler,
+	))
+
+	rootCli.AddCommand(NewAdminCommand(
+		"stop",
+		"Stop the running gkc",
+		StopHandler,
+	))
+}
+
+func NewAdminCommand(name, short string, handler func(*m.ClientCommonConfig) error) *cobra.Command {
+	return &cobra.Command{
+		Use:   name,
+		Short: short,
+		Run: func(cmd *cobra.Command, args []string) {
+			cfg, _, _, err := config.LoadClientConfig(cfgFile, strictConfigMode)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			if cfg.WebServer.Port <= 0 {
+				fmt.Println("web server port should be set if you want to use this feature")
+				os.Exit(1)
+			}
+
+			if err := handler(cfg); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+}
+
+func newAdminClient(cfg *m.ClientCommonConfig) *clientsdk.Client {
+	host := cfg.WebServer.Addr
+	if host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	c := clientsdk.New(host, cfg.WebServer.Port)
+	c.SetAuth(cfg.WebServer.User, cfg.WebServer.Password)
+	if cfg.WebServer.TLS != nil {
+		c.EnableTLS(nil)
+	}
+	return c
+}
+
+func ReloadHandler(cfg *m.ClientCommonConfig) error {
+	if err := newAdminClient(cfg).Reload(context.Background(), strictConfigMode); err != nil {
+		return err
+	}
+	fmt.Println("reload success")
+	return nil
+}
+
+func StatusHandler(cfg *m.ClientCommonConfig) error {
+	res, err := newAdminClient(cfg).GetAllProxyStatus(context.Background())
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Proxy Status...\n\n")
+	types := make([]string, 0, len(res))
+	for t := range res {
+		types = append(types, t)
+	}
+	slices.Sort(types)
+
+	for _, t := range types {
+		arrs := res[t]
+		if len(arrs) == 0 {
+			continue
+		}
+
+		fmt.Println(strings.ToUpper(t))
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "Name\tStatus\tLocalAddr\tPlugin\tRemoteAddr\tError")
+		for _, ps := range arrs {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", ps.Name, ps.Status, ps.LocalAddr, ps.Plugin, ps.RemoteAddr, ps.Err)
+		}
+		_ = w.Flush()
+		fmt.Println("")
+	}
+	return nil
+}
+
+func StopHandler(cfg *m.ClientCommonConfig) error {
+	if err := newAdminClient(cfg).Stop(context.Background()); err != nil {
+		return err
+	}
+	fmt.Println("stop success")
+	return nil
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+)
+
+// adminRequest is a request received by the fake admin API.
+type adminRequest struct {
+	method string
+	uri    string
+	user   string
+	pwd    string
+}
+
+// newAdminServer starts a fake admin API answering status with code and
+// body, and returns the config pointing to it.
+func newAdminServer(t *testing.T, tls bool, code int, body string) (*m.ClientCommonConfig, <-chan adminRequest) {
+	t.Helper()
+	reqCh := make(chan adminRequest, 10)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pwd, _ := r.BasicAuth()
+		reqCh <- adminRequest{method: r.Method, uri: r.URL.RequestURI(), user: user, pwd: pwd}
+		w.WriteHeader(code)
+		_, _ = w.Write([]byte(body))
+	})
+	var ts *httptest.Server
+	if tls {
+		ts = httptest.NewTLSServer(handler)
+	} else {
+		ts = httptest.NewServer(handler)
+	}
+	t.Cleanup(ts.Close)
+
+	host, port, err := net.SplitHostPort(ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &m.ClientCommonConfig{}
+	cfg.WebServer.Addr = host
+	cfg.WebServer.Port, _ = strconv.Atoi(port)
+	cfg.WebServer.User = "admin"
+	cfg.WebServer.Password = "admin-secret"
+	if tls {
+		cfg.WebServer.TLS = &m.TLSConfig{}
+	}
+	return cfg, reqCh
+}
+
+// captureStdout returns what f prints.
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	outCh := make(chan string)
+	go func() {
+		out, _ := io.ReadAll(r)
+		outCh <- string(out)
+	}()
+	f()
+	w.Close()
+	return <-outCh
+}
+
+func TestAdminCommands(t *testing.T) {
+	status := `{"tcp":[{"name":"ssh","type":"tcp","status":"running","local_addr":"127.0.0.1:22","remote_addr":"10.0.0.1:6000"}],` +
+		`"http":[{"name":"web","type":"http","status":"start error","err":"domain is used"}]}`
+
+	tests := []struct {
+		name    string
+		handler func(*m.ClientCommonConfig) error
+		tls     bool
+		strict  bool
+		code    int
+		body    string
+		wantReq adminRequest
+		// wantOut are the lines expected in the output
+		wantOut []string
+		wantErr string
+	}{
+		{
+			name:    "reload",
+			handler: ReloadHandler,
+			code:    http.StatusOK,
+			wantReq: adminRequest{method: http.MethodPost, uri: "/api/reload"},
+			wantOut: []string{"reload success"},
+		},
+		{
+			name:    "strict reload",
+			handler: ReloadHandler,
+			strict:  true,
+			code:    http.StatusOK,
+			wantReq: adminRequest{method: http.MethodPost, uri: "/api/reload?strictConfig=true"},
+			wantOut: []string{"reload success"},
+		},
+		{
+			name:    "reload error",
+			handler: ReloadHandler,
+			code:    http.StatusBadRequest,
+			body:    "proxy [ssh]: localPort: port number 0 must be within the range 1..65535\n",
+			wantReq: adminRequest{method: http.MethodPost, uri: "/api/reload"},
+			wantErr: "400 Bad Request: proxy [ssh]: localPort",
+		},
+		{
+			name:    "status",
+			handler: StatusHandler,
+			code:    http.StatusOK,
+			body:    status,
+			wantReq: adminRequest{method: http.MethodGet, uri: "/api/status"},
+			// the types are sorted
+			wantOut: []string{"HTTP", "web   start error", "domain is used", "TCP", "ssh   running", "10.0.0.1:6000"},
+		},
+		{
+			name:    "invalid status",
+			handler: StatusHandler,
+			code:    http.StatusOK,
+			body:    "not json",
+			wantReq: adminRequest{method: http.MethodGet, uri: "/api/status"},
+			wantErr: "unmarshal proxy status error",
+		},
+		{
+			name:    "stop",
+			handler: StopHandler,
+			code:    http.StatusOK,
+			wantReq: adminRequest{method: http.MethodPost, uri: "/api/stop"},
+			wantOut: []string{"stop success"},
+		},
+		{
+			// the self-signed certificate of the admin server is accepted
+			name:    "stop over tls",
+			handler: StopHandler,
+			tls:     true,
+			code:    http.StatusOK,
+			wantReq: adminRequest{method: http.MethodPost, uri: "/api/stop"},
+			wantOut: []string{"stop success"},
+		},
+		{
+			name:    "unauthorized",
+			handler: StopHandler,
+			code:    http.StatusUnauthorized,
+			wantReq: adminRequest{method: http.MethodPost, uri: "/api/stop"},
+			wantErr: "401 Unauthorized",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, reqCh := newAdminServer(t, tt.tls, tt.code, tt.body)
+			oldStrict := strictConfigMode
+			strictConfigMode = tt.strict
+			defer func() { strictConfigMode = oldStrict }()
+
+			var err error
+			out := captureStdout(t, func() { err = tt.handler(cfg) })
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			select {
+			case req := <-reqCh:
+				tt.wantReq.user, tt.wantReq.pwd = "admin", "admin-secret"
+				if req != tt.wantReq {
+					t.Errorf("expected request %+v, got %+v", tt.wantReq, req)
+				}
+			default:
+				t.Fatal("expected a request to the admin api")
+			}
+
+			for _, want := range tt.wantOut {
+				if !strings.Contains(out, want) {
+					t.Errorf("expected output containing %q, got\n%s", want, out)
+				}
+			}
+			if tt.wantOut != nil && strings.Index(out, tt.wantOut[0]) > strings.Index(out, tt.wantOut[len(tt.wantOut)-1]) {
+				t.Errorf("expected the output in order, got\n%s", out)
+			}
+		})
+	}
+}
+
+func TestNewAdminClientWildcardAddr(t *testing.T) {
+	cfg, reqCh := newAdminServer(t, false, http.StatusOK, "")
+	// a server listening on all addresses is reached on the loopback one
+	cfg.WebServer.Addr = "0.0.0.0"
+	captureStdout(t, func() {
+		if err := StopHandler(cfg); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+	if len(reqCh) != 1 {
+		t.Fatal("expected a request to the admin api")
+	}
+}
@@ -2,11 +2,22 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
 
 	"github.com/gk7790/gk-zap/client"
+	"github.com/gk7790/gk-zap/pkg/config"
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+	"github.com/gk7790/gk-zap/pkg/config/validation"
+	"github.com/gk7790/gk-zap/pkg/utils/log"
 	"github.com/gk7790/gk-zap/pkg/utils/version"
+	"github.com/gk7790/gk-zap/pkg/utils/xlog"
 	"github.com/spf13/cobra"
 )
 
@@ -19,19 +30,31 @@ var (
 
 func init() {
 	rootCli.PersistentFlags().StringVarP(&cfgFile, "config", "c", "./frpc.ini", "config file of frpc")
-	rootCli.PersistentFlags().StringVarP(&cfgDir, "config_dir", "", "", "config directory, run one frpc service for each file in config directory")
-	rootCli.PersistentFlags().BoolVarP(&showVersion, "version", "v", false, "version of frpc")
+	rootCli.PersistentFlags().StringVarP(&cfgDir, "config_dir", "", "", "config directory, run one gkc service for each file in config directory")
+	rootCli.PersistentFlags().BoolVarP(&showVersion, "version", "v", false, "version of gkc")
 	rootCli.PersistentFlags().BoolVarP(&strictConfigMode, "strict_config", "", true, "strict config parsing mode, unknown fields will cause an errors")
+	config.RegisterClientConfigFlags(rootCli)
 }
 
 var rootCli = &cobra.Command{
 	Use:   "gkc",
-	Short: "gkc is the server of zap (https://github.com/gk7790/gk-zap)",
+	Short: "gkc is the client of zap (https://github.com/gk7790/gk-zap)",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if showVersion {
 			fmt.Println(version.Full())
 			return nil
 		}
+		// If cfgDir is not empty, run multiple gkc service for each config file in cfgDir.
+		if cfgDir != "" {
+			ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+			defer stop()
+			if err := runMultipleClients(ctx, cfgDir); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			return nil
+		}
+
 		// Do not show command usage here.
 		err := runClient(cfgFile)
 		if err != nil {
@@ -39,7 +62,6 @@ var rootCli = &cobra.Command{
 			os.Exit(1)
 		}
 		return nil
-		return nil
 	},
 }
 
@@ -49,10 +71,132 @@ func Execute() {
 	}
 }
 
+// runMultipleClients runs one service for each config file in cfgDir until
+// ctx is done. Nothing is started if any of the files is invalid.
+func runMultipleClients(ctx context.Context, cfgDir string) error {
+	entries, err := os.ReadDir(cfgDir)
+	if err != nil {
+		return err
+	}
+
+	type service struct {
+		name        string
+		path        string
+		cfg         *m.ClientCommonConfig
+		proxyCfgs   []m.ProxyConfigurer
+		visitorCfgs []m.VisitorConfigurer
+	}
+	var errs []error
+	services := make([]service, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(cfgDir, entry.Name())
+		cfg, proxyCfgs, visitorCfgs, err := loadAndValidateClientConfig(path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("config file [%s]: %v", path, err))
+			continue
+		}
+		// The logger is process wide, so the files can't log to different
+		// places or at different levels.
+		if len(services) > 0 && cfg.Log != services[0].cfg.Log {
+			errs = append(errs, fmt.Errorf("config file [%s]: log settings differ from [%s], all files in %s must use the same log settings",
+				path, services[0].path, cfgDir))
+			continue
+		}
+		services = append(services, service{
+			name:        strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name())),
+			path:        path,
+			cfg:         cfg,
+			proxyCfgs:   proxyCfgs,
+			visitorCfgs: visitorCfgs,
+		})
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	if len(services) == 0 {
+		return fmt.Errorf("no config file found in %s", cfgDir)
+	}
+
+	// All services share the process wide logger, each service has its own
+	// prefix.
+	initLog(services[0].cfg)
+
+	var wg sync.WaitGroup
+	for _, svc := range services {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			svcCtx := xlog.NewContext(ctx, xlog.New().AppendPrefix(svc.name))
+			if err := startService(svcCtx, svc.cfg, svc.proxyCfgs, svc.visitorCfgs, svc.path); err != nil {
+				log.Errorf("[%s] gkc service error: %v", svc.name, err)
+			}
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+func loadAndValidateClientConfig(path string) (
+	*m.ClientCommonConfig,
+	[]m.ProxyConfigurer,
+	[]m.VisitorConfigurer,
+	error,
+) {
+	cfg, proxyCfgs, visitorCfgs, err := config.LoadClientConfig(path, strictConfigMode)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	warning, err := validation.ValidateClientConfig(cfg, proxyCfgs, visitorCfgs)
+	if warning != nil {
+		fmt.Printf("WARNING: %v\n", warning)
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return cfg, proxyCfgs, visitorCfgs, nil
+}
+
+func initLog(cfg *m.ClientCommonConfig) {
+	log.Init(cfg.Log.To != "console", cfg.Log.To, log.ParseLevel(cfg.Log.Level))
+}
+
 func runClient(cfgFilePath string) error {
-	svr, err := client.NewService(client.ServiceOptions{})
+	cfg, proxyCfgs, visitorCfgs, err := loadAndValidateClientConfig(cfgFilePath)
+	if err != nil {
+		return err
+	}
+	initLog(cfg)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	return startService(ctx, cfg, proxyCfgs, visitorCfgs, cfgFilePath)
+}
+
+func startService(
+	ctx context.Context,
+	cfg *m.ClientCommonConfig,
+	proxyCfgs []m.ProxyConfigurer,
+	visitorCfgs []m.VisitorConfigurer,
+	cfgFile string,
+) error {
+	xl := xlog.FromContextSafe(ctx)
+	if cfgFile != "" {
+		xl.Infof("start gkc service for config file [%s]", cfgFile)
+		defer xl.Infof("gkc service for config file [%s] stopped", cfgFile)
+	}
+	svr, err := client.NewService(client.ServiceOptions{
+		Common:         cfg,
+		ProxyCfgs:      proxyCfgs,
+		VisitorCfgs:    visitorCfgs,
+		ConfigFilePath: cfgFile,
+		StrictConfig:   strictConfigMode,
+	})
 	if err != nil {
 		return err
 	}
-	return svr.Run(context.Background())
+	return svr.Run(ctx)
 }
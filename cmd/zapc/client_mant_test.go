@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// closedPort returns a local port nothing listens on.
+func closedPort(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+	return port
+}
+
+func writeConfigDir(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestRunMultipleClientsErrors(t *testing.T) {
+	valid := fmt.Sprintf("serverAddr: 127.0.0.1\nserverPort: %d\n", closedPort(t))
+
+	tests := []struct {
+		name     string
+		files    map[string]string
+		wantErrs []string
+	}{
+		{
+			// the valid file isn't started either
+			name: "one invalid file",
+			files: map[string]string{
+				"a.yaml": valid,
+				"b.yaml": "serverPort: abc\n",
+			},
+			wantErrs: []string{"config file [DIR/b.yaml]: DIR/b.yaml:1: serverPort"},
+		},
+		{
+			name: "every invalid file is reported",
+			files: map[string]string{
+				"a.yaml": "serverPort: 70000\n",
+				"b.yaml": "proxies:\n  - name: ssh\n    type: tcp\n    localPort: 0\n",
+			},
+			wantErrs: []string{"config file [DIR/a.yaml]: serverPort", "config file [DIR/b.yaml]: proxy [ssh]: localPort"},
+		},
+		{
+			name: "other log settings",
+			files: map[string]string{
+				"a.yaml": valid,
+				"b.yaml": valid + "log:\n  level: debug\n",
+			},
+			wantErrs: []string{"config file [DIR/b.yaml]: log settings differ from [DIR/a.yaml]"},
+		},
+		{
+			// hidden files and directories are skipped
+			name:     "no config file",
+			files:    map[string]string{".a.yaml": valid},
+			wantErrs: []string{"no config file found in DIR"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeConfigDir(t, tt.files)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			err := runMultipleClients(ctx, dir)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			got := strings.ReplaceAll(err.Error(), dir, "DIR")
+			for _, want := range tt.wantErrs {
+				if !strings.Contains(got, want) {
+					t.Errorf("expected error containing %q, got %q", want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestRunMultipleClientsWaitsForAll(t *testing.T) {
+	port := closedPort(t)
+	dir := writeConfigDir(t, map[string]string{
+		// exits after the first failed login
+		"a.yaml": fmt.Sprintf("serverAddr: 127.0.0.1\nserverPort: %d\n", port),
+		// keeps retrying until it is stopped
+		"b.yaml": fmt.Sprintf("serverAddr: 127.0.0.1\nserverPort: %d\nloginFailExit: false\n", port),
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errCh := make(chan error, 1)
+	go func() { errCh <- runMultipleClients(ctx, dir) }()
+
+	select {
+	case err := <-errCh:
+		t.Fatalf("expected to wait for the running service, returned %v", err)
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	cancel()
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("timeout waiting for the services to stop")
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/gk7790/gk-zap/pkg/config"
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+	"github.com/samber/lo"
+	"github.com/spf13/cobra"
+)
+
+var printFormat string
+
+func init() {
+	printCmd.Flags().StringVarP(&printFormat, "format", "f", "yaml", "output format, yaml or json")
+	configCmd.AddCommand(printCmd)
+	configCmd.AddCommand(schemaCmd)
+	rootCli.AddCommand(configCmd)
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect gkc configuration",
+}
+
+var printCmd = &cobra.Command{
+	Use:   "print",
+	Short: "Print the effective configuration with secrets masked",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cliCfg, proxyCfgs, visitorCfgs, err := config.LoadClientConfig(cfgFile, strictConfigMode)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		allCfg := &m.ClientConfig{
+			ClientCommonConfig: *cliCfg,
+			Proxies: lo.Map(proxyCfgs, func(c m.ProxyConfigurer, _ int) m.TypedProxyConfig {
+				return m.TypedProxyConfig{Type: c.GetBaseConfig().Type, ProxyConfigurer: c}
+			}),
+			Visitors: lo.Map(visitorCfgs, func(c m.VisitorConfigurer, _ int) m.TypedVisitorConfig {
+				return m.TypedVisitorConfig{Type: c.GetBaseConfig().Type, VisitorConfigurer: c}
+			}),
+		}
+		config.RedactSecrets(allCfg)
+
+		out, err := config.MarshalConfig(allCfg, printFormat)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		_, _ = os.Stdout.Write(out)
+		return nil
+	},
+}
+
+var schemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Print the JSON Schema of the configuration file",
+	Long: `Print the JSON Schema of the configuration file.
+
+Save it next to the config and reference it to get completion and validation
+in editors, e.g. add the following line on top of a YAML config:
+
+  # yaml-language-server: $schema=./gkc.schema.json`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out, err := json.MarshalIndent(config.ClientConfigSchema(), "", "  ")
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		_, _ = os.Stdout.Write(append(out, '\n'))
+		return nil
+	},
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/gk7790/gk-zap/pkg/config"
+	"github.com/gk7790/gk-zap/pkg/config/validation"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCli.AddCommand(verifyCmd)
+}
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Verify that the configures is valid",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if cfgFile == "" {
+			fmt.Println("gkc: the configuration file is not specified")
+			os.Exit(1)
+		}
+
+		cliCfg, proxyCfgs, visitorCfgs, err := config.LoadClientConfig(cfgFile, strictConfigMode)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		warning, err := validation.ValidateClientConfig(cliCfg, proxyCfgs, visitorCfgs)
+		if warning != nil {
+			fmt.Printf("WARNING: %v\n", warning)
+		}
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("gkc: the configuration file %s syntax is ok\n", cfgFile)
+		return nil
+	},
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/gk7790/gk-zap/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+var printFormat string
+
+func init() {
+	printCmd.Flags().StringVarP(&printFormat, "format", "f", "yaml", "output format, yaml or json")
+	configCmd.AddCommand(printCmd)
+	configCmd.AddCommand(schemaCmd)
+	rootCli.AddCommand(configCmd)
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect gks configuration",
+}
+
+var printCmd = &cobra.Command{
+	Use:   "print",
+	Short: "Print the effective configuration with secrets masked",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		svrCfg, err := config.LoadServerConfig(cfgFile, strictConfigMode)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		config.RedactSecrets(svrCfg)
+
+		out, err := config.MarshalConfig(svrCfg, printFormat)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		_, _ = os.Stdout.Write(out)
+		return nil
+	},
+}
+
+var schemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Print the JSON Schema of the configuration file",
+	Long: `Print the JSON Schema of the configuration file.
+
+Save it next to the config and reference it to get completion and validation
+in editors, e.g. add the following line on top of a YAML config:
+
+  # yaml-language-server: $schema=./gks.schema.json`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out, err := json.MarshalIndent(config.ServerConfigSchema(), "", "  ")
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		_, _ = os.Stdout.Write(append(out, '\n'))
+		return nil
+	},
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/gk7790/gk-zap/pkg/config"
+	"github.com/gk7790/gk-zap/pkg/config/legacy"
+	"github.com/spf13/cobra"
+)
+
+var convertOutput string
+
+func init() {
+	convertCmd.Flags().StringVarP(&convertOutput, "output", "o", "", "write the converted YAML to this file instead of stdout")
+	rootCli.AddCommand(convertCmd)
+}
+
+var convertCmd = &cobra.Command{
+	Use:   "convert [legacy.ini]",
+	Short: "Convert a legacy INI config file to YAML",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := cfgFile
+		if len(args) > 0 {
+			path = args[0]
+		}
+
+		content, err := legacy.GetRenderedConfFromFile(path)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		cfg, warnings, err := legacy.ParseServerConfig(content)
+		for _, w := range warnings {
+			fmt.Fprintf(os.Stderr, "WARNING: %s\n", w)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "convert %s error: %v\n", path, err)
+			os.Exit(1)
+		}
+
+		out, err := config.MarshalYAML(cfg, true)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "marshal config error: %v\n", err)
+			os.Exit(1)
+		}
+		if convertOutput == "" {
+			_, _ = os.Stdout.Write(out)
+			return nil
+		}
+		if err := os.WriteFile(convertOutput, out, 0o600); err != nil {
+			fmt.Fprintf(os.Stderr, "write %s error: %v\n", convertOutput, err)
+			os.Exit(1)
+		}
+		return nil
+	},
+}
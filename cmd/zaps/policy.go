@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gk7790/gk-zap/pkg/config"
+	"github.com/gk7790/gk-zap/pkg/config/validation"
+	hook "github.com/gk7790/gk-zap/pkg/hook/server"
+	"github.com/gk7790/gk-zap/pkg/msg"
+	"github.com/spf13/cobra"
+)
+
+var policyCheckOpts struct {
+	file       string
+	op         string
+	user       string
+	metas      map[string]string
+	source     string
+	proxyType  string
+	proxyName  string
+	remotePort int
+	domains    []string
+	visitor    string
+	output     string
+}
+
+func init() {
+	f := policyCheckCmd.Flags()
+	f.StringVarP(&policyCheckOpts.file, "file", "f", "", "policy file, by default the policyFile of the config")
+	f.StringVar(&policyCheckOpts.op, "op", hook.OpNewProxy, "operation, Login, NewProxy or NewUserConn")
+	f.StringVar(&policyCheckOpts.user, "user", "", "user of the client")
+	f.StringToStringVar(&policyCheckOpts.metas, "meta", nil, "metas of the client, e.g. --meta team=ops")
+	f.StringVar(&policyCheckOpts.source, "source", "", "source address, the client for Login and NewProxy, the user or visitor for NewUserConn")
+	f.StringVar(&policyCheckOpts.proxyType, "proxy-type", "", "proxy type")
+	f.StringVar(&policyCheckOpts.proxyName, "proxy-name", "", "proxy name including the user prefix")
+	f.IntVar(&policyCheckOpts.remotePort, "remote-port", 0, "remote port of tcp and udp proxies")
+	f.StringSliceVar(&policyCheckOpts.domains, "domain", nil, "custom domains of http and https proxies")
+	f.StringVar(&policyCheckOpts.visitor, "visitor", "", "user of the visitor for NewUserConn")
+	f.StringVarP(&policyCheckOpts.output, "output", "o", "text", "output format, text or json")
+	policyCmd.AddCommand(policyCheckCmd)
+	rootCli.AddCommand(policyCmd)
+}
+
+var policyCmd = &cobra.Command{
+	Use:   "policy",
+	Short: "Inspect the policy file of gks",
+}
+
+var policyCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Evaluate a request against the policy without running gks",
+	Long: `Evaluate a request against the policy without running gks and explain
+which rules matched. The exit code is 0 if the request is allowed and 2 if
+it's denied, e.g.
+
+  gks policy check -c gks.yaml --op NewProxy --user alice --proxy-type tcp \
+    --proxy-name alice.ssh --remote-port 6000 --source 10.0.0.8`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		d, err := runPolicyCheck()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if policyCheckOpts.output == "json" {
+			out, _ := json.MarshalIndent(d, "", "  ")
+			fmt.Println(string(out))
+		} else {
+			for _, line := range d.Trace {
+				fmt.Println(line)
+			}
+			if d.Allow {
+				fmt.Print("allowed")
+			} else {
+				fmt.Printf("denied: %s", d.Reason)
+			}
+			if len(d.Modified) > 0 {
+				fmt.Printf(", modified by %s", strings.Join(d.Modified, ", "))
+			}
+			fmt.Println()
+		}
+		if !d.Allow {
+			os.Exit(2)
+		}
+		return nil
+	},
+}
+
+func runPolicyCheck() (*hook.PolicyDecision, error) {
+	o := &policyCheckOpts
+	path := o.file
+	if path == "" {
+		if cfgFile == "" {
+			return nil, fmt.Errorf("gks: neither the policy file nor the configuration file is specified")
+		}
+		svrCfg, err := config.LoadServerConfig(cfgFile, strictConfigMode)
+		if err != nil {
+			return nil, err
+		}
+		if svrCfg.PolicyFile == "" {
+			return nil, fmt.Errorf("gks: policyFile isn't set in %s", cfgFile)
+		}
+		path = svrCfg.PolicyFile
+	}
+
+	c, err := config.LoadPolicyConfig(path, strictConfigMode)
+	if err != nil {
+		return nil, err
+	}
+	if err := validation.ValidatePolicyConfig(c); err != nil {
+		return nil, err
+	}
+	policy, err := hook.NewPolicy(c)
+	if err != nil {
+		return nil, err
+	}
+
+	user := hook.UserInfo{User: o.user, Metas: o.metas, ClientAddress: o.source}
+	var content any
+	switch o.op {
+	case hook.OpLogin:
+		content = &hook.LoginContent{
+			Login:         msg.Login{User: o.user, Metas: o.metas},
+			ClientAddress: o.source,
+		}
+	case hook.OpNewProxy:
+		pxyMsg := msg.NewProxy{
+			ProxyName:  o.proxyName,
+			ProxyType:  o.proxyType,
+			RemotePort: o.remotePort,
+		}
+		// a domain without a dot is taken as a subdomain
+		for _, domain := range o.domains {
+			if strings.Contains(domain, ".") {
+				pxyMsg.CustomDomains = append(pxyMsg.CustomDomains, domain)
+			} else {
+				pxyMsg.SubDomain = domain
+			}
+		}
+		content = &hook.NewProxyContent{User: user, NewProxy: pxyMsg}
+	case hook.OpNewUserConn:
+		user.ClientAddress = ""
+		content = &hook.NewUserConnContent{
+			User:        user,
+			ProxyName:   o.proxyName,
+			ProxyType:   o.proxyType,
+			RemoteAddr:  o.source,
+			VisitorUser: o.visitor,
+		}
+	default:
+		return nil, fmt.Errorf("invalid op %q, optional values are %v", o.op, validation.SupportedPolicyOps)
+	}
+	return policy.Evaluate(o.op, content), nil
+}
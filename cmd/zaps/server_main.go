@@ -4,9 +4,12 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/gk7790/gk-zap/pkg/config"
 	m "github.com/gk7790/gk-zap/pkg/config/model"
+	"github.com/gk7790/gk-zap/pkg/config/validation"
 	"github.com/gk7790/gk-zap/pkg/utils/log"
 	"github.com/gk7790/gk-zap/pkg/utils/version"
 	"github.com/gk7790/gk-zap/server"
@@ -17,14 +20,13 @@ var (
 	cfgFile          string
 	showVersion      bool
 	strictConfigMode bool
-	serverCfg        m.ServerConfig
 )
 
 func init() {
 	rootCli.PersistentFlags().StringVarP(&cfgFile, "config", "c", "", "config file of gks")
 	rootCli.PersistentFlags().BoolVarP(&showVersion, "version", "v", false, "version of gks")
 	rootCli.PersistentFlags().BoolVarP(&strictConfigMode, "strict_config", "", true, "strict config parsing mode, unknown fields will cause errors")
-	config.RegisterServerConfigFlags(rootCli, &serverCfg)
+	config.RegisterServerConfigFlags(rootCli)
 }
 
 var rootCli = &cobra.Command{
@@ -35,22 +37,20 @@ var rootCli = &cobra.Command{
 			fmt.Println(version.Full())
 			return nil
 		}
-		var (
-			svrCfg *m.ServerConfig
-			err    error
-		)
-		if cfgFile != "" {
-			svrCfg, err = config.LoadYamlServerConfig(cfgFile)
-			if err != nil {
-				fmt.Println(err)
-				os.Exit(1)
-			}
-		} else {
-			if err := serverCfg.Complete(); err != nil {
-				fmt.Printf("failed to complete server config: %v\n", err)
-				os.Exit(1)
-			}
-			svrCfg = &serverCfg
+		// config file < env < flags
+		svrCfg, err := config.LoadServerConfig(cfgFile, strictConfigMode)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		warning, err := validation.ValidateServerConfig(svrCfg)
+		if warning != nil {
+			fmt.Printf("WARNING: %v\n", warning)
+		}
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
 		}
 
 		if err := runServer(svrCfg); err != nil {
@@ -69,7 +69,7 @@ func Execute() {
 
 func runServer(cfg *m.ServerConfig) (err error) {
 	// 初始化 logger
-	log.Init(false, "", log.LevelDebug) // false=不写文件, false=Text格式
+	log.Init(cfg.Log.To != "console", cfg.Log.To, log.ParseLevel(cfg.Log.Level))
 
 	if cfgFile != "" {
 		log.Infof("gks uses config file: %s", cfgFile)
@@ -77,13 +77,34 @@ func runServer(cfg *m.ServerConfig) (err error) {
 		log.Infof("gks uses command line arguments for config")
 	}
 
-	svr, err := server.NewService(cfg)
+	svr, err := server.NewService(cfg, cfgFile, strictConfigMode)
 	if err != nil {
 		return err
 	}
 	log.Warnf("gks started successfully")
 
+	// SIGHUP 触发配置热加载
+	if cfgFile != "" {
+		go handleReloadSignal(svr)
+	}
+
 	// 启动服务，并使用一个“永不取消”的根上下文作为运行环境。
 	svr.Run(context.Background())
 	return nil
 }
+
+func handleReloadSignal(svr *server.Service) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	for range ch {
+		log.Infof("received SIGHUP, reloading config file %s", cfgFile)
+		res, err := svr.ReloadFromFile(strictConfigMode)
+		if err != nil {
+			log.Warnf("reload config error: %v", err)
+			continue
+		}
+		if res.Warning != "" {
+			log.Warnf("reload config warning: %s", res.Warning)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/gk7790/gk-zap/pkg/config"
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+	"github.com/gk7790/gk-zap/pkg/config/validation"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCli.AddCommand(verifyCmd)
+}
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Verify that the configures is valid",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if cfgFile == "" {
+			fmt.Println("gks: the configuration file is not specified")
+			os.Exit(1)
+		}
+		svrCfg, err := config.LoadServerConfig(cfgFile, strictConfigMode)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		warning, err := validation.ValidateServerConfig(svrCfg)
+		if warning != nil {
+			fmt.Printf("WARNING: %v\n", warning)
+		}
+		if err == nil && svrCfg.PolicyFile != "" {
+			var policy *m.PolicyConfig
+			if policy, err = config.LoadPolicyConfig(svrCfg.PolicyFile, strictConfigMode); err == nil {
+				err = validation.ValidatePolicyConfig(policy)
+			}
+		}
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Printf("gks: the configuration file %s syntax is ok\n", cfgFile)
+		return nil
+	},
+}
@@ -1,10 +1,13 @@
 package auth
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	m "github.com/gk7790/gk-zap/pkg/config/model"
 	"github.com/gk7790/gk-zap/pkg/msg"
+	"github.com/samber/lo"
 )
 
 type Setter interface {
@@ -16,9 +19,14 @@ type Setter interface {
 func NewAuthSetter(cfg m.AuthClientConfig) (authProvider Setter, err error) {
 	switch cfg.Method {
 	case m.AuthMethodToken:
-		authProvider = NewTokenAuth(cfg.AdditionalScopes, cfg.Token)
+		tokenAuth := NewTokenAuthWithSource(cfg.AdditionalScopes, cfg.Token, cfg.TokenSource)
+		tokenAuth.legacyKey = cfg.LegacyKey
+		tokenAuth.overlap = time.Duration(lo.FromPtr(cfg.TokenSwitchDelay)) * time.Second
+		authProvider = tokenAuth
 	case m.AuthMethodOIDC:
-		// TODO
+		return NewOidcAuthSetter(cfg.AdditionalScopes, cfg.OIDC)
+	case m.AuthMethodMTLS:
+		authProvider = NewMTLSAuthSetter()
 	default:
 		return nil, fmt.Errorf("unsupported auth method: %s", cfg.Method)
 	}
@@ -31,12 +39,48 @@ type Verifier interface {
 	VerifyNewWorkConn(*msg.NewWorkConn) error
 }
 
-func NewAuthVerifier(cfg m.AuthServerConfig) (authVerifier Verifier) {
+func NewAuthVerifier(cfg m.AuthServerConfig) (authVerifier Verifier, err error) {
 	switch cfg.Method {
 	case m.AuthMethodToken:
-		authVerifier = NewTokenAuth(cfg.AdditionalScopes, cfg.Token)
+		tokenAuth := NewTokenAuthWithSource(cfg.AdditionalScopes, cfg.Token, cfg.TokenSource)
+		tokenAuth.allowLegacyKey = cfg.AllowLegacyKey
+		tokenAuth.maxClockSkew = time.Duration(lo.FromPtr(cfg.MaxClockSkew)) * time.Second
+		tokenAuth.overlap = time.Duration(lo.FromPtr(cfg.TokenOverlap)) * time.Second
+		authVerifier = tokenAuth
 	case m.AuthMethodOIDC:
-		// TODO
+		authVerifier = NewOidcAuthVerifier(cfg.AdditionalScopes, cfg.OIDC)
+	case m.AuthMethodMTLS:
+		authVerifier = NewMTLSAuthVerifier(cfg.MTLS)
+	default:
+		return nil, fmt.Errorf("unsupported auth method: %s", cfg.Method)
 	}
-	return authVerifier
+	return authVerifier, nil
+}
+
+// SessionVerifier is implemented by the verifiers which bind the messages
+// after the login to the identity the client logged in with.
+type SessionVerifier interface {
+	// VerifyLoginSession verifies the login like VerifyLogin and returns the
+	// verifier of the following messages of the client.
+	VerifyLoginSession(*msg.Login) (Verifier, error)
+}
+
+// Refresher is implemented by the auth providers whose credentials can
+// change at runtime. RunRefresh blocks until ctx is done.
+type Refresher interface {
+	RunRefresh(ctx context.Context)
+}
+
+// SessionKeySetter is implemented by the setters which sign the login with a
+// secret shared with the server. The secret the login is signed with is the
+// key of the session, e.g. of the encrypted work connections, it doesn't
+// change when the secret is refreshed afterwards.
+type SessionKeySetter interface {
+	SetLoginWithSessionKey(*msg.Login) (sessionKey []byte, err error)
+}
+
+// SessionKeyVerifier is the server side of SessionKeySetter, it returns the
+// secret the login was signed with.
+type SessionKeyVerifier interface {
+	VerifyLoginWithSessionKey(*msg.Login) (sessionKey []byte, err error)
 }
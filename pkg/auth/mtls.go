@@ -0,0 +1,196 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+	"github.com/gk7790/gk-zap/pkg/msg"
+)
+
+// Identity is the identity of a client derived from its connection.
+type Identity struct {
+	User  string
+	Metas map[string]string
+}
+
+// Identifier is implemented by the verifiers which authenticate clients by
+// their connection instead of the credentials in the messages. The server
+// must call Identify for every connection of the client, the Verify methods
+// of such verifiers accept every message.
+type Identifier interface {
+	Identify(state *tls.ConnectionState) (*Identity, error)
+}
+
+// MTLSAuthSetter is used by clients authenticated by their TLS certificate,
+// there is nothing to add to the messages.
+type MTLSAuthSetter struct{}
+
+func NewMTLSAuthSetter() *MTLSAuthSetter {
+	return &MTLSAuthSetter{}
+}
+
+func (*MTLSAuthSetter) SetLogin(*msg.Login) error { return nil }
+
+func (*MTLSAuthSetter) SetPing(*msg.Ping) error { return nil }
+
+func (*MTLSAuthSetter) SetNewWorkConn(*msg.NewWorkConn) error { return nil }
+
+// MTLSAuthVerifier derives the identity of clients from the certificate they
+// presented in the TLS handshake, the chain is verified by the TLS server.
+type MTLSAuthVerifier struct {
+	cfg m.AuthMTLSServerConfig
+	crl *crlFile
+}
+
+func NewMTLSAuthVerifier(cfg m.AuthMTLSServerConfig) *MTLSAuthVerifier {
+	auth := &MTLSAuthVerifier{cfg: cfg}
+	if cfg.CRLFile != "" {
+		auth.crl = &crlFile{path: cfg.CRLFile}
+	}
+	return auth
+}
+
+func (auth *MTLSAuthVerifier) Identify(state *tls.ConnectionState) (*Identity, error) {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil, errors.New("a client certificate signed by the trusted CA is required")
+	}
+	chain := state.VerifiedChains[0]
+	cert := chain[0]
+
+	if auth.crl != nil {
+		var issuer *x509.Certificate
+		if len(chain) > 1 {
+			issuer = chain[1]
+		}
+		if err := auth.crl.check(cert, issuer); err != nil {
+			return nil, err
+		}
+	}
+
+	user := certField(cert, auth.cfg.UserFrom)
+	if user == "" {
+		return nil, fmt.Errorf("client certificate has no %s", auth.cfg.UserFrom)
+	}
+	identity := &Identity{User: user}
+	for key, field := range auth.cfg.Metas {
+		if v := certField(cert, field); v != "" {
+			if identity.Metas == nil {
+				identity.Metas = make(map[string]string)
+			}
+			identity.Metas[key] = v
+		}
+	}
+	return identity, nil
+}
+
+func (*MTLSAuthVerifier) VerifyLogin(*msg.Login) error { return nil }
+
+func (*MTLSAuthVerifier) VerifyPing(*msg.Ping) error { return nil }
+
+func (*MTLSAuthVerifier) VerifyNewWorkConn(*msg.NewWorkConn) error { return nil }
+
+// certField returns the value of field of cert, the first one is used if
+// there are several.
+func certField(cert *x509.Certificate, field string) string {
+	first := func(values []string) string {
+		if len(values) == 0 {
+			return ""
+		}
+		return values[0]
+	}
+
+	switch field {
+	case "commonName":
+		return cert.Subject.CommonName
+	case "dnsSAN":
+		return first(cert.DNSNames)
+	case "emailSAN":
+		return first(cert.EmailAddresses)
+	case "uriSAN":
+		if len(cert.URIs) == 0 {
+			return ""
+		}
+		return cert.URIs[0].String()
+	case "serialNumber":
+		return cert.SerialNumber.Text(16)
+	case "organization":
+		return first(cert.Subject.Organization)
+	case "organizationalUnit":
+		return first(cert.Subject.OrganizationalUnit)
+	default:
+		return ""
+	}
+}
+
+// crlFile is a certificate revocation list loaded from a PEM or DER file,
+// it's loaded again when the file is modified.
+type crlFile struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	list    *x509.RevocationList
+	revoked map[string]struct{}
+}
+
+// check returns an error if cert is revoked. The list must be signed by
+// issuer, the CA which signed cert.
+func (c *crlFile) check(cert, issuer *x509.Certificate) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.load(); err != nil {
+		// fail closed, a broken list must not let revoked certificates in
+		return fmt.Errorf("load crl file error: %v", err)
+	}
+	if issuer == nil || c.list.CheckSignatureFrom(issuer) != nil {
+		return errors.New("crl file isn't signed by the issuer of the client certificate")
+	}
+	if _, ok := c.revoked[cert.SerialNumber.String()]; ok {
+		return fmt.Errorf("client certificate %s has been revoked", cert.SerialNumber.Text(16))
+	}
+	return nil
+}
+
+func (c *crlFile) load() error {
+	info, err := os.Stat(c.path)
+	if err != nil {
+		return err
+	}
+	if c.list != nil && info.ModTime().Equal(c.modTime) {
+		return nil
+	}
+
+	content, err := os.ReadFile(c.path)
+	if err != nil {
+		return err
+	}
+	list, err := parseRevocationList(content)
+	if err != nil {
+		return err
+	}
+	revoked := make(map[string]struct{}, len(list.RevokedCertificateEntries))
+	for _, entry := range list.RevokedCertificateEntries {
+		revoked[entry.SerialNumber.String()] = struct{}{}
+	}
+	c.list, c.revoked, c.modTime = list, revoked, info.ModTime()
+	return nil
+}
+
+// parseRevocationList parses a PEM or DER encoded revocation list.
+func parseRevocationList(content []byte) (*x509.RevocationList, error) {
+	if block, _ := pem.Decode(content); block != nil {
+		if block.Type != "X509 CRL" {
+			return nil, fmt.Errorf("unexpected PEM block type %q", block.Type)
+		}
+		content = block.Bytes
+	}
+	return x509.ParseRevocationList(content)
+}
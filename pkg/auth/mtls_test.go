@@ -0,0 +1,224 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+)
+
+// testCA signs the client certificates and revocation lists of the tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key}
+}
+
+// issue returns a client certificate with the serial number serial.
+func (ca *testCA) issue(t *testing.T, serial int64) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject: pkix.Name{
+			CommonName:         "alice",
+			Organization:       []string{"example"},
+			OrganizationalUnit: []string{"ops"},
+		},
+		DNSNames:       []string{"alice.example.com"},
+		EmailAddresses: []string{"alice@example.com"},
+		NotBefore:      time.Now().Add(-time.Hour),
+		NotAfter:       time.Now().Add(time.Hour),
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// writeCRL writes a PEM revocation list of ca revoking serials to a file.
+func (ca *testCA) writeCRL(t *testing.T, serials ...int64) string {
+	t.Helper()
+	entries := make([]x509.RevocationListEntry, 0, len(serials))
+	for _, serial := range serials {
+		entries = append(entries, x509.RevocationListEntry{SerialNumber: big.NewInt(serial), RevocationTime: time.Now()})
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:                    big.NewInt(1),
+		ThisUpdate:                time.Now().Add(-time.Minute),
+		NextUpdate:                time.Now().Add(time.Hour),
+		RevokedCertificateEntries: entries,
+	}, ca.cert, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "crl.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func verifiedState(chain ...*x509.Certificate) *tls.ConnectionState {
+	return &tls.ConnectionState{PeerCertificates: chain, VerifiedChains: [][]*x509.Certificate{chain}}
+}
+
+func TestMTLSIdentify(t *testing.T) {
+	ca := newTestCA(t, "ca")
+	state := verifiedState(ca.issue(t, 100), ca.cert)
+
+	tests := []struct {
+		name      string
+		userFrom  string
+		metas     map[string]string
+		wantUser  string
+		wantMetas map[string]string
+		wantErr   string
+	}{
+		{name: "common name", userFrom: "commonName", wantUser: "alice"},
+		{name: "dns san", userFrom: "dnsSAN", wantUser: "alice.example.com"},
+		{name: "email san", userFrom: "emailSAN", wantUser: "alice@example.com"},
+		{name: "serial number", userFrom: "serialNumber", wantUser: "64"},
+		{
+			name:     "metas",
+			userFrom: "commonName",
+			// the missing fields are left out
+			metas:     map[string]string{"org": "organization", "team": "organizationalUnit", "uri": "uriSAN"},
+			wantUser:  "alice",
+			wantMetas: map[string]string{"org": "example", "team": "ops"},
+		},
+		{name: "missing user field", userFrom: "uriSAN", wantErr: "client certificate has no uriSAN"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := NewMTLSAuthVerifier(m.AuthMTLSServerConfig{UserFrom: tt.userFrom, Metas: tt.metas})
+			identity, err := auth.Identify(state)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if identity.User != tt.wantUser {
+				t.Errorf("expected user %q, got %q", tt.wantUser, identity.User)
+			}
+			if len(identity.Metas) != len(tt.wantMetas) {
+				t.Fatalf("expected metas %v, got %v", tt.wantMetas, identity.Metas)
+			}
+			for k, v := range tt.wantMetas {
+				if identity.Metas[k] != v {
+					t.Errorf("expected meta %s=%q, got %q", k, v, identity.Metas[k])
+				}
+			}
+		})
+	}
+}
+
+func TestMTLSIdentifyWithoutCertificate(t *testing.T) {
+	ca := newTestCA(t, "ca")
+	auth := NewMTLSAuthVerifier(m.AuthMTLSServerConfig{UserFrom: "commonName"})
+
+	tests := []struct {
+		name  string
+		state *tls.ConnectionState
+	}{
+		{name: "no tls", state: nil},
+		{name: "no peer certificate", state: &tls.ConnectionState{}},
+		// a certificate which wasn't verified against the trusted CA
+		{name: "unverified", state: &tls.ConnectionState{PeerCertificates: []*x509.Certificate{ca.issue(t, 100)}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := auth.Identify(tt.state); err == nil || !strings.Contains(err.Error(), "client certificate") {
+				t.Fatalf("expected the connection to be rejected, got %v", err)
+			}
+		})
+	}
+}
+
+func TestMTLSIdentifyCRL(t *testing.T) {
+	ca := newTestCA(t, "ca")
+	other := newTestCA(t, "other")
+	revoked := ca.issue(t, 100)
+	valid := ca.issue(t, 101)
+
+	tests := []struct {
+		name    string
+		crl     string
+		cert    *x509.Certificate
+		wantErr string
+	}{
+		{name: "not revoked", crl: ca.writeCRL(t, 100), cert: valid},
+		{name: "revoked", crl: ca.writeCRL(t, 100), cert: revoked, wantErr: "client certificate 64 has been revoked"},
+		// a list of another CA can't revoke or allow anything
+		{name: "other issuer", crl: other.writeCRL(t), cert: valid, wantErr: "isn't signed by the issuer"},
+		{name: "missing file", crl: filepath.Join(t.TempDir(), "missing.pem"), cert: valid, wantErr: "load crl file error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := NewMTLSAuthVerifier(m.AuthMTLSServerConfig{UserFrom: "commonName", CRLFile: tt.crl})
+			_, err := auth.Identify(verifiedState(tt.cert, ca.cert))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+
+	// a chain without the issuer can't be checked against the list
+	auth := NewMTLSAuthVerifier(m.AuthMTLSServerConfig{UserFrom: "commonName", CRLFile: ca.writeCRL(t)})
+	if _, err := auth.Identify(verifiedState(valid)); err == nil {
+		t.Fatal("expected an error without the issuer")
+	}
+}
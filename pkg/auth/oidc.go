@@ -0,0 +1,371 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+	"github.com/gk7790/gk-zap/pkg/msg"
+	"golang.org/x/net/proxy"
+)
+
+const oidcHTTPTimeout = 10 * time.Second
+
+// newOidcHTTPClient creates the HTTP client used to talk to the token
+// endpoint, it honors the custom CA, the skip verify flag and the proxy.
+func newOidcHTTPClient(trustedCaFile string, insecureSkipVerify bool, proxyURL string) (*http.Client, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: insecureSkipVerify,
+	}
+	if trustedCaFile != "" {
+		pem, err := os.ReadFile(trustedCaFile)
+		if err != nil {
+			return nil, fmt.Errorf("read trusted ca file error: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no valid certificate found in %s", trustedCaFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	transport := &http.Transport{
+		TLSClientConfig: tlsConfig,
+	}
+	if proxyURL != "" {
+		u, err := url.Parse(proxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("parse proxy url error: %v", err)
+		}
+		switch u.Scheme {
+		case "http", "https":
+			transport.Proxy = http.ProxyURL(u)
+		case "socks5", "socks5h":
+			dialer, err := proxy.FromURL(u, proxy.Direct)
+			if err != nil {
+				return nil, fmt.Errorf("create socks5 dialer error: %v", err)
+			}
+			transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+				if d, ok := dialer.(proxy.ContextDialer); ok {
+					return d.DialContext(ctx, network, addr)
+				}
+				return dialer.Dial(network, addr)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported proxy scheme: %s", u.Scheme)
+		}
+	}
+	return &http.Client{Transport: transport, Timeout: oidcHTTPTimeout}, nil
+}
+
+// OidcAuthProvider gets tokens from the OIDC token endpoint with the client
+// credentials grant and caches them until they expire.
+type OidcAuthProvider struct {
+	additionalAuthScopes []m.AuthScope
+
+	cfg        m.AuthOIDCClientConfig
+	httpClient *http.Client
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+	// authInParams is set once the endpoint rejected the client credentials
+	// in the basic auth header, they are sent as form params from then on
+	authInParams bool
+}
+
+func NewOidcAuthSetter(additionalAuthScopes []m.AuthScope, cfg m.AuthOIDCClientConfig) (*OidcAuthProvider, error) {
+	httpClient, err := newOidcHTTPClient(cfg.TrustedCaFile, cfg.InsecureSkipVerify, cfg.ProxyURL)
+	if err != nil {
+		return nil, err
+	}
+	return &OidcAuthProvider{
+		additionalAuthScopes: additionalAuthScopes,
+		cfg:                  cfg,
+		httpClient:           httpClient,
+	}, nil
+}
+
+type oidcTokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int64  `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+func (auth *OidcAuthProvider) generateAccessToken() (string, error) {
+	auth.mu.Lock()
+	defer auth.mu.Unlock()
+
+	// reuse the token until shortly before it expires
+	if auth.token != "" && (auth.expiresAt.IsZero() || time.Until(auth.expiresAt) > 10*time.Second) {
+		return auth.token, nil
+	}
+
+	tokenResp, status, err := auth.requestToken(auth.authInParams)
+	if err == nil && (status == http.StatusBadRequest || status == http.StatusUnauthorized) && !auth.authInParams {
+		// some providers only accept the client credentials as form params
+		retryResp, retryStatus, retryErr := auth.requestToken(true)
+		if retryErr == nil && retryStatus == http.StatusOK {
+			auth.authInParams = true
+			tokenResp, status = retryResp, retryStatus
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("couldn't generate OIDC token for login: %v", err)
+	}
+	if status != http.StatusOK || tokenResp.Error != "" {
+		reason := tokenResp.Error
+		if tokenResp.ErrorDescription != "" {
+			reason += ": " + tokenResp.ErrorDescription
+		}
+		return "", fmt.Errorf("couldn't generate OIDC token for login: status %d: %s", status, reason)
+	}
+	if tokenResp.AccessToken == "" {
+		return "", fmt.Errorf("couldn't generate OIDC token for login: no access_token in response")
+	}
+
+	auth.token = tokenResp.AccessToken
+	auth.expiresAt = time.Time{}
+	if tokenResp.ExpiresIn > 0 {
+		auth.expiresAt = time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
+	}
+	return auth.token, nil
+}
+
+// requestToken sends a client credentials grant to the token endpoint and
+// returns the decoded response with the HTTP status code.
+func (auth *OidcAuthProvider) requestToken(authInParams bool) (*oidcTokenResponse, int, error) {
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	if auth.cfg.Audience != "" {
+		form.Set("audience", auth.cfg.Audience)
+	}
+	if auth.cfg.Scope != "" {
+		form.Set("scope", auth.cfg.Scope)
+	}
+	for k, v := range auth.cfg.AdditionalEndpointParams {
+		form.Set(k, v)
+	}
+	if authInParams {
+		form.Set("client_id", auth.cfg.ClientID)
+		form.Set("client_secret", auth.cfg.ClientSecret)
+	}
+
+	req, err := http.NewRequest("POST", auth.cfg.TokenEndpointURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if !authInParams {
+		req.SetBasicAuth(url.QueryEscape(auth.cfg.ClientID), url.QueryEscape(auth.cfg.ClientSecret))
+	}
+
+	resp, err := auth.httpClient.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, 0, fmt.Errorf("read token response error: %v", err)
+	}
+
+	tokenResp := &oidcTokenResponse{}
+	if err := json.Unmarshal(body, tokenResp); err != nil && resp.StatusCode == http.StatusOK {
+		return nil, 0, fmt.Errorf("decode token response error: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK && tokenResp.Error == "" {
+		tokenResp.Error = strings.TrimSpace(string(body))
+	}
+	return tokenResp, resp.StatusCode, nil
+}
+
+func (auth *OidcAuthProvider) SetLogin(loginMsg *msg.Login) (err error) {
+	loginMsg.PrivilegeKey, err = auth.generateAccessToken()
+	return err
+}
+
+func (auth *OidcAuthProvider) SetPing(pingMsg *msg.Ping) (err error) {
+	if !slices.Contains(auth.additionalAuthScopes, m.AuthScopeHeartBeats) {
+		return nil
+	}
+
+	pingMsg.PrivilegeKey, err = auth.generateAccessToken()
+	return err
+}
+
+func (auth *OidcAuthProvider) SetNewWorkConn(newWorkConnMsg *msg.NewWorkConn) (err error) {
+	if !slices.Contains(auth.additionalAuthScopes, m.AuthScopeNewWorkConns) {
+		return nil
+	}
+
+	newWorkConnMsg.PrivilegeKey, err = auth.generateAccessToken()
+	return err
+}
+
+// oidcSigningAlgs are the algorithms the tokens may be signed with, the
+// provider usually doesn't list them in its discovery document.
+var oidcSigningAlgs = []string{
+	oidc.RS256, oidc.RS384, oidc.RS512,
+	oidc.PS256, oidc.PS384, oidc.PS512,
+	oidc.ES256, oidc.ES384, oidc.ES512,
+}
+
+// OidcAuthConsumer verifies the OIDC tokens sent by clients as JWTs signed
+// by the keys of the issuer. The provider is discovered on the first login,
+// so gks starts even if the issuer isn't reachable yet.
+type OidcAuthConsumer struct {
+	additionalAuthScopes []m.AuthScope
+
+	cfg        m.AuthOIDCServerConfig
+	httpClient *http.Client
+
+	mu       sync.Mutex
+	verifier *oidc.IDTokenVerifier
+}
+
+func NewOidcAuthVerifier(additionalAuthScopes []m.AuthScope, cfg m.AuthOIDCServerConfig) *OidcAuthConsumer {
+	return &OidcAuthConsumer{
+		additionalAuthScopes: additionalAuthScopes,
+		cfg:                  cfg,
+		httpClient:           &http.Client{Timeout: oidcHTTPTimeout},
+	}
+}
+
+// getVerifier returns the verifier of the provider, a failed discovery is
+// tried again by the next login.
+func (auth *OidcAuthConsumer) getVerifier() (*oidc.IDTokenVerifier, error) {
+	auth.mu.Lock()
+	defer auth.mu.Unlock()
+	if auth.verifier != nil {
+		return auth.verifier, nil
+	}
+
+	// the keys are fetched later with the context of the provider, it must
+	// not be canceled
+	ctx := oidc.ClientContext(context.Background(), auth.httpClient)
+	if auth.cfg.SkipIssuerCheck {
+		ctx = oidc.InsecureIssuerURLContext(ctx, auth.cfg.Issuer)
+	}
+	provider, err := oidc.NewProvider(ctx, auth.cfg.Issuer)
+	if err != nil {
+		return nil, err
+	}
+	auth.verifier = provider.Verifier(&oidc.Config{
+		ClientID:             auth.cfg.Audience,
+		SkipClientIDCheck:    auth.cfg.Audience == "",
+		SkipExpiryCheck:      auth.cfg.SkipExpiryCheck,
+		SkipIssuerCheck:      auth.cfg.SkipIssuerCheck,
+		SupportedSigningAlgs: oidcSigningAlgs,
+	})
+	return auth.verifier, nil
+}
+
+func (auth *OidcAuthConsumer) verify(rawToken string) (*oidc.IDToken, error) {
+	verifier, err := auth.getVerifier()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), oidcHTTPTimeout)
+	defer cancel()
+	return verifier.Verify(ctx, rawToken)
+}
+
+func (auth *OidcAuthConsumer) VerifyLogin(loginMsg *msg.Login) error {
+	if _, err := auth.verify(loginMsg.PrivilegeKey); err != nil {
+		return fmt.Errorf("invalid OIDC token in login: %v", err)
+	}
+	return nil
+}
+
+// VerifyLoginSession verifies the login and returns the verifier of the
+// messages after it, which must carry tokens of the same subject.
+func (auth *OidcAuthConsumer) VerifyLoginSession(loginMsg *msg.Login) (Verifier, error) {
+	token, err := auth.verify(loginMsg.PrivilegeKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OIDC token in login: %v", err)
+	}
+	return &oidcSession{OidcAuthConsumer: auth, subject: token.Subject}, nil
+}
+
+// VerifyPing only checks the token itself, the subject is checked by the
+// verifier VerifyLoginSession returns.
+func (auth *OidcAuthConsumer) VerifyPing(pingMsg *msg.Ping) error {
+	if !slices.Contains(auth.additionalAuthScopes, m.AuthScopeHeartBeats) {
+		return nil
+	}
+
+	_, err := auth.verifyPostLoginToken("heartbeat", pingMsg.PrivilegeKey)
+	return err
+}
+
+func (auth *OidcAuthConsumer) VerifyNewWorkConn(newWorkConnMsg *msg.NewWorkConn) error {
+	if !slices.Contains(auth.additionalAuthScopes, m.AuthScopeNewWorkConns) {
+		return nil
+	}
+
+	_, err := auth.verifyPostLoginToken("NewWorkConn", newWorkConnMsg.PrivilegeKey)
+	return err
+}
+
+// verifyPostLoginToken verifies the token of a message after the login, what
+// names the message in the errors.
+func (auth *OidcAuthConsumer) verifyPostLoginToken(what, privilegeKey string) (*oidc.IDToken, error) {
+	token, err := auth.verify(privilegeKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OIDC token in %s: %v", what, err)
+	}
+	return token, nil
+}
+
+// oidcSession verifies the messages of a client which logged in with a token
+// of subject.
+type oidcSession struct {
+	*OidcAuthConsumer
+
+	subject string
+}
+
+func (s *oidcSession) VerifyPing(pingMsg *msg.Ping) error {
+	if !slices.Contains(s.additionalAuthScopes, m.AuthScopeHeartBeats) {
+		return nil
+	}
+
+	return s.verifySubject("heartbeat", pingMsg.PrivilegeKey)
+}
+
+func (s *oidcSession) VerifyNewWorkConn(newWorkConnMsg *msg.NewWorkConn) error {
+	if !slices.Contains(s.additionalAuthScopes, m.AuthScopeNewWorkConns) {
+		return nil
+	}
+
+	return s.verifySubject("NewWorkConn", newWorkConnMsg.PrivilegeKey)
+}
+
+func (s *oidcSession) verifySubject(what, privilegeKey string) error {
+	token, err := s.verifyPostLoginToken(what, privilegeKey)
+	if err != nil {
+		return err
+	}
+	if token.Subject != s.subject {
+		return fmt.Errorf("received different OIDC subject in login and %s. "+
+			"original subject: %s, new subject: %s",
+			what, s.subject, token.Subject)
+	}
+	return nil
+}
@@ -0,0 +1,495 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+	"github.com/gk7790/gk-zap/pkg/msg"
+)
+
+// testIssuer is an OIDC issuer serving the discovery document, the signing
+// keys and a client credentials token endpoint.
+type testIssuer struct {
+	*httptest.Server
+
+	rsaKey *rsa.PrivateKey
+	ecKey  *ecdsa.PrivateKey
+
+	// discoveryIssuer is the issuer in the discovery document, the URL of
+	// the server if empty
+	discoveryIssuer string
+	// rotatedKey is published with the kid "rotated" once it's set
+	rotatedKey atomic.Pointer[rsa.PrivateKey]
+	// failKeys makes the next fetches of the keys fail
+	failKeys    atomic.Int32
+	keyFetches  atomic.Int32
+	tokenIssued atomic.Int32
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iss := &testIssuer{rsaKey: rsaKey, ecKey: ecKey}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		issuer := iss.discoveryIssuer
+		if issuer == "" {
+			issuer = iss.URL
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":   issuer,
+			"jwks_uri": iss.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		iss.keyFetches.Add(1)
+		if iss.failKeys.Load() > 0 {
+			iss.failKeys.Add(-1)
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		b64 := base64.RawURLEncoding.EncodeToString
+		keys := []map[string]string{
+			{
+				"kty": "RSA", "kid": "rsa", "use": "sig",
+				"n": b64(rsaKey.N.Bytes()),
+				"e": b64(big.NewInt(int64(rsaKey.E)).Bytes()),
+			},
+			{
+				"kty": "EC", "kid": "ec", "crv": "P-256",
+				"x": b64(ecKey.X.FillBytes(make([]byte, 32))),
+				"y": b64(ecKey.Y.FillBytes(make([]byte, 32))),
+			},
+		}
+		if k := iss.rotatedKey.Load(); k != nil {
+			keys = append(keys, map[string]string{
+				"kty": "RSA", "kid": "rotated",
+				"n": b64(k.N.Bytes()),
+				"e": b64(big.NewInt(int64(k.E)).Bytes()),
+			})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": keys})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, ok := r.BasicAuth()
+		if !ok {
+			_ = r.ParseForm()
+			id, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+		}
+		if id != "client" || secret != "secret" || r.PostFormValue("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+		iss.tokenIssued.Add(1)
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token": iss.sign(t, "RS256", "rsa", iss.rsaKey, iss.claims("client", time.Hour)),
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+		})
+	})
+	iss.Server = httptest.NewServer(mux)
+	t.Cleanup(iss.Close)
+	return iss
+}
+
+func (iss *testIssuer) claims(sub string, expiresIn time.Duration) map[string]any {
+	return map[string]any{
+		"iss": iss.URL,
+		"sub": sub,
+		"aud": "gks",
+		"exp": time.Now().Add(expiresIn).Unix(),
+	}
+}
+
+// sign serializes claims as a JWT with the header alg and kid, signed by key.
+func (iss *testIssuer) sign(t *testing.T, alg, kid string, key crypto.Signer, claims map[string]any) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	digest := sha256.Sum256([]byte(signed))
+	var signature []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestOidcVerifyLogin(t *testing.T) {
+	iss := newTestIssuer(t)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	withClaim := func(k string, v any) map[string]any {
+		c := iss.claims("alice", time.Hour)
+		if v == nil {
+			delete(c, k)
+		} else {
+			c[k] = v
+		}
+		return c
+	}
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		token   func() string
+		cfg     func(*m.AuthOIDCServerConfig)
+		wantErr string
+	}{
+		{
+			name:  "rsa",
+			token: func() string { return iss.sign(t, "RS256", "rsa", iss.rsaKey, iss.claims("alice", time.Hour)) },
+		},
+		{
+			name:  "ecdsa",
+			token: func() string { return iss.sign(t, "ES256", "ec", iss.ecKey, iss.claims("alice", time.Hour)) },
+		},
+		{
+			name:  "no kid tries all keys",
+			token: func() string { return iss.sign(t, "ES256", "", iss.ecKey, iss.claims("alice", time.Hour)) },
+		},
+		{
+			name:    "bad signature",
+			token:   func() string { return iss.sign(t, "RS256", "rsa", otherKey, iss.claims("alice", time.Hour)) },
+			wantErr: "failed to verify signature",
+		},
+		{
+			name: "tampered claims",
+			token: func() string {
+				parts := strings.Split(iss.sign(t, "RS256", "rsa", iss.rsaKey, iss.claims("alice", time.Hour)), ".")
+				payload, _ := json.Marshal(iss.claims("mallory", time.Hour))
+				parts[1] = base64.RawURLEncoding.EncodeToString(payload)
+				return strings.Join(parts, ".")
+			},
+			wantErr: "failed to verify signature",
+		},
+		{
+			name:    "ecdsa alg with rsa key",
+			token:   func() string { return iss.sign(t, "ES256", "rsa", iss.ecKey, iss.claims("alice", time.Hour)) },
+			wantErr: "failed to verify signature",
+		},
+		{
+			name:    "rsa alg with ecdsa key",
+			token:   func() string { return iss.sign(t, "RS256", "ec", iss.rsaKey, iss.claims("alice", time.Hour)) },
+			wantErr: "failed to verify signature",
+		},
+		{
+			name:    "unsupported alg",
+			token:   func() string { return iss.sign(t, "HS256", "rsa", iss.rsaKey, iss.claims("alice", time.Hour)) },
+			wantErr: "malformed jwt",
+		},
+		{
+			name:    "unknown kid",
+			token:   func() string { return iss.sign(t, "RS256", "other", iss.rsaKey, iss.claims("alice", time.Hour)) },
+			wantErr: "failed to verify signature",
+		},
+		{
+			name:    "malformed",
+			token:   func() string { return "abc.def" },
+			wantErr: "malformed jwt",
+		},
+		{
+			name:    "wrong issuer",
+			token:   func() string { return iss.sign(t, "RS256", "rsa", iss.rsaKey, withClaim("iss", "https://other")) },
+			wantErr: "id token issued by a different provider",
+		},
+		{
+			name:  "wrong issuer skipped",
+			token: func() string { return iss.sign(t, "RS256", "rsa", iss.rsaKey, withClaim("iss", "https://other")) },
+			cfg:   func(c *m.AuthOIDCServerConfig) { c.SkipIssuerCheck = true },
+		},
+		{
+			name:    "wrong audience",
+			token:   func() string { return iss.sign(t, "RS256", "rsa", iss.rsaKey, withClaim("aud", "other")) },
+			wantErr: `expected audience "gks"`,
+		},
+		{
+			name: "audience in list",
+			token: func() string {
+				return iss.sign(t, "RS256", "rsa", iss.rsaKey, withClaim("aud", []string{"other", "gks"}))
+			},
+		},
+		{
+			name:  "audience not checked",
+			token: func() string { return iss.sign(t, "RS256", "rsa", iss.rsaKey, withClaim("aud", "other")) },
+			cfg:   func(c *m.AuthOIDCServerConfig) { c.Audience = "" },
+		},
+		{
+			name:    "expired",
+			token:   func() string { return iss.sign(t, "RS256", "rsa", iss.rsaKey, iss.claims("alice", -time.Minute)) },
+			wantErr: "token is expired",
+		},
+		{
+			name:    "no expiry",
+			token:   func() string { return iss.sign(t, "RS256", "rsa", iss.rsaKey, withClaim("exp", nil)) },
+			wantErr: "token is expired",
+		},
+		{
+			name:  "expired skipped",
+			token: func() string { return iss.sign(t, "RS256", "rsa", iss.rsaKey, iss.claims("alice", -time.Minute)) },
+			cfg:   func(c *m.AuthOIDCServerConfig) { c.SkipExpiryCheck = true },
+		},
+		{
+			name: "fractional expiry",
+			token: func() string {
+				return iss.sign(t, "RS256", "rsa", iss.rsaKey, withClaim("exp", float64(now.Unix())+3600.5))
+			},
+		},
+		{
+			name: "not valid yet",
+			token: func() string {
+				return iss.sign(t, "RS256", "rsa", iss.rsaKey, withClaim("nbf", now.Add(10*time.Minute).Unix()))
+			},
+			wantErr: "before the nbf",
+		},
+		{
+			name: "not before within clock skew",
+			token: func() string {
+				return iss.sign(t, "RS256", "rsa", iss.rsaKey, withClaim("nbf", now.Add(time.Minute).Unix()))
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := m.AuthOIDCServerConfig{Issuer: iss.URL, Audience: "gks"}
+			if tt.cfg != nil {
+				tt.cfg(&cfg)
+			}
+			verifier := NewOidcAuthVerifier(nil, cfg)
+			err := verifier.VerifyLogin(&msg.Login{PrivilegeKey: tt.token()})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestOidcDiscoveryIssuerCheck(t *testing.T) {
+	iss := newTestIssuer(t)
+	iss.discoveryIssuer = "https://other"
+	token := iss.sign(t, "RS256", "rsa", iss.rsaKey, iss.claims("alice", time.Hour))
+
+	verifier := NewOidcAuthVerifier(nil, m.AuthOIDCServerConfig{Issuer: iss.URL})
+	if err := verifier.VerifyLogin(&msg.Login{PrivilegeKey: token}); err == nil ||
+		!strings.Contains(err.Error(), "did not match the issuer URL returned by provider") {
+		t.Fatalf("expected issuer mismatch error, got %v", err)
+	}
+
+	// skipIssuerCheck accepts the discovery document and the iss claim
+	verifier = NewOidcAuthVerifier(nil, m.AuthOIDCServerConfig{Issuer: iss.URL, SkipIssuerCheck: true})
+	if err := verifier.VerifyLogin(&msg.Login{PrivilegeKey: token}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestOidcKeysRefetch(t *testing.T) {
+	iss := newTestIssuer(t)
+	verifier := NewOidcAuthVerifier(nil, m.AuthOIDCServerConfig{Issuer: iss.URL})
+	login := func(kid string, key *rsa.PrivateKey) error {
+		return verifier.VerifyLogin(&msg.Login{
+			PrivilegeKey: iss.sign(t, "RS256", kid, key, iss.claims("alice", time.Hour)),
+		})
+	}
+
+	// a failed fetch isn't cached, the next token fetches again
+	iss.failKeys.Store(1)
+	if err := login("rsa", iss.rsaKey); err == nil || !strings.Contains(err.Error(), "fetching keys") {
+		t.Fatalf("expected fetch error, got %v", err)
+	}
+	if err := login("rsa", iss.rsaKey); err != nil {
+		t.Fatalf("unexpected error after the issuer recovered: %v", err)
+	}
+
+	// known keys are cached
+	fetches := iss.keyFetches.Load()
+	for range 3 {
+		if err := login("rsa", iss.rsaKey); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if n := iss.keyFetches.Load(); n != fetches {
+		t.Fatalf("expected no more key fetches, got %d", n-fetches)
+	}
+
+	// a key rotated in by the issuer is fetched when a token is signed by it
+	rotated, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := login("rotated", rotated); err == nil {
+		t.Fatal("expected error for a key which isn't published")
+	}
+	iss.rotatedKey.Store(rotated)
+	if err := login("rotated", rotated); err != nil {
+		t.Fatalf("unexpected error for the rotated key: %v", err)
+	}
+}
+
+func TestOidcPostLoginSubject(t *testing.T) {
+	iss := newTestIssuer(t)
+	verifier := NewOidcAuthVerifier([]m.AuthScope{m.AuthScopeHeartBeats}, m.AuthOIDCServerConfig{Issuer: iss.URL})
+	token := func(sub string) string {
+		return iss.sign(t, "RS256", "rsa", iss.rsaKey, iss.claims(sub, time.Hour))
+	}
+
+	alice, err := verifier.VerifyLoginSession(&msg.Login{PrivilegeKey: token("alice")})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	bob, err := verifier.VerifyLoginSession(&msg.Login{PrivilegeKey: token("bob")})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := alice.VerifyPing(&msg.Ping{PrivilegeKey: token("alice")}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// another client which logged in doesn't make the subject valid
+	if err := alice.VerifyPing(&msg.Ping{PrivilegeKey: token("bob")}); err == nil {
+		t.Fatal("expected error for the subject of another login")
+	}
+	if err := bob.VerifyPing(&msg.Ping{PrivilegeKey: token("bob")}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := verifier.VerifyLoginSession(&msg.Login{PrivilegeKey: "invalid"}); err == nil {
+		t.Fatal("expected error for an invalid login token")
+	}
+	// work connections aren't in the scopes
+	if err := alice.VerifyNewWorkConn(&msg.NewWorkConn{PrivilegeKey: "invalid"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestOidcPostLoginErrors(t *testing.T) {
+	iss := newTestIssuer(t)
+	scopes := []m.AuthScope{m.AuthScopeHeartBeats, m.AuthScopeNewWorkConns}
+	verifier := NewOidcAuthVerifier(scopes, m.AuthOIDCServerConfig{Issuer: iss.URL})
+	token := func(sub string) string {
+		return iss.sign(t, "RS256", "rsa", iss.rsaKey, iss.claims(sub, time.Hour))
+	}
+	alice, err := verifier.VerifyLoginSession(&msg.Login{PrivilegeKey: token("alice")})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the errors name the message the token was sent in
+	tests := []struct {
+		name    string
+		verify  func() error
+		wantErr string
+	}{
+		{
+			name:    "ping",
+			verify:  func() error { return verifier.VerifyPing(&msg.Ping{PrivilegeKey: "invalid"}) },
+			wantErr: "invalid OIDC token in heartbeat",
+		},
+		{
+			name:    "work conn",
+			verify:  func() error { return verifier.VerifyNewWorkConn(&msg.NewWorkConn{PrivilegeKey: "invalid"}) },
+			wantErr: "invalid OIDC token in NewWorkConn",
+		},
+		{
+			name:    "session work conn",
+			verify:  func() error { return alice.VerifyNewWorkConn(&msg.NewWorkConn{PrivilegeKey: "invalid"}) },
+			wantErr: "invalid OIDC token in NewWorkConn",
+		},
+		{
+			name:    "session ping subject",
+			verify:  func() error { return alice.VerifyPing(&msg.Ping{PrivilegeKey: token("bob")}) },
+			wantErr: "different OIDC subject in login and heartbeat",
+		},
+		{
+			name:    "session work conn subject",
+			verify:  func() error { return alice.VerifyNewWorkConn(&msg.NewWorkConn{PrivilegeKey: token("bob")}) },
+			wantErr: "different OIDC subject in login and NewWorkConn",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.verify(); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestOidcAuthSetter(t *testing.T) {
+	iss := newTestIssuer(t)
+	setter, err := NewOidcAuthSetter(nil, m.AuthOIDCClientConfig{
+		ClientID:         "client",
+		ClientSecret:     "secret",
+		TokenEndpointURL: iss.URL + "/token",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := NewOidcAuthVerifier(nil, m.AuthOIDCServerConfig{Issuer: iss.URL, Audience: "gks"})
+
+	for range 2 {
+		loginMsg := &msg.Login{}
+		if err := setter.SetLogin(loginMsg); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := verifier.VerifyLogin(loginMsg); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	// the token is cached until it expires
+	if n := iss.tokenIssued.Load(); n != 1 {
+		t.Fatalf("expected 1 token request, got %d", n)
+	}
+
+	setter, err = NewOidcAuthSetter(nil, m.AuthOIDCClientConfig{
+		ClientID:         "client",
+		ClientSecret:     "wrong",
+		TokenEndpointURL: iss.URL + "/token",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := setter.SetLogin(&msg.Login{}); err == nil || !strings.Contains(err.Error(), "invalid_client") {
+		t.Fatalf("expected invalid_client error, got %v", err)
+	}
+}
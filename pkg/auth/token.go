@@ -1,57 +1,340 @@
 package auth
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"slices"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	m "github.com/gk7790/gk-zap/pkg/config/model"
 	"github.com/gk7790/gk-zap/pkg/msg"
 	"github.com/gk7790/gk-zap/pkg/utils/util"
+	"github.com/gk7790/gk-zap/pkg/utils/xlog"
 )
 
 type TokenAuthSetterVerifier struct {
 	additionalAuthScopes []m.AuthScope
-	token                string
+	token                atomic.Pointer[tokenState]
+
+	// mu serializes the changes of the token by SetToken, UpdateToken and
+	// RunRefresh.
+	mu sync.Mutex
+	// source is set if the token is refreshed at runtime
+	source *m.ValueSource
+	// generation is increased when UpdateToken replaces the source, the
+	// tokens resolved from the replaced source are dropped
+	generation    uint64
+	sourceChanged chan struct{}
+
+	// overlap is how long the previous token is still used after the token
+	// changes, the verifier accepts it and the setter keeps signing with it
+	overlap time.Duration
+
+	// legacyKey makes the setter send the md5 based key of old versions
+	legacyKey bool
+	// allowLegacyKey makes the verifier accept the md5 based key
+	allowLegacyKey bool
+	// maxClockSkew limits the age of the keys checked by the verifier, 0
+	// means unlimited
+	maxClockSkew time.Duration
+	nonces       *nonceCache
+}
+
+// tokenState is the token and the one it replaced.
+type tokenState struct {
+	current  string
+	previous string
+	// changedAt is when current replaced previous
+	changedAt time.Time
+	// resolvedAt is when current was read from the token source, it's zero
+	// for a static token
+	resolvedAt time.Time
 }
 
 func NewTokenAuth(additionalAuthScopes []m.AuthScope, token string) *TokenAuthSetterVerifier {
-	return &TokenAuthSetterVerifier{
+	auth := &TokenAuthSetterVerifier{
 		additionalAuthScopes: additionalAuthScopes,
-		token:                token,
+		sourceChanged:        make(chan struct{}, 1),
+		nonces:               newNonceCache(),
 	}
+	auth.token.Store(&tokenState{current: token})
+	return auth
+}
+
+// NewTokenAuthWithSource creates a token auth whose token is resolved again
+// from source every source.RefreshInterval seconds by RunRefresh.
+func NewTokenAuthWithSource(additionalAuthScopes []m.AuthScope, token string, source *m.ValueSource) *TokenAuthSetterVerifier {
+	auth := NewTokenAuth(additionalAuthScopes, token)
+	auth.source = refreshableSource(source)
+	return auth
 }
 
-func (auth *TokenAuthSetterVerifier) SetLogin(loginMsg *msg.Login) error {
-	loginMsg.PrivilegeKey = util.GetAuthKey(auth.token, loginMsg.Timestamp)
+func refreshableSource(source *m.ValueSource) *m.ValueSource {
+	if source != nil && source.RefreshInterval > 0 {
+		return source
+	}
 	return nil
 }
 
-func (auth *TokenAuthSetterVerifier) SetPing(pingMsg *msg.Ping) error {
+// WithToken returns a verifier which checks the messages against token
+// instead, it shares the settings and the nonce cache of auth.
+func (auth *TokenAuthSetterVerifier) WithToken(token string) *TokenAuthSetterVerifier {
+	v := &TokenAuthSetterVerifier{
+		additionalAuthScopes: auth.additionalAuthScopes,
+		sourceChanged:        make(chan struct{}, 1),
+		overlap:              auth.overlap,
+		legacyKey:            auth.legacyKey,
+		allowLegacyKey:       auth.allowLegacyKey,
+		maxClockSkew:         auth.maxClockSkew,
+		nonces:               auth.nonces,
+	}
+	v.token.Store(&tokenState{current: token})
+	return v
+}
+
+// getToken returns the token the setter signs with, it's the previous one
+// during the overlap after a change.
+func (auth *TokenAuthSetterVerifier) getToken() string {
+	s := auth.token.Load()
+	if s.previous != "" && time.Since(s.changedAt) < auth.overlap {
+		return s.previous
+	}
+	return s.current
+}
+
+// verifyTokens returns the tokens the verifier accepts, the previous one is
+// accepted during the overlap after a change.
+func (auth *TokenAuthSetterVerifier) verifyTokens() []string {
+	s := auth.token.Load()
+	if s.previous != "" && s.previous != s.current && time.Since(s.changedAt) < auth.overlap {
+		return []string{s.current, s.previous}
+	}
+	return []string{s.current}
+}
+
+// SetToken replaces the token, messages set or verified afterwards use the
+// new one, or the previous one during the overlap.
+func (auth *TokenAuthSetterVerifier) SetToken(token string) {
+	auth.mu.Lock()
+	defer auth.mu.Unlock()
+	auth.setTokenLocked(token, time.Time{})
+}
+
+func (auth *TokenAuthSetterVerifier) setTokenLocked(token string, resolvedAt time.Time) bool {
+	old := auth.token.Load()
+	if token == old.current {
+		if resolvedAt.After(old.resolvedAt) {
+			s := *old
+			s.resolvedAt = resolvedAt
+			auth.token.Store(&s)
+		}
+		return false
+	}
+	auth.token.Store(&tokenState{
+		current:    token,
+		previous:   old.current,
+		changedAt:  time.Now(),
+		resolvedAt: resolvedAt,
+	})
+	return true
+}
+
+// UpdateToken applies the token and the token source of a reloaded config.
+// resolvedAt is when the config resolved token from source, if RunRefresh
+// has read a newer value from the source since, the newer value is kept.
+// The tokens RunRefresh is resolving from the replaced source are dropped.
+func (auth *TokenAuthSetterVerifier) UpdateToken(token string, source *m.ValueSource, resolvedAt time.Time) {
+	auth.mu.Lock()
+	defer auth.mu.Unlock()
+	auth.source = refreshableSource(source)
+	auth.generation++
+	if source == nil || resolvedAt.After(auth.token.Load().resolvedAt) {
+		auth.setTokenLocked(token, resolvedAt)
+	}
+
+	select {
+	case auth.sourceChanged <- struct{}{}:
+	default:
+	}
+}
+
+// RunRefresh resolves the token source periodically and swaps the token when
+// it changes, until ctx is done. The source may be set or replaced by
+// UpdateToken while it runs.
+func (auth *TokenAuthSetterVerifier) RunRefresh(ctx context.Context) {
+	xl := xlog.FromContextSafe(ctx)
+	for {
+		auth.mu.Lock()
+		source, generation := auth.source, auth.generation
+		auth.mu.Unlock()
+
+		var (
+			timer *time.Timer
+			tick  <-chan time.Time
+		)
+		if source != nil {
+			timer = time.NewTimer(time.Duration(source.RefreshInterval) * time.Second)
+			tick = timer.C
+		}
+		refresh := false
+		select {
+		case <-ctx.Done():
+		case <-auth.sourceChanged:
+		case <-tick:
+			refresh = true
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if !refresh {
+			continue
+		}
+
+		resolvedAt := time.Now()
+		token, err := source.Resolve(ctx)
+		if err != nil {
+			xl.Warnf("refresh auth token error, keep using the current one: %v", err)
+			continue
+		}
+
+		auth.mu.Lock()
+		changed := false
+		if auth.generation == generation {
+			changed = auth.setTokenLocked(token, resolvedAt)
+		}
+		auth.mu.Unlock()
+		if changed {
+			xl.Infof("auth token refreshed from %s source", source.Type)
+		}
+	}
+}
+
+var errTokenMismatch = errors.New("doesn't match token from configuration")
+
+// tokenError describes err of the token in a message of kind what.
+func tokenError(what string, err error) error {
+	if errors.Is(err, errTokenMismatch) {
+		return fmt.Errorf("token in %s %w", what, err)
+	}
+	return fmt.Errorf("invalid token in %s: %w", what, err)
+}
+
+// sign returns the key of a message of typ and the nonce and version it was
+// derived with.
+func (auth *TokenAuthSetterVerifier) sign(typ, runID string, timestamp int64) (key, nonce string, version int, err error) {
+	return auth.signWithToken(auth.getToken(), typ, runID, timestamp)
+}
+
+func (auth *TokenAuthSetterVerifier) signWithToken(token, typ, runID string, timestamp int64) (key, nonce string, version int, err error) {
+	if auth.legacyKey {
+		return util.GetAuthKey(token, timestamp), "", AuthKeyVersionLegacy, nil
+	}
+	if nonce, err = newNonce(); err != nil {
+		return "", "", 0, err
+	}
+	return GetHMACAuthKey(token, typ, runID, timestamp, nonce), nonce, AuthKeyVersionHMAC, nil
+}
+
+// check verifies the key of a message of typ, the timestamp must be within
+// the clock skew window and the nonce must not have been seen before. It
+// returns the token the key was derived from.
+func (auth *TokenAuthSetterVerifier) check(typ, runID string, timestamp int64, nonce string, version int, key string) (string, error) {
+	var keyOf func(token string) string
+	switch version {
+	case AuthKeyVersionLegacy:
+		if !auth.allowLegacyKey {
+			return "", fmt.Errorf("legacy auth key is not allowed, upgrade the client or enable auth.allowLegacyKey")
+		}
+		keyOf = func(token string) string { return util.GetAuthKey(token, timestamp) }
+	case AuthKeyVersionHMAC:
+		if nonce == "" {
+			return "", fmt.Errorf("auth nonce is missing")
+		}
+		keyOf = func(token string) string { return GetHMACAuthKey(token, typ, runID, timestamp, nonce) }
+	default:
+		return "", fmt.Errorf("unsupported auth key version %d", version)
+	}
+	tokens := auth.verifyTokens()
+	i := slices.IndexFunc(tokens, func(token string) bool {
+		return util.ConstantTimeEqString(keyOf(token), key)
+	})
+	if i < 0 {
+		return "", errTokenMismatch
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(defaultNonceTTL).Unix()
+	if auth.maxClockSkew > 0 {
+		skew := now.Sub(time.Unix(timestamp, 0))
+		if skew > auth.maxClockSkew || skew < -auth.maxClockSkew {
+			return "", fmt.Errorf("timestamp %d is out of the allowed clock skew of %v", timestamp, auth.maxClockSkew)
+		}
+		expiresAt = time.Unix(timestamp, 0).Add(auth.maxClockSkew).Unix()
+	}
+	if version == AuthKeyVersionHMAC && !auth.nonces.add(nonce, expiresAt, now) {
+		return "", fmt.Errorf("auth nonce has already been used")
+	}
+	return tokens[i], nil
+}
+
+func (auth *TokenAuthSetterVerifier) SetLogin(loginMsg *msg.Login) (err error) {
+	_, err = auth.SetLoginWithSessionKey(loginMsg)
+	return err
+}
+
+// SetLoginWithSessionKey sets the login like SetLogin and returns the token
+// it was signed with, the server verifies the login with the same token.
+func (auth *TokenAuthSetterVerifier) SetLoginWithSessionKey(loginMsg *msg.Login) (sessionKey []byte, err error) {
+	token := auth.getToken()
+	loginMsg.PrivilegeKey, loginMsg.Nonce, loginMsg.AuthVersion, err = auth.signWithToken(
+		token, authKeyTypeLogin, loginMsg.RunID, loginMsg.Timestamp)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(token), nil
+}
+
+func (auth *TokenAuthSetterVerifier) SetPing(pingMsg *msg.Ping) (err error) {
 	if !slices.Contains(auth.additionalAuthScopes, m.AuthScopeHeartBeats) {
 		return nil
 	}
 
 	pingMsg.Timestamp = time.Now().Unix()
-	pingMsg.PrivilegeKey = util.GetAuthKey(auth.token, pingMsg.Timestamp)
-	return nil
+	pingMsg.PrivilegeKey, pingMsg.Nonce, pingMsg.AuthVersion, err = auth.sign(
+		authKeyTypePing, pingMsg.RunID, pingMsg.Timestamp)
+	return err
 }
 
-func (auth *TokenAuthSetterVerifier) SetNewWorkConn(newWorkConnMsg *msg.NewWorkConn) error {
+func (auth *TokenAuthSetterVerifier) SetNewWorkConn(newWorkConnMsg *msg.NewWorkConn) (err error) {
 	if !slices.Contains(auth.additionalAuthScopes, m.AuthScopeNewWorkConns) {
 		return nil
 	}
 
 	newWorkConnMsg.Timestamp = time.Now().Unix()
-	newWorkConnMsg.PrivilegeKey = util.GetAuthKey(auth.token, newWorkConnMsg.Timestamp)
-	return nil
+	newWorkConnMsg.PrivilegeKey, newWorkConnMsg.Nonce, newWorkConnMsg.AuthVersion, err = auth.sign(
+		authKeyTypeNewWorkConn, newWorkConnMsg.RunID, newWorkConnMsg.Timestamp)
+	return err
 }
 
 func (auth *TokenAuthSetterVerifier) VerifyLogin(m *msg.Login) error {
-	if !util.ConstantTimeEqString(util.GetAuthKey(auth.token, m.Timestamp), m.PrivilegeKey) {
-		return fmt.Errorf("token in login doesn't match token from configuration")
+	_, err := auth.VerifyLoginWithSessionKey(m)
+	return err
+}
+
+// VerifyLoginWithSessionKey verifies the login like VerifyLogin and returns
+// the token it was signed with, the client signs with its session key.
+func (auth *TokenAuthSetterVerifier) VerifyLoginWithSessionKey(m *msg.Login) (sessionKey []byte, err error) {
+	token, err := auth.check(authKeyTypeLogin, m.RunID, m.Timestamp, m.Nonce, m.AuthVersion, m.PrivilegeKey)
+	if err != nil {
+		return nil, tokenError("login", err)
 	}
-	return nil
+	return []byte(token), nil
 }
 
 func (auth *TokenAuthSetterVerifier) VerifyPing(msg *msg.Ping) error {
@@ -59,8 +342,8 @@ func (auth *TokenAuthSetterVerifier) VerifyPing(msg *msg.Ping) error {
 		return nil
 	}
 
-	if !util.ConstantTimeEqString(util.GetAuthKey(auth.token, msg.Timestamp), msg.PrivilegeKey) {
-		return fmt.Errorf("token in heartbeat doesn't match token from configuration")
+	if _, err := auth.check(authKeyTypePing, msg.RunID, msg.Timestamp, msg.Nonce, msg.AuthVersion, msg.PrivilegeKey); err != nil {
+		return tokenError("heartbeat", err)
 	}
 	return nil
 }
@@ -70,8 +353,8 @@ func (auth *TokenAuthSetterVerifier) VerifyNewWorkConn(msg *msg.NewWorkConn) err
 		return nil
 	}
 
-	if !util.ConstantTimeEqString(util.GetAuthKey(auth.token, msg.Timestamp), msg.PrivilegeKey) {
-		return fmt.Errorf("token in NewWorkConn doesn't match token from configuration")
+	if _, err := auth.check(authKeyTypeNewWorkConn, msg.RunID, msg.Timestamp, msg.Nonce, msg.AuthVersion, msg.PrivilegeKey); err != nil {
+		return tokenError("NewWorkConn", err)
 	}
 	return nil
 }
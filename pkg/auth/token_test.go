@@ -0,0 +1,414 @@
+package auth
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+	"github.com/gk7790/gk-zap/pkg/msg"
+	"github.com/gk7790/gk-zap/pkg/utils/log"
+	"github.com/gk7790/gk-zap/pkg/utils/util"
+)
+
+func TestMain(tm *testing.M) {
+	log.Init(false, "", log.LevelError)
+	os.Exit(tm.Run())
+}
+
+func newTestTokenVerifier(maxClockSkew time.Duration, allowLegacyKey bool) *TokenAuthSetterVerifier {
+	v := NewTokenAuth([]m.AuthScope{m.AuthScopeHeartBeats, m.AuthScopeNewWorkConns}, "abc")
+	v.maxClockSkew = maxClockSkew
+	v.allowLegacyKey = allowLegacyKey
+	return v
+}
+
+// hmacLogin returns a login signed with token at timestamp.
+func hmacLogin(token string, timestamp int64, nonce string) *msg.Login {
+	return &msg.Login{
+		RunID:        "run",
+		Timestamp:    timestamp,
+		Nonce:        nonce,
+		AuthVersion:  AuthKeyVersionHMAC,
+		PrivilegeKey: GetHMACAuthKey(token, authKeyTypeLogin, "run", timestamp, nonce),
+	}
+}
+
+func TestTokenVerifyLogin(t *testing.T) {
+	setter := NewTokenAuth(nil, "abc")
+	verifier := newTestTokenVerifier(0, false)
+
+	loginMsg := &msg.Login{RunID: "run", Timestamp: time.Now().Unix()}
+	if err := setter.SetLogin(loginMsg); err != nil {
+		t.Fatal(err)
+	}
+	if loginMsg.AuthVersion != AuthKeyVersionHMAC || loginMsg.Nonce == "" {
+		t.Fatalf("expected a hmac key with a nonce, got version %d nonce %q", loginMsg.AuthVersion, loginMsg.Nonce)
+	}
+	if err := verifier.VerifyLogin(loginMsg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the key is bound to the token, the run id and the message type
+	tests := []struct {
+		name   string
+		modify func(*msg.Login)
+	}{
+		{"other token", func(l *msg.Login) { *l = *hmacLogin("xyz", l.Timestamp, l.Nonce) }},
+		{"other run id", func(l *msg.Login) { l.RunID = "other" }},
+		{"other timestamp", func(l *msg.Login) { l.Timestamp++ }},
+		{"other nonce", func(l *msg.Login) { l.Nonce = "other" }},
+		{"ping key", func(l *msg.Login) {
+			l.PrivilegeKey = GetHMACAuthKey("abc", authKeyTypePing, l.RunID, l.Timestamp, l.Nonce)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := hmacLogin("abc", time.Now().Unix(), "n-"+tt.name)
+			tt.modify(l)
+			err := verifier.VerifyLogin(l)
+			if err == nil || !strings.Contains(err.Error(), "doesn't match token") {
+				t.Fatalf("expected token mismatch, got %v", err)
+			}
+		})
+	}
+}
+
+func TestTokenReplayedNonce(t *testing.T) {
+	setter := NewTokenAuth([]m.AuthScope{m.AuthScopeHeartBeats}, "abc")
+	verifier := newTestTokenVerifier(time.Minute, false)
+
+	loginMsg := &msg.Login{RunID: "run", Timestamp: time.Now().Unix()}
+	if err := setter.SetLogin(loginMsg); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifier.VerifyLogin(loginMsg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := verifier.VerifyLogin(loginMsg); err == nil || !strings.Contains(err.Error(), "already been used") {
+		t.Fatalf("expected replayed login to be rejected, got %v", err)
+	}
+
+	pingMsg := &msg.Ping{RunID: "run"}
+	if err := setter.SetPing(pingMsg); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifier.VerifyPing(pingMsg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := verifier.VerifyPing(pingMsg); err == nil || !strings.Contains(err.Error(), "already been used") {
+		t.Fatalf("expected replayed ping to be rejected, got %v", err)
+	}
+
+	// a fresh message is accepted
+	if err := setter.SetPing(pingMsg); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifier.VerifyPing(pingMsg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the nonce is required for hmac keys
+	noNonce := hmacLogin("abc", time.Now().Unix(), "")
+	if err := verifier.VerifyLogin(noNonce); err == nil || !strings.Contains(err.Error(), "nonce is missing") {
+		t.Fatalf("expected missing nonce error, got %v", err)
+	}
+}
+
+func TestTokenClockSkew(t *testing.T) {
+	const skew = time.Minute
+	verifier := newTestTokenVerifier(skew, false)
+	now := time.Now()
+
+	tests := []struct {
+		name      string
+		timestamp int64
+		wantErr   bool
+	}{
+		{"now", now.Unix(), false},
+		{"just inside in the past", now.Add(-skew + 2*time.Second).Unix(), false},
+		{"just inside in the future", now.Add(skew - 2*time.Second).Unix(), false},
+		{"just outside in the past", now.Add(-skew - 2*time.Second).Unix(), true},
+		{"just outside in the future", now.Add(skew + 2*time.Second).Unix(), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifier.VerifyLogin(hmacLogin("abc", tt.timestamp, "n-"+tt.name))
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "clock skew") {
+					t.Fatalf("expected clock skew error, got %v", err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+
+	// without a limit any timestamp is accepted
+	unlimited := newTestTokenVerifier(0, false)
+	if err := unlimited.VerifyLogin(hmacLogin("abc", now.Add(-time.Hour).Unix(), "old")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestTokenLegacyKey(t *testing.T) {
+	setter := NewTokenAuth(nil, "abc")
+	setter.legacyKey = true
+	loginMsg := &msg.Login{RunID: "run", Timestamp: time.Now().Unix()}
+	if err := setter.SetLogin(loginMsg); err != nil {
+		t.Fatal(err)
+	}
+	if loginMsg.AuthVersion != AuthKeyVersionLegacy || loginMsg.PrivilegeKey != util.GetAuthKey("abc", loginMsg.Timestamp) {
+		t.Fatalf("expected the legacy key, got version %d", loginMsg.AuthVersion)
+	}
+
+	if err := newTestTokenVerifier(0, false).VerifyLogin(loginMsg); err == nil || !strings.Contains(err.Error(), "legacy auth key is not allowed") {
+		t.Fatalf("expected legacy key to be rejected, got %v", err)
+	}
+
+	verifier := newTestTokenVerifier(0, true)
+	if err := verifier.VerifyLogin(loginMsg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wrong := *loginMsg
+	wrong.PrivilegeKey = util.GetAuthKey("xyz", loginMsg.Timestamp)
+	if err := verifier.VerifyLogin(&wrong); err == nil || !strings.Contains(err.Error(), "doesn't match token") {
+		t.Fatalf("expected token mismatch, got %v", err)
+	}
+
+	unknown := *loginMsg
+	unknown.AuthVersion = 99
+	if err := verifier.VerifyLogin(&unknown); err == nil || !strings.Contains(err.Error(), "unsupported auth key version") {
+		t.Fatalf("expected unsupported version error, got %v", err)
+	}
+}
+
+func TestTokenWithToken(t *testing.T) {
+	verifier := newTestTokenVerifier(time.Minute, false)
+	userVerifier := verifier.WithToken("user-token")
+	if userVerifier.maxClockSkew != verifier.maxClockSkew || userVerifier.nonces != verifier.nonces {
+		t.Fatal("expected the copy to share the settings and the nonce cache")
+	}
+
+	loginMsg := hmacLogin("user-token", time.Now().Unix(), "shared")
+	if err := verifier.VerifyLogin(loginMsg); err == nil {
+		t.Fatal("expected the global token to reject the user token")
+	}
+	if err := userVerifier.VerifyLogin(loginMsg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// a nonce seen by one copy is rejected by the others
+	if err := verifier.WithToken("user-token").VerifyLogin(loginMsg); err == nil || !strings.Contains(err.Error(), "already been used") {
+		t.Fatalf("expected replay through another copy to be rejected, got %v", err)
+	}
+
+	// changing the token of a copy doesn't change the original
+	userVerifier.SetToken("changed")
+	if verifier.getToken() != "abc" {
+		t.Fatalf("expected the original token to be kept, got %q", verifier.getToken())
+	}
+}
+
+func TestNonceCacheSweep(t *testing.T) {
+	c := newNonceCache()
+	now := time.Now()
+
+	if !c.add("a", now.Add(30*time.Second).Unix(), now) {
+		t.Fatal("expected a new nonce to be added")
+	}
+	if !c.add("b", now.Add(5*time.Minute).Unix(), now) {
+		t.Fatal("expected a new nonce to be added")
+	}
+	if c.add("a", now.Add(30*time.Second).Unix(), now.Add(10*time.Second)) {
+		t.Fatal("expected a seen nonce to be rejected")
+	}
+
+	// the expired nonces are removed once a minute
+	later := now.Add(2 * time.Minute)
+	if !c.add("c", later.Add(time.Minute).Unix(), later) {
+		t.Fatal("expected a new nonce to be added")
+	}
+	c.mu.Lock()
+	_, hasA := c.seen["a"]
+	_, hasB := c.seen["b"]
+	lastSweep := c.lastSweep
+	c.mu.Unlock()
+	if hasA || !hasB {
+		t.Fatalf("expected only the expired nonce to be swept, a: %v b: %v", hasA, hasB)
+	}
+	if !lastSweep.Equal(later) {
+		t.Fatalf("expected the sweep time to be updated, got %v", lastSweep)
+	}
+
+	// an expired nonce may be used again
+	if !c.add("a", later.Add(time.Minute).Unix(), later) {
+		t.Fatal("expected an expired nonce to be accepted again")
+	}
+}
+
+func TestTokenOverlap(t *testing.T) {
+	verifier := newTestTokenVerifier(time.Minute, false)
+	verifier.overlap = time.Minute
+	verifier.SetToken("new")
+
+	// both tokens are accepted during the overlap, the session key is the
+	// token the login was signed with
+	for _, token := range []string{"abc", "new"} {
+		sessionKey, err := verifier.VerifyLoginWithSessionKey(hmacLogin(token, time.Now().Unix(), "overlap-"+token))
+		if err != nil {
+			t.Fatalf("token %s: unexpected error: %v", token, err)
+		}
+		if string(sessionKey) != token {
+			t.Fatalf("token %s: expected the session key %s, got %s", token, token, sessionKey)
+		}
+	}
+
+	// only the current token is accepted after the overlap
+	s := *verifier.token.Load()
+	s.changedAt = time.Now().Add(-2 * time.Minute)
+	verifier.token.Store(&s)
+	if err := verifier.VerifyLogin(hmacLogin("abc", time.Now().Unix(), "after-abc")); err == nil || !strings.Contains(err.Error(), "doesn't match token") {
+		t.Fatalf("expected the previous token to be rejected, got %v", err)
+	}
+	if err := verifier.VerifyLogin(hmacLogin("new", time.Now().Unix(), "after-new")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// a token replaced twice is not accepted anymore
+	verifier.SetToken("newer")
+	if err := verifier.VerifyLogin(hmacLogin("abc", time.Now().Unix(), "twice")); err == nil {
+		t.Fatal("expected the token before the previous one to be rejected")
+	}
+
+	// without an overlap the previous token is rejected at once
+	noOverlap := newTestTokenVerifier(time.Minute, false)
+	noOverlap.SetToken("new")
+	if err := noOverlap.VerifyLogin(hmacLogin("abc", time.Now().Unix(), "no-overlap")); err == nil {
+		t.Fatal("expected the previous token to be rejected")
+	}
+}
+
+func TestTokenSwitchDelay(t *testing.T) {
+	setter := NewTokenAuth(nil, "abc")
+	setter.overlap = time.Minute
+	setter.SetToken("new")
+
+	// the setter keeps signing with the previous token during the delay
+	loginMsg := &msg.Login{RunID: "run", Timestamp: time.Now().Unix()}
+	sessionKey, err := setter.SetLoginWithSessionKey(loginMsg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(sessionKey) != "abc" || loginMsg.PrivilegeKey != GetHMACAuthKey("abc", authKeyTypeLogin, "run", loginMsg.Timestamp, loginMsg.Nonce) {
+		t.Fatalf("expected the previous token to be used, got session key %q", sessionKey)
+	}
+
+	s := *setter.token.Load()
+	s.changedAt = time.Now().Add(-2 * time.Minute)
+	setter.token.Store(&s)
+	if got := setter.getToken(); got != "new" {
+		t.Fatalf("expected the new token after the delay, got %q", got)
+	}
+}
+
+func TestTokenRefresh(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte("abc\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	source := &m.ValueSource{Type: "file", File: &m.FileSource{Path: path}, RefreshInterval: 1}
+	auth := NewTokenAuthWithSource(nil, "abc", source)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		auth.RunRefresh(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	if err := os.WriteFile(path, []byte("new\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	waitForToken(t, auth, "new")
+	if s := auth.token.Load(); s.previous != "abc" || s.resolvedAt.IsZero() {
+		t.Fatalf("expected the previous token and the resolve time to be kept, got %+v", s)
+	}
+}
+
+func waitForToken(t *testing.T, auth *TokenAuthSetterVerifier, want string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for auth.token.Load().current != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected token %q, got %q", want, auth.token.Load().current)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestTokenUpdateToken(t *testing.T) {
+	source := &m.ValueSource{Type: "env", Env: &m.EnvSource{Name: "GK_TEST_TOKEN"}, RefreshInterval: 60}
+
+	// a reload doesn't replace a value the refresher read later
+	auth := NewTokenAuthWithSource(nil, "abc", source)
+	loadedAt := time.Now()
+	auth.mu.Lock()
+	auth.setTokenLocked("refreshed", loadedAt.Add(time.Second))
+	auth.mu.Unlock()
+	auth.UpdateToken("reloaded", source, loadedAt)
+	if got := auth.token.Load().current; got != "refreshed" {
+		t.Fatalf("expected the newer refreshed token to be kept, got %q", got)
+	}
+
+	// but it replaces an older one
+	auth.UpdateToken("reloaded", source, loadedAt.Add(2*time.Second))
+	if got := auth.token.Load().current; got != "reloaded" {
+		t.Fatalf("expected the reloaded token, got %q", got)
+	}
+
+	// a static token always replaces the current one and stops the refresh
+	auth.UpdateToken("static", nil, time.Time{})
+	if got := auth.token.Load().current; got != "static" || auth.source != nil {
+		t.Fatalf("expected the static token without a source, got %q %v", got, auth.source)
+	}
+}
+
+func TestTokenRefreshDroppedByReload(t *testing.T) {
+	// the command is still running when the config is reloaded
+	source := &m.ValueSource{
+		Type:            "exec",
+		Exec:            &m.ExecSource{Command: "sh", Args: []string{"-c", "sleep 1; echo stale"}},
+		RefreshInterval: 1,
+	}
+	auth := NewTokenAuthWithSource(nil, "abc", source)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		auth.RunRefresh(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	time.Sleep(1500 * time.Millisecond)
+	auth.UpdateToken("reloaded", nil, time.Now())
+	time.Sleep(1500 * time.Millisecond)
+	if got := auth.token.Load().current; got != "reloaded" {
+		t.Fatalf("expected the refresh started before the reload to be dropped, got %q", got)
+	}
+
+	// the refresh starts again when a source is set by a later reload
+	t.Setenv("GK_TEST_TOKEN", "from-env")
+	auth.UpdateToken("reloaded", &m.ValueSource{Type: "env", Env: &m.EnvSource{Name: "GK_TEST_TOKEN"}, RefreshInterval: 1}, time.Now())
+	waitForToken(t, auth, "from-env")
+}
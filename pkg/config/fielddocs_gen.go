@@ -0,0 +1,217 @@
+// Code generated by internal/fielddocs; DO NOT EDIT.
+
+package config
+
+// modelFieldDocs maps type name -> field name -> doc comment of the config
+// model structs.
+var modelFieldDocs = map[string]map[string]string{
+	"AuthClientConfig": {
+		"AdditionalScopes": "Specify whether to include auth info in additional scope. Current supported scopes are: \"HeartBeats\", \"NewWorkConns\".",
+		"LegacyKey":        "LegacyKey specifies whether to send the md5 based key understood by servers of old versions instead of the HMAC-SHA256 one. By default, this value is false.",
+		"Method":           "Method specifies what authentication method to use to authenticate frpc with frps. If \"token\" is specified - token will be read into login message. If \"oidc\" is specified - OIDC (Open ID Connect) token will be issued using OIDC settings. By default, this value is \"token\".",
+		"Token":            "Token specifies the authorization token used to create keys to be sent to the server. The server must have a matching token for authorization to succeed.  By default, this value is \"\".",
+		"TokenSource":      "TokenSource specifies a dynamic source for the authorization token. This is mutually exclusive with Token field.",
+		"TokenSwitchDelay": "TokenSwitchDelay specifies how long the client keeps signing with the previous token after tokenSource returns a new one, in seconds, so that a server which refreshes its token later doesn't reject it. The tokenOverlap of the server must be longer than this value. By default, this value is tokenSource.refreshInterval.",
+	},
+	"AuthMTLSServerConfig": {
+		"CRLFile":  "CRLFile specifies the path of a certificate revocation list issued by the trusted CA, certificates listed in it are rejected. The file is read again when it's modified.",
+		"Metas":    "Metas maps meta keys to the fields of the client certificate their values are taken from. Besides the values of UserFrom, \"serialNumber\", \"organization\" and \"organizationalUnit\" are supported.",
+		"UserFrom": "UserFrom specifies the field of the client certificate used as the user. Optional values are \"commonName\", \"dnsSAN\", \"emailSAN\" and \"uriSAN\", the first value is used for the SAN fields. By default, this value is \"commonName\".",
+	},
+	"AuthOIDCClientConfig": {
+		"AdditionalEndpointParams": "AdditionalEndpointParams specifies additional parameters to be sent this field will be transfer to map[string][]string in OIDC token generator.",
+		"Audience":                 "Audience specifies the audience of the token in OIDC authentication.",
+		"ClientID":                 "ClientID specifies the client ID to use to get a token in OIDC authentication.",
+		"ClientSecret":             "ClientSecret specifies the client secret to use to get a token in OIDC authentication.",
+		"InsecureSkipVerify":       "InsecureSkipVerify disables TLS certificate verification for the OIDC token endpoint. Only use this for debugging, not recommended for production.",
+		"ProxyURL":                 "ProxyURL specifies a proxy to use when connecting to the OIDC token endpoint. Supports http, https, socks5, and socks5h proxy protocols. If empty, no proxy is used for OIDC connections.",
+		"Scope":                    "Scope specifies the scope of the token in OIDC authentication.",
+		"TokenEndpointURL":         "TokenEndpointURL specifies the URL which implements OIDC Token Endpoint. It will be used to get an OIDC token.",
+		"TrustedCaFile":            "TrustedCaFile specifies the path to a custom CA certificate file for verifying the OIDC token endpoint's TLS certificate.",
+	},
+	"AuthOIDCServerConfig": {
+		"Audience":        "Audience specifies the audience OIDC tokens should contain when validated. If this value is empty, audience (\"client ID\") verification will be skipped.",
+		"Issuer":          "Issuer specifies the issuer to verify OIDC tokens with. This issuer will be used to load public keys to verify signature and will be compared with the issuer claim in the OIDC token.",
+		"SkipExpiryCheck": "SkipExpiryCheck specifies whether to skip checking if the OIDC token is expired.",
+		"SkipIssuerCheck": "SkipIssuerCheck specifies whether to skip checking if the OIDC token's issuer claim matches the issuer specified in OidcIssuer.",
+	},
+	"AuthServerConfig": {
+		"AllowLegacyKey": "AllowLegacyKey specifies whether clients may still log in with the md5 based key of old versions. The legacy key has no nonce, a captured login or heartbeat can be replayed until its timestamp is older than maxClockSkew. By default, this value is false.",
+		"MaxClockSkew":   "MaxClockSkew specifies how far the timestamp of a token auth key may be from the clock of the server, in seconds. It must be greater than 0. By default, this value is 300.",
+		"TokenOverlap":   "TokenOverlap specifies how long the previous token is still accepted after the token changes, by a reload or by tokenSource, in seconds. Clients and the server don't see a new token at the same time, it should be longer than the refreshInterval of the clients plus their tokenSwitchDelay. Set it to 0 to reject the previous token at once. By default, this value is 300, or twice tokenSource.refreshInterval if that is longer.",
+	},
+	"ClientCommonConfig": {
+		"DNSServer":          "DNSServer specifies a DNS server address for FRPC to use. If this value is \"\", the default DNS will be used.",
+		"FeatureGates":       "FeatureGates specifies a set of feature gates to enable or disable. This can be used to enable alpha/beta features or disable default features.",
+		"IncludeConfigFiles": "Include other config files for proxies.",
+		"LoginFailExit":      "LoginFailExit controls whether or not the client should exit after a failed login attempt. If false, the client will retry until a login attempt succeeds. By default, this value is true.",
+		"Metadatas":          "Client metadata info",
+		"NatHoleSTUNServer":  "STUN server to help penetrate NAT hole.",
+		"ServerAddr":         "ServerAddr specifies the address of the server to connect to. By default, this value is \"0.0.0.0\".",
+		"ServerPort":         "ServerPort specifies the port to connect to the server on. By default, this value is 7000.",
+		"Start":              "Start specifies a set of enabled proxies by name. If this set is empty, all supplied proxies are enabled. By default, this value is an empty set.",
+		"UDPPacketSize":      "UDPPacketSize specifies the udp packet size By default, this value is 1500",
+		"User":               "User specifies a prefix for proxy names to distinguish them from other clients. If this value is not \"\", proxy names will automatically be changed to \"{user}.{proxy_name}\".",
+	},
+	"ClientTransportConfig": {
+		"ConnectServerLocalIP":    "ConnectServerLocalIP specifies the address of the client bind when it connect to server. Note: This value only use in TCP/Websocket protocol. Not support in KCP protocol.",
+		"DialServerKeepAlive":     "DialServerKeepAlive specifies the interval between keep-alive probes for an active network connection between frpc and frps. If negative, keep-alive probes are disabled.",
+		"DialServerTimeout":       "The maximum amount of time a dial to server will wait for a connect to complete.",
+		"HeartbeatInterval":       "HeartBeatInterval specifies at what interval heartbeats are sent to the server, in seconds. It is not recommended to change this value. By default, this value is 30. Set negative value to disable it.",
+		"HeartbeatTimeout":        "HeartBeatTimeout specifies the maximum allowed heartbeat response delay before the connection is terminated, in seconds. It is not recommended to change this value. By default, this value is 90. Set negative value to disable it.",
+		"PoolCount":               "PoolCount specifies the number of connections the client will make to the server in advance.",
+		"Protocol":                "Protocol specifies the protocol to use when interacting with the server. Valid values are \"tcp\", \"kcp\", \"quic\", \"websocket\" and \"wss\". By default, this value is \"tcp\".",
+		"ProxyURL":                "ProxyURL specifies a proxy address to connect to the server through. If this value is \"\", the server will be connected to directly. By default, this value is read from the \"http_proxy\" environment variable.",
+		"QUIC":                    "QUIC protocol options.",
+		"TCPMux":                  "TCPMux toggles TCP stream multiplexing. This allows multiple requests from a client to share a single TCP connection. If this value is true, the server must have TCP multiplexing enabled as well. By default, this value is true.",
+		"TCPMuxKeepaliveInterval": "TCPMuxKeepaliveInterval specifies the keep alive interval for TCP stream multiplier. If TCPMux is true, heartbeat of application layer is unnecessary because it can only rely on heartbeat in TCPMux.",
+		"TLS":                     "TLS specifies TLS settings for the connection to the server.",
+	},
+	"ExecPluginOptions": {
+		"Command": "Command is the path of the executable, Args are its arguments. The process is started again if it exits.",
+	},
+	"ExecSource": {
+		"Timeout": "Timeout specifies the maximum time the command may run, in seconds. By default, this value is 10.",
+	},
+	"HTTPS2HTTPPluginOptions": {
+		"EnableHTTP2":       "EnableHTTP2 controls whether HTTP/2 is negotiated with the visitor. By default, this value is true.",
+		"HostHeaderRewrite": "HostHeaderRewrite replaces the Host header of forwarded requests.",
+		"LocalAddr":         "LocalAddr is the address of the local HTTP backend, e.g. \"127.0.0.1:8080\".",
+		"RequestHeaders":    "RequestHeaders specifies headers to set on forwarded requests.",
+	},
+	"HTTPS2HTTPSPluginOptions": {
+		"EnableHTTP2":       "EnableHTTP2 controls whether HTTP/2 is negotiated with the visitor. By default, this value is true.",
+		"HostHeaderRewrite": "HostHeaderRewrite replaces the Host header of forwarded requests.",
+		"LocalAddr":         "LocalAddr is the address of the local HTTPS backend, e.g. \"127.0.0.1:8443\".",
+		"RequestHeaders":    "RequestHeaders specifies headers to set on forwarded requests.",
+	},
+	"LogConfig": {
+		"DisablePrintColor": "DisablePrintColor disables log colors when log.to is \"console\".",
+		"Level":             "Level specifies the minimum log level. Valid values are \"trace\", \"debug\", \"info\", \"warn\", and \"error\". By default, this value is \"info\".",
+		"MaxDays":           "MaxDays specifies the maximum number of days to store log information before deletion.",
+		"To":                "This is destination where frp should write the logs. If \"console\" is used, logs will be printed to stdout, otherwise, logs will be written to the specified file. By default, this value is \"console\".",
+	},
+	"NatTraversalConfig": {
+		"DisableAssistedAddrs": "DisableAssistedAddrs disables the use of local network interfaces for assisted connections during NAT traversal. When enabled, only STUN-discovered public addresses will be used.",
+	},
+	"PluginCallOptions": {
+		"CircuitBreaker": "CircuitBreaker stops calling a failing plugin for a while.",
+		"FailurePolicy":  "FailurePolicy specifies what happens to a request when the plugin fails after all retries or its circuit breaker is open, \"reject\" or \"allow\". By default, this value is \"reject\".",
+		"MaxRetries":     "MaxRetries specifies how many times a failed request is retried, with backoff between the attempts. By default, failed requests aren't retried.",
+		"Timeout":        "Timeout specifies the timeout in seconds of a single request to the plugin. By default, this value is 5.",
+	},
+	"PluginCircuitBreakerConfig": {
+		"FailureThreshold": "FailureThreshold specifies how many consecutive failed calls open the circuit breaker. By default, this value is 5.",
+		"OpenTimeout":      "OpenTimeout specifies how many seconds the circuit breaker stays open, after that a single call is let through to probe the plugin. By default, this value is 30.",
+	},
+	"PolicyConfig": {
+		"DefaultAction": "DefaultAction is applied when no allow or deny rule matches, \"allow\" or \"deny\". By default, this value is \"allow\".",
+	},
+	"PolicyMatch": {
+		"Domains":     "Domains matches the custom domains and the subdomain of http and https proxies, any of them matching is enough.",
+		"Metas":       "Metas matches the metas the client sent at login, every key must be present with a value matching the pattern.",
+		"ProxyNames":  "ProxyNames matches the name of the proxy, including the user prefix.",
+		"ProxyTypes":  "ProxyTypes matches the type of the proxy.",
+		"RemotePorts": "RemotePorts matches the remote port of tcp and udp proxies.",
+		"SourceCIDRs": "SourceCIDRs matches the address of the connection: the client for Login and NewProxy, the user or visitor for NewUserConn.",
+		"Users":       "Users matches the user of the client, for NewUserConn it's the user of the proxy owner.",
+		"Visitors":    "Visitors matches the user of the visitor for NewUserConn of stcp, sudp and xtcp proxies.",
+	},
+	"PolicyRule": {
+		"Action": "Action is \"allow\", \"deny\" or \"modify\".",
+		"Name":   "Name is shown when the rule decides a request.",
+		"Ops":    "Ops specifies the operations the rule applies to, Login, NewProxy or NewUserConn. If the length of this value is 0, the rule applies to all of them.",
+		"Reason": "Reason is sent to the client when the rule denies a request.",
+		"Set":    "Set specifies the changes of a modify rule, they apply to NewProxy.",
+	},
+	"ProxyBackend": {
+		"LocalIP":   "LocalIP specifies the IP address or host name of the backend.",
+		"LocalPort": "LocalPort specifies the port of the backend.",
+		"Plugin":    "Plugin specifies what plugin should be used for handling connections. If this value is set, the LocalIP and LocalPort values will be ignored.",
+	},
+	"ProxyBaseConfig": {
+		"Metadatas": "metadata info for each proxy",
+	},
+	"ProxyTransport": {
+		"BandwidthLimit":     "BandwidthLimit limit the bandwidth 0 means no limit",
+		"BandwidthLimitMode": "BandwidthLimitMode specifies whether to limit the bandwidth on the client or server side. Valid values include \"client\" and \"server\". By default, this value is \"client\".",
+		"UseCompression":     "UseCompression controls whether or not communication with the server will be compressed.",
+		"UseEncryption":      "UseEncryption controls whether or not communication with the server will be encrypted. Encryption is done using the tokens supplied in the server and client configuration.",
+	},
+	"STCPVisitorConfig": {
+		"FallbackTo": "FallbackTo specifies the name of another visitor the user connections are redirected to when the server can't connect them to ServerName, e.g. a visitor with a negative bindPort for a standby proxy.",
+	},
+	"ServerConfig": {
+		"AllowPorts":                      "AllowPorts specifies a set of ports that clients are able to proxy to. If the length of this value is 0, all ports are allowed.",
+		"BindAddr":                        "BindAddr specifies the address that the server binds to. By default, this value is \"0.0.0.0\".",
+		"BindPort":                        "BindPort specifies the port that the server listens on. By default, this value is 7000.",
+		"Custom404Page":                   "Custom404Page specifies a path to a custom 404 page to display. If this value is \"\", a default page will be displayed.",
+		"DetailedErrorsToClient":          "DetailedErrorsToClient defines whether to send the specific error (with debug info) to frpc. By default, this value is true.",
+		"EnablePrometheus":                "EnablePrometheus will export prometheus metrics on webserver address in /metrics api.",
+		"ExecPlugins":                     "ExecPlugins specifies the plugins running as local processes, see ExecPluginOptions. Plugin names are shared with HTTPPlugins.",
+		"KCPBindPort":                     "KCPBindPort specifies the KCP port that the server listens on. If this value is 0, the server will not listen for KCP connections.",
+		"MaxPortsPerClient":               "MaxPortsPerClient specifies the maximum number of ports a single client may proxy to. If this value is 0, no limit will be applied.",
+		"NatHoleAnalysisDataReserveHours": "NatHoleAnalysisDataReserveHours specifies the hours to reserve nat hole analysis data.",
+		"PolicyFile":                      "PolicyFile specifies the path of the policy file, its rules accept, reject or change requests before the plugins are called, see PolicyConfig. The file is read again when the config is reloaded.",
+		"ProxyBindAddr":                   "ProxyBindAddr specifies the address that the proxy binds to. This value may be the same as BindAddr.",
+		"QUICBindPort":                    "QUICBindPort specifies the QUIC port that the server listens on. Set this value to 0 will disable this feature.",
+		"SubDomainHost":                   "SubDomainHost specifies the domain that will be attached to sub-domains requested by the client when using Vhost proxying. For example, if this value is set to \"frps.com\" and the client requested the subdomain \"test\", the resulting URL would be \"test.frps.com\".",
+		"TCPMuxHTTPConnectPort":           "TCPMuxHTTPConnectPort specifies the port that the server listens for TCP HTTP CONNECT requests. If the value is 0, the server will not multiplex TCP requests on one single port. If it's not - it will listen on this value for HTTP CONNECT requests.",
+		"TCPMuxPassthrough":               "If TCPMuxPassthrough is true, frps won't do any update on traffic.",
+		"UDPPacketSize":                   "UDPPacketSize specifies the UDP packet size By default, this value is 1500",
+		"UserConnTimeout":                 "UserConnTimeout specifies the maximum time to wait for a work connection. By default, this value is 10.",
+		"UsersFile":                       "UsersFile specifies the path of the users file. If it's set, only the users listed in it are able to log in, see UsersConfig. The file is read again when the config is reloaded. It requires auth.method token or mtls.",
+		"VhostHTTPPort":                   "VhostHTTPPort specifies the port that the server listens for HTTP Vhost requests. If this value is 0, the server will not listen for HTTP requests.",
+		"VhostHTTPSPort":                  "VhostHTTPSPort specifies the port that the server listens for HTTPS Vhost requests. If this value is 0, the server will not listen for HTTPS requests.",
+		"VhostHTTPTimeout":                "VhostHTTPTimeout specifies the response header timeout for the Vhost HTTP server, in seconds. By default, this value is 60.",
+	},
+	"ServerTransportConfig": {
+		"HeartbeatTimeout":        "HeartBeatTimeout specifies the maximum time to wait for a heartbeat before terminating the connection. It is not recommended to change this value. By default, this value is 90. Set negative value to disable it.",
+		"MaxPoolCount":            "MaxPoolCount specifies the maximum pool size for each proxy. By default, this value is 5.",
+		"TCPKeepAlive":            "TCPKeepAlive specifies the interval between keep-alive probes for an active network connection between frpc and frps. If negative, keep-alive probes are disabled.",
+		"TCPMux":                  "TCPMux toggles TCP stream multiplexing. This allows multiple requests from a client to share a single TCP connection. By default, this value is true.",
+		"TCPMuxKeepaliveInterval": "TCPMuxKeepaliveInterval specifies the keep alive interval for TCP stream multiplier. If TCPMux is true, heartbeat of application layer is unnecessary because it can only rely on heartbeat in TCPMux.",
+		"TLS":                     "TLS specifies TLS settings for the connection from the client. If CertFile and KeyFile are empty, a random self-signed certificate is used.",
+	},
+	"TLSClientConfig": {
+		"DisableCustomTLSFirstByte": "If DisableCustomTLSFirstByte is set to false, frpc will establish a connection with frps using the first custom byte when tls is enabled. Since v0.50.0, the default value has been changed to true, and the first custom byte is disabled by default.",
+		"Enable":                    "TLSEnable specifies whether or not TLS should be used when communicating with the server. If \"tls.certFile\" and \"tls.keyFile\" are valid, client will load the supplied tls configuration. Since v0.50.0, the default value has been changed to true, and tls is enabled by default.",
+	},
+	"TLSConfig": {
+		"CertFile":      "CertFile specifies the path of the cert file that client will load.",
+		"KeyFile":       "KeyFile specifies the path of the secret key file that client will load.",
+		"ServerName":    "ServerName specifies the custom server name of tls certificate. By default, server name if same to ServerAddr.",
+		"TrustedCaFile": "TrustedCaFile specifies the path of the trusted ca file that will load.",
+	},
+	"TLSServerConfig": {
+		"Force": "Force specifies whether to only accept TLS-encrypted connections.",
+	},
+	"UserConfig": {
+		"AllowDomains":    "AllowDomains specifies the custom domains the proxies of the user are able to use, patterns like \"*.example.com\" are supported. If the length of this value is 0, all domains are allowed.",
+		"AllowPorts":      "AllowPorts specifies the remote ports the proxies of the user are able to use. If the length of this value is 0, all ports are allowed.",
+		"AllowSubdomains": "AllowSubdomains specifies the subdomains the proxies of the user are able to use, patterns like \"alice-*\" are supported. If the length of this value is 0, all subdomains are allowed.",
+		"MaxProxies":      "MaxProxies specifies the maximum number of proxies of the user across all its clients. If this value is 0, there is no limit.",
+		"Name":            "Name is the user the clients log in as, the \"user\" of the client config.",
+		"ProxyTypes":      "ProxyTypes specifies the proxy types the user is able to use. If the length of this value is 0, all types are allowed.",
+		"Token":           "Token specifies the token of the user, it replaces auth.token for the clients of this user when auth.method is token. If this value is \"\", auth.token is used.",
+	},
+	"ValueSource": {
+		"RefreshInterval": "RefreshInterval specifies how often the value is resolved again, in seconds. If this value is 0, the value is resolved only once when the configuration is loaded.",
+	},
+	"VisitorBaseConfig": {
+		"BindPort":   "BindPort is the port that visitor listens on. It can be less than 0, it means don't bind to the port and only receive connections redirected from other visitors. (This is not supported for SUDP now)",
+		"ServerUser": "if the server user is not set, it defaults to the current user",
+	},
+	"WebServerConfig": {
+		"Addr":        "This is the network address to bind on for serving the web interface and API. By default, this value is \"127.0.0.1\".",
+		"AssetsDir":   "AssetsDir specifies the local directory that the admin server will load resources from. If this value is \"\", assets will be loaded from the bundled executable using embed package.",
+		"Password":    "Password specifies the password that the admin server will use for login.",
+		"Port":        "Port specifies the port for the web server to listen on. If this value is 0, the admin server will not be started.",
+		"PprofEnable": "Enable golang pprof handlers.",
+		"TLS":         "Enable TLS if TLSConfig is not nil.",
+		"User":        "User specifies the username that the web server will use for login.",
+	},
+	"XTCPVisitorConfig": {
+		"NatTraversal": "NatTraversal configuration for NAT traversal",
+	},
+}
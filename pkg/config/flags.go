@@ -1,12 +1,70 @@
 package config
 
 import (
-	m "github.com/gk7790/gk-zap/pkg/config/model"
+	"fmt"
+	"strings"
+
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
-func RegisterServerConfigFlags(cmd *cobra.Command, c *m.ServerConfig) {
-	cmd.PersistentFlags().StringVarP(&c.BindAddr, "bind_addr", "", "0.0.0.0", "bind address")
-	cmd.PersistentFlags().IntVarP(&c.BindPort, "bind_port", "p", 7000, "bind port")
+// overrideFlag records a single config field set by a named flag.
+type overrideFlag struct {
+	overrides *Overrides
+	path      string
+	value     string
+	typ       string
+}
+
+func (f *overrideFlag) String() string { return f.value }
+func (f *overrideFlag) Type() string   { return f.typ }
+func (f *overrideFlag) Set(s string) error {
+	f.value = s
+	f.overrides.Set(f.path, s)
+	return nil
+}
+
+// setFlag records "path=value" pairs given by --set.
+type setFlag struct {
+	overrides *Overrides
+	values    []string
+}
+
+func (f *setFlag) String() string {
+	if len(f.values) == 0 {
+		return ""
+	}
+	return "[" + strings.Join(f.values, ",") + "]"
+}
+func (f *setFlag) Type() string { return "stringArray" }
+func (f *setFlag) Set(s string) error {
+	path, value, ok := strings.Cut(s, "=")
+	if !ok || path == "" {
+		return fmt.Errorf("invalid format %q, should be path=value", s)
+	}
+	f.values = append(f.values, s)
+	f.overrides.Set(path, value)
+	return nil
+}
+
+func addOverrideFlag(fs *pflag.FlagSet, o *Overrides, name, shorthand, path, typ, usage string) {
+	fs.VarP(&overrideFlag{overrides: o, path: path, typ: typ}, name, shorthand, usage)
+}
+
+func addSetFlag(fs *pflag.FlagSet, o *Overrides) {
+	fs.Var(&setFlag{overrides: o}, "set", "override a config field by its json path, e.g. --set transport.poolCount=5, can be repeated")
+}
+
+func RegisterServerConfigFlags(cmd *cobra.Command) {
+	fs := cmd.PersistentFlags()
+	addOverrideFlag(fs, ServerFlagOverrides, "bind_addr", "", "bindAddr", "string", "bind address")
+	addOverrideFlag(fs, ServerFlagOverrides, "bind_port", "p", "bindPort", "int", "bind port")
+	addSetFlag(fs, ServerFlagOverrides)
+}
 
+func RegisterClientConfigFlags(cmd *cobra.Command) {
+	fs := cmd.PersistentFlags()
+	addOverrideFlag(fs, ClientFlagOverrides, "server_addr", "s", "serverAddr", "string", "server address")
+	addOverrideFlag(fs, ClientFlagOverrides, "server_port", "P", "serverPort", "int", "server port")
+	addSetFlag(fs, ClientFlagOverrides)
 }
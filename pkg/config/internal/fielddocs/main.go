@@ -0,0 +1,136 @@
+// Command fielddocs generates the table of the doc comments of the config
+// model fields, the config schema uses it for the descriptions.
+//
+// Usage, from pkg/config:
+//
+//	go run ./internal/fielddocs -model ./model -o fielddocs_gen.go
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+func main() {
+	modelDir := flag.String("model", "./model", "directory of the config model package")
+	output := flag.String("o", "fielddocs_gen.go", "output file")
+	flag.Parse()
+
+	docs, err := parseFieldDocs(*modelDir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	src, err := render(docs)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(*output, src, 0o644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// parseFieldDocs returns type name -> field name -> doc of the structs in
+// the non-test go files of dir.
+func parseFieldDocs(dir string) (map[string]map[string]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	docs := make(map[string]map[string]string)
+	fset := token.NewFileSet()
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, file, nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		ast.Inspect(f, func(n ast.Node) bool {
+			ts, ok := n.(*ast.TypeSpec)
+			if !ok {
+				return true
+			}
+			st, ok := ts.Type.(*ast.StructType)
+			if !ok {
+				return false
+			}
+			for _, field := range st.Fields.List {
+				doc := cleanFieldDoc(field.Doc)
+				if doc == "" {
+					doc = cleanFieldDoc(field.Comment)
+				}
+				if doc == "" {
+					continue
+				}
+				for _, name := range field.Names {
+					if !name.IsExported() {
+						continue
+					}
+					if docs[ts.Name.Name] == nil {
+						docs[ts.Name.Name] = make(map[string]string)
+					}
+					docs[ts.Name.Name][name.Name] = doc
+				}
+			}
+			return false
+		})
+	}
+	return docs, nil
+}
+
+// cleanFieldDoc joins the lines of a comment into one paragraph and drops
+// the "$HideFromDoc" like markers.
+func cleanFieldDoc(cg *ast.CommentGroup) string {
+	if cg == nil {
+		return ""
+	}
+	var lines []string
+	for _, line := range strings.Split(cg.Text(), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "$") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, " ")
+}
+
+func render(docs map[string]map[string]string) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString("// Code generated by internal/fielddocs; DO NOT EDIT.\n\n")
+	b.WriteString("package config\n\n")
+	b.WriteString("// modelFieldDocs maps type name -> field name -> doc comment of the config\n")
+	b.WriteString("// model structs.\n")
+	b.WriteString("var modelFieldDocs = map[string]map[string]string{\n")
+	for _, typ := range sortedKeys(docs) {
+		fmt.Fprintf(&b, "%q: {\n", typ)
+		for _, field := range sortedKeys(docs[typ]) {
+			fmt.Fprintf(&b, "%q: %q,\n", field, docs[typ][field])
+		}
+		b.WriteString("},\n")
+	}
+	b.WriteString("}\n")
+	return format.Source(b.Bytes())
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,220 @@
+package legacy
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+	"github.com/gk7790/gk-zap/pkg/config/types"
+	"gopkg.in/ini.v1"
+)
+
+// ParseClientConfig parses a legacy frpc style INI config: the [common]
+// section and one section for each proxy or visitor. Sections like
+// [range:web] are expanded to one proxy for each local port. Keys that have
+// no counterpart in the model are returned as warnings.
+func ParseClientConfig(content []byte) (*m.ClientConfig, []string, error) {
+	f, err := loadINI(content)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		warnings []string
+		errs     []error
+	)
+	cfg := &m.ClientConfig{}
+
+	common, err := f.GetSection("common")
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid configuration file, not found [common] section")
+	}
+	r := newSectionReader(common)
+	convertClientCommon(r, &cfg.ClientCommonConfig)
+	warnings = append(warnings, r.unused()...)
+	errs = append(errs, r.errs...)
+
+	for _, section := range f.Sections() {
+		name := section.Name()
+		if name == ini.DefaultSection || name == "common" {
+			continue
+		}
+
+		readers := []*sectionReader{newSectionReader(section)}
+		if prefix, ok := strings.CutPrefix(name, "range:"); ok {
+			readers, err = expandRangeSection(section, prefix)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		}
+
+		for _, r := range readers {
+			var role string
+			r.str("role", &role)
+			if role == "visitor" {
+				if v, err := convertVisitor(r); err != nil {
+					errs = append(errs, err)
+				} else {
+					cfg.Visitors = append(cfg.Visitors, m.TypedVisitorConfig{Type: v.GetBaseConfig().Type, VisitorConfigurer: v})
+				}
+			} else {
+				if p, err := convertProxy(r); err != nil {
+					errs = append(errs, err)
+				} else {
+					cfg.Proxies = append(cfg.Proxies, m.TypedProxyConfig{Type: p.GetBaseConfig().Type, ProxyConfigurer: p})
+				}
+			}
+			errs = append(errs, r.errs...)
+		}
+		// unsupported keys are the same in all expanded proxies
+		warnings = append(warnings, readers[0].unused()...)
+	}
+
+	slices.Sort(warnings)
+	if len(errs) > 0 {
+		return nil, warnings, errors.Join(errs...)
+	}
+	return cfg, warnings, nil
+}
+
+func convertClientCommon(r *sectionReader, c *m.ClientCommonConfig) {
+	r.str("server_addr", &c.ServerAddr)
+	r.integer("server_port", &c.ServerPort)
+	r.str("user", &c.User)
+	r.str("dns_server", &c.DNSServer)
+	r.str("nat_hole_stun_server", &c.NatHoleSTUNServer)
+	r.boolPtr("login_fail_exit", &c.LoginFailExit)
+	r.list("start", &c.Start)
+	r.int64("udp_packet_size", &c.UDPPacketSize)
+	r.list("includes", &c.IncludeConfigFiles)
+	c.Metadatas = r.prefixed("meta_")
+
+	// auth
+	var method string
+	r.str("authentication_method", &method)
+	c.Auth.Method = m.AuthMethod(method)
+	r.str("token", &c.Auth.Token)
+	c.Auth.AdditionalScopes = convertAuthScopes(r)
+	r.str("oidc_client_id", &c.Auth.OIDC.ClientID)
+	r.str("oidc_client_secret", &c.Auth.OIDC.ClientSecret)
+	r.str("oidc_audience", &c.Auth.OIDC.Audience)
+	r.str("oidc_scope", &c.Auth.OIDC.Scope)
+	r.str("oidc_token_endpoint_url", &c.Auth.OIDC.TokenEndpointURL)
+	c.Auth.OIDC.AdditionalEndpointParams = r.prefixed("oidc_additional_")
+
+	// admin web server
+	r.str("admin_addr", &c.WebServer.Addr)
+	r.integer("admin_port", &c.WebServer.Port)
+	r.str("admin_user", &c.WebServer.User)
+	r.str("admin_pwd", &c.WebServer.Password)
+	r.str("assets_dir", &c.WebServer.AssetsDir)
+	r.boolean("pprof_enable", &c.WebServer.PprofEnable)
+
+	// transport
+	t := &c.Transport
+	r.str("protocol", &t.Protocol)
+	r.str("http_proxy", &t.ProxyURL)
+	r.int64("dial_server_timeout", &t.DialServerTimeout)
+	r.int64("dial_server_keepalive", &t.DialServerKeepAlive)
+	r.str("connect_server_local_ip", &t.ConnectServerLocalIP)
+	r.integer("pool_count", &t.PoolCount)
+	r.boolPtr("tcp_mux", &t.TCPMux)
+	r.int64("tcp_mux_keepalive_interval", &t.TCPMuxKeepaliveInterval)
+	r.int64("heartbeat_interval", &t.HeartbeatInterval)
+	r.int64("heartbeat_timeout", &t.HeartbeatTimeout)
+	r.integer("quic_keepalive_period", &t.QUIC.KeepalivePeriod)
+	r.integer("quic_max_idle_timeout", &t.QUIC.MaxIdleTimeout)
+	r.integer("quic_max_incoming_streams", &t.QUIC.MaxIncomingStreams)
+	r.boolPtr("tls_enable", &t.TLS.Enable)
+	r.boolPtr("disable_custom_tls_first_byte", &t.TLS.DisableCustomTLSFirstByte)
+	r.str("tls_cert_file", &t.TLS.CertFile)
+	r.str("tls_key_file", &t.TLS.KeyFile)
+	r.str("tls_trusted_ca_file", &t.TLS.TrustedCaFile)
+	r.str("tls_server_name", &t.TLS.ServerName)
+
+	convertLog(r, &c.Log)
+}
+
+func convertAuthScopes(r *sectionReader) []m.AuthScope {
+	var (
+		heartbeats   bool
+		newWorkConns bool
+		scopes       []m.AuthScope
+	)
+	r.boolean("authenticate_heartbeats", &heartbeats)
+	r.boolean("authenticate_new_work_conns", &newWorkConns)
+	if heartbeats {
+		scopes = append(scopes, m.AuthScopeHeartBeats)
+	}
+	if newWorkConns {
+		scopes = append(scopes, m.AuthScopeNewWorkConns)
+	}
+	return scopes
+}
+
+func convertLog(r *sectionReader, c *m.LogConfig) {
+	r.str("log_file", &c.To)
+	r.str("log_level", &c.Level)
+	r.int64("log_max_days", &c.MaxDays)
+	r.boolean("disable_log_color", &c.DisablePrintColor)
+}
+
+// expandRangeSection expands [range:name] to one proxy named name_N for each
+// local port. remote_port, if set, must have the same number of ports.
+func expandRangeSection(section *ini.Section, prefix string) ([]*sectionReader, error) {
+	base := newSectionReader(section)
+	localPortsStr, _ := base.get("local_port")
+	remotePortsStr, hasRemotePorts := base.get("remote_port")
+
+	localPorts, err := parsePorts(localPortsStr)
+	if err != nil {
+		return nil, fmt.Errorf("[%s] local_port: %v", section.Name(), err)
+	}
+	var remotePorts []int
+	if hasRemotePorts && remotePortsStr != "" {
+		remotePorts, err = parsePorts(remotePortsStr)
+		if err != nil {
+			return nil, fmt.Errorf("[%s] remote_port: %v", section.Name(), err)
+		}
+		if len(remotePorts) != len(localPorts) {
+			return nil, fmt.Errorf("[%s] local ports number should be same with remote ports number", section.Name())
+		}
+	}
+
+	readers := make([]*sectionReader, 0, len(localPorts))
+	for i, port := range localPorts {
+		r := newSectionReader(section)
+		r.name = prefix + "_" + strconv.Itoa(i)
+		r.overrides = map[string]string{"local_port": strconv.Itoa(port)}
+		if remotePorts != nil {
+			r.overrides["remote_port"] = strconv.Itoa(remotePorts[i])
+		}
+		readers = append(readers, r)
+	}
+	return readers, nil
+}
+
+func parsePorts(s string) ([]int, error) {
+	ranges, err := types.NewPortsRangeSliceFromString(s)
+	if err != nil {
+		return nil, err
+	}
+	var ports []int
+	for _, pr := range ranges {
+		if pr.Single > 0 {
+			ports = append(ports, pr.Single)
+			continue
+		}
+		for p := pr.Start; p <= pr.End; p++ {
+			ports = append(ports, p)
+		}
+	}
+	if len(ports) == 0 {
+		return nil, fmt.Errorf("no port is specified")
+	}
+	return ports, nil
+}
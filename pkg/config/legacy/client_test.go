@@ -0,0 +1,506 @@
+package legacy
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/samber/lo"
+	"gopkg.in/ini.v1"
+
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+	"github.com/gk7790/gk-zap/pkg/config/types"
+)
+
+func TestParseClientCommon(t *testing.T) {
+	content := `
+[common]
+server_addr = 10.0.0.1
+server_port = 7001
+user = alice
+login_fail_exit = false
+authentication_method = token
+token = abc
+authenticate_heartbeats = true
+authenticate_new_work_conns = true
+admin_addr = 127.0.0.1
+admin_port = 7400
+admin_user = admin
+admin_pwd = secret
+protocol = kcp
+tcp_mux = false
+pool_count = 5
+heartbeat_timeout = 90
+tls_enable
+tls_server_name = example.com
+log_file = ./gkc.log
+log_level = debug
+log_max_days = 7
+meta_env = prod
+includes = a.ini, b.ini
+start = ssh,web
+`
+	cfg, warnings, err := ParseClientConfig([]byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 0 {
+		t.Fatalf("unexpected warnings: %v", warnings)
+	}
+
+	c := cfg.ClientCommonConfig
+	checks := []struct {
+		name      string
+		got, want any
+	}{
+		{"serverAddr", c.ServerAddr, "10.0.0.1"},
+		{"serverPort", c.ServerPort, 7001},
+		{"user", c.User, "alice"},
+		{"loginFailExit", c.LoginFailExit, lo.ToPtr(false)},
+		{"auth.method", c.Auth.Method, m.AuthMethodToken},
+		{"auth.token", c.Auth.Token, "abc"},
+		{"auth.additionalScopes", c.Auth.AdditionalScopes, []m.AuthScope{m.AuthScopeHeartBeats, m.AuthScopeNewWorkConns}},
+		{"webServer.addr", c.WebServer.Addr, "127.0.0.1"},
+		{"webServer.port", c.WebServer.Port, 7400},
+		{"webServer.user", c.WebServer.User, "admin"},
+		{"webServer.password", c.WebServer.Password, "secret"},
+		{"transport.protocol", c.Transport.Protocol, "kcp"},
+		{"transport.tcpMux", c.Transport.TCPMux, lo.ToPtr(false)},
+		{"transport.poolCount", c.Transport.PoolCount, 5},
+		{"transport.heartbeatTimeout", c.Transport.HeartbeatTimeout, int64(90)},
+		// a key without a value is true
+		{"transport.tls.enable", c.Transport.TLS.Enable, lo.ToPtr(true)},
+		{"transport.tls.serverName", c.Transport.TLS.ServerName, "example.com"},
+		{"log.to", c.Log.To, "./gkc.log"},
+		{"log.level", c.Log.Level, "debug"},
+		{"log.maxDays", c.Log.MaxDays, int64(7)},
+		{"metadatas", c.Metadatas, map[string]string{"env": "prod"}},
+		{"includes", c.IncludeConfigFiles, []string{"a.ini", "b.ini"}},
+		{"start", c.Start, []string{"ssh", "web"}},
+	}
+	for _, check := range checks {
+		if !reflect.DeepEqual(check.got, check.want) {
+			t.Errorf("%s: got %#v, want %#v", check.name, check.got, check.want)
+		}
+	}
+}
+
+func TestParseClientProxies(t *testing.T) {
+	tests := []struct {
+		name    string
+		section string
+		want    m.ProxyConfigurer
+	}{
+		{
+			name: "tcp by default",
+			section: `[ssh]
+local_ip = 127.0.0.1
+local_port = 22
+remote_port = 6000
+use_encryption = true
+use_compression = true
+meta_owner = alice`,
+			want: &m.TCPProxyConfig{
+				ProxyBaseConfig: m.ProxyBaseConfig{
+					Name: "ssh", Type: "tcp",
+					Transport:    m.ProxyTransport{UseEncryption: true, UseCompression: true},
+					Metadatas:    map[string]string{"owner": "alice"},
+					ProxyBackend: m.ProxyBackend{LocalIP: "127.0.0.1", LocalPort: 22},
+				},
+				RemotePort: 6000,
+			},
+		},
+		{
+			name: "udp",
+			section: `[dns]
+type = udp
+local_port = 53
+remote_port = 6053`,
+			want: &m.UDPProxyConfig{
+				ProxyBaseConfig: m.ProxyBaseConfig{Name: "dns", Type: "udp", ProxyBackend: m.ProxyBackend{LocalPort: 53}},
+				RemotePort:      6053,
+			},
+		},
+		{
+			name: "http",
+			section: `[web]
+type = http
+local_port = 80
+custom_domains = a.example.com, b.example.com
+subdomain = web
+locations = /,/api
+http_user = u
+http_pwd = p
+host_header_rewrite = backend
+route_by_http_user = u
+header_X-From = gk`,
+			want: &m.HTTPProxyConfig{
+				ProxyBaseConfig: m.ProxyBaseConfig{Name: "web", Type: "http", ProxyBackend: m.ProxyBackend{LocalPort: 80}},
+				DomainConfig: m.DomainConfig{
+					CustomDomains: []string{"a.example.com", "b.example.com"},
+					SubDomain:     "web",
+				},
+				Locations:         []string{"/", "/api"},
+				HTTPUser:          "u",
+				HTTPPassword:      "p",
+				HostHeaderRewrite: "backend",
+				RouteByHTTPUser:   "u",
+				RequestHeaders:    m.HeaderOperations{Set: map[string]string{"X-From": "gk"}},
+			},
+		},
+		{
+			name: "https",
+			section: `[secure]
+type = https
+local_port = 443
+custom_domains = s.example.com`,
+			want: &m.HTTPSProxyConfig{
+				ProxyBaseConfig: m.ProxyBaseConfig{Name: "secure", Type: "https", ProxyBackend: m.ProxyBackend{LocalPort: 443}},
+				DomainConfig:    m.DomainConfig{CustomDomains: []string{"s.example.com"}},
+			},
+		},
+		{
+			name: "tcpmux",
+			section: `[mux]
+type = tcpmux
+local_port = 8080
+subdomain = mux
+multiplexer = httpconnect`,
+			want: &m.TCPMuxProxyConfig{
+				ProxyBaseConfig: m.ProxyBaseConfig{Name: "mux", Type: "tcpmux", ProxyBackend: m.ProxyBackend{LocalPort: 8080}},
+				DomainConfig:    m.DomainConfig{SubDomain: "mux"},
+				Multiplexer:     "httpconnect",
+			},
+		},
+		{
+			name: "stcp",
+			section: `[secret]
+type = stcp
+local_port = 22
+sk = abc
+allow_users = bob, carol`,
+			want: &m.STCPProxyConfig{
+				ProxyBaseConfig: m.ProxyBaseConfig{Name: "secret", Type: "stcp", ProxyBackend: m.ProxyBackend{LocalPort: 22}},
+				Secretkey:       "abc",
+				AllowUsers:      []string{"bob", "carol"},
+			},
+		},
+		{
+			name: "xtcp",
+			section: `[p2p]
+type = xtcp
+local_port = 22
+sk = abc`,
+			want: &m.XTCPProxyConfig{
+				ProxyBaseConfig: m.ProxyBaseConfig{Name: "p2p", Type: "xtcp", ProxyBackend: m.ProxyBackend{LocalPort: 22}},
+				Secretkey:       "abc",
+			},
+		},
+		{
+			name: "sudp",
+			section: `[sdns]
+type = sudp
+local_port = 53
+sk = abc
+allow_users = *`,
+			want: &m.SUDPProxyConfig{
+				ProxyBaseConfig: m.ProxyBaseConfig{Name: "sdns", Type: "sudp", ProxyBackend: m.ProxyBackend{LocalPort: 53}},
+				Secretkey:       "abc",
+				AllowUsers:      []string{"*"},
+			},
+		},
+		{
+			name: "https2http plugin",
+			section: `[plugin]
+type = https
+custom_domains = p.example.com
+plugin = https2http
+plugin_local_addr = 127.0.0.1:8080
+plugin_host_header_rewrite = backend
+plugin_crt_path = ./server.crt
+plugin_key_path = ./server.key
+plugin_header_X-From = gk`,
+			want: &m.HTTPSProxyConfig{
+				ProxyBaseConfig: m.ProxyBaseConfig{
+					Name: "plugin", Type: "https",
+					ProxyBackend: m.ProxyBackend{Plugin: m.TypedClientPluginOptions{
+						Type: m.PluginHTTPS2HTTP,
+						ClientPluginOptions: &m.HTTPS2HTTPPluginOptions{
+							Type:              m.PluginHTTPS2HTTP,
+							LocalAddr:         "127.0.0.1:8080",
+							HostHeaderRewrite: "backend",
+							RequestHeaders:    m.HeaderOperations{Set: map[string]string{"X-From": "gk"}},
+							TLSConfig:         m.TLSConfig{CertFile: "./server.crt", KeyFile: "./server.key"},
+						},
+					}},
+				},
+				DomainConfig: m.DomainConfig{CustomDomains: []string{"p.example.com"}},
+			},
+		},
+		{
+			name: "https2https plugin",
+			section: `[plugin]
+type = https
+custom_domains = p.example.com
+plugin = https2https
+plugin_local_addr = 127.0.0.1:8443`,
+			want: &m.HTTPSProxyConfig{
+				ProxyBaseConfig: m.ProxyBaseConfig{
+					Name: "plugin", Type: "https",
+					ProxyBackend: m.ProxyBackend{Plugin: m.TypedClientPluginOptions{
+						Type: m.PluginHTTPS2HTTPS,
+						ClientPluginOptions: &m.HTTPS2HTTPSPluginOptions{
+							Type:      m.PluginHTTPS2HTTPS,
+							LocalAddr: "127.0.0.1:8443",
+						},
+					}},
+				},
+				DomainConfig: m.DomainConfig{CustomDomains: []string{"p.example.com"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, warnings, err := ParseClientConfig([]byte("[common]\n" + tt.section))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(warnings) != 0 {
+				t.Fatalf("unexpected warnings: %v", warnings)
+			}
+			if len(cfg.Proxies) != 1 {
+				t.Fatalf("expected 1 proxy, got %d", len(cfg.Proxies))
+			}
+			got := cfg.Proxies[0]
+			if got.Type != tt.want.GetBaseConfig().Type {
+				t.Errorf("expected type %s, got %s", tt.want.GetBaseConfig().Type, got.Type)
+			}
+			if !reflect.DeepEqual(got.ProxyConfigurer, tt.want) {
+				t.Errorf("got %#v\nwant %#v", got.ProxyConfigurer, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseClientBandwidthLimit(t *testing.T) {
+	cfg, _, err := ParseClientConfig([]byte("[common]\n[ssh]\nlocal_port = 22\nbandwidth_limit = 1MB\nbandwidth_limit_mode = server\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := types.NewBandwidthQuantity("1MB")
+	transport := cfg.Proxies[0].GetBaseConfig().Transport
+	if transport.BandwidthLimit.String() != want.String() || transport.BandwidthLimitMode != "server" {
+		t.Fatalf("unexpected bandwidth limit %s mode %s", transport.BandwidthLimit.String(), transport.BandwidthLimitMode)
+	}
+}
+
+func TestParseClientVisitors(t *testing.T) {
+	tests := []struct {
+		name    string
+		section string
+		want    m.VisitorConfigurer
+	}{
+		{
+			name: "stcp",
+			section: `[secret_visitor]
+role = visitor
+type = stcp
+server_name = secret
+server_user = bob
+sk = abc
+bind_addr = 127.0.0.1
+bind_port = 9000
+use_encryption = true`,
+			want: &m.STCPVisitorConfig{VisitorBaseConfig: m.VisitorBaseConfig{
+				Name: "secret_visitor", Type: "stcp",
+				Transport:  m.VisitorTransport{UseEncryption: true},
+				SecretKey:  "abc",
+				ServerUser: "bob",
+				ServerName: "secret",
+				BindAddr:   "127.0.0.1",
+				BindPort:   9000,
+			}},
+		},
+		{
+			name: "sudp",
+			section: `[sdns_visitor]
+role = visitor
+type = sudp
+server_name = sdns
+bind_port = 9053`,
+			want: &m.SUDPVisitorConfig{VisitorBaseConfig: m.VisitorBaseConfig{
+				Name: "sdns_visitor", Type: "sudp", ServerName: "sdns", BindPort: 9053,
+			}},
+		},
+		{
+			name: "xtcp",
+			section: `[p2p_visitor]
+role = visitor
+type = xtcp
+server_name = p2p
+bind_port = 9001
+protocol = kcp
+keep_tunnel_open = true
+max_retries_an_hour = 4
+min_retry_interval = 60
+fallback_to = secret_visitor
+fallback_timeout_ms = 500`,
+			want: &m.XTCPVisitorConfig{
+				VisitorBaseConfig: m.VisitorBaseConfig{Name: "p2p_visitor", Type: "xtcp", ServerName: "p2p", BindPort: 9001},
+				Protocol:          "kcp",
+				KeepTunnelOpen:    true,
+				MaxRetriesAnHour:  4,
+				MinRetryInterval:  60,
+				FallbackTo:        "secret_visitor",
+				FallbackTimeoutMs: 500,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, warnings, err := ParseClientConfig([]byte("[common]\n" + tt.section))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(warnings) != 0 {
+				t.Fatalf("unexpected warnings: %v", warnings)
+			}
+			if len(cfg.Visitors) != 1 || len(cfg.Proxies) != 0 {
+				t.Fatalf("expected 1 visitor and no proxy, got %d and %d", len(cfg.Visitors), len(cfg.Proxies))
+			}
+			if !reflect.DeepEqual(cfg.Visitors[0].VisitorConfigurer, tt.want) {
+				t.Errorf("got %#v\nwant %#v", cfg.Visitors[0].VisitorConfigurer, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseClientRangeSection(t *testing.T) {
+	content := `[common]
+[range:game]
+type = udp
+local_port = 6000-6002,6010
+remote_port = 7000-7003
+`
+	cfg, _, err := ParseClientConfig([]byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		name       string
+		localPort  int
+		remotePort int
+	}{
+		{"game_0", 6000, 7000},
+		{"game_1", 6001, 7001},
+		{"game_2", 6002, 7002},
+		{"game_3", 6010, 7003},
+	}
+	if len(cfg.Proxies) != len(want) {
+		t.Fatalf("expected %d proxies, got %d", len(want), len(cfg.Proxies))
+	}
+	for i, w := range want {
+		p, ok := cfg.Proxies[i].ProxyConfigurer.(*m.UDPProxyConfig)
+		if !ok {
+			t.Fatalf("proxy %d: expected udp, got %T", i, cfg.Proxies[i].ProxyConfigurer)
+		}
+		if p.Name != w.name || p.LocalPort != w.localPort || p.RemotePort != w.remotePort {
+			t.Errorf("proxy %d: got %s %d->%d, want %s %d->%d", i, p.Name, p.LocalPort, p.RemotePort, w.name, w.localPort, w.remotePort)
+		}
+	}
+
+	// the remote ports are optional
+	cfg, _, err = ParseClientConfig([]byte("[common]\n[range:web]\nlocal_port = 80,81\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Proxies) != 2 || cfg.Proxies[1].ProxyConfigurer.(*m.TCPProxyConfig).RemotePort != 0 {
+		t.Fatalf("unexpected proxies %#v", cfg.Proxies)
+	}
+}
+
+func TestParseClientWarnings(t *testing.T) {
+	content := `[common]
+server_addr = 10.0.0.1
+dashboard_port = 7500
+[range:web]
+local_port = 80-81
+unknown_key = 1
+[ssh]
+local_port = 22
+plugin_unix_path = /tmp/x
+`
+	_, warnings, err := ParseClientConfig([]byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the unsupported keys of a range section are reported once, with the
+	// name of the first proxy
+	want := []string{
+		"[common] dashboard_port is not supported and ignored",
+		"[ssh] plugin_unix_path is not supported and ignored",
+		"[web_0] unknown_key is not supported and ignored",
+	}
+	if !reflect.DeepEqual(warnings, want) {
+		t.Fatalf("got warnings %q\nwant %q", warnings, want)
+	}
+}
+
+func TestParseClientErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr []string
+	}{
+		{"no common section", "[ssh]\nlocal_port = 22\n", []string{"not found [common] section"}},
+		{"bad integer", "[common]\nserver_port = abc\n", []string{"[common] server_port"}},
+		{"bad bool", "[common]\nlogin_fail_exit = maybe\n", []string{"[common] login_fail_exit"}},
+		{"unsupported proxy type", "[common]\n[x]\ntype = ftp\n", []string{`[x] type: unsupported proxy type "ftp"`}},
+		{"unsupported visitor type", "[common]\n[x]\nrole = visitor\ntype = ftp\n", []string{`[x] type: unsupported visitor type "ftp"`}},
+		{"unsupported plugin", "[common]\n[x]\nplugin = socks5\n", []string{`[x] plugin: unsupported plugin "socks5"`}},
+		{"bad bandwidth limit", "[common]\n[x]\nbandwidth_limit = fast\n", []string{"[x] bandwidth_limit"}},
+		{"range without ports", "[common]\n[range:x]\ntype = tcp\n", []string{"[range:x] local_port"}},
+		{
+			"range with other number of remote ports", "[common]\n[range:x]\nlocal_port = 1-3\nremote_port = 1-2\n",
+			[]string{"[range:x] local ports number should be same with remote ports number"},
+		},
+		{
+			// all errors are reported, not only the first one
+			"several errors", "[common]\nserver_port = abc\n[x]\ntype = ftp\n[y]\nlocal_port = z\n",
+			[]string{"[common] server_port", "[x] type", "[y] local_port"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := ParseClientConfig([]byte(tt.content))
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("expected error containing %q, got %v", want, err)
+				}
+			}
+		})
+	}
+}
+
+func TestConvertProxyBadBandwidthLimit(t *testing.T) {
+	f, err := ini.Load([]byte("[x]\nbandwidth_limit = fast\nlocal_port = 22\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newSectionReader(f.Section("x"))
+	c, err := convertProxy(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.errs) != 1 {
+		t.Fatalf("expected the bandwidth_limit error, got %v", r.errs)
+	}
+	// the invalid value isn't assigned, the other fields still are
+	base := c.GetBaseConfig()
+	if base.Transport.BandwidthLimit != (types.BandwidthQuantity{}) || base.LocalPort != 22 {
+		t.Fatalf("unexpected bandwidth limit %s and local port %d", base.Transport.BandwidthLimit.String(), base.LocalPort)
+	}
+}
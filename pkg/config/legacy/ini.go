@@ -0,0 +1,143 @@
+package legacy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/ini.v1"
+)
+
+func loadINI(content []byte) (*ini.File, error) {
+	return ini.LoadSources(ini.LoadOptions{
+		Insensitive:         false,
+		InsensitiveSections: false,
+		InsensitiveKeys:     false,
+		IgnoreInlineComment: true,
+		AllowBooleanKeys:    true,
+	}, content)
+}
+
+// sectionReader reads typed values from an INI section. It remembers which
+// keys are read, so that the unsupported ones can be reported, and collects
+// errors instead of stopping at the first one.
+type sectionReader struct {
+	name      string
+	values    map[string]string
+	read      map[string]struct{}
+	errs      []error
+	overrides map[string]string
+}
+
+func newSectionReader(s *ini.Section) *sectionReader {
+	return &sectionReader{
+		name:   s.Name(),
+		values: s.KeysHash(),
+		read:   make(map[string]struct{}),
+	}
+}
+
+func (r *sectionReader) get(key string) (string, bool) {
+	r.read[key] = struct{}{}
+	if v, ok := r.overrides[key]; ok {
+		return v, true
+	}
+	v, ok := r.values[key]
+	return strings.TrimSpace(v), ok
+}
+
+func (r *sectionReader) addError(key string, err error) {
+	r.errs = append(r.errs, fmt.Errorf("[%s] %s: %v", r.name, key, err))
+}
+
+func (r *sectionReader) str(key string, dst *string) {
+	if v, ok := r.get(key); ok {
+		*dst = v
+	}
+}
+
+func (r *sectionReader) integer(key string, dst *int) {
+	if v, ok := r.get(key); ok && v != "" {
+		i, err := strconv.Atoi(v)
+		if err != nil {
+			r.addError(key, err)
+			return
+		}
+		*dst = i
+	}
+}
+
+func (r *sectionReader) int64(key string, dst *int64) {
+	if v, ok := r.get(key); ok && v != "" {
+		i, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			r.addError(key, err)
+			return
+		}
+		*dst = i
+	}
+}
+
+func (r *sectionReader) boolean(key string, dst *bool) {
+	if v, ok := r.get(key); ok {
+		// a key without value, like "tls_enable", means true
+		if v == "" {
+			*dst = true
+			return
+		}
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			r.addError(key, err)
+			return
+		}
+		*dst = b
+	}
+}
+
+func (r *sectionReader) boolPtr(key string, dst **bool) {
+	if _, ok := r.get(key); ok {
+		var b bool
+		r.boolean(key, &b)
+		*dst = &b
+	}
+}
+
+// list reads a comma separated list.
+func (r *sectionReader) list(key string, dst *[]string) {
+	if v, ok := r.get(key); ok && v != "" {
+		out := make([]string, 0)
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				out = append(out, item)
+			}
+		}
+		*dst = out
+	}
+}
+
+// prefixed returns all keys starting with prefix, with prefix trimmed.
+func (r *sectionReader) prefixed(prefix string) map[string]string {
+	var out map[string]string
+	for k := range r.values {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		if out == nil {
+			out = make(map[string]string)
+		}
+		v, _ := r.get(k)
+		out[strings.TrimPrefix(k, prefix)] = v
+	}
+	return out
+}
+
+// unused returns a warning for each key that has not been read.
+func (r *sectionReader) unused() []string {
+	var warnings []string
+	for k := range r.values {
+		if _, ok := r.read[k]; !ok {
+			warnings = append(warnings, fmt.Sprintf("[%s] %s is not supported and ignored", r.name, k))
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,107 @@
+package legacy
+
+import (
+	"fmt"
+
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+	"github.com/gk7790/gk-zap/pkg/config/types"
+)
+
+func convertProxy(r *sectionReader) (m.ProxyConfigurer, error) {
+	proxyType := string(m.ProxyTypeTCP)
+	r.str("type", &proxyType)
+	c := m.NewProxyConfigurerByType(m.ProxyType(proxyType))
+	if c == nil {
+		return nil, fmt.Errorf("[%s] type: unsupported proxy type %q", r.name, proxyType)
+	}
+
+	base := c.GetBaseConfig()
+	base.Name = r.name
+	r.str("local_ip", &base.LocalIP)
+	r.integer("local_port", &base.LocalPort)
+	r.boolean("use_encryption", &base.Transport.UseEncryption)
+	r.boolean("use_compression", &base.Transport.UseCompression)
+	r.str("bandwidth_limit_mode", &base.Transport.BandwidthLimitMode)
+	var bandwidthLimit string
+	r.str("bandwidth_limit", &bandwidthLimit)
+	if bandwidthLimit != "" {
+		if q, err := types.NewBandwidthQuantity(bandwidthLimit); err != nil {
+			r.addError("bandwidth_limit", err)
+		} else {
+			base.Transport.BandwidthLimit = q
+		}
+	}
+	base.Metadatas = r.prefixed("meta_")
+	if err := convertPlugin(r, &base.Plugin); err != nil {
+		return nil, err
+	}
+
+	switch v := c.(type) {
+	case *m.TCPProxyConfig:
+		r.integer("remote_port", &v.RemotePort)
+	case *m.UDPProxyConfig:
+		r.integer("remote_port", &v.RemotePort)
+	case *m.HTTPProxyConfig:
+		convertDomainConfig(r, &v.DomainConfig)
+		r.list("locations", &v.Locations)
+		r.str("http_user", &v.HTTPUser)
+		r.str("http_pwd", &v.HTTPPassword)
+		r.str("host_header_rewrite", &v.HostHeaderRewrite)
+		r.str("route_by_http_user", &v.RouteByHTTPUser)
+		v.RequestHeaders.Set = r.prefixed("header_")
+	case *m.HTTPSProxyConfig:
+		convertDomainConfig(r, &v.DomainConfig)
+	case *m.TCPMuxProxyConfig:
+		convertDomainConfig(r, &v.DomainConfig)
+		r.str("multiplexer", &v.Multiplexer)
+		r.str("http_user", &v.HTTPUser)
+		r.str("http_pwd", &v.HTTPPassword)
+		r.str("route_by_http_user", &v.RouteByHTTPUser)
+	case *m.STCPProxyConfig:
+		r.str("sk", &v.Secretkey)
+		r.list("allow_users", &v.AllowUsers)
+	case *m.XTCPProxyConfig:
+		r.str("sk", &v.Secretkey)
+		r.list("allow_users", &v.AllowUsers)
+	case *m.SUDPProxyConfig:
+		r.str("sk", &v.Secretkey)
+		r.list("allow_users", &v.AllowUsers)
+	}
+	return c, nil
+}
+
+func convertDomainConfig(r *sectionReader, c *m.DomainConfig) {
+	r.list("custom_domains", &c.CustomDomains)
+	r.str("subdomain", &c.SubDomain)
+}
+
+func convertPlugin(r *sectionReader, c *m.TypedClientPluginOptions) error {
+	var pluginType string
+	r.str("plugin", &pluginType)
+	if pluginType == "" {
+		return nil
+	}
+
+	switch pluginType {
+	case m.PluginHTTPS2HTTP:
+		o := &m.HTTPS2HTTPPluginOptions{Type: pluginType}
+		r.str("plugin_local_addr", &o.LocalAddr)
+		r.str("plugin_host_header_rewrite", &o.HostHeaderRewrite)
+		r.str("plugin_crt_path", &o.CertFile)
+		r.str("plugin_key_path", &o.KeyFile)
+		o.RequestHeaders.Set = r.prefixed("plugin_header_")
+		c.ClientPluginOptions = o
+	case m.PluginHTTPS2HTTPS:
+		o := &m.HTTPS2HTTPSPluginOptions{Type: pluginType}
+		r.str("plugin_local_addr", &o.LocalAddr)
+		r.str("plugin_host_header_rewrite", &o.HostHeaderRewrite)
+		r.str("plugin_crt_path", &o.CertFile)
+		r.str("plugin_key_path", &o.KeyFile)
+		o.RequestHeaders.Set = r.prefixed("plugin_header_")
+		c.ClientPluginOptions = o
+	default:
+		return fmt.Errorf("[%s] plugin: unsupported plugin %q", r.name, pluginType)
+	}
+	c.Type = pluginType
+	return nil
+}
@@ -0,0 +1,122 @@
+package legacy
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+	"github.com/gk7790/gk-zap/pkg/config/types"
+)
+
+// ParseServerConfig parses a legacy frps style INI config: the [common]
+// section and a [plugin.name] section for each HTTP plugin. Keys that have
+// no counterpart in the model are returned as warnings.
+func ParseServerConfig(content []byte) (*m.ServerConfig, []string, error) {
+	f, err := loadINI(content)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	common, err := f.GetSection("common")
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid configuration file, not found [common] section")
+	}
+
+	cfg := &m.ServerConfig{}
+	r := newSectionReader(common)
+	convertServerCommon(r, cfg)
+	warnings := r.unused()
+	errs := r.errs
+
+	for _, section := range f.Sections() {
+		name, ok := strings.CutPrefix(section.Name(), "plugin.")
+		if !ok {
+			continue
+		}
+		r := newSectionReader(section)
+		p := m.HTTPPluginOptions{Name: name}
+		r.str("addr", &p.Addr)
+		r.str("path", &p.Path)
+		r.list("ops", &p.Ops)
+		r.boolean("tls_verify", &p.TLSVerify)
+		cfg.HTTPPlugins = append(cfg.HTTPPlugins, p)
+		warnings = append(warnings, r.unused()...)
+		errs = append(errs, r.errs...)
+	}
+
+	slices.Sort(warnings)
+	if len(errs) > 0 {
+		return nil, warnings, errors.Join(errs...)
+	}
+	return cfg, warnings, nil
+}
+
+func convertServerCommon(r *sectionReader, c *m.ServerConfig) {
+	r.str("bind_addr", &c.BindAddr)
+	r.integer("bind_port", &c.BindPort)
+	r.integer("kcp_bind_port", &c.KCPBindPort)
+	r.integer("quic_bind_port", &c.QUICBindPort)
+	r.str("proxy_bind_addr", &c.ProxyBindAddr)
+	r.integer("vhost_http_port", &c.VhostHTTPPort)
+	r.int64("vhost_http_timeout", &c.VhostHTTPTimeout)
+	r.integer("vhost_https_port", &c.VhostHTTPSPort)
+	r.integer("tcpmux_httpconnect_port", &c.TCPMuxHTTPConnectPort)
+	r.boolean("tcpmux_passthrough", &c.TCPMuxPassthrough)
+	r.str("subdomain_host", &c.SubDomainHost)
+	r.str("custom_404_page", &c.Custom404Page)
+	r.boolean("enable_prometheus", &c.EnablePrometheus)
+	r.boolPtr("detailed_errors_to_client", &c.DetailedErrorsToClient)
+	r.int64("max_ports_per_client", &c.MaxPortsPerClient)
+	if v, ok := r.get("allow_ports"); ok && v != "" {
+		ports, err := types.NewPortsRangeSliceFromString(v)
+		if err != nil {
+			r.addError("allow_ports", err)
+		} else {
+			c.AllowPorts = ports
+		}
+	}
+	r.int64("user_conn_timeout", &c.UserConnTimeout)
+	r.int64("udp_packet_size", &c.UDPPacketSize)
+	r.int64("nat_hole_analysis_data_reserve_hours", &c.NatHoleAnalysisDataReserveHours)
+
+	// auth
+	var method string
+	r.str("authentication_method", &method)
+	c.Auth.Method = m.AuthMethod(method)
+	r.str("token", &c.Auth.Token)
+	c.Auth.AdditionalScopes = convertAuthScopes(r)
+	r.str("oidc_issuer", &c.Auth.OIDC.Issuer)
+	r.str("oidc_audience", &c.Auth.OIDC.Audience)
+	r.boolean("oidc_skip_expiry_check", &c.Auth.OIDC.SkipExpiryCheck)
+	r.boolean("oidc_skip_issuer_check", &c.Auth.OIDC.SkipIssuerCheck)
+
+	// dashboard
+	r.str("dashboard_addr", &c.WebServer.Addr)
+	r.integer("dashboard_port", &c.WebServer.Port)
+	r.str("dashboard_user", &c.WebServer.User)
+	r.str("dashboard_pwd", &c.WebServer.Password)
+	r.str("assets_dir", &c.WebServer.AssetsDir)
+	var dashboardTLS bool
+	r.boolean("dashboard_tls_mode", &dashboardTLS)
+	if dashboardTLS {
+		c.WebServer.TLS = &m.TLSConfig{}
+		r.str("dashboard_tls_cert_file", &c.WebServer.TLS.CertFile)
+		r.str("dashboard_tls_key_file", &c.WebServer.TLS.KeyFile)
+	}
+
+	// transport
+	t := &c.Transport
+	r.boolPtr("tcp_mux", &t.TCPMux)
+	r.int64("tcp_mux_keepalive_interval", &t.TCPMuxKeepaliveInterval)
+	r.int64("tcp_keepalive", &t.TCPKeepAlive)
+	r.int64("max_pool_count", &t.MaxPoolCount)
+	r.int64("heartbeat_timeout", &t.HeartbeatTimeout)
+	r.boolean("tls_only", &t.TLS.Force)
+	r.str("tls_cert_file", &t.TLS.CertFile)
+	r.str("tls_key_file", &t.TLS.KeyFile)
+	r.str("tls_trusted_ca_file", &t.TLS.TrustedCaFile)
+
+	convertLog(r, &c.Log)
+}
@@ -0,0 +1,73 @@
+package legacy
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+	"github.com/gk7790/gk-zap/pkg/config/types"
+)
+
+func TestParseServerConfig(t *testing.T) {
+	content := `[common]
+bind_port = 7001
+vhost_http_port = 80
+authentication_method = token
+token = abc
+authenticate_heartbeats = true
+allow_ports = 2000-3000,3001
+max_ports_per_client = 10
+dashboard_port = 7500
+dashboard_tls_mode = true
+dashboard_tls_cert_file = ./d.crt
+dashboard_tls_key_file = ./d.key
+tls_only = true
+log_level = warn
+kcp_bind_port = 7001
+unknown_key = 1
+
+[plugin.audit]
+addr = 127.0.0.1:9000
+path = /handler
+ops = Login,NewProxy
+tls_verify = true
+`
+	cfg, warnings, err := ParseServerConfig([]byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"[common] unknown_key is not supported and ignored"}; !reflect.DeepEqual(warnings, want) {
+		t.Fatalf("got warnings %q, want %q", warnings, want)
+	}
+
+	checks := []struct {
+		name      string
+		got, want any
+	}{
+		{"bindPort", cfg.BindPort, 7001},
+		{"kcpBindPort", cfg.KCPBindPort, 7001},
+		{"vhostHTTPPort", cfg.VhostHTTPPort, 80},
+		{"auth.method", cfg.Auth.Method, m.AuthMethodToken},
+		{"auth.token", cfg.Auth.Token, "abc"},
+		{"auth.additionalScopes", cfg.Auth.AdditionalScopes, []m.AuthScope{m.AuthScopeHeartBeats}},
+		{"allowPorts", cfg.AllowPorts, []types.PortsRange{{Start: 2000, End: 3000}, {Single: 3001}}},
+		{"maxPortsPerClient", cfg.MaxPortsPerClient, int64(10)},
+		{"webServer.port", cfg.WebServer.Port, 7500},
+		{"webServer.tls", cfg.WebServer.TLS, &m.TLSConfig{CertFile: "./d.crt", KeyFile: "./d.key"}},
+		{"transport.tls.force", cfg.Transport.TLS.Force, true},
+		{"log.level", cfg.Log.Level, "warn"},
+		{"httpPlugins", cfg.HTTPPlugins, []m.HTTPPluginOptions{{
+			Name: "audit", Addr: "127.0.0.1:9000", Path: "/handler", Ops: []string{"Login", "NewProxy"}, TLSVerify: true,
+		}}},
+	}
+	for _, check := range checks {
+		if !reflect.DeepEqual(check.got, check.want) {
+			t.Errorf("%s: got %#v, want %#v", check.name, check.got, check.want)
+		}
+	}
+
+	if _, _, err := ParseServerConfig([]byte("[common]\nallow_ports = a-b\n")); err == nil || !strings.Contains(err.Error(), "[common] allow_ports") {
+		t.Fatalf("expected allow_ports error, got %v", err)
+	}
+}
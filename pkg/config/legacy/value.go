@@ -1,10 +1,10 @@
 package legacy
 
 import (
-	"bytes"
 	"os"
 	"strings"
-	"text/template"
+
+	"github.com/gk7790/gk-zap/pkg/config/render"
 )
 
 var glbEnvs map[string]string
@@ -32,20 +32,7 @@ func GetValues() *Values {
 }
 
 func RenderContent(in []byte) (out []byte, err error) {
-	tmpl, errRet := template.New("frp").Parse(string(in))
-	if errRet != nil {
-		err = errRet
-		return
-	}
-
-	buffer := bytes.NewBufferString("")
-	v := GetValues()
-	err = tmpl.Execute(buffer, v)
-	if err != nil {
-		return
-	}
-	out = buffer.Bytes()
-	return
+	return render.Execute("frp", in, GetValues())
 }
 
 func GetRenderedConfFromFile(path string) (out []byte, err error) {
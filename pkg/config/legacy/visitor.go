@@ -0,0 +1,36 @@
+package legacy
+
+import (
+	"fmt"
+
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+)
+
+func convertVisitor(r *sectionReader) (m.VisitorConfigurer, error) {
+	var visitorType string
+	r.str("type", &visitorType)
+	c := m.NewVisitorConfigurerByType(m.VisitorType(visitorType))
+	if c == nil {
+		return nil, fmt.Errorf("[%s] type: unsupported visitor type %q", r.name, visitorType)
+	}
+
+	base := c.GetBaseConfig()
+	base.Name = r.name
+	r.boolean("use_encryption", &base.Transport.UseEncryption)
+	r.boolean("use_compression", &base.Transport.UseCompression)
+	r.str("sk", &base.SecretKey)
+	r.str("server_user", &base.ServerUser)
+	r.str("server_name", &base.ServerName)
+	r.str("bind_addr", &base.BindAddr)
+	r.integer("bind_port", &base.BindPort)
+
+	if v, ok := c.(*m.XTCPVisitorConfig); ok {
+		r.str("protocol", &v.Protocol)
+		r.boolean("keep_tunnel_open", &v.KeepTunnelOpen)
+		r.integer("max_retries_an_hour", &v.MaxRetriesAnHour)
+		r.integer("min_retry_interval", &v.MinRetryInterval)
+		r.str("fallback_to", &v.FallbackTo)
+		r.integer("fallback_timeout_ms", &v.FallbackTimeoutMs)
+	}
+	return c, nil
+}
@@ -2,13 +2,17 @@ package config
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
-	"text/template"
 
 	m1 "github.com/gk7790/gk-zap/pkg/config/model"
+	"github.com/gk7790/gk-zap/pkg/config/render"
+	"github.com/samber/lo"
 	"gopkg.in/yaml.v3"
 )
 
@@ -32,57 +36,294 @@ func GetValues() *Values {
 	return &Values{Envs: glbEnvs}
 }
 
-// RenderWithTemplate Render YAML template with environment values
+// RenderWithTemplate Render config template with environment values and the
+// functions of the render package
 func RenderWithTemplate(in []byte, values *Values) ([]byte, error) {
-	tmpl, err := template.New("yaml").Parse(string(in))
+	return render.Execute("yaml", in, values)
+}
+
+// LoadServerConfig loads the server config file at path and completes it.
+// The format is detected by the file extension (.yaml, .yml, .json or
+// .toml). If strict is true, unknown fields cause an error naming their key
+// path. If path is empty, the config only comes from env and flags.
+func LoadServerConfig(path string, strict bool) (*m1.ServerConfig, error) {
+	cfg := &m1.ServerConfig{}
+	if path != "" {
+		f, err := readConfigFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := f.decode("", f.json, cfg, strict); err != nil {
+			return nil, err
+		}
+	}
+	if err := ApplyOverrides(cfg, ServerEnvPrefix, ServerFlagOverrides); err != nil {
+		return nil, err
+	}
+
+	// 调用 Complete() 补全默认项
+	if err := cfg.Complete(); err != nil {
+		return nil, fmt.Errorf("failed to complete config: %w", err)
+	}
+	return cfg, nil
+}
+
+// LoadUsersConfig loads the users file of the server at path, the format is
+// detected like LoadServerConfig does.
+func LoadUsersConfig(path string, strict bool) (*m1.UsersConfig, error) {
+	f, err := readConfigFile(path)
 	if err != nil {
 		return nil, err
 	}
+	c := &m1.UsersConfig{}
+	if err := f.decode("", f.json, c, strict); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
 
-	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, values); err != nil {
+// LoadPolicyConfig loads the policy file of the server at path, the format is
+// detected like LoadServerConfig does.
+func LoadPolicyConfig(path string, strict bool) (*m1.PolicyConfig, error) {
+	f, err := readConfigFile(path)
+	if err != nil {
 		return nil, err
 	}
-	return buf.Bytes(), nil
+	c := &m1.PolicyConfig{}
+	if err := f.decode("", f.json, c, strict); err != nil {
+		return nil, err
+	}
+	c.Complete()
+	return c, nil
 }
 
-func LoadYamlServerConfig(cfgPath string) (*m1.ServerConfig, error) {
-	ext := filepath.Ext(cfgPath)
-	if ext != ".yaml" && ext != ".yml" {
-		return nil, fmt.Errorf("only .yaml/.yml config files are supported, got: %s", ext)
+// LoadFileContentWithTemplate reads the file at path and renders it as a
+// template with env values.
+func LoadFileContentWithTemplate(path string) ([]byte, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return RenderWithTemplate(b, GetValues())
+}
+
+// yamlToJSON converts YAML content to JSON so that it can be decoded through
+// the json tags and custom UnmarshalJSON methods of the config model.
+func yamlToJSON(in []byte) ([]byte, error) {
+	var v any
+	if err := yaml.Unmarshal(in, &v); err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return []byte("{}"), nil
 	}
-	file, err := os.ReadFile(cfgPath)
+	return json.Marshal(v)
+}
+
+// LoadConfigure decodes YAML or JSON content b into c. If strict is true,
+// unknown fields cause an error.
+func LoadConfigure(b []byte, c any, strict bool) error {
+	jsonBytes, err := yamlToJSON(b)
+	if err != nil {
+		return err
+	}
+	return decodeJSON(jsonBytes, c, strict)
+}
+
+func decodeJSON(b []byte, c any, strict bool) error {
+	m1.DisallowUnknownFieldsMu.Lock()
+	defer m1.DisallowUnknownFieldsMu.Unlock()
+	m1.DisallowUnknownFields = strict
+
+	decoder := json.NewDecoder(bytes.NewBuffer(b))
+	if strict {
+		decoder.DisallowUnknownFields()
+	}
+	return decoder.Decode(c)
+}
+
+// configFile is a rendered config file converted to JSON, it remembers where
+// every key is defined to report errors with file and line.
+type configFile struct {
+	path  string
+	json  []byte
+	lines sourceLines
+}
+
+func readConfigFile(path string) (*configFile, error) {
+	content, err := LoadFileContentWithTemplate(path)
 	if err != nil {
 		return nil, fmt.Errorf("cannot read config file: %w", err)
 	}
+	format := detectFormat(path)
+	jsonBytes, err := toJSON(content, format)
+	if err != nil {
+		return nil, parseErrorWithLine(path, content, err)
+	}
+	return &configFile{
+		path:  path,
+		json:  jsonBytes,
+		lines: buildSourceLines(content, format),
+	}, nil
+}
 
-	var cfg m1.ServerConfig
-	if err := yaml.Unmarshal(file, &cfg); err != nil {
-		return nil, fmt.Errorf("invalid YAML config: %w", err)
+// decode decodes b, the JSON of the element at keyPath, into c.
+func (f *configFile) decode(keyPath string, b []byte, c any, strict bool) error {
+	if strict {
+		if err := f.checkUnknownFields(keyPath, b, reflect.TypeOf(c)); err != nil {
+			return err
+		}
 	}
+	if err := decodeJSON(b, c, strict); err != nil {
+		return decodeErrorWithLine(f.path, f.lines, keyPath, err)
+	}
+	return nil
+}
 
-	// 调用 Complete() 补全默认项
-	if err := cfg.Complete(); err != nil {
-		return nil, fmt.Errorf("failed to complete config: %w", err)
+// rawClientConfig keeps proxies and visitors undecoded, so that they can be
+// decoded one by one and errors point to the exact element.
+type rawClientConfig struct {
+	m1.ClientCommonConfig
+
+	Proxies  []json.RawMessage `json:"proxies,omitempty"`
+	Visitors []json.RawMessage `json:"visitors,omitempty"`
+}
+
+func (f *configFile) decodeClientConfig(strict bool) (
+	*m1.ClientCommonConfig,
+	[]m1.ProxyConfigurer,
+	[]m1.VisitorConfigurer,
+	error,
+) {
+	raw := rawClientConfig{}
+	if err := f.decode("", f.json, &raw, strict); err != nil {
+		return nil, nil, nil, err
 	}
 
-	return &cfg, nil
+	// report errors of all proxies and visitors at once
+	var errs []error
+	proxyCfgs := make([]m1.ProxyConfigurer, 0, len(raw.Proxies))
+	for i, b := range raw.Proxies {
+		c := m1.TypedProxyConfig{}
+		if err := f.decode(fmt.Sprintf("proxies[%d]", i), b, &c, strict); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		proxyCfgs = append(proxyCfgs, c.ProxyConfigurer)
+	}
+	visitorCfgs := make([]m1.VisitorConfigurer, 0, len(raw.Visitors))
+	for i, b := range raw.Visitors {
+		c := m1.TypedVisitorConfig{}
+		if err := f.decode(fmt.Sprintf("visitors[%d]", i), b, &c, strict); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		visitorCfgs = append(visitorCfgs, c.VisitorConfigurer)
+	}
+	if len(errs) > 0 {
+		return nil, nil, nil, errors.Join(errs...)
+	}
+	return &raw.ClientCommonConfig, proxyCfgs, visitorCfgs, nil
 }
 
-// LoadYAMLFile Load YAML file and render template
-func LoadYAMLFile(path string) ([]byte, error) {
-	b, err := os.ReadFile(path)
+// LoadClientConfig loads the client config file at path and completes the
+// common config and all proxy and visitor configs. The format is detected by
+// the file extension (.yaml, .yml, .json or .toml). Proxies and visitors in
+// the files matched by "includes" are merged. Only proxies and visitors
+// listed in "start" are returned if it is not empty.
+func LoadClientConfig(path string, strict bool) (
+	*m1.ClientCommonConfig,
+	[]m1.ProxyConfigurer,
+	[]m1.VisitorConfigurer,
+	error,
+) {
+	f, err := readConfigFile(path)
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
-	return RenderWithTemplate(b, GetValues())
+	cliCfg, proxyCfgs, visitorCfgs, err := f.decodeClientConfig(strict)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if err := ApplyOverrides(cliCfg, ClientEnvPrefix, ClientFlagOverrides); err != nil {
+		return nil, nil, nil, err
+	}
+
+	// Load additional config files which only contain proxies and visitors.
+	if len(cliCfg.IncludeConfigFiles) > 0 {
+		extProxyCfgs, extVisitorCfgs, err := LoadAdditionalClientConfigs(resolveIncludePaths(path, cliCfg.IncludeConfigFiles), strict)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		proxyCfgs = append(proxyCfgs, extProxyCfgs...)
+		visitorCfgs = append(visitorCfgs, extVisitorCfgs...)
+	}
+
+	if len(cliCfg.Start) > 0 {
+		startSet := lo.SliceToMap(cliCfg.Start, func(name string) (string, struct{}) {
+			return name, struct{}{}
+		})
+		proxyCfgs = lo.Filter(proxyCfgs, func(c m1.ProxyConfigurer, _ int) bool {
+			_, ok := startSet[c.GetBaseConfig().Name]
+			return ok
+		})
+		visitorCfgs = lo.Filter(visitorCfgs, func(c m1.VisitorConfigurer, _ int) bool {
+			_, ok := startSet[c.GetBaseConfig().Name]
+			return ok
+		})
+	}
+
+	if err := cliCfg.Complete(); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to complete config: %w", err)
+	}
+	for _, c := range proxyCfgs {
+		c.Complete(cliCfg)
+	}
+	for _, c := range visitorCfgs {
+		c.Complete(cliCfg)
+	}
+	return cliCfg, proxyCfgs, visitorCfgs, nil
 }
 
-// LoadYAML Unmarshal YAML content into target struct
-func LoadYAML(path string, out any) error {
-	b, err := LoadYAMLFile(path)
-	if err != nil {
-		return err
+// resolveIncludePaths makes relative include patterns relative to the
+// directory of the main config file.
+func resolveIncludePaths(cfgPath string, includes []string) []string {
+	dir := filepath.Dir(cfgPath)
+	return lo.Map(includes, func(p string, _ int) string {
+		if filepath.IsAbs(p) {
+			return p
+		}
+		return filepath.Join(dir, p)
+	})
+}
+
+// LoadAdditionalClientConfigs loads proxies and visitors from the files
+// matched by the glob patterns in paths. Other fields in these files are
+// ignored.
+func LoadAdditionalClientConfigs(paths []string, strict bool) ([]m1.ProxyConfigurer, []m1.VisitorConfigurer, error) {
+	proxyCfgs := make([]m1.ProxyConfigurer, 0)
+	visitorCfgs := make([]m1.VisitorConfigurer, 0)
+	for _, pattern := range paths {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid include pattern [%s]: %w", pattern, err)
+		}
+		for _, file := range matches {
+			info, err := os.Stat(file)
+			if err != nil || info.IsDir() {
+				continue
+			}
+			f, err := readConfigFile(file)
+			if err != nil {
+				return nil, nil, err
+			}
+			_, extProxyCfgs, extVisitorCfgs, err := f.decodeClientConfig(strict)
+			if err != nil {
+				return nil, nil, err
+			}
+			proxyCfgs = append(proxyCfgs, extProxyCfgs...)
+			visitorCfgs = append(visitorCfgs, extVisitorCfgs...)
+		}
 	}
-	return yaml.Unmarshal(b, out)
+	return proxyCfgs, visitorCfgs, nil
 }
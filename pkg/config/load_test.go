@@ -0,0 +1,118 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+)
+
+// writeFiles writes files, relative paths to their content, to a new
+// directory and returns it.
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func proxyNames(cfgs []m.ProxyConfigurer) []string {
+	names := make([]string, 0, len(cfgs))
+	for _, c := range cfgs {
+		names = append(names, c.GetBaseConfig().Name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestLoadClientConfigIncludes(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"gkc.yaml": "serverAddr: 10.0.0.1\nincludes:\n  - conf.d/*.yaml\n" +
+			"proxies:\n  - name: main\n    type: tcp\n    localPort: 22\n",
+		"conf.d/web.yaml": "proxies:\n  - name: web\n    type: tcp\n    localPort: 80\n",
+		"conf.d/db.yaml":  "proxies:\n  - name: db\n    type: tcp\n    localPort: 5432\n",
+		// not matched by the pattern
+		"conf.d/sub/other.yaml": "proxies:\n  - name: other\n    type: tcp\n    localPort: 81\n",
+	})
+	// the patterns are relative to the directory of the config file, not to
+	// the working directory
+	t.Chdir(t.TempDir())
+
+	_, proxyCfgs, _, err := LoadClientConfig(filepath.Join(dir, "gkc.yaml"), true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := proxyNames(proxyCfgs); !slices.Equal(got, []string{"db", "main", "web"}) {
+		t.Fatalf("unexpected proxies %v", got)
+	}
+}
+
+func TestLoadClientConfigErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		// wantErr is matched after the directory is replaced with "DIR"
+		wantErr string
+	}{
+		{
+			name:    "yaml syntax error",
+			files:   map[string]string{"gkc.yaml": "serverAddr: 10.0.0.1\nserverPort: 7000\n  bad: [\n"},
+			wantErr: "DIR/gkc.yaml:3: ",
+		},
+		{
+			name:    "json syntax error",
+			files:   map[string]string{"gkc.json": "{\n  \"serverAddr\": \"10.0.0.1\",\n  \"serverPort\": 7000,\n}\n"},
+			wantErr: "DIR/gkc.json:4: ",
+		},
+		{
+			name:    "type error",
+			files:   map[string]string{"gkc.yaml": "serverAddr: 10.0.0.1\nserverPort: abc\n"},
+			wantErr: "DIR/gkc.yaml:2: serverPort: ",
+		},
+		{
+			name:    "invalid include pattern",
+			files:   map[string]string{"gkc.yaml": "includes:\n  - \"conf.d/[\"\n"},
+			wantErr: "invalid include pattern [DIR/conf.d/[]",
+		},
+		{
+			name: "error in an included file",
+			files: map[string]string{
+				"gkc.yaml":        "includes:\n  - conf.d/*.yaml\n",
+				"conf.d/web.yaml": "proxies:\n  - name: web\n    type: tcp\n    localPort: http\n",
+			},
+			wantErr: "DIR/conf.d/web.yaml:4: proxies[0].localPort: ",
+		},
+		{
+			name:    "missing file",
+			files:   map[string]string{},
+			wantErr: "cannot read config file",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeFiles(t, tt.files)
+			path := filepath.Join(dir, "gkc.yaml")
+			if _, ok := tt.files["gkc.json"]; ok {
+				path = filepath.Join(dir, "gkc.json")
+			}
+			_, _, _, err := LoadClientConfig(path, true)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if got := strings.ReplaceAll(err.Error(), dir, "DIR"); !strings.Contains(got, tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %q", tt.wantErr, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MarshalYAML marshals v to YAML through its json tags, so that keys keep
+// the names and the order of the config model. If omitZero is true, empty
+// strings, zero numbers, empty lists and empty objects are dropped.
+func MarshalYAML(v any, omitZero bool) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	// YAML is a superset of JSON, parsing it as YAML keeps the key order.
+	var node yaml.Node
+	if err := yaml.Unmarshal(b, &node); err != nil {
+		return nil, err
+	}
+	normalizeYAMLNode(&node, omitZero)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&node); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// normalizeYAMLNode resets the JSON flow style to the YAML block style and
+// drops zero values if omitZero is true. It returns false if node itself is
+// a zero value.
+func normalizeYAMLNode(node *yaml.Node, omitZero bool) bool {
+	node.Style = 0
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, n := range node.Content {
+			normalizeYAMLNode(n, omitZero)
+		}
+		return true
+	case yaml.MappingNode:
+		content := make([]*yaml.Node, 0, len(node.Content))
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			key.Style = 0
+			if !normalizeYAMLNode(value, omitZero) && omitZero {
+				continue
+			}
+			content = append(content, key, value)
+		}
+		node.Content = content
+		return len(content) > 0
+	case yaml.SequenceNode:
+		for _, n := range node.Content {
+			normalizeYAMLNode(n, omitZero)
+		}
+		return len(node.Content) > 0
+	case yaml.ScalarNode:
+		switch node.Tag {
+		case "!!null":
+			return false
+		case "!!str":
+			if node.Value == "" {
+				// keep the empty string quoted
+				node.Style = yaml.DoubleQuotedStyle
+				return false
+			}
+		case "!!int", "!!float":
+			return node.Value != "0"
+		}
+		return true
+	}
+	return true
+}
+
+// MarshalConfig marshals v for printing, format is "yaml" or "json".
+func MarshalConfig(v any, format string) ([]byte, error) {
+	switch format {
+	case "yaml", "yml":
+		return MarshalYAML(v, false)
+	case "json":
+		b, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(b, '\n'), nil
+	default:
+		return nil, fmt.Errorf("unsupported format %q, optional values are yaml and json", format)
+	}
+}
@@ -12,6 +12,7 @@ import (
 type ClientConfig struct {
 	ClientCommonConfig
 
+	Proxies  []TypedProxyConfig   `json:"proxies,omitempty"`
 	Visitors []TypedVisitorConfig `json:"visitors,omitempty"`
 }
 
@@ -178,20 +179,41 @@ type AuthClientConfig struct {
 	// This is mutually exclusive with Token field.
 	TokenSource *ValueSource         `json:"tokenSource,omitempty"`
 	OIDC        AuthOIDCClientConfig `json:"oidc,omitempty"`
+	// LegacyKey specifies whether to send the md5 based key understood by
+	// servers of old versions instead of the HMAC-SHA256 one. By default,
+	// this value is false.
+	LegacyKey bool `json:"legacyKey,omitempty"`
+	// TokenSwitchDelay specifies how long the client keeps signing with the
+	// previous token after tokenSource returns a new one, in seconds, so that
+	// a server which refreshes its token later doesn't reject it. The
+	// tokenOverlap of the server must be longer than this value. By default,
+	// this value is tokenSource.refreshInterval.
+	TokenSwitchDelay *int64 `json:"tokenSwitchDelay,omitempty"`
 }
 
 func (c *AuthClientConfig) Complete() error {
 	c.Method = value.EmptyOr(c.Method, "token")
 
+	if c.TokenSwitchDelay == nil {
+		var delay int64
+		if c.TokenSource != nil {
+			delay = c.TokenSource.RefreshInterval
+		}
+		c.TokenSwitchDelay = &delay
+	}
+
 	// Resolve tokenSource during configuration loading
 	if c.Method == AuthMethodToken && c.TokenSource != nil {
 		token, err := c.TokenSource.Resolve(context.Background())
 		if err != nil {
 			return fmt.Errorf("failed to resolve auth.tokenSource: %w", err)
 		}
-		// Move the resolved token to the Token field and clear TokenSource
+		// Move the resolved token to the Token field, TokenSource is only
+		// kept when the token needs to be refreshed at runtime
 		c.Token = token
-		c.TokenSource = nil
+		if c.TokenSource.RefreshInterval <= 0 {
+			c.TokenSource = nil
+		}
 	}
 	return nil
 }
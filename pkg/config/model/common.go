@@ -23,6 +23,7 @@ type AuthMethod string
 const (
 	AuthMethodToken AuthMethod = "token"
 	AuthMethodOIDC  AuthMethod = "oidc"
+	AuthMethodMTLS  AuthMethod = "mtls"
 )
 
 type QUICOptions struct {
@@ -109,6 +110,79 @@ type HTTPPluginOptions struct {
 	Path      string   `json:"path"`
 	Ops       []string `json:"ops"`
 	TLSVerify bool     `json:"tlsVerify,omitempty"`
+
+	PluginCallOptions
+}
+
+func (c *HTTPPluginOptions) Complete() {
+	c.PluginCallOptions.Complete()
+}
+
+// ExecPluginOptions configures a plugin running as a local process, gks
+// writes one JSON request per line to its stdin and reads one JSON response
+// per line from its stdout. Each request has an id which the response must
+// carry, so responses may be sent out of order.
+type ExecPluginOptions struct {
+	Name string `json:"name"`
+	// Command is the path of the executable, Args are its arguments. The
+	// process is started again if it exits.
+	Command string   `json:"command"`
+	Args    []string `json:"args,omitempty"`
+	Ops     []string `json:"ops"`
+
+	PluginCallOptions
+}
+
+func (c *ExecPluginOptions) Complete() {
+	c.PluginCallOptions.Complete()
+}
+
+type PluginFailurePolicy string
+
+const (
+	// PluginFailurePolicyReject rejects the request if the plugin fails.
+	PluginFailurePolicyReject PluginFailurePolicy = "reject"
+	// PluginFailurePolicyAllow lets the request pass unchanged if the plugin
+	// fails, so an outage of the plugin doesn't lock out every client.
+	PluginFailurePolicyAllow PluginFailurePolicy = "allow"
+)
+
+// PluginCallOptions controls how gks calls a server plugin.
+type PluginCallOptions struct {
+	// Timeout specifies the timeout in seconds of a single request to the
+	// plugin. By default, this value is 5.
+	Timeout int64 `json:"timeout,omitempty"`
+	// MaxRetries specifies how many times a failed request is retried, with
+	// backoff between the attempts. By default, failed requests aren't
+	// retried.
+	MaxRetries int `json:"maxRetries,omitempty"`
+	// FailurePolicy specifies what happens to a request when the plugin
+	// fails after all retries or its circuit breaker is open, "reject" or
+	// "allow". By default, this value is "reject".
+	FailurePolicy PluginFailurePolicy `json:"failurePolicy,omitempty"`
+	// CircuitBreaker stops calling a failing plugin for a while.
+	CircuitBreaker PluginCircuitBreakerConfig `json:"circuitBreaker,omitempty"`
+}
+
+func (c *PluginCallOptions) Complete() {
+	c.Timeout = value.EmptyOr(c.Timeout, 5)
+	c.FailurePolicy = value.EmptyOr(c.FailurePolicy, PluginFailurePolicyReject)
+	c.CircuitBreaker.Complete()
+}
+
+type PluginCircuitBreakerConfig struct {
+	// FailureThreshold specifies how many consecutive failed calls open the
+	// circuit breaker. By default, this value is 5.
+	FailureThreshold int `json:"failureThreshold,omitempty"`
+	// OpenTimeout specifies how many seconds the circuit breaker stays open,
+	// after that a single call is let through to probe the plugin. By
+	// default, this value is 30.
+	OpenTimeout int64 `json:"openTimeout,omitempty"`
+}
+
+func (c *PluginCircuitBreakerConfig) Complete() {
+	c.FailureThreshold = value.EmptyOr(c.FailureThreshold, 5)
+	c.OpenTimeout = value.EmptyOr(c.OpenTimeout, 30)
 }
 
 type HeaderOperations struct {
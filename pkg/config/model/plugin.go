@@ -0,0 +1,130 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+
+	"github.com/gk7790/gk-zap/pkg/utils/value"
+	"github.com/samber/lo"
+)
+
+const (
+	PluginHTTPS2HTTP  = "https2http"
+	PluginHTTPS2HTTPS = "https2https"
+)
+
+var clientPluginOptionsTypeMap = map[string]reflect.Type{
+	PluginHTTPS2HTTP:  reflect.TypeOf(HTTPS2HTTPPluginOptions{}),
+	PluginHTTPS2HTTPS: reflect.TypeOf(HTTPS2HTTPSPluginOptions{}),
+}
+
+type ClientPluginOptions interface {
+	Complete()
+}
+
+type TypedClientPluginOptions struct {
+	Type string `json:"type"`
+	ClientPluginOptions
+}
+
+func (c *TypedClientPluginOptions) UnmarshalJSON(b []byte) error {
+	if len(b) == 4 && string(b) == "null" {
+		return nil
+	}
+
+	typeStruct := struct {
+		Type string `json:"type"`
+	}{}
+	if err := json.Unmarshal(b, &typeStruct); err != nil {
+		return err
+	}
+
+	c.Type = typeStruct.Type
+	if c.Type == "" {
+		return nil
+	}
+
+	options := NewClientPluginOptionsByType(typeStruct.Type)
+	if options == nil {
+		return fmt.Errorf("unknown plugin type: %s", typeStruct.Type)
+	}
+
+	decoder := json.NewDecoder(bytes.NewBuffer(b))
+	if DisallowUnknownFields {
+		decoder.DisallowUnknownFields()
+	}
+	if err := decoder.Decode(options); err != nil {
+		return fmt.Errorf("unmarshal ClientPluginOptions error: %w", err)
+	}
+	c.ClientPluginOptions = options
+	return nil
+}
+
+// ClientPluginTypes returns all supported client plugin types in sorted order.
+func ClientPluginTypes() []string {
+	types := lo.Keys(clientPluginOptionsTypeMap)
+	slices.Sort(types)
+	return types
+}
+
+func NewClientPluginOptionsByType(t string) ClientPluginOptions {
+	v, ok := clientPluginOptionsTypeMap[t]
+	if !ok {
+		return nil
+	}
+	return reflect.New(v).Interface().(ClientPluginOptions)
+}
+
+func (c *TypedClientPluginOptions) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.ClientPluginOptions)
+}
+
+// HTTPS2HTTPPluginOptions terminates TLS on the client with a local
+// certificate and forwards plain HTTP requests to LocalAddr.
+type HTTPS2HTTPPluginOptions struct {
+	Type string `json:"type,omitempty"`
+	// LocalAddr is the address of the local HTTP backend, e.g. "127.0.0.1:8080".
+	LocalAddr string `json:"localAddr,omitempty"`
+	// HostHeaderRewrite replaces the Host header of forwarded requests.
+	HostHeaderRewrite string `json:"hostHeaderRewrite,omitempty"`
+	// RequestHeaders specifies headers to set on forwarded requests.
+	RequestHeaders HeaderOperations `json:"requestHeaders,omitempty"`
+	// EnableHTTP2 controls whether HTTP/2 is negotiated with the visitor. By
+	// default, this value is true.
+	EnableHTTP2 *bool `json:"enableHTTP2,omitempty"`
+	// CertFile and KeyFile are used to terminate TLS. If TrustedCaFile is
+	// set, visitors must present a certificate signed by it. If no
+	// certificate is configured, a random self-signed one will be used.
+	TLSConfig
+}
+
+func (o *HTTPS2HTTPPluginOptions) Complete() {
+	o.EnableHTTP2 = value.EmptyOr(o.EnableHTTP2, lo.ToPtr(true))
+}
+
+// HTTPS2HTTPSPluginOptions terminates TLS on the client with a local
+// certificate and re-encrypts requests to the HTTPS backend at LocalAddr.
+type HTTPS2HTTPSPluginOptions struct {
+	Type string `json:"type,omitempty"`
+	// LocalAddr is the address of the local HTTPS backend, e.g. "127.0.0.1:8443".
+	LocalAddr string `json:"localAddr,omitempty"`
+	// HostHeaderRewrite replaces the Host header of forwarded requests.
+	HostHeaderRewrite string `json:"hostHeaderRewrite,omitempty"`
+	// RequestHeaders specifies headers to set on forwarded requests.
+	RequestHeaders HeaderOperations `json:"requestHeaders,omitempty"`
+	// EnableHTTP2 controls whether HTTP/2 is negotiated with the visitor. By
+	// default, this value is true.
+	EnableHTTP2 *bool `json:"enableHTTP2,omitempty"`
+	// CertFile and KeyFile are used to terminate TLS. If TrustedCaFile is
+	// set, visitors must present a certificate signed by it. If no
+	// certificate is configured, a random self-signed one will be used.
+	// The backend certificate is not verified.
+	TLSConfig
+}
+
+func (o *HTTPS2HTTPSPluginOptions) Complete() {
+	o.EnableHTTP2 = value.EmptyOr(o.EnableHTTP2, lo.ToPtr(true))
+}
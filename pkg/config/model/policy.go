@@ -0,0 +1,81 @@
+package model
+
+import (
+	"github.com/gk7790/gk-zap/pkg/config/types"
+)
+
+type PolicyAction string
+
+const (
+	// PolicyActionAllow accepts the request, the following rules are skipped.
+	PolicyActionAllow PolicyAction = "allow"
+	// PolicyActionDeny rejects the request, the following rules are skipped.
+	PolicyActionDeny PolicyAction = "deny"
+	// PolicyActionModify changes the request with Set and goes on with the
+	// following rules.
+	PolicyActionModify PolicyAction = "modify"
+)
+
+// PolicyConfig is the content of the policy file of the server. The rules
+// are evaluated in order by gks itself before the server plugins are called.
+type PolicyConfig struct {
+	// DefaultAction is applied when no allow or deny rule matches, "allow" or
+	// "deny". By default, this value is "allow".
+	DefaultAction PolicyAction `json:"defaultAction,omitempty"`
+	Rules         []PolicyRule `json:"rules,omitempty"`
+}
+
+func (c *PolicyConfig) Complete() {
+	if c.DefaultAction == "" {
+		c.DefaultAction = PolicyActionAllow
+	}
+}
+
+type PolicyRule struct {
+	// Name is shown when the rule decides a request.
+	Name string `json:"name,omitempty"`
+	// Ops specifies the operations the rule applies to, Login, NewProxy or
+	// NewUserConn. If the length of this value is 0, the rule applies to all
+	// of them.
+	Ops   []string    `json:"ops,omitempty"`
+	Match PolicyMatch `json:"match,omitempty"`
+	// Action is "allow", "deny" or "modify".
+	Action PolicyAction `json:"action"`
+	// Reason is sent to the client when the rule denies a request.
+	Reason string `json:"reason,omitempty"`
+	// Set specifies the changes of a modify rule, they apply to NewProxy.
+	Set PolicyModify `json:"set,omitempty"`
+}
+
+// PolicyMatch matches a request if all of the conditions which are set
+// match. A condition on something the operation doesn't have, e.g. a proxy
+// name on Login, doesn't match. Patterns use the syntax of path.Match.
+type PolicyMatch struct {
+	// Users matches the user of the client, for NewUserConn it's the user of
+	// the proxy owner.
+	Users []string `json:"users,omitempty"`
+	// Metas matches the metas the client sent at login, every key must be
+	// present with a value matching the pattern.
+	Metas map[string]string `json:"metas,omitempty"`
+	// SourceCIDRs matches the address of the connection: the client for
+	// Login and NewProxy, the user or visitor for NewUserConn.
+	SourceCIDRs []string `json:"sourceCIDRs,omitempty"`
+	// ProxyTypes matches the type of the proxy.
+	ProxyTypes []ProxyType `json:"proxyTypes,omitempty"`
+	// ProxyNames matches the name of the proxy, including the user prefix.
+	ProxyNames []string `json:"proxyNames,omitempty"`
+	// RemotePorts matches the remote port of tcp and udp proxies.
+	RemotePorts []types.PortsRange `json:"remotePorts,omitempty"`
+	// Domains matches the custom domains and the subdomain of http and https
+	// proxies, any of them matching is enough.
+	Domains []string `json:"domains,omitempty"`
+	// Visitors matches the user of the visitor for NewUserConn of stcp,
+	// sudp and xtcp proxies.
+	Visitors []string `json:"visitors,omitempty"`
+}
+
+type PolicyModify struct {
+	UseEncryption  *bool  `json:"useEncryption,omitempty"`
+	UseCompression *bool  `json:"useCompression,omitempty"`
+	BandwidthLimit string `json:"bandwidthLimit,omitempty"`
+}
@@ -3,7 +3,9 @@ package model
 import (
 	"context"
 	"fmt"
+	"time"
 
+	"github.com/gk7790/gk-zap/pkg/config/types"
 	"github.com/gk7790/gk-zap/pkg/utils/value"
 	"github.com/samber/lo"
 )
@@ -80,9 +82,24 @@ type ServerConfig struct {
 	// NatHoleAnalysisDataReserveHours specifies the hours to reserve nat hole analysis data.
 	NatHoleAnalysisDataReserveHours int64 `json:"natholeAnalysisDataReserveHours,omitempty"`
 
-	//AllowPorts []types.PortsRange `json:"allowPorts,omitempty"`
+	// AllowPorts specifies a set of ports that clients are able to proxy to.
+	// If the length of this value is 0, all ports are allowed.
+	AllowPorts []types.PortsRange `json:"allowPorts,omitempty"`
 
 	HTTPPlugins []HTTPPluginOptions `json:"httpPlugins,omitempty"`
+	// ExecPlugins specifies the plugins running as local processes, see
+	// ExecPluginOptions. Plugin names are shared with HTTPPlugins.
+	ExecPlugins []ExecPluginOptions `json:"execPlugins,omitempty"`
+
+	// UsersFile specifies the path of the users file. If it's set, only the
+	// users listed in it are able to log in, see UsersConfig. The file is read
+	// again when the config is reloaded. It requires auth.method token or mtls.
+	UsersFile string `json:"usersFile,omitempty"`
+
+	// PolicyFile specifies the path of the policy file, its rules accept,
+	// reject or change requests before the plugins are called, see
+	// PolicyConfig. The file is read again when the config is reloaded.
+	PolicyFile string `json:"policyFile,omitempty"`
 }
 
 func (c *ServerConfig) Complete() error {
@@ -104,6 +121,12 @@ func (c *ServerConfig) Complete() error {
 	c.UserConnTimeout = value.EmptyOr(c.UserConnTimeout, 10)
 	c.UDPPacketSize = value.EmptyOr(c.UDPPacketSize, 1500)
 	c.NatHoleAnalysisDataReserveHours = value.EmptyOr(c.NatHoleAnalysisDataReserveHours, 7*24)
+	for i := range c.HTTPPlugins {
+		c.HTTPPlugins[i].Complete()
+	}
+	for i := range c.ExecPlugins {
+		c.ExecPlugins[i].Complete()
+	}
 	return nil
 }
 
@@ -142,6 +165,9 @@ type ServerTransportConfig struct {
 	// before terminating the connection. It is not recommended to change this
 	// value. By default, this value is 90. Set negative value to disable it.
 	HeartbeatTimeout int64 `json:"heartbeatTimeout,omitempty"`
+	// TLS specifies TLS settings for the connection from the client. If
+	// CertFile and KeyFile are empty, a random self-signed certificate is used.
+	TLS TLSServerConfig `json:"tls,omitempty"`
 }
 
 func (c *ServerTransportConfig) Complete() {
@@ -163,10 +189,48 @@ type AuthServerConfig struct {
 	Token            string               `json:"token,omitempty"`
 	TokenSource      *ValueSource         `json:"tokenSource,omitempty"`
 	OIDC             AuthOIDCServerConfig `json:"oidc,omitempty"`
+	MTLS             AuthMTLSServerConfig `json:"mtls,omitempty"`
+	// AllowLegacyKey specifies whether clients may still log in with the md5
+	// based key of old versions. The legacy key has no nonce, a captured
+	// login or heartbeat can be replayed until its timestamp is older than
+	// maxClockSkew. By default, this value is false.
+	AllowLegacyKey bool `json:"allowLegacyKey,omitempty"`
+	// MaxClockSkew specifies how far the timestamp of a token auth key may be
+	// from the clock of the server, in seconds. It must be greater than 0.
+	// By default, this value is 300.
+	MaxClockSkew *int64 `json:"maxClockSkew,omitempty"`
+	// TokenOverlap specifies how long the previous token is still accepted
+	// after the token changes, by a reload or by tokenSource, in seconds.
+	// Clients and the server don't see a new token at the same time, it
+	// should be longer than the refreshInterval of the clients plus their
+	// tokenSwitchDelay. Set it to 0 to reject the previous token at once. By
+	// default, this value is 300, or twice tokenSource.refreshInterval if
+	// that is longer.
+	TokenOverlap *int64 `json:"tokenOverlap,omitempty"`
+
+	// tokenResolvedAt is when Token was resolved from TokenSource.
+	tokenResolvedAt time.Time
+}
+
+// TokenResolvedAt returns when Token was resolved from TokenSource by
+// Complete, it's zero if there is no TokenSource.
+func (c *AuthServerConfig) TokenResolvedAt() time.Time {
+	return c.tokenResolvedAt
 }
 
 func (c *AuthServerConfig) Complete() error {
 	c.Method = value.EmptyOr(c.Method, "token")
+	c.MaxClockSkew = value.EmptyOr(c.MaxClockSkew, lo.ToPtr[int64](300))
+	if c.TokenOverlap == nil {
+		overlap := int64(300)
+		if c.TokenSource != nil {
+			overlap = max(overlap, 2*c.TokenSource.RefreshInterval)
+		}
+		c.TokenOverlap = &overlap
+	}
+	if c.Method == AuthMethodMTLS {
+		c.MTLS.UserFrom = value.EmptyOr(c.MTLS.UserFrom, "commonName")
+	}
 
 	// Resolve tokenSource during configuration loading
 	if c.Method == AuthMethodToken && c.TokenSource != nil {
@@ -174,13 +238,36 @@ func (c *AuthServerConfig) Complete() error {
 		if err != nil {
 			return fmt.Errorf("failed to resolve auth.tokenSource: %w", err)
 		}
-		// Move the resolved token to the Token field and clear TokenSource
+		// Move the resolved token to the Token field, TokenSource is only
+		// kept when the token needs to be refreshed at runtime
 		c.Token = token
-		c.TokenSource = nil
+		c.tokenResolvedAt = time.Now()
+		if c.TokenSource.RefreshInterval <= 0 {
+			c.TokenSource = nil
+		}
 	}
 	return nil
 }
 
+// AuthMTLSServerConfig configures the mtls auth method, the clients must
+// present a certificate signed by transport.tls.trustedCaFile and the user is
+// taken from it.
+type AuthMTLSServerConfig struct {
+	// UserFrom specifies the field of the client certificate used as the user.
+	// Optional values are "commonName", "dnsSAN", "emailSAN" and "uriSAN", the
+	// first value is used for the SAN fields. By default, this value is
+	// "commonName".
+	UserFrom string `json:"userFrom,omitempty"`
+	// Metas maps meta keys to the fields of the client certificate their
+	// values are taken from. Besides the values of UserFrom, "serialNumber",
+	// "organization" and "organizationalUnit" are supported.
+	Metas map[string]string `json:"metas,omitempty"`
+	// CRLFile specifies the path of a certificate revocation list issued by
+	// the trusted CA, certificates listed in it are rejected. The file is read
+	// again when it's modified.
+	CRLFile string `json:"crlFile,omitempty"`
+}
+
 type TLSServerConfig struct {
 	// Force specifies whether to only accept TLS-encrypted connections.
 	Force bool `json:"force,omitempty"`
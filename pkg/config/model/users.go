@@ -0,0 +1,39 @@
+package model
+
+import (
+	"github.com/gk7790/gk-zap/pkg/config/types"
+)
+
+// UsersConfig is the content of the users file of the server. When it's set
+// only the users listed in it can log in, each with its own token and
+// entitlements.
+type UsersConfig struct {
+	Users []UserConfig `json:"users,omitempty"`
+}
+
+type UserConfig struct {
+	// Name is the user the clients log in as, the "user" of the client
+	// config.
+	Name string `json:"name"`
+	// Token specifies the token of the user, it replaces auth.token for the
+	// clients of this user when auth.method is token. If this value is "",
+	// auth.token is used.
+	Token string `json:"token,omitempty"`
+	// AllowPorts specifies the remote ports the proxies of the user are able
+	// to use. If the length of this value is 0, all ports are allowed.
+	AllowPorts []types.PortsRange `json:"allowPorts,omitempty"`
+	// AllowDomains specifies the custom domains the proxies of the user are
+	// able to use, patterns like "*.example.com" are supported. If the length
+	// of this value is 0, all domains are allowed.
+	AllowDomains []string `json:"allowDomains,omitempty"`
+	// AllowSubdomains specifies the subdomains the proxies of the user are
+	// able to use, patterns like "alice-*" are supported. If the length of
+	// this value is 0, all subdomains are allowed.
+	AllowSubdomains []string `json:"allowSubdomains,omitempty"`
+	// MaxProxies specifies the maximum number of proxies of the user across
+	// all its clients. If this value is 0, there is no limit.
+	MaxProxies int64 `json:"maxProxies,omitempty"`
+	// ProxyTypes specifies the proxy types the user is able to use. If the
+	// length of this value is 0, all types are allowed.
+	ProxyTypes []ProxyType `json:"proxyTypes,omitempty"`
+}
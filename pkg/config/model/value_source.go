@@ -5,7 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"os/exec"
 	"strings"
+	"time"
 )
 
 // ValueSource provides a way to dynamically resolve configuration values
@@ -13,6 +15,12 @@ import (
 type ValueSource struct {
 	Type string      `json:"type"`
 	File *FileSource `json:"file,omitempty"`
+	Env  *EnvSource  `json:"env,omitempty"`
+	Exec *ExecSource `json:"exec,omitempty"`
+	// RefreshInterval specifies how often the value is resolved again, in
+	// seconds. If this value is 0, the value is resolved only once when the
+	// configuration is loaded.
+	RefreshInterval int64 `json:"refreshInterval,omitempty"`
 }
 
 // FileSource specifies how to load a value from a file.
@@ -20,11 +28,29 @@ type FileSource struct {
 	Path string `json:"path"`
 }
 
+// EnvSource specifies how to load a value from an environment variable.
+type EnvSource struct {
+	Name string `json:"name"`
+}
+
+// ExecSource specifies how to load a value from the stdout of a local
+// command.
+type ExecSource struct {
+	Command string   `json:"command"`
+	Args    []string `json:"args,omitempty"`
+	// Timeout specifies the maximum time the command may run, in seconds.
+	// By default, this value is 10.
+	Timeout int64 `json:"timeout,omitempty"`
+}
+
 // Validate validates the ValueSource configuration.
 func (v *ValueSource) Validate() error {
 	if v == nil {
 		return errors.New("valueSource cannot be nil")
 	}
+	if v.RefreshInterval < 0 {
+		return errors.New("refreshInterval cannot be negative")
+	}
 
 	switch v.Type {
 	case "file":
@@ -32,8 +58,18 @@ func (v *ValueSource) Validate() error {
 			return errors.New("file configuration is required when type is 'file'")
 		}
 		return v.File.Validate()
+	case "env":
+		if v.Env == nil {
+			return errors.New("env configuration is required when type is 'env'")
+		}
+		return v.Env.Validate()
+	case "exec":
+		if v.Exec == nil {
+			return errors.New("exec configuration is required when type is 'exec'")
+		}
+		return v.Exec.Validate()
 	default:
-		return fmt.Errorf("unsupported value source type: %s (only 'file' is supported)", v.Type)
+		return fmt.Errorf("unsupported value source type: %s (supported: file, env, exec)", v.Type)
 	}
 }
 
@@ -46,6 +82,10 @@ func (v *ValueSource) Resolve(ctx context.Context) (string, error) {
 	switch v.Type {
 	case "file":
 		return v.File.Resolve(ctx)
+	case "env":
+		return v.Env.Resolve(ctx)
+	case "exec":
+		return v.Exec.Resolve(ctx)
 	default:
 		return "", fmt.Errorf("unsupported value source type: %s", v.Type)
 	}
@@ -77,3 +117,72 @@ func (f *FileSource) Resolve(_ context.Context) (string, error) {
 	// Trim whitespace, which is important for file-based tokens
 	return strings.TrimSpace(string(content)), nil
 }
+
+// Validate validates the EnvSource configuration.
+func (e *EnvSource) Validate() error {
+	if e == nil {
+		return errors.New("envSource cannot be nil")
+	}
+
+	if e.Name == "" {
+		return errors.New("env name cannot be empty")
+	}
+	return nil
+}
+
+// Resolve returns the value of the specified environment variable.
+func (e *EnvSource) Resolve(_ context.Context) (string, error) {
+	if err := e.Validate(); err != nil {
+		return "", err
+	}
+
+	v, ok := os.LookupEnv(e.Name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", e.Name)
+	}
+	return strings.TrimSpace(v), nil
+}
+
+// Validate validates the ExecSource configuration.
+func (e *ExecSource) Validate() error {
+	if e == nil {
+		return errors.New("execSource cannot be nil")
+	}
+
+	if e.Command == "" {
+		return errors.New("exec command cannot be empty")
+	}
+	if e.Timeout < 0 {
+		return errors.New("exec timeout cannot be negative")
+	}
+	return nil
+}
+
+// Resolve runs the specified command and returns its stdout.
+func (e *ExecSource) Resolve(ctx context.Context) (string, error) {
+	if err := e.Validate(); err != nil {
+		return "", err
+	}
+
+	timeout := e.Timeout
+	if timeout == 0 {
+		timeout = 10
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, e.Command, e.Args...).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return "", fmt.Errorf("failed to run command %s: %v: %s", e.Command, err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("failed to run command %s: %v", e.Command, err)
+	}
+
+	v := strings.TrimSpace(string(out))
+	if v == "" {
+		return "", fmt.Errorf("command %s printed nothing", e.Command)
+	}
+	return v, nil
+}
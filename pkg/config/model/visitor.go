@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"slices"
 
 	"github.com/gk7790/gk-zap/pkg/utils/value"
 	"github.com/samber/lo"
@@ -102,7 +103,7 @@ func (c *TypedVisitorConfig) UnmarshalJSON(b []byte) error {
 		decoder.DisallowUnknownFields()
 	}
 	if err := decoder.Decode(configurer); err != nil {
-		return fmt.Errorf("unmarshal VisitorConfig error: %v", err)
+		return fmt.Errorf("unmarshal VisitorConfig error: %w", err)
 	}
 	c.VisitorConfigurer = configurer
 	return nil
@@ -112,6 +113,13 @@ func (c *TypedVisitorConfig) MarshalJSON() ([]byte, error) {
 	return json.Marshal(c.VisitorConfigurer)
 }
 
+// VisitorTypes returns all supported visitor types in sorted order.
+func VisitorTypes() []VisitorType {
+	types := lo.Keys(visitorConfigTypeMap)
+	slices.Sort(types)
+	return types
+}
+
 func NewVisitorConfigurerByType(t VisitorType) VisitorConfigurer {
 	v, ok := visitorConfigTypeMap[t]
 	if !ok {
@@ -126,6 +134,19 @@ var _ VisitorConfigurer = &STCPVisitorConfig{}
 
 type STCPVisitorConfig struct {
 	VisitorBaseConfig
+
+	// FallbackTo specifies the name of another visitor the user connections
+	// are redirected to when the server can't connect them to ServerName,
+	// e.g. a visitor with a negative bindPort for a standby proxy.
+	FallbackTo string `json:"fallbackTo,omitempty"`
+}
+
+func (c *STCPVisitorConfig) Complete(g *ClientCommonConfig) {
+	c.VisitorBaseConfig.Complete(g)
+
+	if c.FallbackTo != "" {
+		c.FallbackTo = lo.Ternary(g.User == "", "", g.User+".") + c.FallbackTo
+	}
 }
 
 var _ VisitorConfigurer = &SUDPVisitorConfig{}
@@ -0,0 +1,288 @@
+package config
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	ServerEnvPrefix = "GKS_"
+	ClientEnvPrefix = "GKC_"
+)
+
+// Overrides are config values set by command line flags, keyed by the json
+// path of the field, e.g. "transport.maxPoolCount". They take precedence over
+// environment variables and the config file.
+type Overrides struct {
+	keys   []string
+	values map[string]string
+}
+
+func (o *Overrides) Set(path, value string) {
+	if o.values == nil {
+		o.values = make(map[string]string)
+	}
+	if _, ok := o.values[path]; !ok {
+		o.keys = append(o.keys, path)
+	}
+	o.values[path] = value
+}
+
+var (
+	// ServerFlagOverrides and ClientFlagOverrides are filled by the flags
+	// registered with RegisterServerConfigFlags and RegisterClientConfigFlags.
+	ServerFlagOverrides = &Overrides{}
+	ClientFlagOverrides = &Overrides{}
+)
+
+// ApplyOverrides applies environment variables with envPrefix and then
+// flags to c, so that flags win over env and env wins over the file.
+func ApplyOverrides(c any, envPrefix string, flags *Overrides) error {
+	if err := ApplyEnvOverrides(c, envPrefix, os.Environ()); err != nil {
+		return err
+	}
+	if flags == nil {
+		return nil
+	}
+	for _, path := range flags.keys {
+		if err := SetFieldByPath(c, path, flags.values[path]); err != nil {
+			return fmt.Errorf("flag override %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// warningOutput receives the warnings for variables which match no field.
+var warningOutput io.Writer = os.Stderr
+
+// ApplyEnvOverrides sets fields of c from environ. The name of a variable is
+// prefix followed by the upper-cased json path of the field joined with "_",
+// e.g. GKS_TRANSPORT_MAXPOOLCOUNT for transport.maxPoolCount. Entries of
+// string maps are set by appending the key, e.g. GKC_METADATAS_env.
+func ApplyEnvOverrides(c any, prefix string, environ []string) error {
+	fields := make(map[string]string)
+	collectEnvNames(reflect.TypeOf(c), "", fields)
+
+	for _, env := range environ {
+		name, value, ok := strings.Cut(env, "=")
+		if !ok || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		key := strings.TrimPrefix(name, prefix)
+		path, ok := fields[strings.ToUpper(key)]
+		if !ok {
+			path, ok = lookupMapEnv(fields, key)
+		}
+		if !ok {
+			// the logger isn't set up while the config is loaded
+			fmt.Fprintf(warningOutput, "WARNING: env %s doesn't match any config field and is ignored\n", name)
+			continue
+		}
+		if err := SetFieldByPath(c, path, value); err != nil {
+			return fmt.Errorf("env %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// lookupMapEnv resolves names like METADATAS_env to "metadatas.env".
+func lookupMapEnv(fields map[string]string, key string) (string, bool) {
+	for i := strings.Index(key, "_"); i > 0; i = nextIndex(key, "_", i) {
+		if path, ok := fields[strings.ToUpper(key[:i])+"_*"]; ok {
+			return path + "." + key[i+1:], true
+		}
+	}
+	return "", false
+}
+
+func nextIndex(s, sep string, from int) int {
+	j := strings.Index(s[from+1:], sep)
+	if j < 0 {
+		return -1
+	}
+	return from + 1 + j
+}
+
+// collectEnvNames maps env names (without prefix) of all settable fields of
+// t to their json paths. String maps are registered as NAME_*.
+func collectEnvNames(t reflect.Type, path string, out map[string]string) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	envName := strings.ToUpper(strings.ReplaceAll(path, ".", "_"))
+	if isLeafType(t) {
+		out[envName] = path
+		return
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		for name, ft := range jsonFields(t) {
+			collectEnvNames(ft, joinKeyPath(path, name), out)
+		}
+	case reflect.Map:
+		if t.Key().Kind() == reflect.String && t.Elem().Kind() == reflect.String {
+			out[envName+"_*"] = path
+		}
+	}
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+func isLeafType(t reflect.Type) bool {
+	if reflect.PointerTo(t).Implements(jsonUnmarshalerType) || reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.String
+	}
+	return false
+}
+
+// SetFieldByPath sets the field of c at the json path to value. Path
+// segments match json names case-insensitively. Lists are comma separated.
+func SetFieldByPath(c any, path, value string) error {
+	v := reflect.ValueOf(c)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		return fmt.Errorf("config must be a non-nil pointer")
+	}
+	segments := strings.Split(path, ".")
+	for i, seg := range segments {
+		for v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		switch {
+		case v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String && i == len(segments)-1:
+			if v.IsNil() {
+				v.Set(reflect.MakeMap(v.Type()))
+			}
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := setValue(elem, value); err != nil {
+				return err
+			}
+			v.SetMapIndex(reflect.ValueOf(seg).Convert(v.Type().Key()), elem)
+			return nil
+		case v.Kind() == reflect.Struct:
+			f, ok := fieldByJSONName(v, seg)
+			if !ok {
+				return fmt.Errorf("unknown config field %q", strings.Join(segments[:i+1], "."))
+			}
+			v = f
+		default:
+			return fmt.Errorf("unknown config field %q", strings.Join(segments[:i+1], "."))
+		}
+	}
+	return setValue(v, value)
+}
+
+// fieldByJSONName finds the field of struct v by its json name, including
+// the promoted fields of embedded structs.
+func fieldByJSONName(v reflect.Value, name string) (reflect.Value, bool) {
+	t := v.Type()
+	var embedded []reflect.Value
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		tagName, _, _ := strings.Cut(tag, ",")
+		if f.Anonymous && tagName == "" {
+			if f.Type.Kind() == reflect.Struct {
+				embedded = append(embedded, v.Field(i))
+			}
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if tagName == "" {
+			tagName = f.Name
+		}
+		if strings.EqualFold(tagName, name) {
+			return v.Field(i), true
+		}
+	}
+	for _, e := range embedded {
+		if f, ok := fieldByJSONName(e, name); ok {
+			return f, true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+func setValue(v reflect.Value, s string) error {
+	if v.Kind() == reflect.Pointer {
+		nv := reflect.New(v.Type().Elem())
+		if err := setValue(nv.Elem(), s); err != nil {
+			return err
+		}
+		v.Set(nv)
+		return nil
+	}
+
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(s))
+	}
+	if u, ok := v.Addr().Interface().(json.Unmarshaler); ok {
+		b, _ := json.Marshal(s)
+		return u.UnmarshalJSON(b)
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(i)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", v.Type())
+		}
+		items := reflect.MakeSlice(v.Type(), 0, 0)
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = reflect.Append(items, reflect.ValueOf(item).Convert(v.Type().Elem()))
+			}
+		}
+		v.Set(items)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+)
+
+func TestOverridesPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gks.yaml")
+	content := "bindAddr: 10.0.0.1\nbindPort: 7001\ntransport:\n  maxPoolCount: 3\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("GKS_BINDPORT", "7002")
+	t.Setenv("GKS_TRANSPORT_MAXPOOLCOUNT", "4")
+	old := ServerFlagOverrides
+	ServerFlagOverrides = &Overrides{}
+	t.Cleanup(func() { ServerFlagOverrides = old })
+	ServerFlagOverrides.Set("bindPort", "7003")
+
+	cfg, err := LoadServerConfig(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// flag > env > file
+	if cfg.BindPort != 7003 {
+		t.Errorf("expected the flag to win, got bindPort %d", cfg.BindPort)
+	}
+	if cfg.Transport.MaxPoolCount != 4 {
+		t.Errorf("expected the env to win over the file, got maxPoolCount %d", cfg.Transport.MaxPoolCount)
+	}
+	if cfg.BindAddr != "10.0.0.1" {
+		t.Errorf("expected the file value to be kept, got bindAddr %s", cfg.BindAddr)
+	}
+}
+
+func TestApplyEnvOverrides(t *testing.T) {
+	environ := []string{
+		// embedded ClientCommonConfig
+		"GKC_SERVERADDR=10.0.0.1",
+		"GKC_SERVERPORT=7001",
+		// nested and case-insensitive
+		"GKC_TRANSPORT_TLS_SERVERNAME=example.com",
+		"GKC_auth_token=abc",
+		// pointer
+		"GKC_LOGINFAILEXIT=false",
+		// lists are comma separated
+		"GKC_START=ssh, web",
+		// string maps keep the case of the key
+		"GKC_METADATAS_env=prod",
+		"GKC_METADATAS_owner_name=alice",
+		// other prefixes are ignored
+		"GKS_BINDPORT=7000",
+		"PATH=/bin",
+	}
+	var out bytes.Buffer
+	warningOutput = &out
+	t.Cleanup(func() { warningOutput = os.Stderr })
+
+	cfg := &m.ClientConfig{}
+	if err := ApplyEnvOverrides(cfg, ClientEnvPrefix, environ); err != nil {
+		t.Fatal(err)
+	}
+	checks := []struct {
+		name      string
+		got, want any
+	}{
+		{"serverAddr", cfg.ServerAddr, "10.0.0.1"},
+		{"serverPort", cfg.ServerPort, 7001},
+		{"transport.tls.serverName", cfg.Transport.TLS.ServerName, "example.com"},
+		{"auth.token", cfg.Auth.Token, "abc"},
+		{"loginFailExit", cfg.LoginFailExit != nil && !*cfg.LoginFailExit, true},
+		{"start", cfg.Start, []string{"ssh", "web"}},
+		{"metadatas", cfg.Metadatas, map[string]string{"env": "prod", "owner_name": "alice"}},
+	}
+	for _, c := range checks {
+		if !reflect.DeepEqual(c.got, c.want) {
+			t.Errorf("%s: got %#v, want %#v", c.name, c.got, c.want)
+		}
+	}
+	if out.Len() != 0 {
+		t.Errorf("unexpected warnings: %s", out.String())
+	}
+}
+
+func TestApplyEnvOverridesUnknown(t *testing.T) {
+	var out bytes.Buffer
+	warningOutput = &out
+	t.Cleanup(func() { warningOutput = os.Stderr })
+
+	cfg := &m.ServerConfig{}
+	environ := []string{"GKS_BINDPROT=7000", "GKS_TRANSPORT=1", "GKS_BINDPORT=7001"}
+	if err := ApplyEnvOverrides(cfg, ServerEnvPrefix, environ); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.BindPort != 7001 {
+		t.Fatalf("expected bindPort 7001, got %d", cfg.BindPort)
+	}
+	for _, name := range []string{"GKS_BINDPROT", "GKS_TRANSPORT"} {
+		if !strings.Contains(out.String(), "env "+name+" doesn't match any config field") {
+			t.Errorf("expected a warning for %s, got %q", name, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "GKS_BINDPORT") {
+		t.Errorf("unexpected warning for GKS_BINDPORT: %q", out.String())
+	}
+}
+
+func TestApplyEnvOverridesBadValue(t *testing.T) {
+	tests := []struct {
+		env     string
+		wantErr string
+	}{
+		{"GKS_BINDPORT=abc", "env GKS_BINDPORT"},
+		{"GKS_DETAILEDERRORSTOCLIENT=maybe", "env GKS_DETAILEDERRORSTOCLIENT"},
+		{"GKS_TRANSPORT_MAXPOOLCOUNT=1.5", "env GKS_TRANSPORT_MAXPOOLCOUNT"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.env, func(t *testing.T) {
+			err := ApplyEnvOverrides(&m.ServerConfig{}, ServerEnvPrefix, []string{tt.env})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestSetFieldByPath(t *testing.T) {
+	cfg := &m.ClientConfig{}
+	tests := []struct {
+		path, value string
+		wantErr     string
+	}{
+		{"serverAddr", "10.0.0.1", ""},
+		{"SERVERPORT", "7001", ""},
+		{"transport.tls.enable", "true", ""},
+		{"metadatas.env", "prod", ""},
+		{"unknown", "1", `unknown config field "unknown"`},
+		{"transport.unknown", "1", `unknown config field "transport.unknown"`},
+		{"serverAddr.x", "1", `unknown config field "serverAddr.x"`},
+		{"serverPort", "seven", "invalid syntax"},
+		{"serverPort", "99999999999999999999", "out of range"},
+	}
+	for _, tt := range tests {
+		err := SetFieldByPath(cfg, tt.path, tt.value)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", tt.path, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s=%s: expected error containing %q, got %v", tt.path, tt.value, tt.wantErr, err)
+		}
+	}
+	if cfg.ServerAddr != "10.0.0.1" || cfg.ServerPort != 7001 || cfg.Transport.TLS.Enable == nil || !*cfg.Transport.TLS.Enable ||
+		cfg.Metadatas["env"] != "prod" {
+		t.Fatalf("unexpected config %+v", cfg.ClientCommonConfig)
+	}
+
+	if err := SetFieldByPath(*cfg, "serverAddr", "x"); err == nil {
+		t.Fatal("expected an error for a config which isn't a pointer")
+	}
+}
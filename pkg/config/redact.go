@@ -0,0 +1,88 @@
+package config
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// SecretFields are the json names of config fields holding secrets, they
+// are masked by RedactSecrets wherever they appear.
+var SecretFields = []string{
+	"token",
+	"clientSecret",
+	"password",
+	"httpPassword",
+	"secretKey",
+}
+
+// SecretMapFields are the json names of map fields whose values are all
+// secrets, e.g. a client_assertion in additionalEndpointParams.
+var SecretMapFields = []string{
+	"additionalEndpointParams",
+}
+
+const redactedValue = "******"
+
+// RedactSecrets replaces every non-empty secret field in v with a mask. v
+// must be a pointer, it is modified in place.
+func RedactSecrets(v any) {
+	redactValue(reflect.ValueOf(v))
+}
+
+func redactValue(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if !v.IsNil() {
+			redactValue(v.Elem())
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			fv := v.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if fv.Kind() == reflect.String && fv.CanSet() && fv.Len() > 0 && slices.Contains(SecretFields, name) {
+				fv.SetString(redactedValue)
+				continue
+			}
+			if fv.Kind() == reflect.Map && slices.Contains(SecretMapFields, name) {
+				redactMapValues(fv)
+				continue
+			}
+			redactValue(fv)
+		}
+	case reflect.Map:
+		// map values aren't addressable, they are redacted on a copy
+		for _, k := range v.MapKeys() {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(v.MapIndex(k))
+			if elem.Kind() == reflect.String && elem.Len() > 0 &&
+				k.Kind() == reflect.String && slices.Contains(SecretFields, k.String()) {
+				elem.SetString(redactedValue)
+			} else {
+				redactValue(elem)
+			}
+			v.SetMapIndex(k, elem)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			redactValue(v.Index(i))
+		}
+	}
+}
+
+// redactMapValues masks every non-empty string value of the map v.
+func redactMapValues(v reflect.Value) {
+	if v.Type().Elem().Kind() != reflect.String {
+		return
+	}
+	for _, k := range v.MapKeys() {
+		if v.MapIndex(k).Len() > 0 {
+			v.SetMapIndex(k, reflect.ValueOf(redactedValue).Convert(v.Type().Elem()))
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"testing"
+
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+)
+
+func TestRedactSecretsServer(t *testing.T) {
+	cfg := &m.ServerConfig{
+		BindPort: 7000,
+		Auth: m.AuthServerConfig{
+			Method: m.AuthMethodToken,
+			Token:  "secret",
+			OIDC:   m.AuthOIDCServerConfig{Issuer: "https://issuer.example.com"},
+		},
+		WebServer: m.WebServerConfig{User: "admin", Password: "admin-secret"},
+	}
+	RedactSecrets(cfg)
+
+	if cfg.Auth.Token != redactedValue || cfg.WebServer.Password != redactedValue {
+		t.Errorf("expected the secrets to be masked, got token %q and password %q", cfg.Auth.Token, cfg.WebServer.Password)
+	}
+	// other fields pass through
+	if cfg.BindPort != 7000 || cfg.Auth.Method != m.AuthMethodToken ||
+		cfg.Auth.OIDC.Issuer != "https://issuer.example.com" || cfg.WebServer.User != "admin" {
+		t.Errorf("expected the other fields to be kept, got %+v", cfg)
+	}
+}
+
+func TestRedactSecretsClient(t *testing.T) {
+	cfg := &m.ClientConfig{
+		ClientCommonConfig: m.ClientCommonConfig{
+			ServerAddr: "10.0.0.1",
+			User:       "alice",
+			Auth: m.AuthClientConfig{
+				OIDC: m.AuthOIDCClientConfig{
+					ClientID:                 "gkc",
+					ClientSecret:             "oidc-secret",
+					AdditionalEndpointParams: map[string]string{"client_assertion": "jwt", "empty": ""},
+				},
+			},
+			Metadatas: map[string]string{"token": "meta-secret", "team": "ops"},
+		},
+		// the proxies are behind an interface
+		Proxies: []m.TypedProxyConfig{{Type: "http", ProxyConfigurer: &m.HTTPProxyConfig{
+			ProxyBaseConfig: m.ProxyBaseConfig{Name: "web", Type: "http"},
+			HTTPUser:        "bob",
+			HTTPPassword:    "http-secret",
+		}}},
+	}
+	RedactSecrets(cfg)
+
+	oidc := cfg.Auth.OIDC
+	if oidc.ClientSecret != redactedValue || oidc.AdditionalEndpointParams["client_assertion"] != redactedValue {
+		t.Errorf("expected the oidc secrets to be masked, got %+v", oidc)
+	}
+	if cfg.Metadatas["token"] != redactedValue {
+		t.Errorf("expected the token meta to be masked, got %q", cfg.Metadatas["token"])
+	}
+	httpCfg := cfg.Proxies[0].ProxyConfigurer.(*m.HTTPProxyConfig)
+	if httpCfg.HTTPPassword != redactedValue {
+		t.Errorf("expected httpPassword to be masked, got %q", httpCfg.HTTPPassword)
+	}
+
+	// empty secrets and other fields pass through
+	if cfg.Auth.Token != "" || oidc.AdditionalEndpointParams["empty"] != "" {
+		t.Errorf("expected the empty secrets to stay empty, got %q and %q", cfg.Auth.Token, oidc.AdditionalEndpointParams["empty"])
+	}
+	if cfg.ServerAddr != "10.0.0.1" || cfg.User != "alice" || oidc.ClientID != "gkc" ||
+		cfg.Metadatas["team"] != "ops" || httpCfg.HTTPUser != "bob" || httpCfg.Name != "web" {
+		t.Errorf("expected the other fields to be kept, got %+v", cfg)
+	}
+}
+
+func TestRedactSecretsUsers(t *testing.T) {
+	cfg := &m.UsersConfig{Users: []m.UserConfig{
+		{Name: "alice", Token: "alice-secret", AllowDomains: []string{"*.example.com"}},
+		// uses auth.token
+		{Name: "bob"},
+	}}
+	RedactSecrets(cfg)
+
+	if cfg.Users[0].Token != redactedValue {
+		t.Errorf("expected the token of alice to be masked, got %q", cfg.Users[0].Token)
+	}
+	if cfg.Users[1].Token != "" {
+		t.Errorf("expected the empty token of bob to be kept, got %q", cfg.Users[1].Token)
+	}
+	if cfg.Users[0].Name != "alice" || cfg.Users[0].AllowDomains[0] != "*.example.com" {
+		t.Errorf("expected the other fields to be kept, got %+v", cfg.Users[0])
+	}
+}
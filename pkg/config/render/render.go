@@ -0,0 +1,183 @@
+// Package render renders config files as text/template templates with a
+// function map shared by the YAML/JSON/TOML loader and the legacy INI
+// parser.
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/gk7790/gk-zap/pkg/utils/util"
+)
+
+// Execute renders in as a template named name with data.
+func Execute(name string, in []byte, data any) ([]byte, error) {
+	tmpl, err := template.New(name).Funcs(Funcs()).Parse(string(in))
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Funcs returns the functions available in config templates.
+func Funcs() template.FuncMap {
+	return template.FuncMap{
+		"env":                  env,
+		"parseNumberRange":     parseNumberRange,
+		"parseNumberRangePair": parseNumberRangePair,
+		"readFile":             readFile,
+		"hostname":             os.Hostname,
+		"splitList":            splitList,
+		"add":                  add,
+		"sub":                  sub,
+		"mul":                  mul,
+		"div":                  div,
+		"mod":                  mod,
+	}
+}
+
+// env returns the value of the environment variable name, or the first
+// default if it is not set, e.g. {{ env "SERVER_ADDR" "127.0.0.1" }}.
+func env(name string, defaults ...string) string {
+	if v, ok := os.LookupEnv(name); ok {
+		return v
+	}
+	if len(defaults) > 0 {
+		return defaults[0]
+	}
+	return ""
+}
+
+// parseNumberRange expands "1000-1002,2000" to [1000 1001 1002 2000].
+func parseNumberRange(s string) ([]int64, error) {
+	return util.ParseRangeNumbers(s)
+}
+
+type NumberPair struct {
+	First  int64
+	Second int64
+}
+
+// parseNumberRangePair zips two number ranges of the same length, it is
+// useful to map local ports to remote ports one by one.
+func parseNumberRangePair(firstRange, secondRange string) ([]NumberPair, error) {
+	first, err := util.ParseRangeNumbers(firstRange)
+	if err != nil {
+		return nil, err
+	}
+	second, err := util.ParseRangeNumbers(secondRange)
+	if err != nil {
+		return nil, err
+	}
+	if len(first) != len(second) {
+		return nil, fmt.Errorf("first and second range numbers are not in pairs")
+	}
+	pairs := make([]NumberPair, 0, len(first))
+	for i := range first {
+		pairs = append(pairs, NumberPair{First: first[i], Second: second[i]})
+	}
+	return pairs, nil
+}
+
+// readFile returns the content of the file at path without the trailing
+// line break.
+func readFile(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// splitList splits s by sep, the argument order follows sprig so that it
+// can be used in pipelines: {{ env "PORTS" | splitList "," }}.
+func splitList(sep, s string) []string {
+	return strings.Split(s, sep)
+}
+
+func add(a, b any) (int64, error) {
+	x, y, err := toInt64Pair(a, b)
+	return x + y, err
+}
+
+func sub(a, b any) (int64, error) {
+	x, y, err := toInt64Pair(a, b)
+	return x - y, err
+}
+
+func mul(a, b any) (int64, error) {
+	x, y, err := toInt64Pair(a, b)
+	return x * y, err
+}
+
+func div(a, b any) (int64, error) {
+	x, y, err := toInt64Pair(a, b)
+	if err != nil {
+		return 0, err
+	}
+	if y == 0 {
+		return 0, fmt.Errorf("division by zero")
+	}
+	return x / y, nil
+}
+
+func mod(a, b any) (int64, error) {
+	x, y, err := toInt64Pair(a, b)
+	if err != nil {
+		return 0, err
+	}
+	if y == 0 {
+		return 0, fmt.Errorf("division by zero")
+	}
+	return x % y, nil
+}
+
+func toInt64Pair(a, b any) (int64, int64, error) {
+	x, err := toInt64(a)
+	if err != nil {
+		return 0, 0, err
+	}
+	y, err := toInt64(b)
+	if err != nil {
+		return 0, 0, err
+	}
+	return x, y, nil
+}
+
+func toInt64(v any) (int64, error) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), nil
+	case int8:
+		return int64(n), nil
+	case int16:
+		return int64(n), nil
+	case int32:
+		return int64(n), nil
+	case int64:
+		return n, nil
+	case uint:
+		return int64(n), nil
+	case uint8:
+		return int64(n), nil
+	case uint16:
+		return int64(n), nil
+	case uint32:
+		return int64(n), nil
+	case uint64:
+		return int64(n), nil
+	case string:
+		return strconv.ParseInt(strings.TrimSpace(n), 10, 64)
+	default:
+		return 0, fmt.Errorf("%v (%T) is not a number", v, v)
+	}
+}
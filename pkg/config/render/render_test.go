@@ -0,0 +1,86 @@
+package render
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExecute(t *testing.T) {
+	t.Setenv("GK_TEST_ADDR", "10.0.0.1")
+	t.Setenv("GK_TEST_EMPTY", "")
+	t.Setenv("GK_TEST_PORTS", "22,80")
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("secret\r\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		in      string
+		want    string
+		wantErr string
+	}{
+		{name: "env", in: `{{ env "GK_TEST_ADDR" }}`, want: "10.0.0.1"},
+		{name: "env default", in: `{{ env "GK_TEST_MISSING" "127.0.0.1" }}`, want: "127.0.0.1"},
+		{name: "env without default", in: `{{ env "GK_TEST_MISSING" }}`, want: ""},
+		// a variable set to "" doesn't fall back to the default
+		{name: "env empty", in: `{{ env "GK_TEST_EMPTY" "127.0.0.1" }}`, want: ""},
+		{
+			name: "number range",
+			in:   `{{ range parseNumberRange "1000-1002,2000" }}{{ . }} {{ end }}`,
+			want: "1000 1001 1002 2000 ",
+		},
+		{name: "invalid number range", in: `{{ parseNumberRange "a-b" }}`, wantErr: "parseNumberRange"},
+		{
+			name: "number range pair",
+			in:   `{{ range parseNumberRangePair "6000-6001" "22,80" }}{{ .First }}:{{ .Second }} {{ end }}`,
+			want: "6000:22 6001:80 ",
+		},
+		{
+			name:    "number ranges not in pairs",
+			in:      `{{ parseNumberRangePair "6000-6002" "22,80" }}`,
+			wantErr: "not in pairs",
+		},
+		{name: "read file", in: `{{ readFile "` + tokenFile + `" }}`, want: "secret"},
+		{
+			name: "split list",
+			in:   `{{ range env "GK_TEST_PORTS" | splitList "," }}[{{ . }}]{{ end }}`,
+			want: "[22][80]",
+		},
+		{name: "add", in: `{{ add 6000 22 }}`, want: "6022"},
+		{name: "add string", in: `{{ add "6000" 22 }}`, want: "6022"},
+		{name: "sub", in: `{{ sub 6022 6000 }}`, want: "22"},
+		{name: "mul", in: `{{ mul 3 -4 }}`, want: "-12"},
+		{name: "div", in: `{{ div 7 2 }}`, want: "3"},
+		{name: "mod", in: `{{ mod 7 2 }}`, want: "1"},
+		{name: "div by zero", in: `{{ div 7 0 }}`, wantErr: "division by zero"},
+		{name: "mod by zero", in: `{{ mod 7 "0" }}`, wantErr: "division by zero"},
+		{name: "not a number", in: `{{ add 1 "a" }}`, wantErr: "invalid syntax"},
+		{name: "not a number type", in: `{{ mul 1 1.5 }}`, wantErr: "1.5 (float64) is not a number"},
+		{
+			// the ports of the loop are computed from the range
+			name: "pipeline",
+			in:   `{{ range $i, $p := parseNumberRange "22,80" }}{{ add 6000 $i }}={{ $p }} {{ end }}`,
+			want: "6000=22 6001=80 ",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := Execute("gkc.yaml", []byte(tt.in), nil)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(out) != tt.want {
+				t.Fatalf("expected %q, got %q", tt.want, out)
+			}
+		})
+	}
+}
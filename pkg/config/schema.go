@@ -0,0 +1,227 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+
+	m1 "github.com/gk7790/gk-zap/pkg/config/model"
+)
+
+//go:generate go run ./internal/fielddocs -model ./model -o fielddocs_gen.go
+
+const schemaDraft = "http://json-schema.org/draft-07/schema#"
+
+// Schema is a JSON Schema (draft-07) document, only the keywords used by
+// the config schema are supported.
+type Schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties any                `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	Const                any                `json:"const,omitempty"`
+	Default              any                `json:"default,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+	If                   *Schema            `json:"if,omitempty"`
+	Then                 *Schema            `json:"then,omitempty"`
+}
+
+// ServerConfigSchema returns the JSON Schema of the server config file.
+func ServerConfigSchema() *Schema {
+	c := &m1.ServerConfig{}
+	_ = c.Complete()
+
+	s := newSchemaBuilder().build(reflect.TypeOf(c), reflect.ValueOf(c))
+	s.Schema = schemaDraft
+	s.Title = "gks configuration"
+	return s
+}
+
+// ClientConfigSchema returns the JSON Schema of the client config file.
+func ClientConfigSchema() *Schema {
+	c := &m1.ClientConfig{}
+	_ = c.Complete()
+	// the default is read from the environment, it doesn't belong to the schema
+	c.Transport.ProxyURL = ""
+
+	s := newSchemaBuilder().build(reflect.TypeOf(c), reflect.ValueOf(c))
+	s.Schema = schemaDraft
+	s.Title = "gkc configuration"
+	return s
+}
+
+var schemaEnums = map[reflect.Type][]any{
+	reflect.TypeOf(m1.AuthMethod("")):          {m1.AuthMethodToken, m1.AuthMethodOIDC, m1.AuthMethodMTLS},
+	reflect.TypeOf(m1.AuthScope("")):           {m1.AuthScopeHeartBeats, m1.AuthScopeNewWorkConns},
+	reflect.TypeOf(m1.PolicyAction("")):        {m1.PolicyActionAllow, m1.PolicyActionDeny, m1.PolicyActionModify},
+	reflect.TypeOf(m1.PluginFailurePolicy("")): {m1.PluginFailurePolicyReject, m1.PluginFailurePolicyAllow},
+}
+
+type schemaBuilder struct {
+	// type name -> field name -> doc
+	docs map[string]map[string]string
+}
+
+func newSchemaBuilder() *schemaBuilder {
+	return &schemaBuilder{docs: modelFieldDocs}
+}
+
+// build returns the schema of t. v is a completed value of t which provides
+// the defaults, it may be invalid if there is no default.
+func (b *schemaBuilder) build(t reflect.Type, v reflect.Value) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+		if v.IsValid() {
+			if v.IsNil() {
+				v = reflect.Value{}
+			} else {
+				v = v.Elem()
+			}
+		}
+	}
+
+	switch t {
+	case typedProxyConfigType:
+		return b.proxyUnion()
+	case typedVisitorConfigType:
+		return b.visitorUnion()
+	case typedClientPluginOptionsType:
+		return b.clientPluginUnion()
+	}
+	if reflect.PointerTo(t).Implements(jsonUnmarshalerType) {
+		return &Schema{Type: "string"}
+	}
+
+	s := &Schema{}
+	switch t.Kind() {
+	case reflect.String:
+		s.Type = "string"
+		s.Enum = schemaEnums[t]
+	case reflect.Bool:
+		s.Type = "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		s.Type = "integer"
+	case reflect.Float32, reflect.Float64:
+		s.Type = "number"
+	case reflect.Slice, reflect.Array:
+		s.Type = "array"
+		s.Items = b.build(t.Elem(), reflect.Value{})
+		return s
+	case reflect.Map:
+		s.Type = "object"
+		s.AdditionalProperties = b.build(t.Elem(), reflect.Value{})
+		return s
+	case reflect.Struct:
+		s.Type = "object"
+		s.Properties = make(map[string]*Schema)
+		s.AdditionalProperties = false
+		b.addProperties(s, t, v)
+		return s
+	default:
+		return s
+	}
+
+	if v.IsValid() && !v.IsZero() {
+		s.Default = v.Interface()
+	}
+	return s
+}
+
+// addProperties adds the fields of struct t to s, the fields of embedded
+// structs are promoted like encoding/json does.
+func (b *schemaBuilder) addProperties(s *Schema, t reflect.Type, v reflect.Value) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		var fv reflect.Value
+		if v.IsValid() {
+			fv = v.Field(i)
+		}
+
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			b.addProperties(s, f.Type, fv)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		ps := b.build(f.Type, fv)
+		ps.Description = b.docs[t.Name()][f.Name]
+		s.Properties[name] = ps
+	}
+}
+
+func (b *schemaBuilder) proxyUnion() *Schema {
+	g := &m1.ClientCommonConfig{}
+	branches := make(map[string]any)
+	for _, typ := range m1.ProxyTypes() {
+		pc := m1.NewProxyConfigurerByType(typ)
+		pc.Complete(g)
+		branches[string(typ)] = pc
+	}
+	return union(b, m1.ProxyTypes(), branches, true)
+}
+
+func (b *schemaBuilder) visitorUnion() *Schema {
+	g := &m1.ClientCommonConfig{}
+	branches := make(map[string]any)
+	for _, typ := range m1.VisitorTypes() {
+		vc := m1.NewVisitorConfigurerByType(typ)
+		vc.Complete(g)
+		branches[string(typ)] = vc
+	}
+	return union(b, m1.VisitorTypes(), branches, true)
+}
+
+func (b *schemaBuilder) clientPluginUnion() *Schema {
+	branches := make(map[string]any)
+	for _, typ := range m1.ClientPluginTypes() {
+		po := m1.NewClientPluginOptionsByType(typ)
+		po.Complete()
+		branches[typ] = po
+	}
+	return union(b, m1.ClientPluginTypes(), branches, false)
+}
+
+// union returns the schema of a typed union discriminated by its "type"
+// field, each branch is selected with if/then so editors only offer the
+// fields of the given type.
+func union[T ~string](b *schemaBuilder, types []T, branches map[string]any, required bool) *Schema {
+	names := make([]any, 0, len(types))
+	for _, t := range types {
+		names = append(names, string(t))
+	}
+	s := &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"type": {Type: "string", Enum: names},
+		},
+	}
+	if required {
+		s.Required = []string{"type"}
+	}
+	for _, name := range names {
+		c := branches[name.(string)]
+		s.AllOf = append(s.AllOf, &Schema{
+			If: &Schema{
+				Properties: map[string]*Schema{"type": {Const: name}},
+				Required:   []string{"type"},
+			},
+			Then: b.build(reflect.TypeOf(c), reflect.ValueOf(c)),
+		})
+	}
+	return s
+}
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+// decodeSchema marshals s and decodes it into generic JSON values, like an
+// editor reads it.
+func decodeSchema(t *testing.T, s *Schema) map[string]any {
+	t.Helper()
+	out, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(out, &doc); err != nil {
+		t.Fatalf("invalid schema json: %v", err)
+	}
+	return doc
+}
+
+// property returns the schema at the key path of doc.
+func property(t *testing.T, doc map[string]any, path ...string) map[string]any {
+	t.Helper()
+	for _, name := range path {
+		props, _ := doc["properties"].(map[string]any)
+		p, ok := props[name].(map[string]any)
+		if !ok {
+			t.Fatalf("schema has no property %q", name)
+		}
+		doc = p
+	}
+	return doc
+}
+
+func TestConfigSchema(t *testing.T) {
+	tests := []struct {
+		name      string
+		schema    *Schema
+		title     string
+		wantProps []string
+	}{
+		{
+			name:      "server",
+			schema:    ServerConfigSchema(),
+			title:     "gks configuration",
+			wantProps: []string{"bindAddr", "bindPort", "auth", "transport", "webServer", "log", "httpPlugins", "usersFile", "policyFile"},
+		},
+		{
+			name:      "client",
+			schema:    ClientConfigSchema(),
+			title:     "gkc configuration",
+			wantProps: []string{"serverAddr", "serverPort", "auth", "transport", "webServer", "log", "includes", "proxies", "visitors"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := decodeSchema(t, tt.schema)
+			if doc["$schema"] != schemaDraft || doc["title"] != tt.title || doc["type"] != "object" {
+				t.Fatalf("unexpected schema header %v %v %v", doc["$schema"], doc["title"], doc["type"])
+			}
+			// unknown fields are reported by editors like in strict mode
+			if doc["additionalProperties"] != false {
+				t.Errorf("expected additionalProperties false, got %v", doc["additionalProperties"])
+			}
+			for _, name := range tt.wantProps {
+				property(t, doc, name)
+			}
+
+			method := property(t, doc, "auth", "method")
+			if enum, _ := method["enum"].([]any); !slices.Contains(enum, any("token")) || !slices.Contains(enum, any("mtls")) {
+				t.Errorf("unexpected auth.method enum %v", method["enum"])
+			}
+		})
+	}
+}
+
+func TestServerConfigSchemaDefaults(t *testing.T) {
+	doc := decodeSchema(t, ServerConfigSchema())
+	bindPort := property(t, doc, "bindPort")
+	if bindPort["type"] != "integer" || bindPort["default"] != float64(7000) {
+		t.Errorf("unexpected bindPort schema %v", bindPort)
+	}
+	// the descriptions come from the doc comments of the model
+	if bindPort["description"] == nil || bindPort["description"] == "" {
+		t.Error("expected bindPort to have a description")
+	}
+}
+
+func TestClientConfigSchemaProxies(t *testing.T) {
+	doc := decodeSchema(t, ClientConfigSchema())
+	items, ok := property(t, doc, "proxies")["items"].(map[string]any)
+	if !ok {
+		t.Fatal("expected proxies to be an array")
+	}
+	if required, _ := items["required"].([]any); !slices.Contains(required, any("type")) {
+		t.Errorf("expected the type of a proxy to be required, got %v", items["required"])
+	}
+
+	// every proxy type selects the fields of its branch
+	types, _ := property(t, items, "type")["enum"].([]any)
+	branches, _ := items["allOf"].([]any)
+	if !slices.Contains(types, any("tcp")) || len(branches) != len(types) {
+		t.Fatalf("expected a branch for each of the proxy types %v, got %d", types, len(branches))
+	}
+	for _, raw := range branches {
+		branch := raw.(map[string]any)
+		typ := property(t, branch["if"].(map[string]any), "type")["const"]
+		then := branch["then"].(map[string]any)
+		property(t, then, "name")
+		if typ == "tcp" {
+			property(t, then, "remotePort")
+		}
+	}
+}
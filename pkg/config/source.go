@@ -0,0 +1,249 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/pelletier/go-toml/v2/unstable"
+	"gopkg.in/yaml.v3"
+)
+
+type configFormat string
+
+const (
+	formatYAML configFormat = "yaml"
+	formatJSON configFormat = "json"
+	formatTOML configFormat = "toml"
+)
+
+// detectFormat returns the config format by the file extension. Files
+// without a known extension are treated as YAML.
+func detectFormat(path string) configFormat {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		return formatTOML
+	case ".json":
+		return formatJSON
+	default:
+		return formatYAML
+	}
+}
+
+// toJSON converts content in the given format to JSON so that it can be
+// decoded through the json tags and custom UnmarshalJSON methods of the
+// config model.
+func toJSON(content []byte, format configFormat) ([]byte, error) {
+	switch format {
+	case formatTOML:
+		v := make(map[string]any)
+		if err := toml.Unmarshal(content, &v); err != nil {
+			return nil, err
+		}
+		return json.Marshal(v)
+	case formatJSON:
+		// validate with the json package for precise syntax error offsets
+		if err := json.Unmarshal(content, new(any)); err != nil {
+			return nil, err
+		}
+		return yamlToJSON(content)
+	default:
+		return yamlToJSON(content)
+	}
+}
+
+// sourceLines maps key paths like "transport.tls.enable" or
+// "proxies[1].localPort" to the line where they are defined.
+type sourceLines map[string]int
+
+// lookup returns the line of path, or of its closest parent if path itself
+// is not found.
+func (s sourceLines) lookup(path string) int {
+	for path != "" {
+		if line, ok := s[path]; ok {
+			return line
+		}
+		i := strings.LastIndexAny(path, ".[")
+		if i < 0 {
+			break
+		}
+		path = path[:i]
+	}
+	return 0
+}
+
+func buildSourceLines(content []byte, format configFormat) sourceLines {
+	lines := make(sourceLines)
+	switch format {
+	case formatTOML:
+		buildTOMLSourceLines(content, lines)
+	default:
+		var node yaml.Node
+		if err := yaml.Unmarshal(content, &node); err == nil {
+			buildYAMLSourceLines(&node, "", lines)
+		}
+	}
+	return lines
+}
+
+func joinKeyPath(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+func buildYAMLSourceLines(node *yaml.Node, path string, lines sourceLines) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, n := range node.Content {
+			buildYAMLSourceLines(n, path, lines)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			p := joinKeyPath(path, key.Value)
+			lines[p] = key.Line
+			buildYAMLSourceLines(value, p, lines)
+		}
+	case yaml.SequenceNode:
+		for i, n := range node.Content {
+			p := path + "[" + strconv.Itoa(i) + "]"
+			lines[p] = n.Line
+			buildYAMLSourceLines(n, p, lines)
+		}
+	}
+}
+
+func buildTOMLSourceLines(content []byte, lines sourceLines) {
+	p := unstable.Parser{}
+	p.Reset(content)
+
+	// current index of every array table, like "proxies" -> 2
+	arrayIndex := make(map[string]int)
+	// tablePath resolves a table key to a path, array tables on the way are
+	// replaced by their current element.
+	tablePath := func(keys []string) string {
+		path, name := "", ""
+		for _, k := range keys {
+			path = joinKeyPath(path, k)
+			name = joinKeyPath(name, k)
+			if idx, ok := arrayIndex[name]; ok {
+				path += "[" + strconv.Itoa(idx) + "]"
+			}
+		}
+		return path
+	}
+	keyOf := func(n *unstable.Node) ([]string, int) {
+		keys := []string{}
+		line := 0
+		it := n.Key()
+		for it.Next() {
+			k := it.Node()
+			keys = append(keys, string(k.Data))
+			if line == 0 {
+				line = p.Shape(k.Raw).Start.Line
+			}
+		}
+		return keys, line
+	}
+
+	var walkValue func(n *unstable.Node, path string)
+	walkKeyValue := func(n *unstable.Node, prefix string) {
+		keys, line := keyOf(n)
+		path := prefix
+		for _, k := range keys {
+			path = joinKeyPath(path, k)
+		}
+		lines[path] = line
+		walkValue(n.Value(), path)
+	}
+	walkValue = func(n *unstable.Node, path string) {
+		switch n.Kind {
+		case unstable.InlineTable:
+			it := n.Children()
+			for it.Next() {
+				walkKeyValue(it.Node(), path)
+			}
+		case unstable.Array:
+			it := n.Children()
+			for i := 0; it.Next(); i++ {
+				p := path + "[" + strconv.Itoa(i) + "]"
+				if line, ok := lines[path]; ok {
+					lines[p] = line
+				}
+				walkValue(it.Node(), p)
+			}
+		}
+	}
+
+	prefix := ""
+	for p.NextExpression() {
+		e := p.Expression()
+		switch e.Kind {
+		case unstable.Table:
+			keys, line := keyOf(e)
+			prefix = tablePath(keys)
+			lines[prefix] = line
+		case unstable.ArrayTable:
+			keys, line := keyOf(e)
+			name := strings.Join(keys, ".")
+			if idx, ok := arrayIndex[name]; ok {
+				arrayIndex[name] = idx + 1
+			} else {
+				arrayIndex[name] = 0
+			}
+			prefix = tablePath(keys)
+			lines[prefix] = line
+		case unstable.KeyValue:
+			walkKeyValue(e, prefix)
+		}
+	}
+}
+
+var yamlLineRe = regexp.MustCompile(`^yaml: line (\d+): `)
+
+// parseErrorWithLine formats an error returned while parsing content as
+// "file:line: message" if the line is known.
+func parseErrorWithLine(path string, content []byte, err error) error {
+	var (
+		decodeErr *toml.DecodeError
+		syntaxErr *json.SyntaxError
+	)
+	switch {
+	case errors.As(err, &decodeErr):
+		row, _ := decodeErr.Position()
+		return fmt.Errorf("%s:%d: %s", path, row, decodeErr.Error())
+	case errors.As(err, &syntaxErr):
+		line := bytes.Count(content[:min(int(syntaxErr.Offset), len(content))], []byte("\n")) + 1
+		return fmt.Errorf("%s:%d: %s", path, line, syntaxErr.Error())
+	}
+	if m := yamlLineRe.FindStringSubmatch(err.Error()); m != nil {
+		return fmt.Errorf("%s:%s: %s", path, m[1], strings.TrimPrefix(err.Error(), m[0]))
+	}
+	return fmt.Errorf("%s: %w", path, err)
+}
+
+// decodeErrorWithLine formats an error returned while decoding the element
+// at keyPath, which may be empty for the whole file.
+func decodeErrorWithLine(path string, lines sourceLines, keyPath string, err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		keyPath = joinKeyPath(keyPath, typeErr.Field)
+	}
+
+	location := path
+	if line := lines.lookup(keyPath); line > 0 {
+		location += ":" + strconv.Itoa(line)
+	}
+	if keyPath != "" {
+		return fmt.Errorf("%s: %s: %w", location, keyPath, err)
+	}
+	return fmt.Errorf("%s: %w", location, err)
+}
@@ -0,0 +1,186 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	m1 "github.com/gk7790/gk-zap/pkg/config/model"
+)
+
+var (
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+	typedProxyConfigType         = reflect.TypeOf(m1.TypedProxyConfig{})
+	typedVisitorConfigType       = reflect.TypeOf(m1.TypedVisitorConfig{})
+	typedClientPluginOptionsType = reflect.TypeOf(m1.TypedClientPluginOptions{})
+)
+
+// findUnknownFields walks v, the generic form of a JSON document, along the
+// json tags of t and returns the key paths that t does not know, like
+// "transport.tcpMuxx" or "proxies[0].localPortt".
+func findUnknownFields(v any, t reflect.Type, path string) []string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	// typed unions are resolved by their "type" field
+	switch t {
+	case typedProxyConfigType, typedVisitorConfigType, typedClientPluginOptionsType:
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		concrete := concreteTypeOf(t, obj)
+		if concrete == nil {
+			return nil
+		}
+		return findUnknownFields(v, concrete, path)
+	}
+	if reflect.PointerTo(t).Implements(jsonUnmarshalerType) {
+		return nil
+	}
+
+	var unknown []string
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		fields := jsonFields(t)
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		for _, k := range keys {
+			p := joinKeyPath(path, k)
+			ft, ok := lookupJSONField(fields, k)
+			if !ok {
+				unknown = append(unknown, p)
+				continue
+			}
+			unknown = append(unknown, findUnknownFields(obj[k], ft, p)...)
+		}
+	case reflect.Slice, reflect.Array:
+		arr, ok := v.([]any)
+		if !ok {
+			return nil
+		}
+		for i, item := range arr {
+			unknown = append(unknown, findUnknownFields(item, t.Elem(), path+"["+strconv.Itoa(i)+"]")...)
+		}
+	case reflect.Map:
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		for k, item := range obj {
+			unknown = append(unknown, findUnknownFields(item, t.Elem(), joinKeyPath(path, k))...)
+		}
+		slices.Sort(unknown)
+	}
+	return unknown
+}
+
+func concreteTypeOf(t reflect.Type, obj map[string]any) reflect.Type {
+	typ, _ := obj["type"].(string)
+	var c any
+	switch t {
+	case typedProxyConfigType:
+		if pc := m1.NewProxyConfigurerByType(m1.ProxyType(typ)); pc != nil {
+			c = pc
+		}
+	case typedVisitorConfigType:
+		if vc := m1.NewVisitorConfigurerByType(m1.VisitorType(typ)); vc != nil {
+			c = vc
+		}
+	case typedClientPluginOptionsType:
+		if po := m1.NewClientPluginOptionsByType(typ); po != nil {
+			c = po
+		}
+	}
+	if c == nil {
+		return nil
+	}
+	return reflect.TypeOf(c)
+}
+
+// jsonFields returns the json names of the fields of struct type t,
+// including the promoted fields of embedded structs.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			for ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				for k, v := range jsonFields(ft) {
+					if _, ok := fields[k]; !ok {
+						fields[k] = v
+					}
+				}
+			}
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+// lookupJSONField matches key like encoding/json does, preferring an exact
+// match and falling back to a case-insensitive one.
+func lookupJSONField(fields map[string]reflect.Type, key string) (reflect.Type, bool) {
+	if t, ok := fields[key]; ok {
+		return t, true
+	}
+	for name, t := range fields {
+		if strings.EqualFold(name, key) {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// checkUnknownFields returns an error listing every unknown key in the JSON
+// document b, with the line where it is defined.
+func (f *configFile) checkUnknownFields(keyPath string, b []byte, t reflect.Type) error {
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil
+	}
+	unknown := findUnknownFields(v, t, keyPath)
+	if len(unknown) == 0 {
+		return nil
+	}
+	slices.SortStableFunc(unknown, func(a, b string) int {
+		return f.lines.lookup(a) - f.lines.lookup(b)
+	})
+	msgs := make([]string, 0, len(unknown))
+	for _, p := range unknown {
+		location := f.path
+		if line := f.lines.lookup(p); line > 0 {
+			location += ":" + strconv.Itoa(line)
+		}
+		msgs = append(msgs, fmt.Sprintf("%s: unknown field %q", location, p))
+	}
+	return fmt.Errorf("%s", strings.Join(msgs, "\n"))
+}
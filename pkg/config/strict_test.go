@@ -0,0 +1,100 @@
+package config
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStrictUnknownFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		server  bool
+		// wantErrs are the lines of the error, "DIR" is the directory of
+		// the file
+		wantErrs []string
+	}{
+		{
+			name:     "nested server field",
+			file:     "gks.yaml",
+			content:  "bindPort: 7000\ntransport:\n  tcpMuxx: true\n",
+			server:   true,
+			wantErrs: []string{`DIR/gks.yaml:3: unknown field "transport.tcpMuxx"`},
+		},
+		{
+			name:     "toml",
+			file:     "gks.toml",
+			content:  "bindPort = 7000\n\n[transport]\ntcpMuxx = true\n",
+			server:   true,
+			wantErrs: []string{`DIR/gks.toml:4: unknown field "transport.tcpMuxx"`},
+		},
+		{
+			name:    "proxy list entries",
+			file:    "gkc.yaml",
+			content: "serverAddr: 10.0.0.1\nproxies:\n  - name: ssh\n    type: tcp\n    localPort: 22\n  - name: web\n    type: tcp\n    localPortt: 80\n",
+			wantErrs: []string{
+				`DIR/gkc.yaml:8: unknown field "proxies[1].localPortt"`,
+			},
+		},
+		{
+			// the fields of the proxy type apply, remotePort is a tcp field
+			name:     "field of another proxy type",
+			file:     "gkc.yaml",
+			content:  "proxies:\n  - name: web\n    type: http\n    localPort: 80\n    remotePort: 8080\n",
+			wantErrs: []string{`DIR/gkc.yaml:5: unknown field "proxies[0].remotePort"`},
+		},
+		{
+			name:     "plugin options",
+			file:     "gkc.yaml",
+			content:  "proxies:\n  - name: web\n    type: https\n    plugin:\n      type: https2http\n      localAddrr: 127.0.0.1:80\n",
+			wantErrs: []string{`DIR/gkc.yaml:6: unknown field "proxies[0].plugin.localAddrr"`},
+		},
+		{
+			name:     "visitor list entries",
+			file:     "gkc.yaml",
+			content:  "visitors:\n  - name: ssh\n    type: stcp\n    serverName: ssh\n    bindPortt: 6000\n",
+			wantErrs: []string{`DIR/gkc.yaml:5: unknown field "visitors[0].bindPortt"`},
+		},
+		{
+			// every unknown field is reported, in the order of the file
+			name:    "several fields",
+			file:    "gkc.yaml",
+			content: "serverAddrr: 10.0.0.1\ntransport:\n  tls:\n    enablee: true\nauth:\n  tokenn: abc\n",
+			wantErrs: []string{
+				`DIR/gkc.yaml:1: unknown field "serverAddrr"`,
+				`DIR/gkc.yaml:4: unknown field "transport.tls.enablee"`,
+				`DIR/gkc.yaml:6: unknown field "auth.tokenn"`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeFiles(t, map[string]string{tt.file: tt.content})
+			path := filepath.Join(dir, tt.file)
+			load := func(strict bool) error {
+				if tt.server {
+					_, err := LoadServerConfig(path, strict)
+					return err
+				}
+				_, _, _, err := LoadClientConfig(path, strict)
+				return err
+			}
+
+			err := load(true)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			got := strings.Split(strings.ReplaceAll(err.Error(), dir, "DIR"), "\n")
+			if strings.Join(got, "\n") != strings.Join(tt.wantErrs, "\n") {
+				t.Fatalf("expected errors\n%s\ngot\n%s", strings.Join(tt.wantErrs, "\n"), strings.Join(got, "\n"))
+			}
+
+			// unknown fields are ignored if not strict
+			if err := load(false); err != nil {
+				t.Fatalf("unexpected error without strict: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package validation
+
+import (
+	"fmt"
+	"slices"
+
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+	"github.com/samber/lo"
+)
+
+var (
+	SupportedTransportProtocols = []string{"tcp", "quic"}
+
+	SupportedAuthMethods = []m.AuthMethod{
+		m.AuthMethodToken,
+		m.AuthMethodOIDC,
+		m.AuthMethodMTLS,
+	}
+
+	SupportedAuthAdditionalScopes = []m.AuthScope{
+		m.AuthScopeHeartBeats,
+		m.AuthScopeNewWorkConns,
+	}
+)
+
+func ValidateClientCommonConfig(c *m.ClientCommonConfig) (Warning, error) {
+	var (
+		warnings Warning
+		errs     error
+	)
+
+	if !slices.Contains(SupportedAuthMethods, c.Auth.Method) {
+		errs = AppendError(errs, fmt.Errorf("auth.method: invalid value %q, optional values are %v", c.Auth.Method, SupportedAuthMethods))
+	}
+	for _, scope := range c.Auth.AdditionalScopes {
+		if !slices.Contains(SupportedAuthAdditionalScopes, scope) {
+			errs = AppendError(errs, fmt.Errorf("auth.additionalScopes: invalid value %q, optional values are %v", scope, SupportedAuthAdditionalScopes))
+		}
+	}
+
+	if lo.FromPtr(c.Auth.TokenSwitchDelay) < 0 {
+		errs = AppendError(errs, fmt.Errorf("auth.tokenSwitchDelay: must not be negative"))
+	}
+
+	if c.Auth.Method == m.AuthMethodOIDC {
+		if c.Auth.OIDC.TokenEndpointURL == "" {
+			errs = AppendError(errs, fmt.Errorf("auth.oidc.tokenEndpointURL: must be set when auth.method is oidc"))
+		}
+		errs = AppendError(errs, validateFileExists(c.Auth.OIDC.TrustedCaFile, "auth.oidc.trustedCaFile"))
+	}
+	if c.Auth.Method == m.AuthMethodMTLS {
+		if c.Transport.Protocol != "tcp" || !lo.FromPtr(c.Transport.TLS.Enable) {
+			errs = AppendError(errs, fmt.Errorf("auth.method: mtls requires transport.protocol tcp with transport.tls.enable"))
+		}
+		if c.Transport.TLS.CertFile == "" || c.Transport.TLS.KeyFile == "" {
+			errs = AppendError(errs, fmt.Errorf("transport.tls.certFile and transport.tls.keyFile: must be set when auth.method is mtls"))
+		}
+	}
+
+	errs = AppendError(errs, ValidatePort(c.ServerPort, "serverPort"))
+	errs = AppendError(errs, validateWebServerConfig(&c.WebServer))
+	errs = AppendError(errs, validateLogConfig(&c.Log))
+
+	if !slices.Contains(SupportedTransportProtocols, c.Transport.Protocol) {
+		errs = AppendError(errs, fmt.Errorf("transport.protocol: invalid value %q, optional values are %v", c.Transport.Protocol, SupportedTransportProtocols))
+	}
+	if c.Transport.PoolCount < 0 {
+		errs = AppendError(errs, fmt.Errorf("transport.poolCount: must not be negative"))
+	}
+
+	if lo.FromPtr(c.Transport.TLS.Enable) {
+		errs = AppendError(errs, validateTLSFiles(&c.Transport.TLS.TLSConfig, "transport.tls"))
+	} else if c.Transport.TLS.CertFile != "" || c.Transport.TLS.KeyFile != "" || c.Transport.TLS.TrustedCaFile != "" {
+		warnings = AppendError(warnings, fmt.Errorf("transport.tls.enable is false, tls files will be ignored"))
+	}
+	return warnings, errs
+}
+
+func ValidateProxyConfigurerForClient(c m.ProxyConfigurer) error {
+	base := c.GetBaseConfig()
+	if base.Name == "" {
+		return fmt.Errorf("name should not be empty")
+	}
+
+	var errs error
+	if base.Plugin.ClientPluginOptions == nil {
+		if base.LocalPort <= 0 || base.LocalPort > 65535 {
+			errs = AppendError(errs, fmt.Errorf("localPort: port number %d must be within the range 1..65535", base.LocalPort))
+		}
+	}
+	if !slices.Contains([]string{"", "client", "server"}, base.Transport.BandwidthLimitMode) {
+		errs = AppendError(errs, fmt.Errorf("transport.bandwidthLimitMode: invalid value %q, optional values are client and server", base.Transport.BandwidthLimitMode))
+	}
+
+	switch v := c.(type) {
+	case *m.TCPProxyConfig:
+		errs = AppendError(errs, ValidatePort(v.RemotePort, "remotePort"))
+	case *m.UDPProxyConfig:
+		errs = AppendError(errs, ValidatePort(v.RemotePort, "remotePort"))
+	case *m.HTTPProxyConfig:
+		errs = AppendError(errs, validateDomainConfig(&v.DomainConfig))
+	case *m.HTTPSProxyConfig:
+		errs = AppendError(errs, validateDomainConfig(&v.DomainConfig))
+	case *m.TCPMuxProxyConfig:
+		errs = AppendError(errs, validateDomainConfig(&v.DomainConfig))
+		if v.Multiplexer != string(m.TCPMultiplexerHTTPConnect) {
+			errs = AppendError(errs, fmt.Errorf("multiplexer: invalid value %q, optional values are %s", v.Multiplexer, m.TCPMultiplexerHTTPConnect))
+		}
+	}
+	return errs
+}
+
+func validateDomainConfig(c *m.DomainConfig) error {
+	if len(c.CustomDomains) == 0 && c.SubDomain == "" {
+		return fmt.Errorf("customDomains and subdomain should have at least one of them set")
+	}
+	return nil
+}
+
+func ValidateVisitorConfigurer(c m.VisitorConfigurer) error {
+	base := c.GetBaseConfig()
+	if base.Name == "" {
+		return fmt.Errorf("name should not be empty")
+	}
+
+	var errs error
+	if base.ServerName == "" {
+		errs = AppendError(errs, fmt.Errorf("serverName should not be empty"))
+	}
+	// a negative bindPort only receives connections from other visitors
+	if base.BindPort == 0 {
+		errs = AppendError(errs, fmt.Errorf("bindPort should not be 0"))
+	} else if base.BindPort > 65535 {
+		errs = AppendError(errs, fmt.Errorf("bindPort: port number %d must not be greater than 65535", base.BindPort))
+	}
+	return errs
+}
+
+// ValidateClientConfig validates the common config and every proxy and
+// visitor. Errors are prefixed with the name of the proxy or visitor.
+func ValidateClientConfig(c *m.ClientCommonConfig, proxyCfgs []m.ProxyConfigurer, visitorCfgs []m.VisitorConfigurer) (Warning, error) {
+	var (
+		warnings Warning
+		errs     error
+	)
+	if c != nil {
+		warning, err := ValidateClientCommonConfig(c)
+		warnings = AppendError(warnings, warning)
+		errs = AppendError(errs, err)
+	}
+
+	proxyNames := make(map[string]struct{})
+	for _, c := range proxyCfgs {
+		name := c.GetBaseConfig().Name
+		errs = AppendError(errs, withPrefix(fmt.Sprintf("proxy [%s]", name), ValidateProxyConfigurerForClient(c)))
+		if _, ok := proxyNames[name]; ok {
+			errs = AppendError(errs, fmt.Errorf("proxy [%s]: duplicate name", name))
+		}
+		proxyNames[name] = struct{}{}
+	}
+
+	visitorNames := make(map[string]struct{})
+	for _, c := range visitorCfgs {
+		name := c.GetBaseConfig().Name
+		errs = AppendError(errs, withPrefix(fmt.Sprintf("visitor [%s]", name), ValidateVisitorConfigurer(c)))
+		if _, ok := visitorNames[name]; ok {
+			errs = AppendError(errs, fmt.Errorf("visitor [%s]: duplicate name", name))
+		}
+		visitorNames[name] = struct{}{}
+	}
+	for _, c := range visitorCfgs {
+		v, ok := c.(*m.STCPVisitorConfig)
+		if !ok || v.FallbackTo == "" {
+			continue
+		}
+		if v.FallbackTo == v.Name {
+			errs = AppendError(errs, fmt.Errorf("visitor [%s]: fallbackTo: must not be the visitor itself", v.Name))
+		} else if _, ok := visitorNames[v.FallbackTo]; !ok {
+			errs = AppendError(errs, fmt.Errorf("visitor [%s]: fallbackTo: visitor [%s] is not defined", v.Name, v.FallbackTo))
+		}
+	}
+	return warnings, errs
+}
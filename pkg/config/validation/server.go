@@ -0,0 +1,373 @@
+package validation
+
+import (
+	"fmt"
+	"net/netip"
+	"path"
+	"slices"
+
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+	"github.com/gk7790/gk-zap/pkg/config/types"
+	plugin "github.com/gk7790/gk-zap/pkg/hook/server"
+	"github.com/samber/lo"
+)
+
+var SupportedHTTPPluginOps = []string{
+	plugin.OpLogin,
+	plugin.OpNewProxy,
+	plugin.OpCloseProxy,
+	plugin.OpPing,
+	plugin.OpNewWorkConn,
+	plugin.OpNewUserConn,
+}
+
+var SupportedPluginFailurePolicies = []m.PluginFailurePolicy{
+	m.PluginFailurePolicyReject,
+	m.PluginFailurePolicyAllow,
+}
+
+var (
+	SupportedMTLSUserFields = []string{"commonName", "dnsSAN", "emailSAN", "uriSAN"}
+	SupportedMTLSMetaFields = append(slices.Clone(SupportedMTLSUserFields),
+		"serialNumber", "organization", "organizationalUnit")
+)
+
+// ValidateServerConfig validates c after Complete is called. All problems
+// are reported at once.
+func ValidateServerConfig(c *m.ServerConfig) (Warning, error) {
+	var (
+		warnings Warning
+		errs     error
+	)
+
+	warning, err := validateServerAuthConfig(&c.Auth)
+	warnings = AppendError(warnings, warning)
+	errs = AppendError(errs, err)
+
+	if c.Auth.Method == m.AuthMethodMTLS && c.Transport.TLS.TrustedCaFile == "" {
+		errs = AppendError(errs, fmt.Errorf("transport.tls.trustedCaFile: must be set when auth.method is mtls"))
+	}
+
+	warning, err = validateServerPorts(c)
+	warnings = AppendError(warnings, warning)
+	errs = AppendError(errs, err)
+
+	errs = AppendError(errs, validateWebServerConfig(&c.WebServer))
+	errs = AppendError(errs, validateLogConfig(&c.Log))
+	errs = AppendError(errs, validateTLSFiles(&c.Transport.TLS.TLSConfig, "transport.tls"))
+	errs = AppendError(errs, validateFileExists(c.Custom404Page, "custom404Page"))
+	errs = AppendError(errs, validateFileExists(c.UsersFile, "usersFile"))
+	// oidc 的 token 不绑定用户, 任何有效的 token 都可以冒充用户文件中的用户
+	if c.UsersFile != "" && c.Auth.Method != m.AuthMethodToken && c.Auth.Method != m.AuthMethodMTLS {
+		errs = AppendError(errs, fmt.Errorf("usersFile: is only supported when auth.method is token or mtls"))
+	}
+	errs = AppendError(errs, validateFileExists(c.PolicyFile, "policyFile"))
+
+	if c.Transport.MaxPoolCount < 0 {
+		errs = AppendError(errs, fmt.Errorf("transport.maxPoolCount: must not be negative"))
+	}
+	if c.MaxPortsPerClient < 0 {
+		errs = AppendError(errs, fmt.Errorf("maxPortsPerClient: must not be negative"))
+	}
+
+	errs = AppendError(errs, validateHTTPPlugins(c.HTTPPlugins))
+	errs = AppendError(errs, validateExecPlugins(c.ExecPlugins, c.HTTPPlugins))
+	return warnings, errs
+}
+
+func validateServerAuthConfig(c *m.AuthServerConfig) (Warning, error) {
+	var (
+		warnings Warning
+		errs     error
+	)
+	if !slices.Contains(SupportedAuthMethods, c.Method) {
+		errs = AppendError(errs, fmt.Errorf("auth.method: invalid value %q, optional values are %v", c.Method, SupportedAuthMethods))
+	}
+	for _, scope := range c.AdditionalScopes {
+		if !slices.Contains(SupportedAuthAdditionalScopes, scope) {
+			errs = AppendError(errs, fmt.Errorf("auth.additionalScopes: invalid value %q, optional values are %v", scope, SupportedAuthAdditionalScopes))
+		}
+	}
+	if c.Method == m.AuthMethodToken && c.Token == "" {
+		warnings = AppendError(warnings, fmt.Errorf("auth.token is empty, any client is allowed to connect"))
+	}
+	if c.Method == m.AuthMethodOIDC && c.OIDC.Issuer == "" {
+		errs = AppendError(errs, fmt.Errorf("auth.oidc.issuer: must be set when auth.method is oidc"))
+	}
+	if c.Method == m.AuthMethodMTLS {
+		if !slices.Contains(SupportedMTLSUserFields, c.MTLS.UserFrom) {
+			errs = AppendError(errs, fmt.Errorf("auth.mtls.userFrom: invalid value %q, optional values are %v", c.MTLS.UserFrom, SupportedMTLSUserFields))
+		}
+		for key, field := range c.MTLS.Metas {
+			if !slices.Contains(SupportedMTLSMetaFields, field) {
+				errs = AppendError(errs, fmt.Errorf("auth.mtls.metas.%s: invalid value %q, optional values are %v", key, field, SupportedMTLSMetaFields))
+			}
+		}
+		errs = AppendError(errs, validateFileExists(c.MTLS.CRLFile, "auth.mtls.crlFile"))
+	}
+	if c.MaxClockSkew != nil && *c.MaxClockSkew <= 0 {
+		errs = AppendError(errs, fmt.Errorf("auth.maxClockSkew: must be greater than 0"))
+	}
+	if lo.FromPtr(c.TokenOverlap) < 0 {
+		errs = AppendError(errs, fmt.Errorf("auth.tokenOverlap: must not be negative"))
+	}
+	if c.Method == m.AuthMethodToken && c.AllowLegacyKey {
+		warnings = AppendError(warnings, fmt.Errorf("auth.allowLegacyKey is enabled, login messages of old clients can be replayed within auth.maxClockSkew"))
+	}
+	return warnings, errs
+}
+
+func validateServerPorts(c *m.ServerConfig) (Warning, error) {
+	var (
+		warnings Warning
+		errs     error
+	)
+
+	type port struct {
+		field string
+		value int
+	}
+	tcpPorts := []port{
+		{"bindPort", c.BindPort},
+		{"vhostHTTPPort", c.VhostHTTPPort},
+		{"vhostHTTPSPort", c.VhostHTTPSPort},
+		{"tcpmuxHTTPConnectPort", c.TCPMuxHTTPConnectPort},
+		{"webServer.port", c.WebServer.Port},
+		{"sshTunnelGateway.bindPort", c.SSHTunnelGateway.BindPort},
+	}
+	udpPorts := []port{
+		{"kcpBindPort", c.KCPBindPort},
+		{"quicBindPort", c.QUICBindPort},
+	}
+
+	// webServer.port is checked with the web server config
+	for _, p := range slices.Concat(tcpPorts, udpPorts) {
+		if p.field != "webServer.port" {
+			errs = AppendError(errs, ValidatePort(p.value, p.field))
+		}
+	}
+	if c.BindPort == 0 {
+		errs = AppendError(errs, fmt.Errorf("bindPort: must be set"))
+	}
+
+	checkConflicts := func(network string, ports []port) {
+		used := make(map[int]string)
+		for _, p := range ports {
+			if p.value <= 0 {
+				continue
+			}
+			if other, ok := used[p.value]; ok {
+				errs = AppendError(errs, fmt.Errorf("%s: %s port %d is already used by %s", p.field, network, p.value, other))
+				continue
+			}
+			used[p.value] = p.field
+		}
+	}
+	checkConflicts("tcp", tcpPorts)
+	checkConflicts("udp", udpPorts)
+
+	errs = AppendError(errs, validatePortsRanges(c.AllowPorts, "allowPorts"))
+
+	if c.SubDomainHost != "" && c.VhostHTTPPort == 0 && c.VhostHTTPSPort == 0 && c.TCPMuxHTTPConnectPort == 0 {
+		warnings = AppendError(warnings, fmt.Errorf("subDomainHost is set but no vhost port is enabled, it will not take effect"))
+	}
+	if c.TCPMuxPassthrough && c.TCPMuxHTTPConnectPort == 0 {
+		warnings = AppendError(warnings, fmt.Errorf("tcpmuxPassthrough is set but tcpmuxHTTPConnectPort is not, it will not take effect"))
+	}
+	return warnings, errs
+}
+
+func validatePortsRanges(ranges []types.PortsRange, fieldPath string) error {
+	var errs error
+	for i, pr := range ranges {
+		field := fmt.Sprintf("%s[%d]", fieldPath, i)
+		switch {
+		case pr.Single > 0:
+			errs = AppendError(errs, ValidatePort(pr.Single, field+".single"))
+		case pr.Start > 0 || pr.End > 0:
+			errs = AppendError(errs, ValidatePort(pr.Start, field+".start"))
+			errs = AppendError(errs, ValidatePort(pr.End, field+".end"))
+			if pr.Start > pr.End {
+				errs = AppendError(errs, fmt.Errorf("%s: start %d is greater than end %d", field, pr.Start, pr.End))
+			}
+		default:
+			errs = AppendError(errs, fmt.Errorf("%s: either single or start and end must be set", field))
+		}
+	}
+	return errs
+}
+
+// ValidateUsersConfig validates the content of the users file.
+func ValidateUsersConfig(c *m.UsersConfig) error {
+	var errs error
+	seen := make(map[string]struct{})
+	for i, u := range c.Users {
+		field := fmt.Sprintf("users[%d]", i)
+		if u.Name == "" {
+			errs = AppendError(errs, fmt.Errorf("%s.name: must be set", field))
+		} else if _, ok := seen[u.Name]; ok {
+			errs = AppendError(errs, fmt.Errorf("%s.name: user %q is defined more than once", field, u.Name))
+		}
+		seen[u.Name] = struct{}{}
+
+		errs = AppendError(errs, validatePortsRanges(u.AllowPorts, field+".allowPorts"))
+		errs = AppendError(errs, validatePatterns(u.AllowDomains, field+".allowDomains"))
+		errs = AppendError(errs, validatePatterns(u.AllowSubdomains, field+".allowSubdomains"))
+		if u.MaxProxies < 0 {
+			errs = AppendError(errs, fmt.Errorf("%s.maxProxies: must not be negative", field))
+		}
+		for j, typ := range u.ProxyTypes {
+			if !slices.Contains(m.ProxyTypes(), typ) {
+				errs = AppendError(errs, fmt.Errorf("%s.proxyTypes[%d]: invalid value %q, optional values are %v", field, j, typ, m.ProxyTypes()))
+			}
+		}
+	}
+	return errs
+}
+
+var (
+	SupportedPolicyOps     = []string{plugin.OpLogin, plugin.OpNewProxy, plugin.OpNewUserConn}
+	SupportedPolicyActions = []m.PolicyAction{m.PolicyActionAllow, m.PolicyActionDeny, m.PolicyActionModify}
+)
+
+func ValidatePolicyConfig(c *m.PolicyConfig) error {
+	var errs error
+	if c.DefaultAction != m.PolicyActionAllow && c.DefaultAction != m.PolicyActionDeny {
+		errs = AppendError(errs, fmt.Errorf("defaultAction: invalid value %q, optional values are %v",
+			c.DefaultAction, []m.PolicyAction{m.PolicyActionAllow, m.PolicyActionDeny}))
+	}
+	for i, r := range c.Rules {
+		field := fmt.Sprintf("rules[%d]", i)
+		for j, op := range r.Ops {
+			if !slices.Contains(SupportedPolicyOps, op) {
+				errs = AppendError(errs, fmt.Errorf("%s.ops[%d]: invalid value %q, optional values are %v", field, j, op, SupportedPolicyOps))
+			}
+		}
+		if !slices.Contains(SupportedPolicyActions, r.Action) {
+			errs = AppendError(errs, fmt.Errorf("%s.action: invalid value %q, optional values are %v", field, r.Action, SupportedPolicyActions))
+		}
+		set := r.Set
+		if r.Action == m.PolicyActionModify && set.UseEncryption == nil && set.UseCompression == nil && set.BandwidthLimit == "" {
+			errs = AppendError(errs, fmt.Errorf("%s.set: should not be empty for a modify rule", field))
+		}
+		if set.BandwidthLimit != "" {
+			if _, err := types.NewBandwidthQuantity(set.BandwidthLimit); err != nil {
+				errs = AppendError(errs, fmt.Errorf("%s.set.bandwidthLimit: %v", field, err))
+			}
+		}
+
+		match := r.Match
+		errs = AppendError(errs, validatePatterns(match.Users, field+".match.users"))
+		for k, pattern := range match.Metas {
+			if _, err := path.Match(pattern, ""); err != nil {
+				errs = AppendError(errs, fmt.Errorf("%s.match.metas.%s: invalid pattern %q", field, k, pattern))
+			}
+		}
+		for j, cidr := range match.SourceCIDRs {
+			if _, err := netip.ParsePrefix(cidr); err != nil {
+				errs = AppendError(errs, fmt.Errorf("%s.match.sourceCIDRs[%d]: %v", field, j, err))
+			}
+		}
+		for j, typ := range match.ProxyTypes {
+			if !slices.Contains(m.ProxyTypes(), typ) {
+				errs = AppendError(errs, fmt.Errorf("%s.match.proxyTypes[%d]: invalid value %q, optional values are %v", field, j, typ, m.ProxyTypes()))
+			}
+		}
+		errs = AppendError(errs, validatePatterns(match.ProxyNames, field+".match.proxyNames"))
+		errs = AppendError(errs, validatePortsRanges(match.RemotePorts, field+".match.remotePorts"))
+		errs = AppendError(errs, validatePatterns(match.Domains, field+".match.domains"))
+		errs = AppendError(errs, validatePatterns(match.Visitors, field+".match.visitors"))
+	}
+	return errs
+}
+
+// validatePatterns checks the patterns are valid for path.Match.
+func validatePatterns(patterns []string, fieldPath string) error {
+	var errs error
+	for i, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			errs = AppendError(errs, fmt.Errorf("%s[%d]: invalid pattern %q", fieldPath, i, pattern))
+		}
+	}
+	return errs
+}
+
+func validateHTTPPlugins(plugins []m.HTTPPluginOptions) error {
+	var errs error
+	names := make(map[string]struct{})
+	for i, p := range plugins {
+		field := fmt.Sprintf("httpPlugins[%d]", i)
+		if p.Name == "" {
+			errs = AppendError(errs, fmt.Errorf("%s.name: should not be empty", field))
+		} else if _, ok := names[p.Name]; ok {
+			errs = AppendError(errs, fmt.Errorf("%s.name: duplicate name %q", field, p.Name))
+		}
+		names[p.Name] = struct{}{}
+
+		if p.Addr == "" {
+			errs = AppendError(errs, fmt.Errorf("%s.addr: should not be empty", field))
+		}
+		if len(p.Ops) == 0 {
+			errs = AppendError(errs, fmt.Errorf("%s.ops: should not be empty", field))
+		}
+		for _, op := range p.Ops {
+			if !slices.Contains(SupportedHTTPPluginOps, op) {
+				errs = AppendError(errs, fmt.Errorf("%s.ops: invalid value %q, optional values are %v", field, op, SupportedHTTPPluginOps))
+			}
+		}
+		errs = AppendError(errs, validatePluginCallOptions(&p.PluginCallOptions, field))
+	}
+	return errs
+}
+
+func validateExecPlugins(plugins []m.ExecPluginOptions, httpPlugins []m.HTTPPluginOptions) error {
+	var errs error
+	names := make(map[string]struct{})
+	for _, p := range httpPlugins {
+		names[p.Name] = struct{}{}
+	}
+	for i, p := range plugins {
+		field := fmt.Sprintf("execPlugins[%d]", i)
+		if p.Name == "" {
+			errs = AppendError(errs, fmt.Errorf("%s.name: should not be empty", field))
+		} else if _, ok := names[p.Name]; ok {
+			errs = AppendError(errs, fmt.Errorf("%s.name: duplicate name %q", field, p.Name))
+		}
+		names[p.Name] = struct{}{}
+
+		if p.Command == "" {
+			errs = AppendError(errs, fmt.Errorf("%s.command: should not be empty", field))
+		}
+		if len(p.Ops) == 0 {
+			errs = AppendError(errs, fmt.Errorf("%s.ops: should not be empty", field))
+		}
+		for _, op := range p.Ops {
+			if !slices.Contains(SupportedHTTPPluginOps, op) {
+				errs = AppendError(errs, fmt.Errorf("%s.ops: invalid value %q, optional values are %v", field, op, SupportedHTTPPluginOps))
+			}
+		}
+		errs = AppendError(errs, validatePluginCallOptions(&p.PluginCallOptions, field))
+	}
+	return errs
+}
+
+func validatePluginCallOptions(c *m.PluginCallOptions, field string) error {
+	var errs error
+	if c.Timeout < 0 {
+		errs = AppendError(errs, fmt.Errorf("%s.timeout: should not be negative", field))
+	}
+	if c.MaxRetries < 0 {
+		errs = AppendError(errs, fmt.Errorf("%s.maxRetries: should not be negative", field))
+	}
+	if !slices.Contains(SupportedPluginFailurePolicies, c.FailurePolicy) {
+		errs = AppendError(errs, fmt.Errorf("%s.failurePolicy: invalid value %q, optional values are %v",
+			field, c.FailurePolicy, SupportedPluginFailurePolicies))
+	}
+	if c.CircuitBreaker.FailureThreshold < 0 {
+		errs = AppendError(errs, fmt.Errorf("%s.circuitBreaker.failureThreshold: should not be negative", field))
+	}
+	if c.CircuitBreaker.OpenTimeout < 0 {
+		errs = AppendError(errs, fmt.Errorf("%s.circuitBreaker.openTimeout: should not be negative", field))
+	}
+	return errs
+}
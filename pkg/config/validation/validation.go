@@ -0,0 +1,81 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+)
+
+// Warning is a config problem that does not stop the service from running.
+type Warning error
+
+// AppendError joins errs into err, nil values are dropped.
+func AppendError(err error, errs ...error) error {
+	return errors.Join(append([]error{err}, errs...)...)
+}
+
+// withPrefix prefixes every error joined in err, so that each line of the
+// final message says where it comes from.
+func withPrefix(prefix string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var errs error
+		for _, e := range joined.Unwrap() {
+			errs = AppendError(errs, withPrefix(prefix, e))
+		}
+		return errs
+	}
+	return fmt.Errorf("%s: %w", prefix, err)
+}
+
+func ValidatePort(port int, fieldPath string) error {
+	if 0 <= port && port <= 65535 {
+		return nil
+	}
+	return fmt.Errorf("%s: port number %d must be within the range 0..65535", fieldPath, port)
+}
+
+func validateFileExists(path string, fieldPath string) error {
+	if path == "" {
+		return nil
+	}
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("%s: %v", fieldPath, err)
+	}
+	return nil
+}
+
+var SupportedLogLevels = []string{"trace", "debug", "info", "warn", "error"}
+
+func validateLogConfig(c *m.LogConfig) error {
+	if !slices.Contains(SupportedLogLevels, c.Level) {
+		return fmt.Errorf("log.level: invalid value %q, optional values are %v", c.Level, SupportedLogLevels)
+	}
+	return nil
+}
+
+// validateTLSFiles checks that the files exist and that certFile and keyFile
+// are set together.
+func validateTLSFiles(c *m.TLSConfig, fieldPath string) error {
+	var errs error
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		errs = AppendError(errs, fmt.Errorf("%s: certFile and keyFile must be set together", fieldPath))
+	}
+	errs = AppendError(errs, validateFileExists(c.CertFile, fieldPath+".certFile"))
+	errs = AppendError(errs, validateFileExists(c.KeyFile, fieldPath+".keyFile"))
+	errs = AppendError(errs, validateFileExists(c.TrustedCaFile, fieldPath+".trustedCaFile"))
+	return errs
+}
+
+func validateWebServerConfig(c *m.WebServerConfig) error {
+	errs := ValidatePort(c.Port, "webServer.port")
+	if c.TLS != nil {
+		errs = AppendError(errs, validateTLSFiles(c.TLS, "webServer.tls"))
+	}
+	return errs
+}
@@ -0,0 +1,163 @@
+package validation
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+	"github.com/samber/lo"
+)
+
+// checkMessages checks that err contains every message of want and nothing
+// if want is empty.
+func checkMessages(t *testing.T, kind string, err error, want []string) {
+	t.Helper()
+	if len(want) == 0 {
+		if err != nil {
+			t.Errorf("unexpected %s: %v", kind, err)
+		}
+		return
+	}
+	if err == nil {
+		t.Errorf("expected %s %q, got none", kind, want)
+		return
+	}
+	for _, w := range want {
+		if !strings.Contains(err.Error(), w) {
+			t.Errorf("expected %s containing %q, got %q", kind, w, err.Error())
+		}
+	}
+}
+
+func TestValidateServerConfig(t *testing.T) {
+	tests := []struct {
+		name         string
+		modify       func(c *m.ServerConfig)
+		wantErrs     []string
+		wantWarnings []string
+	}{
+		{name: "valid", modify: func(*m.ServerConfig) {}},
+		{
+			name:     "errors",
+			modify:   func(c *m.ServerConfig) { c.BindPort = 0; c.VhostHTTPPort = 70000 },
+			wantErrs: []string{"bindPort: must be set", "vhostHTTPPort: port number 70000"},
+		},
+		{
+			// warnings don't stop the server
+			name:         "warnings",
+			modify:       func(c *m.ServerConfig) { c.Auth.Token = ""; c.SubDomainHost = "example.com" },
+			wantWarnings: []string{"auth.token is empty", "subDomainHost is set but no vhost port is enabled"},
+		},
+		{
+			name: "error and warning",
+			modify: func(c *m.ServerConfig) {
+				c.Auth.Token = ""
+				c.VhostHTTPPort = 7000
+			},
+			wantErrs:     []string{"vhostHTTPPort: tcp port 7000 is already used by bindPort"},
+			wantWarnings: []string{"auth.token is empty"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &m.ServerConfig{BindPort: 7000, Auth: m.AuthServerConfig{Token: "secret"}}
+			if err := c.Complete(); err != nil {
+				t.Fatal(err)
+			}
+			tt.modify(c)
+			warnings, errs := ValidateServerConfig(c)
+			checkMessages(t, "error", errs, tt.wantErrs)
+			checkMessages(t, "warning", warnings, tt.wantWarnings)
+		})
+	}
+}
+
+func TestValidateClientConfig(t *testing.T) {
+	tcpProxy := func(name string, localPort int) m.ProxyConfigurer {
+		return &m.TCPProxyConfig{ProxyBaseConfig: m.ProxyBaseConfig{
+			Name: name, Type: "tcp", ProxyBackend: m.ProxyBackend{LocalPort: localPort},
+		}}
+	}
+	tests := []struct {
+		name         string
+		modify       func(c *m.ClientCommonConfig)
+		proxies      []m.ProxyConfigurer
+		visitors     []m.VisitorConfigurer
+		wantErrs     []string
+		wantWarnings []string
+	}{
+		{name: "valid", proxies: []m.ProxyConfigurer{tcpProxy("ssh", 22)}},
+		{
+			name:     "common error",
+			modify:   func(c *m.ClientCommonConfig) { c.ServerPort = 70000; c.Transport.Protocol = "kcpp" },
+			wantErrs: []string{"serverPort: port number 70000", `transport.protocol: invalid value "kcpp"`},
+		},
+		{
+			// the errors of proxies and visitors name them
+			name:    "proxy and visitor errors",
+			proxies: []m.ProxyConfigurer{tcpProxy("ssh", 0), tcpProxy("ssh", 22)},
+			visitors: []m.VisitorConfigurer{&m.STCPVisitorConfig{VisitorBaseConfig: m.VisitorBaseConfig{
+				Name: "db", Type: "stcp", ServerName: "db", BindPort: 0,
+			}}},
+			wantErrs: []string{
+				"proxy [ssh]: localPort: port number 0 must be within the range 1..65535",
+				"proxy [ssh]: duplicate name",
+				"visitor [db]: bindPort should not be 0",
+			},
+		},
+		{
+			name: "visitor fallback",
+			visitors: []m.VisitorConfigurer{
+				&m.STCPVisitorConfig{
+					VisitorBaseConfig: m.VisitorBaseConfig{Name: "db", Type: "stcp", ServerName: "db", BindPort: 5432},
+					FallbackTo:        "db",
+				},
+				&m.STCPVisitorConfig{
+					VisitorBaseConfig: m.VisitorBaseConfig{Name: "web", Type: "stcp", ServerName: "web", BindPort: 8080},
+					FallbackTo:        "standby",
+				},
+			},
+			wantErrs: []string{
+				"visitor [db]: fallbackTo: must not be the visitor itself",
+				"visitor [web]: fallbackTo: visitor [standby] is not defined",
+			},
+		},
+		{
+			name: "warning",
+			modify: func(c *m.ClientCommonConfig) {
+				c.Transport.TLS.Enable = lo.ToPtr(false)
+				c.Transport.TLS.TrustedCaFile = "ca.crt"
+			},
+			wantWarnings: []string{"transport.tls.enable is false, tls files will be ignored"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &m.ClientCommonConfig{}
+			if err := c.Complete(); err != nil {
+				t.Fatal(err)
+			}
+			if tt.modify != nil {
+				tt.modify(c)
+			}
+			warnings, errs := ValidateClientConfig(c, tt.proxies, tt.visitors)
+			checkMessages(t, "error", errs, tt.wantErrs)
+			checkMessages(t, "warning", warnings, tt.wantWarnings)
+		})
+	}
+}
+
+func TestAppendError(t *testing.T) {
+	if err := AppendError(nil, nil); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	first, second := errors.New("first"), errors.New("second")
+	err := withPrefix("proxy [ssh]", AppendError(AppendError(nil, first), nil, second))
+	if err.Error() != "proxy [ssh]: first\nproxy [ssh]: second" {
+		t.Fatalf("unexpected message %q", err.Error())
+	}
+	if !errors.Is(err, second) {
+		t.Fatal("expected the joined errors to be kept")
+	}
+}
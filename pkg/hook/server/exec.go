@@ -0,0 +1,392 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"reflect"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+	"github.com/gk7790/gk-zap/pkg/utils/log"
+)
+
+const (
+	// execRestartDelay is the delay before a crashed process is started
+	// again, it's doubled on every crash up to execMaxRestartDelay and reset
+	// once a process runs for execStableDuration.
+	execRestartDelay    = time.Second
+	execMaxRestartDelay = 30 * time.Second
+	execStableDuration  = time.Minute
+
+	// execCloseGrace is how long a closed plugin waits for the requests in
+	// flight before it stops the process.
+	execCloseGrace = 30 * time.Second
+	// execKillDelay is how long a process may take to exit after its stdin
+	// is closed before it's killed.
+	execKillDelay = 5 * time.Second
+)
+
+var errExecPluginClosed = errors.New("exec plugin is closed")
+
+// execPlugin sends the hook requests to a long-lived local process as
+// newline-delimited JSON over its stdin and reads the responses from its
+// stdout, the requests carry ids so they can be handled concurrently.
+type execPlugin struct {
+	options m.ExecPluginOptions
+
+	nextID  atomic.Uint64
+	pending atomic.Int64
+
+	mu           sync.Mutex
+	proc         *execProcess
+	closed       bool
+	restartDelay time.Duration
+	nextStart    time.Time
+}
+
+// NewExecPlugin creates the plugin and starts its process, the process is
+// started again on the next request if it fails to start.
+func NewExecPlugin(options m.ExecPluginOptions) Plugin {
+	p := &execPlugin{
+		options:      options,
+		restartDelay: execRestartDelay,
+	}
+	if _, err := p.process(); err != nil {
+		log.Warnf("start exec plugin [%s] error: %v", options.Name, err)
+	}
+	return p
+}
+
+func (p *execPlugin) Name() string {
+	return p.options.Name
+}
+
+func (p *execPlugin) IsSupport(op string) bool {
+	return slices.Contains(p.options.Ops, op)
+}
+
+// Handle sends content to the process, retContent has the same type as a
+// pointer to content like for HTTP plugins.
+func (p *execPlugin) Handle(ctx context.Context, op string, content any) (*Response, any, error) {
+	p.pending.Add(1)
+	defer p.pending.Add(-1)
+
+	proc, err := p.process()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	id := strconv.FormatUint(p.nextID.Add(1), 10)
+	r := &Request{
+		ID:      id,
+		Version: APIVersion,
+		Op:      op,
+		Content: content,
+	}
+	res := &Response{Content: reflect.New(reflect.TypeOf(content)).Interface()}
+	if err := proc.send(ctx, r, res); err != nil {
+		return nil, nil, err
+	}
+	// a null content decodes to nil, which can't replace the content
+	if !res.Reject && !res.Unchange && res.Content == nil {
+		return nil, nil, fmt.Errorf("response [%s] changed the content but has none", id)
+	}
+	return res, res.Content, nil
+}
+
+// process returns the running process, it starts a new one if the previous
+// one exited and the restart delay has passed.
+func (p *execPlugin) process() (*execProcess, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil, errExecPluginClosed
+	}
+	if p.proc != nil {
+		err := p.proc.exitErr()
+		if err == nil {
+			return p.proc, nil
+		}
+		// crashed or killed, fall through to start a new one
+		p.onExit(p.proc, err)
+	}
+	if now := time.Now(); now.Before(p.nextStart) {
+		return nil, fmt.Errorf("exec plugin is restarting in %v", p.nextStart.Sub(now).Round(time.Millisecond))
+	}
+
+	proc, err := startExecProcess(p.options)
+	if err != nil {
+		p.nextStart = time.Now().Add(p.restartDelay)
+		p.restartDelay = min(2*p.restartDelay, execMaxRestartDelay)
+		return nil, err
+	}
+	p.proc = proc
+	log.Infof("exec plugin [%s] started, pid [%d]", p.options.Name, proc.cmd.Process.Pid)
+	return proc, nil
+}
+
+// onExit computes when a new process may be started after proc exited with
+// err, it must be called with p.mu held.
+func (p *execPlugin) onExit(proc *execProcess, err error) {
+	log.Warnf("exec plugin [%s] exited: %v", p.options.Name, err)
+	if time.Since(proc.started) >= execStableDuration {
+		p.restartDelay = execRestartDelay
+	}
+	p.nextStart = time.Now().Add(p.restartDelay)
+	p.restartDelay = min(2*p.restartDelay, execMaxRestartDelay)
+	p.proc = nil
+}
+
+// Close stops the process once the requests in flight are done, or after
+// execCloseGrace. No process is started afterwards.
+func (p *execPlugin) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+
+	proc := p.proc
+	p.proc = nil
+	if proc == nil {
+		return nil
+	}
+	go func() {
+		deadline := time.Now().Add(execCloseGrace)
+		for p.pending.Load() > 0 && time.Now().Before(deadline) {
+			time.Sleep(100 * time.Millisecond)
+		}
+		proc.stop()
+	}()
+	return nil
+}
+
+// execProcess is a running plugin process.
+type execProcess struct {
+	name    string
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	started time.Time
+
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	waiters map[string]*execWaiter
+	// killErr is why the process was killed as broken
+	killErr error
+
+	// stderrDone is closed when stderr is fully read, cmd.Wait closes the
+	// pipe so it must not be called before
+	stderrDone chan struct{}
+	// done is closed when the process has exited, err is why
+	done chan struct{}
+	err  error
+}
+
+type execWaiter struct {
+	res *Response
+	ch  chan error
+}
+
+func startExecProcess(options m.ExecPluginOptions) (*execProcess, error) {
+	cmd := exec.Command(options.Command, options.Args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	proc := &execProcess{
+		name:       options.Name,
+		cmd:        cmd,
+		stdin:      stdin,
+		started:    time.Now(),
+		waiters:    make(map[string]*execWaiter),
+		stderrDone: make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	go proc.logStderr(stderr)
+	go proc.readLoop(stdout)
+	return proc, nil
+}
+
+// send writes r and waits for the response with the same id, which is
+// decoded into res.
+func (proc *execProcess) send(ctx context.Context, r *Request, res *Response) error {
+	buf, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	w := &execWaiter{res: res, ch: make(chan error, 1)}
+
+	proc.mu.Lock()
+	select {
+	case <-proc.done:
+		proc.mu.Unlock()
+		return fmt.Errorf("exec plugin exited: %v", proc.err)
+	default:
+	}
+	proc.waiters[r.ID] = w
+	proc.mu.Unlock()
+	defer func() {
+		proc.mu.Lock()
+		delete(proc.waiters, r.ID)
+		proc.mu.Unlock()
+	}()
+
+	// the write blocks if the process stops reading stdin, it's done in
+	// the background so that ctx still applies
+	written := make(chan error, 1)
+	go func() {
+		proc.writeMu.Lock()
+		_, err := proc.stdin.Write(append(buf, '\n'))
+		proc.writeMu.Unlock()
+		written <- err
+	}()
+	select {
+	case err := <-written:
+		if err != nil {
+			return fmt.Errorf("write request to exec plugin error: %v", err)
+		}
+	case <-proc.done:
+		return fmt.Errorf("exec plugin exited: %v", proc.err)
+	case <-ctx.Done():
+		// a process which doesn't read its requests is of no use anymore,
+		// it's killed so that a new one is started
+		proc.kill(fmt.Errorf("request [%s] couldn't be written in time", r.ID))
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-w.ch:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// readLoop dispatches the responses to the waiters until stdout is closed,
+// then it waits for the process and fails the remaining waiters.
+func (proc *execProcess) readLoop(stdout io.Reader) {
+	reader := bufio.NewReader(stdout)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			proc.dispatch(line)
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	<-proc.stderrDone
+	err := proc.cmd.Wait()
+	if err == nil {
+		err = errors.New("process exited")
+	}
+	proc.mu.Lock()
+	if proc.killErr != nil {
+		err = fmt.Errorf("killed: %v", proc.killErr)
+	}
+	proc.err = err
+	close(proc.done)
+	for id, w := range proc.waiters {
+		w.ch <- fmt.Errorf("exec plugin exited: %v", err)
+		delete(proc.waiters, id)
+	}
+	proc.mu.Unlock()
+}
+
+func (proc *execProcess) dispatch(line []byte) {
+	var head struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(line, &head); err != nil {
+		log.Warnf("exec plugin [%s] wrote an invalid response: %v", proc.name, err)
+		return
+	}
+
+	proc.mu.Lock()
+	w, ok := proc.waiters[head.ID]
+	delete(proc.waiters, head.ID)
+	proc.mu.Unlock()
+	if !ok {
+		// the request timed out meanwhile
+		log.Debugf("exec plugin [%s] response [%s] has no waiting request", proc.name, head.ID)
+		return
+	}
+	w.ch <- json.Unmarshal(line, w.res)
+}
+
+func (proc *execProcess) logStderr(stderr io.Reader) {
+	defer close(proc.stderrDone)
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		log.Infof("exec plugin [%s] stderr: %s", proc.name, scanner.Text())
+	}
+	// a line too long for the scanner stops it, the rest is discarded so
+	// that the process doesn't block on a full pipe
+	_, _ = io.Copy(io.Discard, stderr)
+}
+
+// exitErr returns why the process exited or was killed, or nil if it's
+// still usable.
+func (proc *execProcess) exitErr() error {
+	select {
+	case <-proc.done:
+		return proc.err
+	default:
+	}
+	proc.mu.Lock()
+	defer proc.mu.Unlock()
+	if proc.killErr != nil {
+		return fmt.Errorf("killed: %v", proc.killErr)
+	}
+	return nil
+}
+
+// kill kills the process as broken, the error of the process is err.
+func (proc *execProcess) kill(err error) {
+	proc.mu.Lock()
+	if proc.killErr != nil {
+		proc.mu.Unlock()
+		return
+	}
+	proc.killErr = err
+	proc.mu.Unlock()
+
+	log.Warnf("exec plugin [%s] is broken, kill it: %v", proc.name, err)
+	_ = proc.cmd.Process.Kill()
+}
+
+// stop closes stdin so the process can exit by itself and kills it if it
+// doesn't in time.
+func (proc *execProcess) stop() {
+	_ = proc.stdin.Close()
+	select {
+	case <-proc.done:
+	case <-time.After(execKillDelay):
+		_ = proc.cmd.Process.Kill()
+	}
+}
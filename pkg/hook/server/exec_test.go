@@ -0,0 +1,248 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+)
+
+// execPluginHelperEnv selects the behavior of the test binary when it's
+// started as the process of an exec plugin, see TestExecPluginHelper.
+const execPluginHelperEnv = "GK_TEST_EXEC_PLUGIN"
+
+// TestExecPluginHelper isn't a real test, it's the plugin process of the
+// exec plugin tests. The modes are:
+//
+//	reverse: answers every two requests in the reverse order
+//	slow:    answers every request after 300ms
+//	crash:   exits when it reads a request
+//	null:    answers every request with a changed but null content
+//	stuck:   never reads its stdin
+func TestExecPluginHelper(t *testing.T) {
+	mode := os.Getenv(execPluginHelperEnv)
+	if mode == "" {
+		return
+	}
+
+	if mode == "stuck" {
+		time.Sleep(time.Hour)
+	}
+	type request struct {
+		ID      string          `json:"id"`
+		Content json.RawMessage `json:"content"`
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	reply := func(r request) {
+		_ = encoder.Encode(map[string]any{"id": r.ID, "unchange": false, "content": r.Content})
+	}
+
+	var held []request
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			os.Exit(0)
+		}
+		var r request
+		_ = json.Unmarshal(line, &r)
+		switch mode {
+		case "reverse":
+			held = append(held, r)
+			if len(held) == 2 {
+				reply(held[1])
+				reply(held[0])
+				held = nil
+			}
+		case "slow":
+			time.Sleep(300 * time.Millisecond)
+			reply(r)
+		case "crash":
+			os.Exit(1)
+		case "null":
+			_ = encoder.Encode(map[string]any{"id": r.ID, "unchange": false, "content": nil})
+		}
+	}
+}
+
+func newTestExecPlugin(t *testing.T, mode string) *execPlugin {
+	t.Helper()
+	t.Setenv(execPluginHelperEnv, mode)
+	p := NewExecPlugin(m.ExecPluginOptions{
+		Name:    "test",
+		Command: os.Args[0],
+		Args:    []string{"-test.run=^TestExecPluginHelper$"},
+		Ops:     []string{OpNewUserConn},
+	}).(*execPlugin)
+	t.Cleanup(func() {
+		p.Close()
+	})
+	return p
+}
+
+// waitExit waits for proc to exit and returns why.
+func waitExit(t *testing.T, proc *execProcess) error {
+	t.Helper()
+	select {
+	case <-proc.done:
+		return proc.err
+	case <-time.After(10 * time.Second):
+		t.Fatal("timeout waiting for the process to exit")
+		return nil
+	}
+}
+
+func TestExecPluginResponseID(t *testing.T) {
+	p := newTestExecPlugin(t, "reverse")
+
+	// the process answers the second request first, each caller must still
+	// get the response of its own request
+	var wg sync.WaitGroup
+	for _, name := range []string{"a", "b", "c", "d"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			res, retContent, err := p.Handle(ctx, OpNewUserConn, NewUserConnContent{ProxyName: name})
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", name, err)
+				return
+			}
+			if res.Unchange {
+				t.Errorf("%s: expected the response of the process", name)
+			}
+			if got := retContent.(*NewUserConnContent).ProxyName; got != name {
+				t.Errorf("%s: got the response of request %s", name, got)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestExecPluginRestartBackoff(t *testing.T) {
+	p := newTestExecPlugin(t, "crash")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for i, wantDelay := range []time.Duration{execRestartDelay, 2 * execRestartDelay} {
+		if _, _, err := p.Handle(ctx, OpNewUserConn, NewUserConnContent{}); err == nil ||
+			!strings.Contains(err.Error(), "exec plugin exited") {
+			t.Fatalf("crash %d: expected the exit error, got %v", i, err)
+		}
+		// the crashed process isn't started again until the delay passed
+		_, _, err := p.Handle(ctx, OpNewUserConn, NewUserConnContent{})
+		if err == nil || !strings.Contains(err.Error(), "exec plugin is restarting") {
+			t.Fatalf("crash %d: expected the restart error, got %v", i, err)
+		}
+		p.mu.Lock()
+		delay := time.Until(p.nextStart)
+		nextDelay := p.restartDelay
+		// skip the wait
+		p.nextStart = time.Now()
+		p.mu.Unlock()
+		if delay <= 0 || delay > wantDelay {
+			t.Fatalf("crash %d: expected a restart delay of up to %v, got %v", i, wantDelay, delay)
+		}
+		if nextDelay != 2*wantDelay {
+			t.Fatalf("crash %d: expected the next delay to double to %v, got %v", i, 2*wantDelay, nextDelay)
+		}
+	}
+}
+
+func TestExecPluginWriteTimeout(t *testing.T) {
+	p := newTestExecPlugin(t, "stuck")
+	p.mu.Lock()
+	proc := p.proc
+	p.mu.Unlock()
+	if proc == nil {
+		t.Fatal("expected the process to be started")
+	}
+
+	// the request doesn't fit in the pipe of a process which doesn't read
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	content := NewUserConnContent{ProxyName: strings.Repeat("x", 1<<20)}
+	if _, _, err := p.Handle(ctx, OpNewUserConn, content); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if err := waitExit(t, proc); err == nil || !strings.Contains(err.Error(), "couldn't be written in time") {
+		t.Fatalf("expected the process to be killed, got %v", err)
+	}
+	// the killed process is replaced after the restart delay
+	_, _, err := p.Handle(context.Background(), OpNewUserConn, NewUserConnContent{})
+	if err == nil || !strings.Contains(err.Error(), "exec plugin is restarting") {
+		t.Fatalf("expected the restart error, got %v", err)
+	}
+}
+
+func TestExecPluginCloseWaitsForRequests(t *testing.T) {
+	p := newTestExecPlugin(t, "slow")
+	p.mu.Lock()
+	proc := p.proc
+	p.mu.Unlock()
+	if proc == nil {
+		t.Fatal("expected the process to be started")
+	}
+
+	type result struct {
+		content any
+		err     error
+	}
+	resCh := make(chan result, 1)
+	go func() {
+		_, retContent, err := p.Handle(context.Background(), OpNewUserConn, NewUserConnContent{ProxyName: "a"})
+		resCh <- result{retContent, err}
+	}()
+	// close while the process is handling the request
+	for p.pending.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := p.Handle(context.Background(), OpNewUserConn, NewUserConnContent{}); !errors.Is(err, errExecPluginClosed) {
+		t.Fatalf("expected the closed error, got %v", err)
+	}
+
+	select {
+	case r := <-resCh:
+		if r.err != nil {
+			t.Fatalf("expected the request in flight to finish, got %v", r.err)
+		}
+		if got := r.content.(*NewUserConnContent).ProxyName; got != "a" {
+			t.Fatalf("unexpected response %s", got)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("timeout waiting for the request in flight")
+	}
+	// the process exits once the request is done and its stdin is closed
+	if err := waitExit(t, proc); err == nil || strings.Contains(err.Error(), "killed") {
+		t.Fatalf("expected the process to exit by itself, got %v", err)
+	}
+}
+
+func TestExecPluginNullContent(t *testing.T) {
+	p := newTestExecPlugin(t, "null")
+	mgr := NewManager()
+	mgr.Register(p)
+
+	for range 2 {
+		_, err := mgr.NewUserConn(&NewUserConnContent{ProxyName: "a"})
+		if err == nil || !strings.Contains(err.Error(), "send NewUserConn request to plugin error") {
+			t.Fatalf("expected the null content to fail the request, got %v", err)
+		}
+	}
+	// the process answered, it's kept for the next requests
+	if p.proc == nil || p.proc.exitErr() != nil {
+		t.Fatal("expected the process to keep running")
+	}
+}
@@ -0,0 +1,248 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+	"github.com/gk7790/gk-zap/pkg/utils/wait"
+	"github.com/gk7790/gk-zap/pkg/utils/xlog"
+)
+
+// ErrCircuitOpen is returned while the circuit breaker of a plugin is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// PluginStats are the counters of a plugin since it was created, the plugins
+// are created again when the config is reloaded.
+type PluginStats struct {
+	Name string `json:"name"`
+	// Calls is the number of requests handled by the plugin, including the
+	// ones skipped by the circuit breaker.
+	Calls int64 `json:"calls"`
+	// Errors is the number of failed attempts, including the retried ones.
+	Errors int64 `json:"errors"`
+	// Retries is the number of attempts after the first one.
+	Retries int64 `json:"retries"`
+	// ShortCircuits is the number of calls skipped while the circuit breaker
+	// was open.
+	ShortCircuits int64 `json:"shortCircuits"`
+	// FailOpens is the number of failed calls let through because the
+	// failure policy is "allow".
+	FailOpens int64 `json:"failOpens"`
+	// AvgLatencyMs and MaxLatencyMs are the latencies of the attempts which
+	// reached the plugin, in milliseconds.
+	AvgLatencyMs float64 `json:"avgLatencyMs"`
+	MaxLatencyMs float64 `json:"maxLatencyMs"`
+	CircuitOpen  bool    `json:"circuitOpen"`
+}
+
+// StatsReporter is implemented by the plugins which keep PluginStats.
+type StatsReporter interface {
+	Stats() PluginStats
+}
+
+// guardedPlugin calls a plugin with a timeout per attempt, retries failed
+// attempts with backoff and stops calling the plugin for a while after
+// repeated failures. Failures are turned into rejections or let through
+// according to the failure policy.
+type guardedPlugin struct {
+	Plugin
+
+	options m.PluginCallOptions
+	breaker *circuitBreaker
+
+	calls         atomic.Int64
+	errors        atomic.Int64
+	retries       atomic.Int64
+	shortCircuits atomic.Int64
+	failOpens     atomic.Int64
+	attempts      atomic.Int64
+	latencySum    atomic.Int64
+	latencyMax    atomic.Int64
+}
+
+// NewGuardedPlugin wraps p with the call options, options must be completed.
+func NewGuardedPlugin(p Plugin, options m.PluginCallOptions) Plugin {
+	return &guardedPlugin{
+		Plugin:  p,
+		options: options,
+		breaker: &circuitBreaker{
+			threshold:   options.CircuitBreaker.FailureThreshold,
+			openTimeout: time.Duration(options.CircuitBreaker.OpenTimeout) * time.Second,
+		},
+	}
+}
+
+func (p *guardedPlugin) Handle(ctx context.Context, op string, content any) (*Response, any, error) {
+	p.calls.Add(1)
+	res, retContent, err := p.handle(ctx, op, content)
+	if err == nil {
+		return res, retContent, nil
+	}
+	// a request the caller gave up on isn't let through either
+	if p.options.FailurePolicy != m.PluginFailurePolicyAllow || ctx.Err() != nil {
+		return nil, nil, err
+	}
+
+	p.failOpens.Add(1)
+	xlog.FromContextSafe(ctx).Warnf("plugin [%s] %s error, the request is allowed by the failure policy: %v",
+		p.Name(), op, err)
+	return &Response{Reject: false, Unchange: true}, nil, nil
+}
+
+func (p *guardedPlugin) handle(ctx context.Context, op string, content any) (*Response, any, error) {
+	if !p.breaker.allow(time.Now()) {
+		p.shortCircuits.Add(1)
+		return nil, nil, ErrCircuitOpen
+	}
+
+	backoff := wait.NewFastBackoffManager(wait.FastBackoffOptions{
+		Duration:           0,
+		InitDurationIfFail: 200 * time.Millisecond,
+		Factor:             2.0,
+		Jitter:             0.1,
+		MaxDuration:        5 * time.Second,
+	})
+	backoff.Backoff(0, false)
+
+	var (
+		delay time.Duration
+		err   error
+	)
+	for attempt := 0; attempt <= p.options.MaxRetries; attempt++ {
+		if attempt > 0 {
+			p.retries.Add(1)
+			delay = backoff.Backoff(delay, true)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				p.breaker.release()
+				return nil, nil, ctx.Err()
+			}
+		}
+
+		var (
+			res        *Response
+			retContent any
+		)
+		res, retContent, err = p.attempt(ctx, op, content)
+		if err == nil {
+			p.breaker.done(time.Now(), true)
+			return res, retContent, nil
+		}
+		// the attempt failed because the caller gave up, not the plugin
+		if ctx.Err() != nil {
+			p.breaker.release()
+			return nil, nil, ctx.Err()
+		}
+		p.errors.Add(1)
+	}
+	p.breaker.done(time.Now(), false)
+	return nil, nil, fmt.Errorf("%d attempts failed, last error: %v", p.options.MaxRetries+1, err)
+}
+
+func (p *guardedPlugin) attempt(ctx context.Context, op string, content any) (*Response, any, error) {
+	if p.options.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(p.options.Timeout)*time.Second)
+		defer cancel()
+	}
+
+	start := time.Now()
+	res, retContent, err := p.Plugin.Handle(ctx, op, content)
+	latency := time.Since(start)
+
+	p.attempts.Add(1)
+	p.latencySum.Add(int64(latency))
+	for {
+		maxLatency := p.latencyMax.Load()
+		if int64(latency) <= maxLatency || p.latencyMax.CompareAndSwap(maxLatency, int64(latency)) {
+			break
+		}
+	}
+	return res, retContent, err
+}
+
+// Close closes the wrapped plugin if it's an io.Closer.
+func (p *guardedPlugin) Close() error {
+	if c, ok := p.Plugin.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+func (p *guardedPlugin) Stats() PluginStats {
+	stats := PluginStats{
+		Name:          p.Name(),
+		Calls:         p.calls.Load(),
+		Errors:        p.errors.Load(),
+		Retries:       p.retries.Load(),
+		ShortCircuits: p.shortCircuits.Load(),
+		FailOpens:     p.failOpens.Load(),
+		MaxLatencyMs:  float64(p.latencyMax.Load()) / float64(time.Millisecond),
+		CircuitOpen:   p.breaker.isOpen(time.Now()),
+	}
+	if attempts := p.attempts.Load(); attempts > 0 {
+		stats.AvgLatencyMs = float64(p.latencySum.Load()) / float64(attempts) / float64(time.Millisecond)
+	}
+	return stats
+}
+
+// circuitBreaker opens after threshold consecutive failed calls. While open
+// every call is skipped, after openTimeout a single call is let through and
+// its result closes or opens the breaker again.
+type circuitBreaker struct {
+	threshold   int
+	openTimeout time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+func (b *circuitBreaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.threshold {
+		return true
+	}
+	if b.probing || now.Before(b.openUntil) {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+func (b *circuitBreaker) done(now time.Time, success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if success {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = now.Add(b.openTimeout)
+	}
+}
+
+// release ends a call allowed by allow without a result, e.g. when the
+// caller gave up, the breaker stays as it is.
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+func (b *circuitBreaker) isOpen(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.failures >= b.threshold && now.Before(b.openUntil)
+}
@@ -0,0 +1,198 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+)
+
+// flakyPlugin fails the calls until failures is used up, it succeeds after.
+type flakyPlugin struct {
+	failures atomic.Int32
+	calls    atomic.Int32
+}
+
+func (p *flakyPlugin) Name() string { return "flaky" }
+
+func (p *flakyPlugin) IsSupport(string) bool { return true }
+
+func (p *flakyPlugin) Handle(ctx context.Context, _ string, _ any) (*Response, any, error) {
+	p.calls.Add(1)
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	if p.failures.Add(-1) >= 0 {
+		return nil, nil, errors.New("unavailable")
+	}
+	return &Response{Unchange: true}, nil, nil
+}
+
+func newTestGuardedPlugin(p Plugin, maxRetries int, policy m.PluginFailurePolicy) *guardedPlugin {
+	options := m.PluginCallOptions{MaxRetries: maxRetries, FailurePolicy: policy}
+	options.Complete()
+	options.CircuitBreaker.FailureThreshold = 2
+	return NewGuardedPlugin(p, options).(*guardedPlugin)
+}
+
+func TestGuardedPluginRetry(t *testing.T) {
+	tests := []struct {
+		name       string
+		failures   int32
+		maxRetries int
+		wantErr    string
+		wantCalls  int32
+	}{
+		{name: "success", failures: 0, maxRetries: 2, wantCalls: 1},
+		{name: "success after retries", failures: 2, maxRetries: 2, wantCalls: 3},
+		{name: "retries used up", failures: 3, maxRetries: 1, wantErr: "2 attempts failed", wantCalls: 2},
+		{name: "no retries", failures: 1, maxRetries: 0, wantErr: "1 attempts failed", wantCalls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flaky := &flakyPlugin{}
+			flaky.failures.Store(tt.failures)
+			p := newTestGuardedPlugin(flaky, tt.maxRetries, m.PluginFailurePolicyReject)
+			p.breaker.threshold = 10
+
+			_, _, err := p.Handle(context.Background(), OpLogin, nil)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if n := flaky.calls.Load(); n != tt.wantCalls {
+				t.Fatalf("expected %d attempts, got %d", tt.wantCalls, n)
+			}
+			stats := p.Stats()
+			if stats.Calls != 1 || stats.Retries != int64(tt.wantCalls-1) || stats.Errors != int64(min(tt.failures, tt.wantCalls)) {
+				t.Fatalf("unexpected stats %+v", stats)
+			}
+		})
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	b := &circuitBreaker{threshold: 2, openTimeout: time.Minute}
+	now := time.Now()
+
+	// failures below the threshold keep it closed, a success resets them
+	b.done(now, false)
+	b.done(now, true)
+	b.done(now, false)
+	if !b.allow(now) || b.isOpen(now) {
+		t.Fatal("expected the breaker to be closed")
+	}
+	b.done(now, false)
+	if b.allow(now) || !b.isOpen(now) {
+		t.Fatal("expected the breaker to open after 2 consecutive failures")
+	}
+
+	// a single probe is let through after the timeout
+	now = now.Add(time.Minute)
+	if !b.allow(now) {
+		t.Fatal("expected a probe after the open timeout")
+	}
+	if b.allow(now) {
+		t.Fatal("expected only one probe at a time")
+	}
+	// a failed probe opens it again
+	b.done(now, false)
+	if b.allow(now) || !b.isOpen(now) {
+		t.Fatal("expected the breaker to open again after a failed probe")
+	}
+
+	// a probe without a result lets the next call probe
+	now = now.Add(time.Minute)
+	if !b.allow(now) {
+		t.Fatal("expected a probe after the open timeout")
+	}
+	b.release()
+	if !b.allow(now) {
+		t.Fatal("expected another probe after a released one")
+	}
+	// a successful probe closes it
+	b.done(now, true)
+	if !b.allow(now) || !b.allow(now) || b.isOpen(now) {
+		t.Fatal("expected the breaker to close after a successful probe")
+	}
+}
+
+func TestGuardedPluginFailurePolicy(t *testing.T) {
+	tests := []struct {
+		policy    m.PluginFailurePolicy
+		wantAllow bool
+	}{
+		{policy: m.PluginFailurePolicyReject},
+		{policy: m.PluginFailurePolicyAllow, wantAllow: true},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			flaky := &flakyPlugin{}
+			flaky.failures.Store(100)
+			p := newTestGuardedPlugin(flaky, 0, tt.policy)
+
+			// the failures open the breaker, the calls after it don't reach
+			// the plugin and get the same treatment
+			for i := range 4 {
+				res, _, err := p.Handle(context.Background(), OpLogin, nil)
+				if tt.wantAllow {
+					if err != nil || res == nil || res.Reject || !res.Unchange {
+						t.Fatalf("call %d: expected the request to be allowed unchanged, got %+v %v", i, res, err)
+					}
+				} else if err == nil {
+					t.Fatalf("call %d: expected an error", i)
+				} else if i >= 2 && !errors.Is(err, ErrCircuitOpen) {
+					t.Fatalf("call %d: expected the circuit breaker error, got %v", i, err)
+				}
+			}
+			if n := flaky.calls.Load(); n != 2 {
+				t.Fatalf("expected the plugin to be called until the breaker opened, got %d calls", n)
+			}
+			stats := p.Stats()
+			wantFailOpens := int64(0)
+			if tt.wantAllow {
+				wantFailOpens = 4
+			}
+			if stats.Calls != 4 || stats.ShortCircuits != 2 || stats.FailOpens != wantFailOpens || !stats.CircuitOpen {
+				t.Fatalf("unexpected stats %+v", stats)
+			}
+		})
+	}
+}
+
+func TestGuardedPluginCanceled(t *testing.T) {
+	flaky := &flakyPlugin{}
+	p := newTestGuardedPlugin(flaky, 3, m.PluginFailurePolicyAllow)
+	p.breaker.threshold = 1
+
+	// a request canceled by the caller neither counts as a failure of the
+	// plugin nor is let through by the failure policy
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := p.Handle(ctx, OpLogin, nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context canceled, got %v", err)
+	}
+	// canceled while waiting for a retry
+	flaky.failures.Store(1)
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, _, err := p.Handle(ctx, OpLogin, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if p.breaker.isOpen(time.Now()) {
+		t.Fatal("expected canceled requests to keep the breaker closed")
+	}
+	if res, _, err := p.Handle(context.Background(), OpLogin, nil); err != nil || res.Reject {
+		t.Fatalf("unexpected result %+v %v", res, err)
+	}
+	if stats := p.Stats(); stats.FailOpens != 0 || stats.ShortCircuits != 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+)
+
+// ReqidHeader carries the request id of a hook request, plugins can use it to
+// correlate their logs with gks.
+const ReqidHeader = "X-Zap-Reqid"
+
+const (
+	// httpPluginTimeout is the timeout of the http client, a backstop for
+	// the callers which don't set a deadline on the context.
+	httpPluginTimeout = 30 * time.Second
+	// httpPluginMaxResponseSize limits the response body read from a plugin.
+	httpPluginMaxResponseSize = 1 << 20
+)
+
+// httpPlugin sends the hook requests to an HTTP endpoint as JSON.
+type httpPlugin struct {
+	options m.HTTPPluginOptions
+
+	url    string
+	client *http.Client
+}
+
+func NewHTTPPlugin(options m.HTTPPluginOptions) Plugin {
+	u := options.Addr + options.Path
+	if !strings.HasPrefix(u, "https://") && !strings.HasPrefix(u, "http://") {
+		u = "http://" + u
+	}
+
+	client := &http.Client{
+		Timeout: max(httpPluginTimeout, time.Duration(options.Timeout)*time.Second),
+	}
+	if strings.HasPrefix(u, "https://") {
+		client.Transport = &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: !options.TLSVerify},
+		}
+	}
+	return &httpPlugin{
+		options: options,
+		url:     u,
+		client:  client,
+	}
+}
+
+func (p *httpPlugin) Name() string {
+	return p.options.Name
+}
+
+func (p *httpPlugin) IsSupport(op string) bool {
+	return slices.Contains(p.options.Ops, op)
+}
+
+// Handle sends content to the plugin, retContent has the same type as a
+// pointer to content, e.g. *LoginContent for LoginContent.
+func (p *httpPlugin) Handle(ctx context.Context, op string, content any) (*Response, any, error) {
+	r := &Request{
+		Version: APIVersion,
+		Op:      op,
+		Content: content,
+	}
+	var res Response
+	res.Content = reflect.New(reflect.TypeOf(content)).Interface()
+	if err := p.do(ctx, r, &res); err != nil {
+		return nil, nil, err
+	}
+	// a null content decodes to nil, which can't replace the content
+	if !res.Reject && !res.Unchange && res.Content == nil {
+		return nil, nil, errors.New("plugin changed the content but returned none")
+	}
+	return &res, res.Content, nil
+}
+
+func (p *httpPlugin) do(ctx context.Context, r *Request, res *Response) error {
+	buf, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	v := url.Values{}
+	v.Set("version", r.Version)
+	v.Set("op", r.Op)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url+"?"+v.Encode(), bytes.NewReader(buf))
+	if err != nil {
+		return err
+	}
+	req.Header.Set(ReqidHeader, GetReqidFromContext(ctx))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("do http request error code: %d", resp.StatusCode)
+	}
+	buf, err = io.ReadAll(io.LimitReader(resp.Body, httpPluginMaxResponseSize+1))
+	if err != nil {
+		return err
+	}
+	if len(buf) > httpPluginMaxResponseSize {
+		return fmt.Errorf("response is larger than %d bytes", httpPluginMaxResponseSize)
+	}
+	return json.Unmarshal(buf, res)
+}
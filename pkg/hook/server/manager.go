@@ -4,6 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/gk7790/gk-zap/pkg/utils/log"
 	"github.com/gk7790/gk-zap/pkg/utils/xlog"
@@ -12,6 +16,13 @@ import (
 )
 
 type Manager struct {
+	// policy is evaluated before the plugins of its ops, see SetPolicy
+	policy atomic.Pointer[policyPlugin]
+
+	// mu guards the plugin lists, they are replaced on config reload
+	mu sync.RWMutex
+
+	plugins            []Plugin
 	loginPlugins       []Plugin
 	newProxyPlugins    []Plugin
 	closeProxyPlugins  []Plugin
@@ -32,6 +43,32 @@ func NewManager() *Manager {
 }
 
 func (m *Manager) Register(p Plugin) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.register(p)
+}
+
+// Replace unregisters all plugins and registers plugins instead, requests in
+// flight keep using the plugins they started with. The old plugins which are
+// io.Closers are closed, they must let the requests in flight finish.
+func (m *Manager) Replace(plugins []Plugin) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closePlugins()
+	m.loginPlugins = make([]Plugin, 0)
+	m.newProxyPlugins = make([]Plugin, 0)
+	m.closeProxyPlugins = make([]Plugin, 0)
+	m.pingPlugins = make([]Plugin, 0)
+	m.newWorkConnPlugins = make([]Plugin, 0)
+	m.newUserConnPlugins = make([]Plugin, 0)
+	m.plugins = nil
+	for _, p := range plugins {
+		m.register(p)
+	}
+}
+
+func (m *Manager) register(p Plugin) {
+	m.plugins = append(m.plugins, p)
 	if p.IsSupport(OpLogin) {
 		m.loginPlugins = append(m.loginPlugins, p)
 	}
@@ -52,8 +89,59 @@ func (m *Manager) Register(p Plugin) {
 	}
 }
 
+// Close closes the registered plugins which are io.Closers.
+func (m *Manager) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closePlugins()
+}
+
+func (m *Manager) closePlugins() {
+	for _, p := range m.plugins {
+		if c, ok := p.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				log.Warnf("close plugin [%s] error: %v", p.Name(), err)
+			}
+		}
+	}
+}
+
+// Stats returns the stats of the registered plugins which keep them.
+func (m *Manager) Stats() []PluginStats {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	stats := make([]PluginStats, 0, len(m.plugins))
+	for _, p := range m.plugins {
+		if r, ok := p.(StatsReporter); ok {
+			stats = append(stats, r.Stats())
+		}
+	}
+	return stats
+}
+
+// SetPolicy sets the policy evaluated before the plugins, nil removes it.
+func (m *Manager) SetPolicy(p *Policy) {
+	if p == nil {
+		m.policy.Store(nil)
+		return
+	}
+	m.policy.Store(&policyPlugin{policy: p})
+}
+
+// snapshot returns the current plugins of list under the read lock, the
+// policy comes first if it handles op.
+func (m *Manager) snapshot(op string, list *[]Plugin) []Plugin {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if p := m.policy.Load(); p != nil && p.IsSupport(op) {
+		return append([]Plugin{p}, *list...)
+	}
+	return *list
+}
+
 func (m *Manager) Login(content *LoginContent) (*LoginContent, error) {
-	if len(m.loginPlugins) == 0 {
+	plugins := m.snapshot(OpLogin, &m.loginPlugins)
+	if len(plugins) == 0 {
 		return content, nil
 	}
 	var (
@@ -66,26 +154,33 @@ func (m *Manager) Login(content *LoginContent) (*LoginContent, error) {
 	)
 
 	reqid, _ := util.RandID()
-	ctx := context.Background()
-	log.Infof("reqid: " + reqid)
-	for _, p := range m.loginPlugins {
+	xl := xlog.New().AppendPrefix("reqid: " + reqid)
+	ctx := xlog.NewContext(context.Background(), xl)
+	ctx = NewReqidContext(ctx, reqid)
+	for _, p := range plugins {
 		res, retContent, err = p.Handle(ctx, OpLogin, *content)
 		if err != nil {
-			log.Warnf("send Login request to plugin [%s] error: %v", p.Name(), err)
+			xl.Warnf("send Login request to plugin [%s] error: %v", p.Name(), err)
 			return nil, errors.New("send Login request to plugin error")
 		}
 		if res.Reject {
 			return nil, fmt.Errorf("%s", res.RejectReason)
 		}
 		if !res.Unchange {
-			content = retContent.(*LoginContent)
+			c, err := changedContent[LoginContent](p, OpLogin, retContent)
+			if err != nil {
+				xl.Warnf("%v", err)
+				return nil, errors.New("invalid Login response from plugin")
+			}
+			content = c
 		}
 	}
 	return content, nil
 }
 
 func (m *Manager) NewProxy(content *NewProxyContent) (*NewProxyContent, error) {
-	if len(m.newProxyPlugins) == 0 {
+	plugins := m.snapshot(OpNewProxy, &m.newProxyPlugins)
+	if len(plugins) == 0 {
 		return content, nil
 	}
 	var (
@@ -100,7 +195,7 @@ func (m *Manager) NewProxy(content *NewProxyContent) (*NewProxyContent, error) {
 	xl := xlog.New().AppendPrefix("reqid: " + reqid)
 	ctx := xlog.NewContext(context.Background(), xl)
 	ctx = NewReqidContext(ctx, reqid)
-	for _, p := range m.newProxyPlugins {
+	for _, p := range plugins {
 		res, retContent, err = p.Handle(ctx, OpNewProxy, *content)
 		if err != nil {
 			xl.Warnf("send NewProxy request to plugin [%s] error: %v", p.Name(), err)
@@ -110,19 +205,122 @@ func (m *Manager) NewProxy(content *NewProxyContent) (*NewProxyContent, error) {
 			return nil, fmt.Errorf("%s", res.RejectReason)
 		}
 		if !res.Unchange {
-			content = retContent.(*NewProxyContent)
+			c, err := changedContent[NewProxyContent](p, OpNewProxy, retContent)
+			if err != nil {
+				xl.Warnf("%v", err)
+				return nil, errors.New("invalid NewProxy response from plugin")
+			}
+			content = c
 		}
 	}
 	return content, nil
 }
 
+// CloseProxy notifies the plugins that a proxy is closed, the proxy is closed
+// anyway so the responses are ignored and only the errors are returned.
+func (m *Manager) CloseProxy(content *CloseProxyContent) error {
+	plugins := m.snapshot(OpCloseProxy, &m.closeProxyPlugins)
+	if len(plugins) == 0 {
+		return nil
+	}
+
+	errs := make([]string, 0)
+	reqid, _ := util.RandID()
+	xl := xlog.New().AppendPrefix("reqid: " + reqid)
+	ctx := xlog.NewContext(context.Background(), xl)
+	ctx = NewReqidContext(ctx, reqid)
+	for _, p := range plugins {
+		_, _, err := p.Handle(ctx, OpCloseProxy, *content)
+		if err != nil {
+			xl.Warnf("send CloseProxy request to plugin [%s] error: %v", p.Name(), err)
+			errs = append(errs, fmt.Sprintf("[%s]: %v", p.Name(), err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("send CloseProxy request to plugin errors: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
 func (m *Manager) NewWorkConn(content *NewWorkConnContent) (*NewWorkConnContent, error) {
+	plugins := m.snapshot(OpNewWorkConn, &m.newWorkConnPlugins)
+	if len(plugins) == 0 {
+		return content, nil
+	}
+	var (
+		res = &Response{
+			Reject:   false,
+			Unchange: true,
+		}
+		retContent any
+		err        error
+	)
+	reqid, _ := util.RandID()
+	xl := xlog.New().AppendPrefix("reqid: " + reqid)
+	ctx := xlog.NewContext(context.Background(), xl)
+	ctx = NewReqidContext(ctx, reqid)
+	for _, p := range plugins {
+		res, retContent, err = p.Handle(ctx, OpNewWorkConn, *content)
+		if err != nil {
+			xl.Warnf("send NewWorkConn request to plugin [%s] error: %v", p.Name(), err)
+			return nil, errors.New("send NewWorkConn request to plugin error")
+		}
+		if res.Reject {
+			return nil, fmt.Errorf("%s", res.RejectReason)
+		}
+		if !res.Unchange {
+			c, err := changedContent[NewWorkConnContent](p, OpNewWorkConn, retContent)
+			if err != nil {
+				xl.Warnf("%v", err)
+				return nil, errors.New("invalid NewWorkConn response from plugin")
+			}
+			content = c
+		}
+	}
+	return content, nil
+}
 
+func (m *Manager) NewUserConn(content *NewUserConnContent) (*NewUserConnContent, error) {
+	plugins := m.snapshot(OpNewUserConn, &m.newUserConnPlugins)
+	if len(plugins) == 0 {
+		return content, nil
+	}
+	var (
+		res = &Response{
+			Reject:   false,
+			Unchange: true,
+		}
+		retContent any
+		err        error
+	)
+	reqid, _ := util.RandID()
+	xl := xlog.New().AppendPrefix("reqid: " + reqid)
+	ctx := xlog.NewContext(context.Background(), xl)
+	ctx = NewReqidContext(ctx, reqid)
+	for _, p := range plugins {
+		res, retContent, err = p.Handle(ctx, OpNewUserConn, *content)
+		if err != nil {
+			xl.Warnf("send NewUserConn request to plugin [%s] error: %v", p.Name(), err)
+			return nil, errors.New("send NewUserConn request to plugin error")
+		}
+		if res.Reject {
+			return nil, fmt.Errorf("%s", res.RejectReason)
+		}
+		if !res.Unchange {
+			c, err := changedContent[NewUserConnContent](p, OpNewUserConn, retContent)
+			if err != nil {
+				xl.Warnf("%v", err)
+				return nil, errors.New("invalid NewUserConn response from plugin")
+			}
+			content = c
+		}
+	}
 	return content, nil
 }
 
 func (m *Manager) Ping(content *PingContent) (*PingContent, error) {
-	if len(m.pingPlugins) == 0 {
+	plugins := m.snapshot(OpPing, &m.pingPlugins)
+	if len(plugins) == 0 {
 		return content, nil
 	}
 	var (
@@ -137,7 +335,7 @@ func (m *Manager) Ping(content *PingContent) (*PingContent, error) {
 	xl := xlog.New().AppendPrefix("reqid: " + reqid)
 	ctx := xlog.NewContext(context.Background(), xl)
 	ctx = NewReqidContext(ctx, reqid)
-	for _, p := range m.pingPlugins {
+	for _, p := range plugins {
 		res, retContent, err = p.Handle(ctx, OpPing, *content)
 		if err != nil {
 			xl.Warnf("send Ping request to plugin [%s] error: %v", p.Name(), err)
@@ -147,8 +345,23 @@ func (m *Manager) Ping(content *PingContent) (*PingContent, error) {
 			return nil, fmt.Errorf("%s", res.RejectReason)
 		}
 		if !res.Unchange {
-			content = retContent.(*PingContent)
+			c, err := changedContent[PingContent](p, OpPing, retContent)
+			if err != nil {
+				xl.Warnf("%v", err)
+				return nil, errors.New("invalid Ping response from plugin")
+			}
+			content = c
 		}
 	}
 	return content, nil
 }
+
+// changedContent returns the content changed by plugin p, a reply which
+// doesn't carry it, e.g. a null content, is an error and not a change.
+func changedContent[T any](p Plugin, op string, retContent any) (*T, error) {
+	c, ok := retContent.(*T)
+	if !ok || c == nil {
+		return nil, fmt.Errorf("plugin [%s] changed the %s content but returned %T", p.Name(), op, retContent)
+	}
+	return c, nil
+}
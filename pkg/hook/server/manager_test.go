@@ -0,0 +1,282 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+	"github.com/gk7790/gk-zap/pkg/msg"
+	"github.com/gk7790/gk-zap/pkg/utils/log"
+)
+
+func TestMain(tm *testing.M) {
+	log.Init(false, "", log.LevelError)
+	os.Exit(tm.Run())
+}
+
+// testPlugin records the contents it's called with and answers with handle.
+type testPlugin struct {
+	name   string
+	ops    []string
+	handle func(content any) (*Response, any, error)
+
+	calls []any
+}
+
+func (p *testPlugin) Name() string { return p.name }
+
+func (p *testPlugin) IsSupport(op string) bool { return slices.Contains(p.ops, op) }
+
+func (p *testPlugin) Handle(_ context.Context, _ string, content any) (*Response, any, error) {
+	p.calls = append(p.calls, content)
+	if p.handle == nil {
+		return &Response{Unchange: true}, nil, nil
+	}
+	return p.handle(content)
+}
+
+func rejectWith(reason string) func(any) (*Response, any, error) {
+	return func(any) (*Response, any, error) {
+		return &Response{Reject: true, RejectReason: reason}, nil, nil
+	}
+}
+
+func TestManagerNewWorkConn(t *testing.T) {
+	modify := func(content any) (*Response, any, error) {
+		c := content.(NewWorkConnContent)
+		c.User.Metas = map[string]string{"modified": "true"}
+		return &Response{Unchange: false}, &c, nil
+	}
+	tests := []struct {
+		name      string
+		first     func(any) (*Response, any, error)
+		wantErr   string
+		wantMetas map[string]string
+		// wantSecond is whether the second plugin is called
+		wantSecond bool
+	}{
+		{name: "unchanged", wantSecond: true},
+		{name: "modify", first: modify, wantMetas: map[string]string{"modified": "true"}, wantSecond: true},
+		{name: "reject", first: rejectWith("no work conn"), wantErr: "no work conn"},
+		{
+			name:    "error",
+			first:   func(any) (*Response, any, error) { return nil, nil, errors.New("down") },
+			wantErr: "send NewWorkConn request to plugin error",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first := &testPlugin{name: "first", ops: []string{OpNewWorkConn}, handle: tt.first}
+			second := &testPlugin{name: "second", ops: []string{OpNewWorkConn}}
+			other := &testPlugin{name: "other", ops: []string{OpNewUserConn}}
+			mgr := NewManager()
+			mgr.Register(first)
+			mgr.Register(second)
+			mgr.Register(other)
+
+			content := &NewWorkConnContent{User: UserInfo{User: "alice"}, NewWorkConn: msg.NewWorkConn{RunID: "abc"}}
+			res, err := mgr.NewWorkConn(content)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := len(second.calls) == 1; got != tt.wantSecond {
+				t.Fatalf("expected the second plugin called %v, got %d calls", tt.wantSecond, len(second.calls))
+			}
+			if len(other.calls) != 0 {
+				t.Fatal("a plugin without the op must not be called")
+			}
+			if err != nil {
+				return
+			}
+			// the next plugin and the caller see the modified content
+			if tt.wantMetas != nil {
+				if got := second.calls[0].(NewWorkConnContent).User.Metas; got["modified"] != "true" {
+					t.Errorf("expected the second plugin to get the modified content, got %v", got)
+				}
+			}
+			if res.RunID != "abc" || len(res.User.Metas) != len(tt.wantMetas) {
+				t.Errorf("unexpected content %+v", res)
+			}
+		})
+	}
+}
+
+func TestManagerNewUserConn(t *testing.T) {
+	modify := func(content any) (*Response, any, error) {
+		c := content.(NewUserConnContent)
+		c.RemoteAddr = "192.0.2.1:1000"
+		return &Response{Unchange: false}, &c, nil
+	}
+	tests := []struct {
+		name       string
+		first      func(any) (*Response, any, error)
+		wantErr    string
+		wantAddr   string
+		wantSecond bool
+	}{
+		{name: "unchanged", wantAddr: "127.0.0.1:1000", wantSecond: true},
+		{name: "modify", first: modify, wantAddr: "192.0.2.1:1000", wantSecond: true},
+		{name: "reject", first: rejectWith("visitor not allowed"), wantErr: "visitor not allowed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first := &testPlugin{name: "first", ops: []string{OpNewUserConn}, handle: tt.first}
+			second := &testPlugin{name: "second", ops: []string{OpNewUserConn}}
+			mgr := NewManager()
+			mgr.Register(first)
+			mgr.Register(second)
+
+			res, err := mgr.NewUserConn(&NewUserConnContent{
+				User:        UserInfo{User: "alice"},
+				ProxyName:   "alice.ssh",
+				ProxyType:   "stcp",
+				RemoteAddr:  "127.0.0.1:1000",
+				VisitorUser: "bob",
+			})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := len(second.calls) == 1; got != tt.wantSecond {
+				t.Fatalf("expected the second plugin called %v, got %d calls", tt.wantSecond, len(second.calls))
+			}
+			if err != nil {
+				return
+			}
+			if got := second.calls[0].(NewUserConnContent).RemoteAddr; got != tt.wantAddr {
+				t.Errorf("expected the second plugin to get %s, got %s", tt.wantAddr, got)
+			}
+			if res.RemoteAddr != tt.wantAddr || res.VisitorUser != "bob" {
+				t.Errorf("unexpected content %+v", res)
+			}
+		})
+	}
+}
+
+func TestManagerCloseProxy(t *testing.T) {
+	tests := []struct {
+		name    string
+		first   func(any) (*Response, any, error)
+		wantErr string
+	}{
+		{name: "unchanged"},
+		// the proxy is closed anyway, responses don't stop the chain
+		{name: "reject", first: rejectWith("ignored")},
+		{
+			name: "modify",
+			first: func(content any) (*Response, any, error) {
+				c := content.(CloseProxyContent)
+				c.ProxyName = "other"
+				return &Response{Unchange: false}, &c, nil
+			},
+		},
+		{
+			name:    "error",
+			first:   func(any) (*Response, any, error) { return nil, nil, errors.New("down") },
+			wantErr: "[first]: down",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first := &testPlugin{name: "first", ops: []string{OpCloseProxy}, handle: tt.first}
+			second := &testPlugin{name: "second", ops: []string{OpCloseProxy}}
+			mgr := NewManager()
+			mgr.Register(first)
+			mgr.Register(second)
+
+			err := mgr.CloseProxy(&CloseProxyContent{
+				User:       UserInfo{User: "alice"},
+				CloseProxy: msg.CloseProxy{ProxyName: "alice.ssh"},
+			})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			// every plugin is notified with the original content
+			if len(second.calls) != 1 {
+				t.Fatalf("expected the second plugin to be called once, got %d", len(second.calls))
+			}
+			if got := second.calls[0].(CloseProxyContent).ProxyName; got != "alice.ssh" {
+				t.Errorf("expected the original proxy name, got %s", got)
+			}
+		})
+	}
+}
+
+func TestManagerNullContent(t *testing.T) {
+	// a plugin which claims a change without returning the content
+	null := func(any) (*Response, any, error) { return &Response{Unchange: false}, nil, nil }
+	typedNull := func(any) (*Response, any, error) { return &Response{Unchange: false}, (*LoginContent)(nil), nil }
+	tests := []struct {
+		name   string
+		op     string
+		handle func(any) (*Response, any, error)
+		call   func(mgr *Manager) error
+	}{
+		{name: "login", op: OpLogin, handle: null, call: func(mgr *Manager) error {
+			_, err := mgr.Login(&LoginContent{})
+			return err
+		}},
+		{name: "login typed nil", op: OpLogin, handle: typedNull, call: func(mgr *Manager) error {
+			_, err := mgr.Login(&LoginContent{})
+			return err
+		}},
+		// a content of another op isn't taken either
+		{name: "new proxy wrong type", op: OpNewProxy, handle: typedNull, call: func(mgr *Manager) error {
+			_, err := mgr.NewProxy(&NewProxyContent{})
+			return err
+		}},
+		{name: "ping", op: OpPing, handle: null, call: func(mgr *Manager) error {
+			_, err := mgr.Ping(&PingContent{})
+			return err
+		}},
+		{name: "new work conn", op: OpNewWorkConn, handle: null, call: func(mgr *Manager) error {
+			_, err := mgr.NewWorkConn(&NewWorkConnContent{})
+			return err
+		}},
+		{name: "new user conn", op: OpNewUserConn, handle: null, call: func(mgr *Manager) error {
+			_, err := mgr.NewUserConn(&NewUserConnContent{})
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mgr := NewManager()
+			mgr.Register(&testPlugin{name: "null", ops: []string{tt.op}, handle: tt.handle})
+			err := tt.call(mgr)
+			if err == nil || !strings.Contains(err.Error(), "invalid "+tt.op+" response from plugin") {
+				t.Fatalf("expected an invalid response error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestManagerHTTPPluginNullContent(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"unchange":false,"content":null}`))
+	}))
+	defer srv.Close()
+
+	mgr := NewManager()
+	mgr.Register(NewHTTPPlugin(m.HTTPPluginOptions{Name: "null", Addr: srv.URL, Ops: []string{OpLogin}}))
+	_, err := mgr.Login(&LoginContent{Login: msg.Login{User: "alice"}})
+	if err == nil || !strings.Contains(err.Error(), "send Login request to plugin error") {
+		t.Fatalf("expected the null content to fail the request, got %v", err)
+	}
+}
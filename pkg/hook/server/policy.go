@@ -0,0 +1,284 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"path"
+	"reflect"
+	"slices"
+	"strings"
+
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+	"github.com/gk7790/gk-zap/pkg/config/types"
+)
+
+// Policy evaluates the rules of a policy file, see m.PolicyConfig.
+type Policy struct {
+	defaultAction m.PolicyAction
+	rules         []policyRule
+}
+
+type policyRule struct {
+	m.PolicyRule
+
+	index int
+	cidrs []netip.Prefix
+}
+
+// NewPolicy compiles c, c must be completed and validated.
+func NewPolicy(c *m.PolicyConfig) (*Policy, error) {
+	p := &Policy{
+		defaultAction: c.DefaultAction,
+		rules:         make([]policyRule, 0, len(c.Rules)),
+	}
+	for i, r := range c.Rules {
+		rule := policyRule{PolicyRule: r, index: i}
+		for _, cidr := range r.Match.SourceCIDRs {
+			prefix, err := netip.ParsePrefix(cidr)
+			if err != nil {
+				return nil, fmt.Errorf("rules[%d]: %v", i, err)
+			}
+			rule.cidrs = append(rule.cidrs, prefix.Masked())
+		}
+		p.rules = append(p.rules, rule)
+	}
+	return p, nil
+}
+
+// PolicyDecision is the result of evaluating a request against a policy.
+type PolicyDecision struct {
+	Allow bool `json:"allow"`
+	// Rule is the rule which allowed or denied the request, it's empty if
+	// the default action applied.
+	Rule   string `json:"rule,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	// Modified lists the modify rules which changed the request.
+	Modified []string `json:"modified,omitempty"`
+	// Trace explains how every rule was evaluated.
+	Trace []string `json:"trace"`
+}
+
+// Evaluate evaluates the request of op, content is a pointer to its content
+// like *NewProxyContent and it's changed by the modify rules.
+func (p *Policy) Evaluate(op string, content any) *PolicyDecision {
+	d := &PolicyDecision{Trace: make([]string, 0, len(p.rules))}
+	req, ok := newPolicyRequest(content)
+	if !ok {
+		d.Allow = true
+		d.Trace = append(d.Trace, fmt.Sprintf("op %s isn't handled by the policy", op))
+		return d
+	}
+
+	for _, r := range p.rules {
+		name := r.displayName()
+		if len(r.Ops) > 0 && !slices.Contains(r.Ops, op) {
+			d.Trace = append(d.Trace, fmt.Sprintf("%s: skipped, doesn't apply to %s", name, op))
+			continue
+		}
+		if cond, ok := r.match(req); !ok {
+			d.Trace = append(d.Trace, fmt.Sprintf("%s: not matched, %s", name, cond))
+			continue
+		}
+
+		switch r.Action {
+		case m.PolicyActionModify:
+			if changes := r.modify(content); len(changes) > 0 {
+				d.Modified = append(d.Modified, name)
+				d.Trace = append(d.Trace, fmt.Sprintf("%s: matched, modify %s", name, strings.Join(changes, ", ")))
+			} else {
+				d.Trace = append(d.Trace, fmt.Sprintf("%s: matched, nothing to modify for %s", name, op))
+			}
+			continue
+		case m.PolicyActionDeny:
+			d.Rule, d.Reason = name, r.Reason
+			if d.Reason == "" {
+				d.Reason = "denied by policy rule " + name
+			}
+		default:
+			d.Rule, d.Allow = name, true
+		}
+		d.Trace = append(d.Trace, fmt.Sprintf("%s: matched, %s", name, r.Action))
+		return d
+	}
+
+	d.Allow = p.defaultAction != m.PolicyActionDeny
+	if !d.Allow {
+		d.Reason = "denied by the default action of policy"
+	}
+	d.Trace = append(d.Trace, fmt.Sprintf("no allow or deny rule matched, default action %s", p.defaultAction))
+	return d
+}
+
+func (r *policyRule) displayName() string {
+	if r.Name != "" {
+		return fmt.Sprintf("rules[%d] %q", r.index, r.Name)
+	}
+	return fmt.Sprintf("rules[%d]", r.index)
+}
+
+// match returns whether req matches all conditions of r, or the first
+// condition which doesn't match.
+func (r *policyRule) match(req *policyRequest) (string, bool) {
+	c := &r.Match
+	if len(c.Users) > 0 && !matchPatterns(c.Users, req.user) {
+		return fmt.Sprintf("user %q isn't in users", req.user), false
+	}
+	for k, pattern := range c.Metas {
+		v, ok := req.metas[k]
+		if ok {
+			ok, _ = path.Match(pattern, v)
+		}
+		if !ok {
+			return fmt.Sprintf("meta %q doesn't match %q", k, pattern), false
+		}
+	}
+	if len(r.cidrs) > 0 {
+		if !req.source.IsValid() {
+			return "no source address", false
+		}
+		if !slices.ContainsFunc(r.cidrs, func(prefix netip.Prefix) bool { return prefix.Contains(req.source) }) {
+			return fmt.Sprintf("source %s isn't in sourceCIDRs", req.source), false
+		}
+	}
+	if len(c.ProxyTypes) > 0 && !slices.Contains(c.ProxyTypes, m.ProxyType(req.proxyType)) {
+		return fmt.Sprintf("proxy type %q isn't in proxyTypes", req.proxyType), false
+	}
+	if len(c.ProxyNames) > 0 && (req.proxyName == "" || !matchPatterns(c.ProxyNames, req.proxyName)) {
+		return fmt.Sprintf("proxy name %q isn't in proxyNames", req.proxyName), false
+	}
+	if len(c.RemotePorts) > 0 && (req.remotePort <= 0 || !slices.ContainsFunc(c.RemotePorts, func(pr types.PortsRange) bool {
+		if pr.Single > 0 {
+			return req.remotePort == pr.Single
+		}
+		return req.remotePort >= pr.Start && req.remotePort <= pr.End
+	})) {
+		return fmt.Sprintf("remote port %d isn't in remotePorts", req.remotePort), false
+	}
+	if len(c.Domains) > 0 && !slices.ContainsFunc(req.domains, func(domain string) bool {
+		return matchPatterns(c.Domains, domain)
+	}) {
+		return fmt.Sprintf("domains %v aren't in domains", req.domains), false
+	}
+	if len(c.Visitors) > 0 && (req.visitor == "" || !matchPatterns(c.Visitors, req.visitor)) {
+		return fmt.Sprintf("visitor %q isn't in visitors", req.visitor), false
+	}
+	return "", true
+}
+
+// modify applies the changes of r to content and describes them.
+func (r *policyRule) modify(content any) []string {
+	c, ok := content.(*NewProxyContent)
+	if !ok {
+		return nil
+	}
+	changes := make([]string, 0)
+	if v := r.Set.UseEncryption; v != nil {
+		c.UseEncryption = *v
+		changes = append(changes, fmt.Sprintf("useEncryption=%t", *v))
+	}
+	if v := r.Set.UseCompression; v != nil {
+		c.UseCompression = *v
+		changes = append(changes, fmt.Sprintf("useCompression=%t", *v))
+	}
+	if v := r.Set.BandwidthLimit; v != "" {
+		c.BandwidthLimit = v
+		changes = append(changes, "bandwidthLimit="+v)
+	}
+	return changes
+}
+
+func matchPatterns(patterns []string, name string) bool {
+	return slices.ContainsFunc(patterns, func(pattern string) bool {
+		ok, _ := path.Match(pattern, name)
+		return ok
+	})
+}
+
+// policyRequest holds the attributes of a request the rules match on.
+type policyRequest struct {
+	user       string
+	metas      map[string]string
+	source     netip.Addr
+	proxyType  string
+	proxyName  string
+	remotePort int
+	domains    []string
+	visitor    string
+}
+
+func newPolicyRequest(content any) (*policyRequest, bool) {
+	switch c := content.(type) {
+	case *LoginContent:
+		return &policyRequest{
+			user:   c.User,
+			metas:  c.Metas,
+			source: parseSourceAddr(c.ClientAddress),
+		}, true
+	case *NewProxyContent:
+		req := &policyRequest{
+			user:       c.User.User,
+			metas:      c.User.Metas,
+			source:     parseSourceAddr(c.User.ClientAddress),
+			proxyType:  c.ProxyType,
+			proxyName:  c.ProxyName,
+			remotePort: c.RemotePort,
+			domains:    slices.Clone(c.CustomDomains),
+		}
+		if c.SubDomain != "" {
+			req.domains = append(req.domains, c.SubDomain)
+		}
+		return req, true
+	case *NewUserConnContent:
+		return &policyRequest{
+			user:      c.User.User,
+			metas:     c.User.Metas,
+			source:    parseSourceAddr(c.RemoteAddr),
+			proxyType: c.ProxyType,
+			proxyName: c.ProxyName,
+			visitor:   c.VisitorUser,
+		}, true
+	default:
+		return nil, false
+	}
+}
+
+// parseSourceAddr returns the IP of addr, which is "ip:port" or "ip".
+func parseSourceAddr(addr string) netip.Addr {
+	if ap, err := netip.ParseAddrPort(addr); err == nil {
+		return ap.Addr().Unmap()
+	}
+	if ip, err := netip.ParseAddr(addr); err == nil {
+		return ip.Unmap()
+	}
+	return netip.Addr{}
+}
+
+// PolicyPluginName is the name the policy is called by in the logs.
+const PolicyPluginName = "policy"
+
+// policyPlugin runs a Policy as the first plugin of the chain.
+type policyPlugin struct {
+	policy *Policy
+}
+
+func (p *policyPlugin) Name() string {
+	return PolicyPluginName
+}
+
+func (p *policyPlugin) IsSupport(op string) bool {
+	return op == OpLogin || op == OpNewProxy || op == OpNewUserConn
+}
+
+func (p *policyPlugin) Handle(_ context.Context, op string, content any) (*Response, any, error) {
+	// content is passed by value, the modify rules change a copy
+	ptr := reflect.New(reflect.TypeOf(content))
+	ptr.Elem().Set(reflect.ValueOf(content))
+	retContent := ptr.Interface()
+
+	d := p.policy.Evaluate(op, retContent)
+	if !d.Allow {
+		return &Response{Reject: true, RejectReason: d.Reason}, nil, nil
+	}
+	return &Response{Unchange: len(d.Modified) == 0}, retContent, nil
+}
@@ -0,0 +1,282 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+	"github.com/gk7790/gk-zap/pkg/config/types"
+	"github.com/gk7790/gk-zap/pkg/msg"
+	"github.com/samber/lo"
+)
+
+func newTestPolicy(t *testing.T, defaultAction m.PolicyAction, rules ...m.PolicyRule) *Policy {
+	t.Helper()
+	c := &m.PolicyConfig{DefaultAction: defaultAction, Rules: rules}
+	c.Complete()
+	p, err := NewPolicy(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func newProxyContent(user, source, pxyType, name string, remotePort int, domains ...string) *NewProxyContent {
+	return &NewProxyContent{
+		User: UserInfo{User: user, Metas: map[string]string{"team": "ops"}, ClientAddress: source},
+		NewProxy: msg.NewProxy{
+			ProxyName:     name,
+			ProxyType:     pxyType,
+			RemotePort:    remotePort,
+			CustomDomains: domains,
+		},
+	}
+}
+
+func TestPolicyFirstMatch(t *testing.T) {
+	p := newTestPolicy(t, m.PolicyActionDeny,
+		m.PolicyRule{Name: "deny-bob", Match: m.PolicyMatch{Users: []string{"bob"}}, Action: m.PolicyActionDeny, Reason: "bob is banned"},
+		m.PolicyRule{Name: "allow-a", Match: m.PolicyMatch{Users: []string{"a*"}}, Action: m.PolicyActionAllow},
+		// never reached, the rule above matches first
+		m.PolicyRule{Name: "deny-alice", Match: m.PolicyMatch{Users: []string{"alice"}}, Action: m.PolicyActionDeny},
+	)
+
+	tests := []struct {
+		user       string
+		wantAllow  bool
+		wantRule   string
+		wantReason string
+	}{
+		{user: "bob", wantRule: `rules[0] "deny-bob"`, wantReason: "bob is banned"},
+		{user: "alice", wantAllow: true, wantRule: `rules[1] "allow-a"`},
+		{user: "dave", wantReason: "denied by the default action of policy"},
+	}
+	for _, tt := range tests {
+		d := p.Evaluate(OpNewProxy, newProxyContent(tt.user, "10.0.0.1:5000", "tcp", "x", 6000))
+		if d.Allow != tt.wantAllow || d.Rule != tt.wantRule || d.Reason != tt.wantReason {
+			t.Errorf("user %q: unexpected decision %+v", tt.user, d)
+		}
+	}
+}
+
+func TestPolicyDefaultAction(t *testing.T) {
+	rule := m.PolicyRule{Ops: []string{OpLogin}, Match: m.PolicyMatch{Users: []string{"alice"}}, Action: m.PolicyActionDeny}
+	for _, action := range []m.PolicyAction{"", m.PolicyActionAllow, m.PolicyActionDeny} {
+		p := newTestPolicy(t, action, rule)
+		// the rule only applies to Login
+		d := p.Evaluate(OpNewProxy, newProxyContent("alice", "10.0.0.1:5000", "tcp", "x", 6000))
+		if wantAllow := action != m.PolicyActionDeny; d.Allow != wantAllow || d.Rule != "" {
+			t.Errorf("default action %q: unexpected decision %+v", action, d)
+		}
+		d = p.Evaluate(OpLogin, &LoginContent{Login: msg.Login{User: "alice"}})
+		if d.Allow || d.Rule != "rules[0]" || d.Reason != "denied by policy rule rules[0]" {
+			t.Errorf("default action %q: unexpected decision for login %+v", action, d)
+		}
+	}
+
+	// the ops the policy doesn't handle are allowed
+	p := newTestPolicy(t, m.PolicyActionDeny)
+	if d := p.Evaluate(OpPing, &PingContent{}); !d.Allow {
+		t.Errorf("unexpected decision for ping %+v", d)
+	}
+}
+
+func TestPolicyMatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		match   m.PolicyMatch
+		op      string
+		content any
+		want    bool
+	}{
+		{
+			name:    "ipv4 cidr",
+			match:   m.PolicyMatch{SourceCIDRs: []string{"10.0.0.0/8"}},
+			content: newProxyContent("alice", "10.1.2.3:5000", "tcp", "x", 6000),
+			want:    true,
+		},
+		{
+			name:    "ipv4 outside cidr",
+			match:   m.PolicyMatch{SourceCIDRs: []string{"10.0.0.0/8", "192.168.0.0/16"}},
+			content: newProxyContent("alice", "172.16.0.1:5000", "tcp", "x", 6000),
+		},
+		{
+			name:    "ipv4 mapped ipv6",
+			match:   m.PolicyMatch{SourceCIDRs: []string{"10.0.0.0/8"}},
+			content: newProxyContent("alice", "[::ffff:10.0.0.1]:5000", "tcp", "x", 6000),
+			want:    true,
+		},
+		{
+			name:    "ipv6 cidr",
+			match:   m.PolicyMatch{SourceCIDRs: []string{"2001:db8::/32"}},
+			content: newProxyContent("alice", "[2001:db8::1]:5000", "tcp", "x", 6000),
+			want:    true,
+		},
+		{
+			name:    "no source address",
+			match:   m.PolicyMatch{SourceCIDRs: []string{"0.0.0.0/0"}},
+			content: newProxyContent("alice", "", "tcp", "x", 6000),
+		},
+		{
+			name:    "proxy name glob",
+			match:   m.PolicyMatch{ProxyNames: []string{"alice.*"}},
+			content: newProxyContent("alice", "10.0.0.1:5000", "tcp", "alice.ssh", 6000),
+			want:    true,
+		},
+		{
+			name:    "proxy name glob doesn't cross a slash",
+			match:   m.PolicyMatch{ProxyNames: []string{"alice*"}},
+			content: newProxyContent("alice", "10.0.0.1:5000", "tcp", "alice/ssh", 6000),
+		},
+		{
+			name:    "meta glob",
+			match:   m.PolicyMatch{Metas: map[string]string{"team": "o?s"}},
+			content: newProxyContent("alice", "10.0.0.1:5000", "tcp", "x", 6000),
+			want:    true,
+		},
+		{
+			name:    "missing meta",
+			match:   m.PolicyMatch{Metas: map[string]string{"env": "*"}},
+			content: newProxyContent("alice", "10.0.0.1:5000", "tcp", "x", 6000),
+		},
+		{
+			name:    "domain glob",
+			match:   m.PolicyMatch{Domains: []string{"*.example.com"}},
+			content: newProxyContent("alice", "10.0.0.1:5000", "http", "web", 0, "other.org", "www.example.com"),
+			want:    true,
+		},
+		{
+			name:    "port range",
+			match:   m.PolicyMatch{RemotePorts: []types.PortsRange{{Single: 22}, {Start: 6000, End: 6010}}},
+			content: newProxyContent("alice", "10.0.0.1:5000", "tcp", "x", 6010),
+			want:    true,
+		},
+		{
+			name:    "single port",
+			match:   m.PolicyMatch{RemotePorts: []types.PortsRange{{Single: 22}, {Start: 6000, End: 6010}}},
+			content: newProxyContent("alice", "10.0.0.1:5000", "tcp", "x", 22),
+			want:    true,
+		},
+		{
+			name:    "port outside range",
+			match:   m.PolicyMatch{RemotePorts: []types.PortsRange{{Single: 22}, {Start: 6000, End: 6010}}},
+			content: newProxyContent("alice", "10.0.0.1:5000", "tcp", "x", 6011),
+		},
+		{
+			name:    "random port",
+			match:   m.PolicyMatch{RemotePorts: []types.PortsRange{{Start: 1, End: 65535}}},
+			content: newProxyContent("alice", "10.0.0.1:5000", "tcp", "x", 0),
+		},
+		{
+			name:    "all conditions must match",
+			match:   m.PolicyMatch{Users: []string{"alice"}, ProxyTypes: []m.ProxyType{m.ProxyTypeUDP}},
+			content: newProxyContent("alice", "10.0.0.1:5000", "tcp", "x", 6000),
+		},
+		{
+			name:  "visitor",
+			match: m.PolicyMatch{Visitors: []string{"b*"}, SourceCIDRs: []string{"192.0.2.0/24"}},
+			op:    OpNewUserConn,
+			content: &NewUserConnContent{
+				User: UserInfo{User: "alice"}, ProxyName: "alice.ssh", ProxyType: "stcp",
+				RemoteAddr: "192.0.2.7:40000", VisitorUser: "bob",
+			},
+			want: true,
+		},
+		{
+			name:    "login has no proxy name",
+			match:   m.PolicyMatch{ProxyNames: []string{"*"}},
+			op:      OpLogin,
+			content: &LoginContent{Login: msg.Login{User: "alice"}, ClientAddress: "10.0.0.1:5000"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestPolicy(t, m.PolicyActionDeny, m.PolicyRule{Match: tt.match, Action: m.PolicyActionAllow})
+			op := tt.op
+			if op == "" {
+				op = OpNewProxy
+			}
+			if d := p.Evaluate(op, tt.content); d.Allow != tt.want {
+				t.Fatalf("expected match %v, got %+v", tt.want, d)
+			}
+		})
+	}
+}
+
+func TestPolicyPlugin(t *testing.T) {
+	mgr := NewManager()
+	mgr.SetPolicy(newTestPolicy(t, m.PolicyActionAllow,
+		m.PolicyRule{Match: m.PolicyMatch{RemotePorts: []types.PortsRange{{Single: 22}}}, Action: m.PolicyActionDeny, Reason: "no ssh"},
+	))
+	// the policy runs before the plugins, a denied request doesn't reach them
+	plugin := &testPlugin{name: "plugin", ops: []string{OpNewProxy}}
+	mgr.Register(plugin)
+
+	if _, err := mgr.NewProxy(newProxyContent("alice", "10.0.0.1:5000", "tcp", "x", 22)); err == nil || err.Error() != "no ssh" {
+		t.Fatalf("expected the policy to deny, got %v", err)
+	}
+	if len(plugin.calls) != 0 {
+		t.Fatal("expected the plugin not to be called")
+	}
+	content := newProxyContent("alice", "10.0.0.1:5000", "tcp", "x", 6000)
+	res, err := mgr.NewProxy(content)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// the policy doesn't change the request
+	if res != content || len(plugin.calls) != 1 {
+		t.Fatalf("expected the request to pass unchanged, got %+v", res)
+	}
+
+	if res, _, err := (&policyPlugin{policy: newTestPolicy(t, m.PolicyActionDeny)}).Handle(
+		context.Background(), OpLogin, LoginContent{}); err != nil || !res.Reject {
+		t.Fatalf("expected the default action to reject, got %+v %v", res, err)
+	}
+}
+
+func TestPolicyModify(t *testing.T) {
+	mgr := NewManager()
+	mgr.SetPolicy(newTestPolicy(t, m.PolicyActionAllow,
+		m.PolicyRule{
+			Name:   "limit-alice",
+			Ops:    []string{OpNewProxy},
+			Match:  m.PolicyMatch{Users: []string{"alice"}},
+			Action: m.PolicyActionModify,
+			Set:    m.PolicyModify{UseEncryption: lo.ToPtr(true), BandwidthLimit: "1MB"},
+		},
+		// modify rules go on with the following rules
+		m.PolicyRule{Match: m.PolicyMatch{RemotePorts: []types.PortsRange{{Single: 22}}}, Action: m.PolicyActionDeny, Reason: "no ssh"},
+	))
+	plugin := &testPlugin{name: "plugin", ops: []string{OpNewProxy}}
+	mgr.Register(plugin)
+
+	content := newProxyContent("alice", "10.0.0.1:5000", "tcp", "x", 6000)
+	res, err := mgr.NewProxy(content)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !res.UseEncryption || res.BandwidthLimit != "1MB" || res.ProxyName != "x" {
+		t.Fatalf("expected the request to be modified, got %+v", res.NewProxy)
+	}
+	if got := plugin.calls[0].(NewProxyContent); !got.UseEncryption || got.BandwidthLimit != "1MB" {
+		t.Errorf("expected the plugin to get the modified request, got %+v", got.NewProxy)
+	}
+	if content.UseEncryption || content.BandwidthLimit != "" {
+		t.Errorf("expected the original request to be kept, got %+v", content.NewProxy)
+	}
+
+	if _, err := mgr.NewProxy(newProxyContent("alice", "10.0.0.1:5000", "tcp", "x", 22)); err == nil || err.Error() != "no ssh" {
+		t.Fatalf("expected a later rule to deny the modified request, got %v", err)
+	}
+
+	// other users aren't modified
+	res, err = mgr.NewProxy(newProxyContent("bob", "10.0.0.1:5000", "tcp", "x", 6000))
+	if err != nil || res.UseEncryption || res.BandwidthLimit != "" {
+		t.Fatalf("expected the request of bob to pass unchanged, got %+v %v", res, err)
+	}
+
+	d := mgr.policy.Load().policy.Evaluate(OpNewProxy, newProxyContent("alice", "10.0.0.1:5000", "tcp", "x", 6000))
+	if !d.Allow || len(d.Modified) != 1 || d.Modified[0] != `rules[0] "limit-alice"` {
+		t.Errorf("unexpected decision %+v", d)
+	}
+}
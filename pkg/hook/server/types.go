@@ -3,12 +3,16 @@ package server
 import "github.com/gk7790/gk-zap/pkg/msg"
 
 type Request struct {
+	// ID matches the response of an exec plugin with its request, it's
+	// omitted for HTTP plugins.
+	ID      string `json:"id,omitempty"`
 	Version string `json:"version"`
 	Op      string `json:"op"`
 	Content any    `json:"content"`
 }
 
 type Response struct {
+	ID           string `json:"id,omitempty"`
 	Reject       bool   `json:"reject"`
 	RejectReason string `json:"reject_reason"`
 	Unchange     bool   `json:"unchange"`
@@ -25,6 +29,8 @@ type UserInfo struct {
 	User  string            `json:"user"`
 	Metas map[string]string `json:"metas"`
 	RunID string            `json:"run_id"`
+	// ClientAddress is the address of the control connection of the client.
+	ClientAddress string `json:"client_address,omitempty"`
 }
 
 type NewProxyContent struct {
@@ -47,9 +53,14 @@ type NewWorkConnContent struct {
 	msg.NewWorkConn
 }
 
+// NewUserConnContent is sent for a user connection to a proxy before the
+// connection is handed to the proxy.
 type NewUserConnContent struct {
 	User       UserInfo `json:"user"`
 	ProxyName  string   `json:"proxy_name"`
 	ProxyType  string   `json:"proxy_type"`
 	RemoteAddr string   `json:"remote_addr"`
+	// VisitorUser is the user of the visitor, it's empty if the visitor
+	// didn't log in.
+	VisitorUser string `json:"visitor_user,omitempty"`
 }
@@ -67,6 +67,8 @@ type Login struct {
 	User         string            `json:"user,omitempty"`
 	PrivilegeKey string            `json:"privilege_key,omitempty"`
 	Timestamp    int64             `json:"timestamp,omitempty"`
+	Nonce        string            `json:"nonce,omitempty"`
+	AuthVersion  int               `json:"auth_version,omitempty"`
 	RunID        string            `json:"run_id,omitempty"`
 	Metas        map[string]string `json:"metas,omitempty"`
 
@@ -132,6 +134,8 @@ type NewWorkConn struct {
 	RunID        string `json:"run_id,omitempty"`
 	PrivilegeKey string `json:"privilege_key,omitempty"`
 	Timestamp    int64  `json:"timestamp,omitempty"`
+	Nonce        string `json:"nonce,omitempty"`
+	AuthVersion  int    `json:"auth_version,omitempty"`
 }
 
 type ReqWorkConn struct{}
@@ -160,8 +164,11 @@ type NewVisitorConnResp struct {
 }
 
 type Ping struct {
+	RunID        string `json:"run_id,omitempty"`
 	PrivilegeKey string `json:"privilege_key,omitempty"`
 	Timestamp    int64  `json:"timestamp,omitempty"`
+	Nonce        string `json:"nonce,omitempty"`
+	AuthVersion  int    `json:"auth_version,omitempty"`
 }
 
 type Pong struct {
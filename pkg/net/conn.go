@@ -199,7 +199,7 @@ type cryptoRW struct {
 	aead      cipher.AEAD
 	nonceSize int
 	writeMu   sync.Mutex
-	readBuf   []byte // temporary buffer for read frame
+	readBuf   []byte // decrypted plaintext not yet returned by Read
 }
 
 // NewCryptoReadWriter returns an io.ReadWriter that encrypts writes and decrypts reads.
@@ -256,8 +256,15 @@ func (c *cryptoRW) Write(p []byte) (n int, err error) {
 	return len(p), nil
 }
 
-// Read: reads a frame and returns decrypted plaintext
+// Read: returns buffered plaintext left from the previous frame first,
+// otherwise reads and decrypts the next frame
 func (c *cryptoRW) Read(p []byte) (int, error) {
+	if len(c.readBuf) > 0 {
+		n := copy(p, c.readBuf)
+		c.readBuf = c.readBuf[n:]
+		return n, nil
+	}
+
 	// read 4-byte length
 	var lenBuf [4]byte
 	if _, err := io.ReadFull(c.rw, lenBuf[:]); err != nil {
@@ -278,13 +285,8 @@ func (c *cryptoRW) Read(p []byte) (int, error) {
 	if err != nil {
 		return 0, err
 	}
-	// copy into supplied buffer
+	// copy into supplied buffer and keep the remainder for the next Read
 	n := copy(p, plaintext)
-	if n < len(plaintext) {
-		// If user's p is smaller than plaintext, we return the first part and keep remainder?
-		// Simpler: return io.ErrShortBuffer to indicate buffer too small.
-		// Caller should provide a large enough buffer or read in loop.
-		return n, io.ErrShortBuffer
-	}
+	c.readBuf = plaintext[n:]
 	return n, nil
 }
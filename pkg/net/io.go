@@ -0,0 +1,100 @@
+package net
+
+import (
+	"compress/flate"
+	"crypto/sha256"
+	"io"
+	"sync"
+)
+
+// -------------------------------
+// Join: 双向转发两个连接的数据
+// -------------------------------
+
+// Join copies data between c1 and c2 in both directions until either side
+// is closed, then closes both.
+func Join(c1 io.ReadWriteCloser, c2 io.ReadWriteCloser) (inCount int64, outCount int64, errs []error) {
+	var wait sync.WaitGroup
+	recordErrs := make([]error, 2)
+	pipe := func(number int, to io.ReadWriteCloser, from io.ReadWriteCloser, count *int64) {
+		defer wait.Done()
+		defer to.Close()
+		defer from.Close()
+
+		buf := make([]byte, 32*1024)
+		*count, recordErrs[number] = io.CopyBuffer(to, from, buf)
+	}
+
+	wait.Add(2)
+	go pipe(0, c1, c2, &inCount)
+	go pipe(1, c2, c1, &outCount)
+	wait.Wait()
+
+	for _, e := range recordErrs {
+		if e != nil {
+			errs = append(errs, e)
+		}
+	}
+	return
+}
+
+// -------------------------------
+// WithEncryption / WithCompression: 传输层加密与压缩
+// -------------------------------
+
+type readWriteCloser struct {
+	io.Reader
+	io.Writer
+	closeFn func() error
+}
+
+func (rwc *readWriteCloser) Close() error {
+	return rwc.closeFn()
+}
+
+// WithEncryption wraps rwc so that all data is encrypted with an AES-256 key
+// derived from key. Both sides must use the same key.
+func WithEncryption(rwc io.ReadWriteCloser, key []byte) (io.ReadWriteCloser, error) {
+	sum := sha256.Sum256(key)
+	rw, err := NewCryptoReadWriter(rwc, sum[:])
+	if err != nil {
+		return nil, err
+	}
+	return &readWriteCloser{
+		Reader:  rw,
+		Writer:  rw,
+		closeFn: rwc.Close,
+	}, nil
+}
+
+type compressedWriter struct {
+	w  *flate.Writer
+	mu sync.Mutex
+}
+
+// Write compresses p and flushes it immediately, so that the peer can read
+// it without waiting for more data.
+func (cw *compressedWriter) Write(p []byte) (n int, err error) {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	if n, err = cw.w.Write(p); err != nil {
+		return
+	}
+	err = cw.w.Flush()
+	return
+}
+
+// WithCompression wraps rwc so that all data is compressed with DEFLATE.
+func WithCompression(rwc io.ReadWriteCloser) io.ReadWriteCloser {
+	// flate.NewWriter only fails with an invalid level.
+	w, _ := flate.NewWriter(rwc, flate.DefaultCompression)
+	r := flate.NewReader(rwc)
+	return &readWriteCloser{
+		Reader: r,
+		Writer: &compressedWriter{w: w},
+		closeFn: func() error {
+			_ = r.Close()
+			return rwc.Close()
+		},
+	}
+}
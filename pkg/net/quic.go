@@ -0,0 +1,36 @@
+package net
+
+import (
+	"net"
+
+	quic "github.com/quic-go/quic-go"
+)
+
+// -------------------------------
+// QUIC stream 封装成 net.Conn
+// -------------------------------
+
+type wrapQuicStream struct {
+	*quic.Stream
+	c *quic.Conn
+}
+
+func QuicStreamToNetConn(s *quic.Stream, c *quic.Conn) net.Conn {
+	return &wrapQuicStream{
+		Stream: s,
+		c:      c,
+	}
+}
+
+func (conn *wrapQuicStream) LocalAddr() net.Addr {
+	return conn.c.LocalAddr()
+}
+
+func (conn *wrapQuicStream) RemoteAddr() net.Addr {
+	return conn.c.RemoteAddr()
+}
+
+func (conn *wrapQuicStream) Close() error {
+	conn.CancelRead(0)
+	return conn.Stream.Close()
+}
@@ -0,0 +1,77 @@
+package net
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"time"
+)
+
+// TLSHeadByte is sent by clients before the TLS handshake when custom TLS
+// first byte is enabled.
+var TLSHeadByte = 0x17
+
+const tlsHandshakeByte = 0x16
+
+// -------------------------------
+// peekConn: 可预读首字节的连接
+// -------------------------------
+
+type peekConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *peekConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// CheckAndEnableTLSServerConnWithTimeout peeks the first byte of c to decide
+// whether the client starts a TLS handshake. If so the returned conn is a
+// TLS server conn. If tlsOnly is true, non-TLS connections are rejected.
+func CheckAndEnableTLSServerConnWithTimeout(
+	c net.Conn, tlsConfig *tls.Config, tlsOnly bool, timeout time.Duration,
+) (out net.Conn, isTLS bool, custom bool, err error) {
+	pc := &peekConn{Conn: c, r: bufio.NewReader(c)}
+
+	_ = c.SetReadDeadline(time.Now().Add(timeout))
+	head, err := pc.r.Peek(1)
+	_ = c.SetReadDeadline(time.Time{})
+	if err != nil {
+		return nil, false, false, err
+	}
+
+	switch {
+	case int(head[0]) == TLSHeadByte:
+		_, _ = pc.r.Discard(1)
+		out = tls.Server(pc, tlsConfig)
+		isTLS = true
+		custom = true
+	case head[0] == tlsHandshakeByte:
+		out = tls.Server(pc, tlsConfig)
+		isTLS = true
+	default:
+		if tlsOnly {
+			return nil, false, false, fmt.Errorf("non-TLS connection received on a TlsOnly server")
+		}
+		out = pc
+	}
+	return
+}
+
+type tlsStateKey struct{}
+
+// NewContextWithTLSState returns a context carrying the state of the TLS
+// connection the messages were received on.
+func NewContextWithTLSState(ctx context.Context, state *tls.ConnectionState) context.Context {
+	return context.WithValue(ctx, tlsStateKey{}, state)
+}
+
+// TLSStateFromContext returns the TLS state stored in ctx, or nil if the
+// connection isn't a TLS one.
+func TLSStateFromContext(ctx context.Context) *tls.ConnectionState {
+	state, _ := ctx.Value(tlsStateKey{}).(*tls.ConnectionState)
+	return state
+}
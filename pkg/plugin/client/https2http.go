@@ -0,0 +1,115 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"time"
+
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+	pkgNet "github.com/gk7790/gk-zap/pkg/net"
+	"github.com/gk7790/gk-zap/pkg/transport"
+	"github.com/gk7790/gk-zap/pkg/utils/log"
+	"github.com/samber/lo"
+)
+
+func init() {
+	Register(m.PluginHTTPS2HTTP, NewHTTPS2HTTPPlugin)
+}
+
+type HTTPS2HTTPPlugin struct {
+	opts *m.HTTPS2HTTPPluginOptions
+
+	l *pkgNet.InternalListener
+	s *http.Server
+}
+
+func NewHTTPS2HTTPPlugin(options m.ClientPluginOptions) (Plugin, error) {
+	opts := options.(*m.HTTPS2HTTPPluginOptions)
+
+	p := &HTTPS2HTTPPlugin{
+		opts: opts,
+		l:    pkgNet.NewInternalListener(),
+	}
+
+	rp := &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.Out.Header["X-Forwarded-For"] = r.In.Header["X-Forwarded-For"]
+			r.SetXForwarded()
+			req := r.Out
+			req.URL.Scheme = "http"
+			req.URL.Host = p.opts.LocalAddr
+			if p.opts.HostHeaderRewrite != "" {
+				req.Host = p.opts.HostHeaderRewrite
+			}
+			for k, v := range p.opts.RequestHeaders.Set {
+				req.Header.Set(k, v)
+			}
+		},
+		ErrorHandler: proxyErrorHandler(m.PluginHTTPS2HTTP),
+	}
+
+	s, err := newHTTPSServer(rp, opts.TLSConfig, lo.FromPtr(opts.EnableHTTP2))
+	if err != nil {
+		return nil, fmt.Errorf("gen TLS config error: %v", err)
+	}
+	p.s = s
+
+	go func() {
+		_ = p.s.ServeTLS(p.l, "", "")
+	}()
+	return p, nil
+}
+
+func (p *HTTPS2HTTPPlugin) Handle(_ context.Context, connInfo *ConnectionInfo) {
+	wrapConn := wrapPluginConn(connInfo)
+	if err := p.l.PutConn(wrapConn); err != nil {
+		log.Debugf("[%s] put conn error: %v", p.Name(), err)
+		wrapConn.Close()
+	}
+}
+
+func (p *HTTPS2HTTPPlugin) Name() string {
+	return m.PluginHTTPS2HTTP
+}
+
+func (p *HTTPS2HTTPPlugin) Close() error {
+	return p.s.Close()
+}
+
+// newHTTPSServer builds an http.Server which terminates TLS with the
+// certificate configured in tlsCfg and serves handler.
+func newHTTPSServer(handler http.Handler, tlsCfg m.TLSConfig, enableHTTP2 bool) (*http.Server, error) {
+	tlsConfig, err := transport.NewServerTLSConfig(tlsCfg.CertFile, tlsCfg.KeyFile, tlsCfg.TrustedCaFile)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 60 * time.Second,
+		TLSConfig:         tlsConfig,
+	}
+	if !enableHTTP2 {
+		s.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
+	}
+	return s, nil
+}
+
+func proxyErrorHandler(name string) func(http.ResponseWriter, *http.Request, error) {
+	return func(rw http.ResponseWriter, req *http.Request, err error) {
+		log.Warnf("[%s] proxy request [%s %s] error: %v", name, req.Method, req.URL.String(), err)
+		rw.WriteHeader(http.StatusBadGateway)
+		_, _ = rw.Write([]byte(err.Error()))
+	}
+}
+
+func wrapPluginConn(connInfo *ConnectionInfo) *pkgNet.WrapReadWriteCloserConn {
+	wrapConn := pkgNet.WrapReadWriteCloserToConn(connInfo.Conn, connInfo.UnderlyingConn)
+	if connInfo.SrcAddr != nil {
+		wrapConn.SetRemoteAddr(connInfo.SrcAddr)
+	}
+	return wrapConn
+}
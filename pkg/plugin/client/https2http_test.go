@@ -0,0 +1,188 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samber/lo"
+
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+	"github.com/gk7790/gk-zap/pkg/utils/log"
+)
+
+func TestMain(tm *testing.M) {
+	log.Init(false, "", log.LevelError)
+	os.Exit(tm.Run())
+}
+
+// backendRequest is what the local backend saw of a forwarded request.
+type backendRequest struct {
+	host    string
+	header  http.Header
+	tls     bool
+	request string
+}
+
+func newBackend(t *testing.T, useTLS bool) (addr string, reqCh <-chan backendRequest) {
+	t.Helper()
+	ch := make(chan backendRequest, 1)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ch <- backendRequest{host: r.Host, header: r.Header.Clone(), tls: r.TLS != nil, request: r.Method + " " + r.URL.Path}
+		_, _ = w.Write([]byte("hello"))
+	})
+	var s *httptest.Server
+	if useTLS {
+		s = httptest.NewTLSServer(handler)
+	} else {
+		s = httptest.NewServer(handler)
+	}
+	t.Cleanup(s.Close)
+	return s.Listener.Addr().String(), ch
+}
+
+// newVisitorClient returns a client whose connections are handed to p the
+// way a proxy hands it user connections.
+func newVisitorClient(p Plugin, srcAddr net.Addr) *http.Client {
+	return &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				userConn, pluginConn := net.Pipe()
+				go p.Handle(ctx, &ConnectionInfo{Conn: pluginConn, UnderlyingConn: pluginConn, SrcAddr: srcAddr})
+				return userConn, nil
+			},
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+}
+
+func TestHTTPSPlugins(t *testing.T) {
+	srcAddr := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 40000}
+	headers := m.HeaderOperations{Set: map[string]string{"X-From": "gk"}}
+
+	tests := []struct {
+		name       string
+		backendTLS bool
+		create     func(localAddr string) (Plugin, error)
+	}{
+		{
+			name: m.PluginHTTPS2HTTP,
+			create: func(localAddr string) (Plugin, error) {
+				return NewHTTPS2HTTPPlugin(&m.HTTPS2HTTPPluginOptions{
+					LocalAddr:         localAddr,
+					HostHeaderRewrite: "backend.local",
+					RequestHeaders:    headers,
+					EnableHTTP2:       lo.ToPtr(true),
+				})
+			},
+		},
+		{
+			name:       m.PluginHTTPS2HTTPS,
+			backendTLS: true,
+			create: func(localAddr string) (Plugin, error) {
+				return NewHTTPS2HTTPSPlugin(&m.HTTPS2HTTPSPluginOptions{
+					LocalAddr:         localAddr,
+					HostHeaderRewrite: "backend.local",
+					RequestHeaders:    headers,
+					EnableHTTP2:       lo.ToPtr(false),
+				})
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backendAddr, reqCh := newBackend(t, tt.backendTLS)
+			p, err := tt.create(backendAddr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer p.Close()
+
+			req, _ := http.NewRequest("GET", "https://www.example.com/path", nil)
+			req.Header.Set("X-From", "visitor")
+			resp, err := newVisitorClient(p, srcAddr).Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+
+			// the visitor talks TLS to the plugin
+			if resp.TLS == nil || resp.StatusCode != http.StatusOK || string(body) != "hello" {
+				t.Fatalf("unexpected response: tls %v, status %d, body %q", resp.TLS != nil, resp.StatusCode, body)
+			}
+
+			got := <-reqCh
+			if got.request != "GET /path" {
+				t.Errorf("expected GET /path, got %s", got.request)
+			}
+			if got.tls != tt.backendTLS {
+				t.Errorf("expected backend tls %v, got %v", tt.backendTLS, got.tls)
+			}
+			if got.host != "backend.local" {
+				t.Errorf("expected the host to be rewritten, got %s", got.host)
+			}
+			if v := got.header.Get("X-From"); v != "gk" {
+				t.Errorf("expected the configured header to replace the visitor's, got %s", v)
+			}
+			if v := got.header.Get("X-Forwarded-For"); v != "192.0.2.1" {
+				t.Errorf("expected X-Forwarded-For of the user, got %s", v)
+			}
+			if v := got.header.Get("X-Forwarded-Proto"); v != "https" {
+				t.Errorf("expected X-Forwarded-Proto https, got %s", v)
+			}
+		})
+	}
+}
+
+func TestHTTPSPluginBackendError(t *testing.T) {
+	// nothing listens on the address of a closed listener
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	p, err := NewHTTPS2HTTPPlugin(&m.HTTPS2HTTPPluginOptions{LocalAddr: addr, EnableHTTP2: lo.ToPtr(true)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	resp, err := newVisitorClient(p, nil).Get("https://www.example.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway || !strings.Contains(string(body), "refused") {
+		t.Fatalf("expected bad gateway, got %d %q", resp.StatusCode, body)
+	}
+}
+
+func TestHTTPSPluginClosed(t *testing.T) {
+	p, err := NewHTTPS2HTTPPlugin(&m.HTTPS2HTTPPluginOptions{LocalAddr: "127.0.0.1:1", EnableHTTP2: lo.ToPtr(true)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Close()
+	// wait for the server to close its listener
+	time.Sleep(100 * time.Millisecond)
+
+	// connections handed to a closed plugin are closed instead of leaking
+	userConn, pluginConn := net.Pipe()
+	p.Handle(context.Background(), &ConnectionInfo{Conn: pluginConn, UnderlyingConn: pluginConn})
+	_ = userConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := userConn.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("expected the connection to be closed, got %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+	pkgNet "github.com/gk7790/gk-zap/pkg/net"
+	"github.com/gk7790/gk-zap/pkg/utils/log"
+	"github.com/samber/lo"
+)
+
+func init() {
+	Register(m.PluginHTTPS2HTTPS, NewHTTPS2HTTPSPlugin)
+}
+
+type HTTPS2HTTPSPlugin struct {
+	opts *m.HTTPS2HTTPSPluginOptions
+
+	l *pkgNet.InternalListener
+	s *http.Server
+}
+
+func NewHTTPS2HTTPSPlugin(options m.ClientPluginOptions) (Plugin, error) {
+	opts := options.(*m.HTTPS2HTTPSPluginOptions)
+
+	p := &HTTPS2HTTPSPlugin{
+		opts: opts,
+		l:    pkgNet.NewInternalListener(),
+	}
+
+	tr := &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+
+	rp := &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.Out.Header["X-Forwarded-For"] = r.In.Header["X-Forwarded-For"]
+			r.SetXForwarded()
+			req := r.Out
+			req.URL.Scheme = "https"
+			req.URL.Host = p.opts.LocalAddr
+			if p.opts.HostHeaderRewrite != "" {
+				req.Host = p.opts.HostHeaderRewrite
+			}
+			for k, v := range p.opts.RequestHeaders.Set {
+				req.Header.Set(k, v)
+			}
+		},
+		Transport:    tr,
+		ErrorHandler: proxyErrorHandler(m.PluginHTTPS2HTTPS),
+	}
+
+	s, err := newHTTPSServer(rp, opts.TLSConfig, lo.FromPtr(opts.EnableHTTP2))
+	if err != nil {
+		return nil, fmt.Errorf("gen TLS config error: %v", err)
+	}
+	p.s = s
+
+	go func() {
+		_ = p.s.ServeTLS(p.l, "", "")
+	}()
+	return p, nil
+}
+
+func (p *HTTPS2HTTPSPlugin) Handle(_ context.Context, connInfo *ConnectionInfo) {
+	wrapConn := wrapPluginConn(connInfo)
+	if err := p.l.PutConn(wrapConn); err != nil {
+		log.Debugf("[%s] put conn error: %v", p.Name(), err)
+		wrapConn.Close()
+	}
+}
+
+func (p *HTTPS2HTTPSPlugin) Name() string {
+	return m.PluginHTTPS2HTTPS
+}
+
+func (p *HTTPS2HTTPSPlugin) Close() error {
+	return p.s.Close()
+}
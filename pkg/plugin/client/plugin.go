@@ -0,0 +1,62 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+)
+
+// CreatorFn creates a Plugin from its options.
+type CreatorFn func(options m.ClientPluginOptions) (Plugin, error)
+
+var (
+	creators   = make(map[string]CreatorFn)
+	creatorsMu sync.RWMutex
+)
+
+// Register registers a plugin creator under name. It panics if name is
+// registered twice.
+func Register(name string, fn CreatorFn) {
+	creatorsMu.Lock()
+	defer creatorsMu.Unlock()
+	if _, exist := creators[name]; exist {
+		panic(fmt.Sprintf("plugin [%s] is already registered", name))
+	}
+	creators[name] = fn
+}
+
+func Create(name string, options m.ClientPluginOptions) (p Plugin, err error) {
+	creatorsMu.RLock()
+	fn, ok := creators[name]
+	creatorsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("plugin [%s] is not registered", name)
+	}
+	return fn(options)
+}
+
+// ConnectionInfo describes a user connection handed to a plugin by a proxy.
+type ConnectionInfo struct {
+	// Conn is the connection to read from and write to, it may be wrapped by
+	// encryption or compression.
+	Conn io.ReadWriteCloser
+	// UnderlyingConn is the raw work connection.
+	UnderlyingConn net.Conn
+
+	// SrcAddr and DstAddr are the addresses of the original user connection
+	// reported by the server, they may be nil.
+	SrcAddr net.Addr
+	DstAddr net.Addr
+}
+
+// Plugin handles user connections on behalf of a proxy instead of
+// forwarding them to LocalIP:LocalPort.
+type Plugin interface {
+	Name() string
+	Handle(ctx context.Context, connInfo *ConnectionInfo)
+	Close() error
+}
@@ -0,0 +1,123 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client talks to the admin API of a running gkc.
+type Client struct {
+	address  string
+	scheme   string
+	authUser string
+	authPwd  string
+
+	httpClient *http.Client
+}
+
+func New(host string, port int) *Client {
+	return &Client{
+		address:    net.JoinHostPort(host, strconv.Itoa(port)),
+		scheme:     "http",
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (c *Client) SetAuth(user, pwd string) {
+	c.authUser = user
+	c.authPwd = pwd
+}
+
+// EnableTLS makes requests over https. The admin server usually runs with a
+// self-signed certificate, so it is not verified unless tlsConfig says so.
+func (c *Client) EnableTLS(tlsConfig *tls.Config) {
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	c.scheme = "https"
+	c.httpClient.Transport = &http.Transport{TLSClientConfig: tlsConfig}
+}
+
+// ProxyStatus mirrors the items returned by GET /api/status.
+type ProxyStatus struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Status     string `json:"status"`
+	Err        string `json:"err"`
+	LocalAddr  string `json:"local_addr"`
+	Plugin     string `json:"plugin"`
+	RemoteAddr string `json:"remote_addr"`
+}
+
+// GetAllProxyStatus returns proxies grouped by type.
+func (c *Client) GetAllProxyStatus(ctx context.Context) (map[string][]ProxyStatus, error) {
+	content, err := c.do(ctx, http.MethodGet, "/api/status", nil)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string][]ProxyStatus)
+	if err := json.Unmarshal([]byte(content), &res); err != nil {
+		return nil, fmt.Errorf("unmarshal proxy status error: %v, content: %s", err, strings.TrimSpace(content))
+	}
+	return res, nil
+}
+
+func (c *Client) Reload(ctx context.Context, strictMode bool) error {
+	v := url.Values{}
+	if strictMode {
+		v.Set("strictConfig", "true")
+	}
+	path := "/api/reload"
+	if len(v) > 0 {
+		path += "?" + v.Encode()
+	}
+	_, err := c.do(ctx, http.MethodPost, path, nil)
+	return err
+}
+
+func (c *Client) Stop(ctx context.Context) error {
+	_, err := c.do(ctx, http.MethodPost, "/api/stop", nil)
+	return err
+}
+
+func (c *Client) GetConfig(ctx context.Context) (string, error) {
+	return c.do(ctx, http.MethodGet, "/api/config", nil)
+}
+
+func (c *Client) UpdateConfig(ctx context.Context, content string) error {
+	_, err := c.do(ctx, http.MethodPut, "/api/config", strings.NewReader(content))
+	return err
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body io.Reader) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.scheme+"://"+c.address+path, body)
+	if err != nil {
+		return "", err
+	}
+	if c.authUser != "" || c.authPwd != "" {
+		req.SetBasicAuth(c.authUser, c.authPwd)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	buf, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(buf)))
+	}
+	return string(buf), nil
+}
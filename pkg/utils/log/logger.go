@@ -23,6 +23,9 @@ var (
 
 var std *slog.Logger
 
+// levelVar 为全局日志级别，支持运行时通过 SetLevel 调整
+var levelVar = new(slog.LevelVar)
+
 // Init 初始化全局 logger。
 // toFile: 是否写入文件；filePath: 文件路径（当 toFile 为 true 时生效）
 func Init(toFile bool, filePath string, level slog.Level) *slog.Logger {
@@ -38,7 +41,8 @@ func Init(toFile bool, filePath string, level slog.Level) *slog.Logger {
 		out = os.Stdout
 	}
 
-	opts := &slog.HandlerOptions{Level: level}
+	levelVar.Set(level)
+	opts := &slog.HandlerOptions{Level: levelVar}
 	h := NewSimpleHandler(out, opts, 3)
 	std = slog.New(h)
 	// 让 package-level slog.* 调用使用我们初始化的 logger（可选）
@@ -46,6 +50,25 @@ func Init(toFile bool, filePath string, level slog.Level) *slog.Logger {
 	return std
 }
 
+// SetLevel 在运行时调整全局日志级别，无需重新 Init。
+func SetLevel(level slog.Level) {
+	levelVar.Set(level)
+}
+
+// ParseLevel 将配置中的日志级别字符串转换为 slog.Level，未知值按 info 处理。
+func ParseLevel(s string) slog.Level {
+	switch strings.ToLower(s) {
+	case "trace", "debug":
+		return LevelDebug
+	case "warn":
+		return LevelWarn
+	case "error":
+		return LevelError
+	default:
+		return LevelInfo
+	}
+}
+
 // SimpleHandler 是自定义的 slog.Handler，用于输出类似 frp 风格的日志。
 type SimpleHandler struct {
 	out        io.Writer
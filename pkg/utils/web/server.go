@@ -0,0 +1,119 @@
+package web
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"strconv"
+	"time"
+
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+	"github.com/gk7790/gk-zap/pkg/transport"
+	"github.com/gk7790/gk-zap/pkg/utils/util"
+)
+
+var (
+	defaultReadTimeout  = 60 * time.Second
+	defaultWriteTimeout = 60 * time.Second
+)
+
+// Server is the admin HTTP server configured by m.WebServerConfig. All
+// handlers are protected by basic auth if User or Password is set.
+type Server struct {
+	addr string
+	ln   net.Listener
+	tls  bool
+
+	mux *http.ServeMux
+	hs  *http.Server
+
+	user     string
+	password string
+}
+
+func NewServer(cfg m.WebServerConfig) (*Server, error) {
+	addr := net.JoinHostPort(cfg.Addr, strconv.Itoa(cfg.Port))
+
+	mux := http.NewServeMux()
+	hs := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: defaultReadTimeout,
+		ReadTimeout:       defaultReadTimeout,
+		WriteTimeout:      defaultWriteTimeout,
+	}
+	s := &Server{
+		addr:     addr,
+		mux:      mux,
+		hs:       hs,
+		user:     cfg.User,
+		password: cfg.Password,
+	}
+	if cfg.PprofEnable {
+		s.HandleFunc("/debug/pprof/", pprof.Index)
+		s.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		s.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		s.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		s.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.TLS != nil {
+		tlsConfig, err := transport.NewServerTLSConfig(cfg.TLS.CertFile, cfg.TLS.KeyFile, cfg.TLS.TrustedCaFile)
+		if err != nil {
+			ln.Close()
+			return nil, err
+		}
+		ln = tls.NewListener(ln, tlsConfig)
+		s.tls = true
+	}
+	s.ln = ln
+	return s, nil
+}
+
+func (s *Server) Address() string {
+	return s.addr
+}
+
+// TLS reports whether the server is serving HTTPS.
+func (s *Server) TLS() bool {
+	return s.tls
+}
+
+// HandleFunc registers handler for pattern, pattern uses the syntax of
+// http.ServeMux, e.g. "GET /api/status".
+func (s *Server) HandleFunc(pattern string, handler http.HandlerFunc) {
+	s.mux.Handle(pattern, s.basicAuth(handler))
+}
+
+func (s *Server) Run() error {
+	err := s.hs.Serve(s.ln)
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+func (s *Server) Close() error {
+	return s.hs.Close()
+}
+
+func (s *Server) basicAuth(next http.Handler) http.Handler {
+	if s.user == "" && s.password == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, passwd, ok := r.BasicAuth()
+		if !ok || !util.ConstantTimeEqString(user, s.user) || !util.ConstantTimeEqString(passwd, s.password) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
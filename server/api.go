@@ -0,0 +1,56 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gk7790/gk-zap/pkg/utils/log"
+	"github.com/gk7790/gk-zap/pkg/utils/web"
+)
+
+type GeneralResponse struct {
+	Code int
+	Msg  string
+}
+
+func (svr *Service) registerRouteHandlers(ws *web.Server) {
+	ws.HandleFunc("POST /api/reload", svr.apiReload)
+	ws.HandleFunc("GET /api/plugins", svr.apiPlugins)
+}
+
+// POST /api/reload
+func (svr *Service) apiReload(w http.ResponseWriter, r *http.Request) {
+	// the same mode as SIGHUP unless the request specifies one
+	strictConfigMode := svr.strictConfig
+	if v := r.URL.Query().Get("strictConfig"); v != "" {
+		if strict, err := strconv.ParseBool(v); err == nil {
+			strictConfigMode = strict
+		}
+	}
+	log.Infof("http request [/api/reload]")
+
+	result, err := svr.ReloadFromFile(strictConfigMode)
+	if err != nil {
+		res := GeneralResponse{Code: 400, Msg: err.Error()}
+		log.Warnf("reload gks config error: %s", res.Msg)
+		w.WriteHeader(res.Code)
+		_, _ = w.Write([]byte(res.Msg))
+		return
+	}
+
+	buf, _ := json.Marshal(result)
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(buf)
+	log.Infof("http response [/api/reload]")
+}
+
+// GET /api/plugins
+func (svr *Service) apiPlugins(w http.ResponseWriter, r *http.Request) {
+	log.Infof("http request [/api/plugins]")
+
+	buf, _ := json.Marshal(svr.hookManager.Stats())
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(buf)
+	log.Infof("http response [/api/plugins]")
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net"
 	"runtime/debug"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -25,12 +26,16 @@ import (
 
 type ControlManager struct {
 	ctlsByRunID map[string]*Control
+	// proxyOwners maps the proxy names to the controls which registered
+	// them, a name is registered by one control at a time
+	proxyOwners map[string]*Control
 	mu          sync.RWMutex
 }
 
 func NewControlManager() *ControlManager {
 	return &ControlManager{
 		ctlsByRunID: make(map[string]*Control),
+		proxyOwners: make(map[string]*Control),
 	}
 }
 
@@ -62,6 +67,35 @@ func (cm *ControlManager) GetByID(runID string) (ctl *Control, ok bool) {
 	return
 }
 
+// GetByProxy returns the control of the client which registered the proxy.
+func (cm *ControlManager) GetByProxy(name string) (ctl *Control, ok bool) {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	ctl, ok = cm.proxyOwners[name]
+	return
+}
+
+// acquireProxy records ctl as the owner of the proxy name, it returns false
+// if another control registered it.
+func (cm *ControlManager) acquireProxy(name string, ctl *Control) bool {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if owner, ok := cm.proxyOwners[name]; ok && owner != ctl {
+		return false
+	}
+	cm.proxyOwners[name] = ctl
+	return true
+}
+
+// releaseProxy forgets the owner of the proxy name if it's ctl.
+func (cm *ControlManager) releaseProxy(name string, ctl *Control) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if owner, ok := cm.proxyOwners[name]; ok && owner == ctl {
+		delete(cm.proxyOwners, name)
+	}
+}
+
 func (cm *ControlManager) Close() error {
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
@@ -89,6 +123,21 @@ type Control struct {
 
 	// 登入信息
 	loginMsg *msg.Login
+	// 客户端登录时发送的 user, 服务端从证书得到 user 时可能与 loginMsg.User 不同
+	clientUser string
+
+	// 用户文件, 热加载时替换
+	users *atomic.Pointer[userDB]
+	// 每个用户的代理数量, 所有控制器共享
+	proxyCounter *proxyCounter
+	// 全部控制器, 代理名称在服务端唯一
+	ctlManager *ControlManager
+	// 本客户端已注册的代理
+	proxies map[string]*serverProxy
+	// vhost 端口的路由, 所有控制器共享
+	routers *vhostRouters
+	// 本客户端的 tcp 和 udp 代理占用的端口数量
+	portsUsed int64
 
 	// 控制器连接 connection
 	conn net.Conn
@@ -97,11 +146,13 @@ type Control struct {
 	ctx context.Context
 	// 本链接的日志
 	xl *xlog.Logger
-	// Server configuration information
-	serverCfg *m.ServerConfig
+	// Server configuration information, it may be replaced by a reload
+	serverCfg *atomic.Pointer[m.ServerConfig]
 
 	// 工作连接 work connections
 	workConnCh chan net.Conn
+	// 加密工作连接的密钥, 登录时确定
+	sessionKey []byte
 
 	// 上次收到Ping消息
 	lastPing atomic.Value
@@ -112,22 +163,35 @@ type Control struct {
 	doneCh chan struct{}
 }
 
-func NewControl(ctx context.Context, ctlConn net.Conn, hookManager *hook.Manager, loginMsg *msg.Login, serverCfg *m.ServerConfig) (*Control, error) {
+func NewControl(
+	ctx context.Context,
+	ctlConn net.Conn,
+	authVerifier auth.Verifier,
+	hookManager *hook.Manager,
+	loginMsg *msg.Login,
+	serverCfg *atomic.Pointer[m.ServerConfig],
+) (*Control, error) {
 	poolCount := loginMsg.PoolCount
-	if poolCount > int(serverCfg.Transport.MaxPoolCount) {
-		poolCount = int(serverCfg.Transport.MaxPoolCount)
+	if maxPoolCount := int(serverCfg.Load().Transport.MaxPoolCount); poolCount > maxPoolCount {
+		poolCount = maxPoolCount
 	}
 	ctl := &Control{
-		runID:       loginMsg.RunID,
-		ctx:         ctx,
-		conn:        ctlConn,
-		hookManager: hookManager,
-		serverCfg:   serverCfg,
-		xl:          xlog.FromContextSafe(ctx),
-		doneCh:      make(chan struct{}),
+		runID:        loginMsg.RunID,
+		ctx:          ctx,
+		conn:         ctlConn,
+		authVerifier: authVerifier,
+		hookManager:  hookManager,
+		loginMsg:     loginMsg,
+		serverCfg:    serverCfg,
+		xl:           xlog.FromContextSafe(ctx),
+		workConnCh:   make(chan net.Conn, poolCount+10),
+		poolCount:    poolCount,
+		proxies:      make(map[string]*serverProxy),
+		doneCh:       make(chan struct{}),
 	}
 	ctl.lastPing.Store(time.Now())
 	ctl.msgDispatcher = msg.NewDispatcher(ctl.conn)
+	ctl.registerMsgHandlers()
 	return ctl, nil
 }
 
@@ -143,12 +207,10 @@ func (ctl *Control) registerMsgHandlers() {
 func (ctl *Control) handleNewProxy(m msg.Message) {
 	xl := ctl.xl
 	inMsg := m.(*msg.NewProxy)
+	clientProxyName := inMsg.ProxyName
+	inMsg.ProxyName = ctl.serverProxyName(inMsg.ProxyName)
 	content := &hook.NewProxyContent{
-		User: hook.UserInfo{
-			User:  ctl.loginMsg.User,
-			Metas: ctl.loginMsg.Metas,
-			RunID: ctl.loginMsg.RunID,
-		},
+		User:     ctl.userInfo(),
 		NewProxy: *inMsg,
 	}
 	var remoteAddr string
@@ -159,12 +221,12 @@ func (ctl *Control) handleNewProxy(m msg.Message) {
 	}
 	// register proxy in this control
 	resp := &msg.NewProxyResp{
-		ProxyName: inMsg.ProxyName,
+		ProxyName: clientProxyName,
 	}
 	if err != nil {
 		xl.Warnf("new proxy [%s] type [%s] error: %v", inMsg.ProxyName, inMsg.ProxyType, err)
 		resp.Error = util.GenerateResponseErrorString(fmt.Sprintf("new proxy [%s] error", inMsg.ProxyName),
-			err, lo.FromPtr(ctl.serverCfg.DetailedErrorsToClient))
+			err, lo.FromPtr(ctl.serverCfg.Load().DetailedErrorsToClient))
 	} else {
 		resp.RemoteAddr = remoteAddr
 		xl.Infof("new proxy [%s] type [%s] success", inMsg.ProxyName, inMsg.ProxyType)
@@ -173,8 +235,82 @@ func (ctl *Control) handleNewProxy(m msg.Message) {
 	_ = ctl.msgDispatcher.Send(resp)
 }
 
+// serverProxyName returns the name of a proxy on the server. The client
+// prefixes the names with the user it sent, the prefix is replaced if the
+// server changed the user, e.g. with the one of the client certificate.
+func (ctl *Control) serverProxyName(name string) string {
+	if ctl.clientUser == ctl.loginMsg.User {
+		return name
+	}
+	if ctl.clientUser != "" {
+		name = strings.TrimPrefix(name, ctl.clientUser+".")
+	}
+	return lo.Ternary(ctl.loginMsg.User == "", "", ctl.loginMsg.User+".") + name
+}
+
+// clientProxyName is the reverse of serverProxyName.
+func (ctl *Control) clientProxyName(name string) string {
+	if ctl.clientUser == ctl.loginMsg.User {
+		return name
+	}
+	if ctl.loginMsg.User != "" {
+		name = strings.TrimPrefix(name, ctl.loginMsg.User+".")
+	}
+	return lo.Ternary(ctl.clientUser == "", "", ctl.clientUser+".") + name
+}
+
 func (ctl *Control) RegisterProxy(pxyMsg *msg.NewProxy) (remoteAddr string, err error) {
-	return "", nil
+	user := ctl.loginMsg.User
+	var maxProxies int64
+	if db := ctl.users.Load(); db != nil {
+		u, ok := db.get(user)
+		if !ok {
+			return "", fmt.Errorf("user [%s] is not allowed anymore", user)
+		}
+		if err = checkUserProxy(u, pxyMsg); err != nil {
+			return "", err
+		}
+		maxProxies = u.MaxProxies
+	}
+
+	// allowPorts 和 maxPortsPerClient 可以热加载, 每次都读取当前配置
+	serverCfg := ctl.serverCfg.Load()
+	if pxyMsg.RemotePort > 0 && len(serverCfg.AllowPorts) > 0 && !portInRanges(serverCfg.AllowPorts, pxyMsg.RemotePort) {
+		return "", fmt.Errorf("port [%d] is not allowed", pxyMsg.RemotePort)
+	}
+
+	ctl.mu.Lock()
+	defer ctl.mu.Unlock()
+	if _, ok := ctl.proxies[pxyMsg.ProxyName]; ok {
+		return "", fmt.Errorf("proxy [%s] is already registered", pxyMsg.ProxyName)
+	}
+	usePort := usesPort(pxyMsg.ProxyType)
+	if usePort && serverCfg.MaxPortsPerClient > 0 && ctl.portsUsed >= serverCfg.MaxPortsPerClient {
+		return "", fmt.Errorf("client has reached the limit of %d ports", serverCfg.MaxPortsPerClient)
+	}
+	if !ctl.ctlManager.acquireProxy(pxyMsg.ProxyName, ctl) {
+		return "", fmt.Errorf("proxy [%s] is already registered by another client", pxyMsg.ProxyName)
+	}
+	if !ctl.proxyCounter.acquire(user, maxProxies) {
+		ctl.ctlManager.releaseProxy(pxyMsg.ProxyName, ctl)
+		return "", fmt.Errorf("user [%s] has reached the limit of %d proxies", user, maxProxies)
+	}
+	pxy := &serverProxy{cfg: pxyMsg, clientName: ctl.clientProxyName(pxyMsg.ProxyName)}
+	if remoteAddr, err = ctl.startProxy(pxy, serverCfg); err != nil {
+		ctl.proxyCounter.release(user, 1)
+		ctl.ctlManager.releaseProxy(pxyMsg.ProxyName, ctl)
+		return "", err
+	}
+	ctl.proxies[pxyMsg.ProxyName] = pxy
+	if usePort {
+		ctl.portsUsed++
+	}
+	return remoteAddr, nil
+}
+
+// usesPort returns whether the proxies of pxyType take a port of the server.
+func usesPort(pxyType string) bool {
+	return pxyType == string(m.ProxyTypeTCP) || pxyType == string(m.ProxyTypeUDP)
 }
 
 func (ctl *Control) handlePing(m msg.Message) {
@@ -182,11 +318,7 @@ func (ctl *Control) handlePing(m msg.Message) {
 	inMsg := m.(*msg.Ping)
 
 	content := &hook.PingContent{
-		User: hook.UserInfo{
-			User:  ctl.loginMsg.User,
-			Metas: ctl.loginMsg.Metas,
-			RunID: ctl.loginMsg.RunID,
-		},
+		User: ctl.userInfo(),
 		Ping: *inMsg,
 	}
 	retContent, err := ctl.hookManager.Ping(content)
@@ -194,10 +326,15 @@ func (ctl *Control) handlePing(m msg.Message) {
 		inMsg = &retContent.Ping
 		err = ctl.authVerifier.VerifyPing(inMsg)
 	}
+	// the run id is signed by the client, a heartbeat of another client
+	// must not keep this one alive
+	if err == nil && inMsg.RunID != "" && inMsg.RunID != ctl.loginMsg.RunID {
+		err = fmt.Errorf("run id [%s] of heartbeat doesn't match", inMsg.RunID)
+	}
 	if err != nil {
 		xl.Warnf("received invalid ping: %v", err)
 		_ = ctl.msgDispatcher.Send(&msg.Pong{
-			Error: util.GenerateResponseErrorString("invalid ping", err, lo.FromPtr(ctl.serverCfg.DetailedErrorsToClient)),
+			Error: util.GenerateResponseErrorString("invalid ping", err, lo.FromPtr(ctl.serverCfg.Load().DetailedErrorsToClient)),
 		})
 		return
 	}
@@ -234,10 +371,19 @@ func (ctl *Control) RegisterWorkConn(conn net.Conn) error {
 	defer func() {
 		if err := recover(); err != nil {
 			log.Errorf("panic error: %v", err)
-			log.Errorf(string(debug.Stack()))
+			log.Errorf("%s", debug.Stack())
 		}
 	}()
 
+	// worker 在持有写锁时关闭 workConnCh
+	ctl.mu.RLock()
+	defer ctl.mu.RUnlock()
+	select {
+	case <-ctl.msgDispatcher.Done():
+		return fmt.Errorf("control is closed")
+	default:
+	}
+
 	select {
 	case ctl.workConnCh <- conn:
 		log.Debugf("new work connection registered")
@@ -249,12 +395,13 @@ func (ctl *Control) RegisterWorkConn(conn net.Conn) error {
 }
 
 func (ctl *Control) heartbeatWorker() {
-	if ctl.serverCfg.Transport.HeartbeatTimeout <= 0 {
+	heartbeatTimeout := ctl.serverCfg.Load().Transport.HeartbeatTimeout
+	if heartbeatTimeout <= 0 {
 		return
 	}
 	xl := ctl.xl
 	go wait.Until(func() {
-		if time.Since(ctl.lastPing.Load().(time.Time)) > time.Duration(ctl.serverCfg.Transport.HeartbeatTimeout)*time.Second {
+		if time.Since(ctl.lastPing.Load().(time.Time)) > time.Duration(heartbeatTimeout)*time.Second {
 			xl.Warnf("heartbeat timeout")
 			ctl.conn.Close()
 			return
@@ -265,7 +412,11 @@ func (ctl *Control) heartbeatWorker() {
 func (ctl *Control) handleCloseProxy(m msg.Message) {
 	xl := ctl.xl
 	inMsg := m.(*msg.CloseProxy)
-	_ = ctl.CloseProxy(inMsg)
+	inMsg.ProxyName = ctl.serverProxyName(inMsg.ProxyName)
+	if err := ctl.CloseProxy(inMsg); err != nil {
+		xl.Warnf("close proxy [%s] error: %v", inMsg.ProxyName, err)
+		return
+	}
 	xl.Infof("close proxy [%s] success", inMsg.ProxyName)
 }
 
@@ -279,10 +430,103 @@ func (ctl *Control) WaitClosed() {
 }
 
 func (ctl *Control) worker() {
+	xl := ctl.xl
+
+	go ctl.heartbeatWorker()
+	go ctl.msgDispatcher.Run()
 
+	<-ctl.msgDispatcher.Done()
+	ctl.conn.Close()
+
+	// 关闭尚未使用的工作连接
+	ctl.mu.Lock()
+	close(ctl.workConnCh)
+	for workConn := range ctl.workConnCh {
+		workConn.Close()
+	}
+	// 释放本客户端的代理计数
+	ctl.proxyCounter.release(ctl.loginMsg.User, int64(len(ctl.proxies)))
+	for name, pxy := range ctl.proxies {
+		pxy.stop()
+		ctl.ctlManager.releaseProxy(name, ctl)
+		ctl.notifyCloseProxy(name, pxy.cfg.ProxyType)
+	}
+	clear(ctl.proxies)
+	ctl.portsUsed = 0
+	ctl.mu.Unlock()
+
+	xl.Infof("client exit success")
+	close(ctl.doneCh)
 }
 
 func (ctl *Control) CloseProxy(closeMsg *msg.CloseProxy) (err error) {
 	ctl.mu.Lock()
+	defer ctl.mu.Unlock()
+	pxy, ok := ctl.proxies[closeMsg.ProxyName]
+	if !ok {
+		return fmt.Errorf("proxy [%s] isn't registered", closeMsg.ProxyName)
+	}
+	delete(ctl.proxies, closeMsg.ProxyName)
+	pxy.stop()
+	ctl.ctlManager.releaseProxy(closeMsg.ProxyName, ctl)
+	if usesPort(pxy.cfg.ProxyType) {
+		ctl.portsUsed--
+	}
+	ctl.proxyCounter.release(ctl.loginMsg.User, 1)
+	ctl.notifyCloseProxy(closeMsg.ProxyName, pxy.cfg.ProxyType)
 	return err
 }
+
+// notifyCloseProxy tells the plugins that the proxy is closed, the plugins
+// are called in the background so that ctl.mu isn't held meanwhile.
+func (ctl *Control) notifyCloseProxy(name, pxyType string) {
+	content := &hook.CloseProxyContent{
+		User:       ctl.userInfo(),
+		CloseProxy: msg.CloseProxy{ProxyName: name},
+	}
+	go func() {
+		if err := ctl.hookManager.CloseProxy(content); err != nil {
+			ctl.xl.Warnf("close proxy [%s] type [%s] plugin error: %v", name, pxyType, err)
+		}
+	}()
+}
+
+// proxy returns the proxy name if it's registered by ctl.
+func (ctl *Control) proxy(name string) (*serverProxy, bool) {
+	ctl.mu.RLock()
+	defer ctl.mu.RUnlock()
+	pxy, ok := ctl.proxies[name]
+	return pxy, ok
+}
+
+// handleUserConn asks the plugins whether conn, a connection of a user to
+// the proxy name of ctl, is allowed. Every inbound user connection of every
+// proxy type must be checked before it's handed to the proxy. visitorUser is
+// the user of the visitor if conn comes from one, it's empty otherwise or if
+// the visitor didn't log in.
+func (ctl *Control) handleUserConn(name string, conn net.Conn, visitorUser string) error {
+	pxy, ok := ctl.proxy(name)
+	if !ok {
+		return fmt.Errorf("proxy [%s] isn't registered", name)
+	}
+	content := &hook.NewUserConnContent{
+		User:        ctl.userInfo(),
+		ProxyName:   name,
+		ProxyType:   pxy.cfg.ProxyType,
+		RemoteAddr:  conn.RemoteAddr().String(),
+		VisitorUser: visitorUser,
+	}
+	if _, err := ctl.hookManager.NewUserConn(content); err != nil {
+		return fmt.Errorf("user connection from [%s] to proxy [%s] is rejected: %v", content.RemoteAddr, name, err)
+	}
+	return nil
+}
+
+func (ctl *Control) userInfo() hook.UserInfo {
+	return hook.UserInfo{
+		User:          ctl.loginMsg.User,
+		Metas:         ctl.loginMsg.Metas,
+		RunID:         ctl.loginMsg.RunID,
+		ClientAddress: ctl.conn.RemoteAddr().String(),
+	}
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+	"github.com/gk7790/gk-zap/pkg/msg"
+)
+
+func TestControlManagerProxyOwners(t *testing.T) {
+	var users atomic.Pointer[userDB]
+	counter := newProxyCounter()
+	ctlManager := NewControlManager()
+	serverCfg := &m.ServerConfig{}
+
+	alice, aliceClient := newTestControl(t, "alice", &users, counter, ctlManager, serverCfg)
+	bob, _ := newTestControl(t, "bob", &users, counter, ctlManager, serverCfg)
+
+	if _, err := alice.RegisterProxy(&msg.NewProxy{ProxyName: "ssh", ProxyType: "stcp"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// the names are unique on the server, not only per client
+	if _, err := bob.RegisterProxy(&msg.NewProxy{ProxyName: "ssh", ProxyType: "stcp"}); err == nil ||
+		!strings.Contains(err.Error(), "registered by another client") {
+		t.Fatalf("expected the name to be taken, got %v", err)
+	}
+	if counter.counts["bob"] != 0 {
+		t.Fatalf("expected the rejected proxy not to be counted, got %d", counter.counts["bob"])
+	}
+	if owner, ok := ctlManager.GetByProxy("ssh"); !ok || owner != alice {
+		t.Fatalf("expected alice to own the proxy, got %v", owner)
+	}
+
+	// the name is free again once its owner exits
+	go alice.worker()
+	aliceClient.Close()
+	select {
+	case <-alice.doneCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("control didn't exit")
+	}
+	if _, ok := ctlManager.GetByProxy("ssh"); ok {
+		t.Fatal("expected the proxy of the exited client to be released")
+	}
+	if _, err := bob.RegisterProxy(&msg.NewProxy{ProxyName: "ssh", ProxyType: "stcp"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if owner, ok := ctlManager.GetByProxy("ssh"); !ok || owner != bob {
+		t.Fatalf("expected bob to own the proxy, got %v", owner)
+	}
+	if err := bob.CloseProxy(&msg.CloseProxy{ProxyName: "ssh"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := ctlManager.GetByProxy("ssh"); ok {
+		t.Fatal("expected the closed proxy to be released")
+	}
+}
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/gk7790/gk-zap/pkg/config"
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+	"github.com/gk7790/gk-zap/pkg/config/validation"
+	hook "github.com/gk7790/gk-zap/pkg/hook/server"
+	"github.com/gk7790/gk-zap/pkg/utils/log"
+)
+
+// newPlugins creates the plugins configured by httpPlugins and execPlugins,
+// they are registered in the hook manager at startup and on every reload.
+func newPlugins(cfg *m.ServerConfig) []hook.Plugin {
+	plugins := make([]hook.Plugin, 0, len(cfg.HTTPPlugins)+len(cfg.ExecPlugins))
+	for _, o := range cfg.HTTPPlugins {
+		log.Infof("plugin [%s] has been registered", o.Name)
+		plugins = append(plugins, hook.NewGuardedPlugin(hook.NewHTTPPlugin(o), o.PluginCallOptions))
+	}
+	for _, o := range cfg.ExecPlugins {
+		log.Infof("exec plugin [%s] has been registered", o.Name)
+		plugins = append(plugins, hook.NewGuardedPlugin(hook.NewExecPlugin(o), o.PluginCallOptions))
+	}
+	return plugins
+}
+
+// loadPolicyFile loads and validates the policy file at path.
+func loadPolicyFile(path string, strict bool) (*m.PolicyConfig, error) {
+	c, err := config.LoadPolicyConfig(path, strict)
+	if err != nil {
+		return nil, fmt.Errorf("load policy file error: %v", err)
+	}
+	if err := validation.ValidatePolicyConfig(c); err != nil {
+		return nil, fmt.Errorf("invalid policy file %s: %v", path, err)
+	}
+	return c, nil
+}
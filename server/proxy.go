@@ -0,0 +1,203 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+	"github.com/gk7790/gk-zap/pkg/config/types"
+	"github.com/gk7790/gk-zap/pkg/msg"
+	pkgNet "github.com/gk7790/gk-zap/pkg/net"
+)
+
+// serverProxy is a proxy registered by the client of a control.
+type serverProxy struct {
+	cfg *msg.NewProxy
+	// clientName is the name the client knows the proxy by
+	clientName string
+	// close stops accepting the user connections of the proxy, it's nil if
+	// gks doesn't accept them itself
+	close func()
+}
+
+func (pxy *serverProxy) stop() {
+	if pxy.close != nil {
+		pxy.close()
+	}
+}
+
+// startProxy accepts the user connections of pxy: tcp proxies listen on
+// their remote port, http, https and tcpmux proxies are routed from the vhost
+// ports by domain. The users of stcp, sudp and xtcp proxies come through
+// visitors and udp has no connections, nothing is started for them.
+func (ctl *Control) startProxy(pxy *serverProxy, serverCfg *m.ServerConfig) (remoteAddr string, err error) {
+	pxyMsg := pxy.cfg
+	switch m.ProxyType(pxyMsg.ProxyType) {
+	case m.ProxyTypeTCP:
+		var l net.Listener
+		l, err = listenRemotePort(serverCfg.ProxyBindAddr, pxyMsg.RemotePort, serverCfg.AllowPorts)
+		if err != nil {
+			return "", err
+		}
+		pxy.close = func() { l.Close() }
+		go ctl.serveProxy(pxyMsg.ProxyName, l)
+		return ":" + strconv.Itoa(l.Addr().(*net.TCPAddr).Port), nil
+	case m.ProxyTypeHTTP, m.ProxyTypeHTTPS, m.ProxyTypeTCPMUX:
+		router, portField := ctl.routers.router(pxyMsg.ProxyType)
+		if router == nil {
+			return "", fmt.Errorf("%s proxies are not supported, %s of the server is not set", pxyMsg.ProxyType, portField)
+		}
+		domains := proxyDomains(pxyMsg, serverCfg.SubDomainHost)
+		if err = router.add(pxyMsg.ProxyName, domains); err != nil {
+			return "", err
+		}
+		pxy.close = func() { router.del(pxyMsg.ProxyName, domains) }
+		return strings.Join(domains, ","), nil
+	}
+	return "", nil
+}
+
+// proxyDomains returns the domains of a http, https or tcpmux proxy.
+func proxyDomains(pxyMsg *msg.NewProxy, subDomainHost string) []string {
+	domains := make([]string, 0, len(pxyMsg.CustomDomains)+1)
+	for _, domain := range pxyMsg.CustomDomains {
+		domains = append(domains, strings.ToLower(domain))
+	}
+	if pxyMsg.SubDomain != "" && subDomainHost != "" {
+		domains = append(domains, strings.ToLower(pxyMsg.SubDomain+"."+subDomainHost))
+	}
+	return domains
+}
+
+// listenRemotePort listens on port of bindAddr, if port is 0 a port of
+// allowPorts is chosen, any port if allowPorts is empty.
+func listenRemotePort(bindAddr string, port int, allowPorts []types.PortsRange) (net.Listener, error) {
+	if port > 0 || len(allowPorts) == 0 {
+		return net.Listen("tcp", net.JoinHostPort(bindAddr, strconv.Itoa(port)))
+	}
+	for _, r := range allowPorts {
+		start, end := r.Start, r.End
+		if r.Single > 0 {
+			start, end = r.Single, r.Single
+		}
+		for p := start; p <= end; p++ {
+			if l, err := net.Listen("tcp", net.JoinHostPort(bindAddr, strconv.Itoa(p))); err == nil {
+				return l, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no allowed port is available")
+}
+
+// serveProxy accepts the user connections of the proxy name from l until l
+// is closed.
+func (ctl *Control) serveProxy(name string, l net.Listener) {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			ctl.xl.Debugf("listener of proxy [%s] closed: %v", name, err)
+			return
+		}
+		go ctl.handleProxyConn(name, c)
+	}
+}
+
+// GetWorkConn returns a work connection from the pool, it asks the client
+// for one if the pool is empty and waits up to userConnTimeout.
+func (ctl *Control) GetWorkConn() (net.Conn, error) {
+	var (
+		workConn net.Conn
+		ok       bool
+	)
+	select {
+	case workConn, ok = <-ctl.workConnCh:
+		if !ok {
+			return nil, fmt.Errorf("control is closed")
+		}
+	default:
+		if err := ctl.msgDispatcher.Send(&msg.ReqWorkConn{}); err != nil {
+			return nil, fmt.Errorf("control is closed")
+		}
+		select {
+		case workConn, ok = <-ctl.workConnCh:
+			if !ok {
+				return nil, fmt.Errorf("control is closed")
+			}
+		case <-time.After(time.Duration(ctl.serverCfg.Load().UserConnTimeout) * time.Second):
+			return nil, fmt.Errorf("timeout trying to get work connection")
+		}
+	}
+	// refill the pool for the next user connection
+	_ = ctl.msgDispatcher.Send(&msg.ReqWorkConn{})
+	return workConn, nil
+}
+
+// handleProxyConn hands userConn, a connection of a user of the proxy name,
+// to the client through a work connection once the plugins allowed it.
+func (ctl *Control) handleProxyConn(name string, userConn net.Conn) {
+	xl := ctl.xl
+	defer userConn.Close()
+
+	if err := ctl.handleUserConn(name, userConn, ""); err != nil {
+		xl.Warnf("%v", err)
+		return
+	}
+	pxy, ok := ctl.proxy(name)
+	if !ok {
+		return
+	}
+
+	startMsg := &msg.StartWorkConn{ProxyName: pxy.clientName}
+	startMsg.SrcAddr, startMsg.SrcPort = splitAddr(userConn.RemoteAddr())
+	startMsg.DstAddr, startMsg.DstPort = splitAddr(userConn.LocalAddr())
+	var workConn net.Conn
+	// the pooled work connections may have been closed by the client
+	for range 3 {
+		conn, err := ctl.GetWorkConn()
+		if err != nil {
+			xl.Warnf("get work connection for proxy [%s] error: %v", name, err)
+			return
+		}
+		if err := msg.WriteMsg(conn, startMsg); err != nil {
+			xl.Debugf("send StartWorkConn to work connection error: %v, try again", err)
+			conn.Close()
+			continue
+		}
+		workConn = conn
+		break
+	}
+	if workConn == nil {
+		xl.Warnf("no usable work connection for proxy [%s]", name)
+		return
+	}
+
+	var (
+		remote io.ReadWriteCloser = workConn
+		err    error
+	)
+	if pxy.cfg.UseEncryption {
+		remote, err = pkgNet.WithEncryption(remote, ctl.sessionKey)
+		if err != nil {
+			workConn.Close()
+			xl.Errorf("create encryption stream error: %v", err)
+			return
+		}
+	}
+	if pxy.cfg.UseCompression {
+		remote = pkgNet.WithCompression(remote)
+	}
+	xl.Debugf("join connections of proxy [%s], user [%s]", name, userConn.RemoteAddr())
+	inCount, outCount, _ := pkgNet.Join(remote, userConn)
+	xl.Debugf("join connections of proxy [%s] closed, in %d bytes, out %d bytes", name, inCount, outCount)
+}
+
+func splitAddr(addr net.Addr) (string, uint16) {
+	if tcpAddr, ok := addr.(*net.TCPAddr); ok {
+		return tcpAddr.IP.String(), uint16(tcpAddr.Port)
+	}
+	return "", 0
+}
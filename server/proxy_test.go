@@ -0,0 +1,241 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gk7790/gk-zap/pkg/auth"
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+	hook "github.com/gk7790/gk-zap/pkg/hook/server"
+	"github.com/gk7790/gk-zap/pkg/msg"
+	pkgNet "github.com/gk7790/gk-zap/pkg/net"
+)
+
+func TestVhostRouter(t *testing.T) {
+	r := newVhostRouter()
+	if err := r.add("alice.web", []string{"example.com", "*.example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.add("alice.api", []string{"api.example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.add("bob.web", []string{"other.com", "example.com"}); err == nil ||
+		!strings.Contains(err.Error(), "already used") {
+		t.Fatalf("expected error containing %q, got %v", "already used", err)
+	}
+	if _, ok := r.get("other.com"); ok {
+		t.Fatal("expected no domain of a rejected proxy to be added")
+	}
+
+	tests := []struct {
+		host   string
+		want   string
+		wantOK bool
+	}{
+		{host: "example.com", want: "alice.web", wantOK: true},
+		{host: "Example.COM:8080", want: "alice.web", wantOK: true},
+		{host: "www.example.com", want: "alice.web", wantOK: true},
+		{host: "a.b.example.com", want: "alice.web", wantOK: true},
+		{host: "api.example.com", want: "alice.api", wantOK: true},
+		{host: "example.org"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			got, ok := r.get(tt.host)
+			if got != tt.want || ok != tt.wantOK {
+				t.Fatalf("expected %q %v, got %q %v", tt.want, tt.wantOK, got, ok)
+			}
+		})
+	}
+
+	r.del("alice.web", []string{"example.com", "*.example.com"})
+	if _, ok := r.get("www.example.com"); ok {
+		t.Fatal("expected the routes of the closed proxy to be removed")
+	}
+}
+
+func TestReadTLSServerName(t *testing.T) {
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	go func() {
+		defer clientConn.Close()
+		_ = tls.Client(clientConn, &tls.Config{ServerName: "secure.example.com", InsecureSkipVerify: true}).Handshake()
+	}()
+
+	host, read, err := readTLSServerName(serverConn)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if host != "secure.example.com" {
+		t.Fatalf("expected the server name secure.example.com, got %q", host)
+	}
+	// the ClientHello is replayed to the client of the proxy
+	if len(read) == 0 || read[0] != 0x16 {
+		t.Fatalf("expected the read bytes to start with a handshake record, got %v", read)
+	}
+}
+
+// serveWorkConns plays the client of a control: it answers the ReqWorkConn
+// messages with work connections which echo the data of the users.
+func serveWorkConns(t *testing.T, svr *Service, client *testClient, runID string) {
+	for rawMsg := range client.msgCh {
+		if _, ok := rawMsg.(*msg.ReqWorkConn); !ok {
+			continue
+		}
+		newWorkConn := &msg.NewWorkConn{RunID: runID}
+		if err := auth.NewTokenAuth(testAuthScopes, "secret").SetNewWorkConn(newWorkConn); err != nil {
+			t.Error(err)
+			return
+		}
+		serverConn, clientConn := net.Pipe()
+		go func() {
+			defer clientConn.Close()
+			var start msg.StartWorkConn
+			if err := msg.ReadMsgInto(clientConn, &start); err != nil {
+				return
+			}
+			var rwc io.ReadWriteCloser = clientConn
+			if start.ProxyName == "alice.secure" {
+				var err error
+				if rwc, err = pkgNet.WithEncryption(rwc, []byte("secret")); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+			// the proxy name is echoed first so that the test sees the route
+			_, _ = io.WriteString(rwc, start.ProxyName+"\n")
+			_, _ = io.Copy(rwc, rwc)
+		}()
+		_ = svr.RegisterWorkConn(serverConn, newWorkConn)
+	}
+}
+
+func TestProxyUserConns(t *testing.T) {
+	svr := newTestService(t)
+	svr.routers = &vhostRouters{http: newVhostRouter(), tcpmux: newVhostRouter()}
+	policy, err := hook.NewPolicy(&m.PolicyConfig{Rules: []m.PolicyRule{{
+		Ops:    []string{hook.OpNewUserConn},
+		Match:  m.PolicyMatch{ProxyNames: []string{"alice.denied"}},
+		Action: m.PolicyActionDeny,
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	svr.hookManager.SetPolicy(policy)
+
+	client, serverConn := newTestClient(t)
+	if err := svr.RegisterControl(serverConn, signedLogin(t, "secret", "run"), "alice", false); err != nil {
+		t.Fatal(err)
+	}
+	go serveWorkConns(t, svr, client, "run")
+	ctl, _ := svr.ctlManager.GetByID("run")
+
+	vhost := func(router *vhostRouter, route func(net.Conn, *vhostRouter) (string, net.Conn, error)) string {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { l.Close() })
+		go svr.serveVhost(l, router, route)
+		return l.Addr().String()
+	}
+	httpAddr := vhost(svr.routers.http, routeHTTP)
+	tcpmuxAddr := vhost(svr.routers.tcpmux, routeTCPMux(false))
+
+	tests := []struct {
+		name  string
+		proxy *msg.NewProxy
+		// dial opens a user connection, by default to the remote port
+		dial func(remoteAddr string) (net.Conn, error)
+		// send is sent by the user and echoed after the proxy name
+		send     string
+		rejected bool
+	}{
+		{
+			name:  "tcp",
+			proxy: &msg.NewProxy{ProxyName: "alice.ssh", ProxyType: "tcp"},
+			send:  "ping\n",
+		},
+		{
+			name:  "tcp with encryption",
+			proxy: &msg.NewProxy{ProxyName: "alice.secure", ProxyType: "tcp", UseEncryption: true},
+			send:  "ping\n",
+		},
+		{
+			name:     "rejected by the policy",
+			proxy:    &msg.NewProxy{ProxyName: "alice.denied", ProxyType: "tcp"},
+			send:     "ping\n",
+			rejected: true,
+		},
+		{
+			name:  "http",
+			proxy: &msg.NewProxy{ProxyName: "alice.web", ProxyType: "http", CustomDomains: []string{"web.example.com"}},
+			dial: func(string) (net.Conn, error) {
+				return net.Dial("tcp", httpAddr)
+			},
+			send: "GET / HTTP/1.1\r\nHost: web.example.com\r\n\r\n",
+		},
+		{
+			name:  "tcpmux",
+			proxy: &msg.NewProxy{ProxyName: "alice.mux", ProxyType: "tcpmux", CustomDomains: []string{"mux.example.com"}},
+			dial: func(string) (net.Conn, error) {
+				c, err := net.Dial("tcp", tcpmuxAddr)
+				if err != nil {
+					return nil, err
+				}
+				_, _ = io.WriteString(c, "CONNECT mux.example.com:22 HTTP/1.1\r\nHost: mux.example.com:22\r\n\r\n")
+				// the response is read exactly, the tunnel follows it
+				resp := make([]byte, len("HTTP/1.1 200 OK\r\n\r\n"))
+				if _, err := io.ReadFull(c, resp); err != nil || string(resp) != "HTTP/1.1 200 OK\r\n\r\n" {
+					c.Close()
+					return nil, fmt.Errorf("CONNECT failed: %q %v", resp, err)
+				}
+				return c, nil
+			},
+			send: "ping\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			remoteAddr, err := ctl.RegisterProxy(tt.proxy)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer func() { _ = ctl.CloseProxy(&msg.CloseProxy{ProxyName: tt.proxy.ProxyName}) }()
+
+			dial := tt.dial
+			if dial == nil {
+				dial = func(remoteAddr string) (net.Conn, error) {
+					return net.Dial("tcp", "127.0.0.1"+remoteAddr)
+				}
+			}
+			userConn, err := dial(remoteAddr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer userConn.Close()
+			_ = userConn.SetDeadline(time.Now().Add(5 * time.Second))
+
+			if _, err := io.WriteString(userConn, tt.send); err != nil {
+				t.Fatalf("write error: %v", err)
+			}
+			if tt.rejected {
+				if _, err := userConn.Read(make([]byte, 1)); err != io.EOF {
+					t.Fatalf("expected the user connection to be closed, got %v", err)
+				}
+				return
+			}
+			// the bytes the vhost router read reach the client too
+			want := tt.proxy.ProxyName + "\n" + tt.send
+			got := make([]byte, len(want))
+			if _, err := io.ReadFull(userConn, got); err != nil || string(got) != want {
+				t.Fatalf("expected %q, got %q %v", want, got, err)
+			}
+		})
+	}
+}
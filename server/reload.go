@@ -0,0 +1,196 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/gk7790/gk-zap/pkg/auth"
+	"github.com/gk7790/gk-zap/pkg/config"
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+	"github.com/gk7790/gk-zap/pkg/config/validation"
+	hook "github.com/gk7790/gk-zap/pkg/hook/server"
+	"github.com/gk7790/gk-zap/pkg/utils/log"
+)
+
+// ReloadResult describes the outcome of a config reload.
+type ReloadResult struct {
+	// Applied lists the key paths of the changes that took effect.
+	Applied []string `json:"applied"`
+	// RestartRequired lists the key paths of the changes that are ignored
+	// until gks is restarted, like bindPort.
+	RestartRequired []string `json:"restartRequired"`
+	// Warning is the validation warning of the new config, if any.
+	Warning string `json:"warning,omitempty"`
+}
+
+// ReloadFromFile reads the config file gks was started with again,
+// validates it and applies it with Reload.
+func (svr *Service) ReloadFromFile(strict bool) (*ReloadResult, error) {
+	if svr.configFilePath == "" {
+		return nil, errors.New("gks has no config file path")
+	}
+
+	newCfg, err := config.LoadServerConfig(svr.configFilePath, strict)
+	if err != nil {
+		return nil, err
+	}
+	warning, err := validation.ValidateServerConfig(newCfg)
+	if err != nil {
+		return nil, err
+	}
+	var users *m.UsersConfig
+	if newCfg.UsersFile != "" {
+		if users, err = loadUsersFile(newCfg.UsersFile, strict); err != nil {
+			return nil, err
+		}
+	}
+
+	var policy *m.PolicyConfig
+	if newCfg.PolicyFile != "" {
+		if policy, err = loadPolicyFile(newCfg.PolicyFile, strict); err != nil {
+			return nil, err
+		}
+	}
+
+	res, err := svr.Reload(newCfg, users, policy)
+	if err != nil {
+		return nil, err
+	}
+	if warning != nil {
+		res.Warning = warning.Error()
+	}
+	return res, nil
+}
+
+// Reload applies the changes of newCfg that are safe to make while running:
+// auth.token, auth.tokenSource, allowPorts, httpPlugins, execPlugins, log.level,
+// detailedErrorsToClient, maxPortsPerClient, usersFile and policyFile. Other
+// changes need a restart and are only reported. newCfg must be completed and
+// validated, users and policy are the validated contents of
+// newCfg.UsersFile and newCfg.PolicyFile, or nil if they aren't set. Nothing
+// is applied if an error is returned.
+func (svr *Service) Reload(newCfg *m.ServerConfig, users *m.UsersConfig, policy *m.PolicyConfig) (*ReloadResult, error) {
+	svr.reloadMu.Lock()
+	defer svr.reloadMu.Unlock()
+
+	oldCfg := svr.cfg.Load()
+
+	// the policy is compiled first, it's the only part which can fail
+	var compiledPolicy *hook.Policy
+	if policy != nil {
+		var err error
+		if compiledPolicy, err = hook.NewPolicy(policy); err != nil {
+			return nil, fmt.Errorf("invalid policy file %s: %v", newCfg.PolicyFile, err)
+		}
+	}
+
+	// start from the running config so that changes requiring a restart
+	// don't take effect half way
+	applied := *oldCfg
+	applied.Auth.Token = newCfg.Auth.Token
+	applied.Auth.TokenSource = newCfg.Auth.TokenSource
+	applied.AllowPorts = newCfg.AllowPorts
+	applied.HTTPPlugins = newCfg.HTTPPlugins
+	applied.ExecPlugins = newCfg.ExecPlugins
+	applied.Log.Level = newCfg.Log.Level
+	applied.DetailedErrorsToClient = newCfg.DetailedErrorsToClient
+	applied.MaxPortsPerClient = newCfg.MaxPortsPerClient
+	applied.UsersFile = newCfg.UsersFile
+	applied.PolicyFile = newCfg.PolicyFile
+
+	res := &ReloadResult{
+		Applied:         diffConfig(oldCfg, &applied),
+		RestartRequired: diffConfig(&applied, newCfg),
+	}
+
+	// 用户文件的路径不变时, 内容的变化也算作 usersFile 的变化
+	var oldUsers *m.UsersConfig
+	if db := svr.users.Load(); db != nil {
+		oldUsers = db.cfg
+	}
+	if !reflect.DeepEqual(users, oldUsers) && !slices.Contains(res.Applied, "usersFile") {
+		res.Applied = append(res.Applied, "usersFile")
+		slices.Sort(res.Applied)
+	}
+	if users != nil {
+		svr.users.Store(newUserDB(users))
+	} else {
+		svr.users.Store(nil)
+	}
+
+	if !reflect.DeepEqual(policy, svr.policyCfg) && !slices.Contains(res.Applied, "policyFile") {
+		res.Applied = append(res.Applied, "policyFile")
+		slices.Sort(res.Applied)
+	}
+	svr.hookManager.SetPolicy(compiledPolicy)
+	svr.policyCfg = policy
+
+	if v, ok := svr.authVerifier.(*auth.TokenAuthSetterVerifier); ok {
+		v.UpdateToken(applied.Auth.Token, applied.Auth.TokenSource, newCfg.Auth.TokenResolvedAt())
+	}
+	if !reflect.DeepEqual(applied.HTTPPlugins, oldCfg.HTTPPlugins) ||
+		!reflect.DeepEqual(applied.ExecPlugins, oldCfg.ExecPlugins) {
+		svr.hookManager.Replace(newPlugins(&applied))
+	}
+	if applied.Log.Level != oldCfg.Log.Level {
+		log.SetLevel(log.ParseLevel(applied.Log.Level))
+	}
+	svr.cfg.Store(&applied)
+
+	log.Infof("config reloaded, applied changes: %v", res.Applied)
+	if len(res.RestartRequired) > 0 {
+		log.Warnf("changes of %v require a restart to take effect", res.RestartRequired)
+	}
+	return res, nil
+}
+
+// diffConfig returns the json key paths of the leaf fields that differ
+// between a and b.
+func diffConfig(a, b *m.ServerConfig) []string {
+	diffs := make([]string, 0)
+	diffValue(reflect.ValueOf(a).Elem(), reflect.ValueOf(b).Elem(), "", &diffs)
+	slices.Sort(diffs)
+	return diffs
+}
+
+func diffValue(a, b reflect.Value, path string, diffs *[]string) {
+	if a.Kind() == reflect.Pointer {
+		if a.IsNil() || b.IsNil() {
+			if a.IsNil() != b.IsNil() {
+				*diffs = append(*diffs, path)
+			}
+			return
+		}
+		a, b = a.Elem(), b.Elem()
+	}
+	if a.Kind() != reflect.Struct {
+		if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+			*diffs = append(*diffs, path)
+		}
+		return
+	}
+
+	t := a.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		p := path
+		if !f.Anonymous || name != "" {
+			if name == "" {
+				name = f.Name
+			}
+			if path != "" {
+				p = path + "." + name
+			} else {
+				p = name
+			}
+		}
+		diffValue(a.Field(i), b.Field(i), p, diffs)
+	}
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gk7790/gk-zap/pkg/auth"
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+	"github.com/gk7790/gk-zap/pkg/msg"
+)
+
+func TestReload(t *testing.T) {
+	users := &m.UsersConfig{Users: []m.UserConfig{{Name: "alice", Token: "alice-secret"}}}
+	policy := &m.PolicyConfig{DefaultAction: m.PolicyActionDeny}
+
+	tests := []struct {
+		name                string
+		modify              func(c *m.ServerConfig)
+		users               *m.UsersConfig
+		policy              *m.PolicyConfig
+		wantApplied         []string
+		wantRestartRequired []string
+	}{
+		{name: "unchanged", modify: func(*m.ServerConfig) {}},
+		{
+			name:                "bind port",
+			modify:              func(c *m.ServerConfig) { c.BindPort = 7001 },
+			wantRestartRequired: []string{"bindPort"},
+		},
+		{
+			name:        "token",
+			modify:      func(c *m.ServerConfig) { c.Auth.Token = "new-secret" },
+			wantApplied: []string{"auth.token"},
+		},
+		{
+			name:        "users file",
+			modify:      func(c *m.ServerConfig) { c.UsersFile = "users.yaml" },
+			users:       users,
+			wantApplied: []string{"usersFile"},
+		},
+		{
+			name:        "policy file",
+			modify:      func(c *m.ServerConfig) { c.PolicyFile = "policy.yaml" },
+			policy:      policy,
+			wantApplied: []string{"policyFile"},
+		},
+		{
+			// the safe changes are applied, the others wait for a restart
+			name: "mixed",
+			modify: func(c *m.ServerConfig) {
+				c.MaxPortsPerClient = 10
+				c.Log.Level = "warn"
+				c.BindPort = 7001
+				c.Transport.MaxPoolCount = 10
+			},
+			wantApplied:         []string{"log.level", "maxPortsPerClient"},
+			wantRestartRequired: []string{"bindPort", "transport.maxPoolCount"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svr := newTestService(t)
+			oldCfg := svr.cfg.Load()
+			newCfg := *oldCfg
+			tt.modify(&newCfg)
+
+			res, err := svr.Reload(&newCfg, tt.users, tt.policy)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !slices.Equal(res.Applied, tt.wantApplied) {
+				t.Errorf("expected applied %v, got %v", tt.wantApplied, res.Applied)
+			}
+			if !slices.Equal(res.RestartRequired, tt.wantRestartRequired) {
+				t.Errorf("expected restart required %v, got %v", tt.wantRestartRequired, res.RestartRequired)
+			}
+
+			// the running config has the applied changes only
+			cfg := svr.cfg.Load()
+			if got := diffConfig(cfg, &newCfg); !slices.Equal(got, res.RestartRequired) {
+				t.Errorf("expected the running config to differ in %v, got %v", res.RestartRequired, got)
+			}
+			if (svr.users.Load() != nil) != (tt.users != nil) {
+				t.Errorf("expected users to be loaded: %v", tt.users != nil)
+			}
+			if svr.policyCfg != tt.policy {
+				t.Errorf("expected policy %v, got %v", tt.policy, svr.policyCfg)
+			}
+		})
+	}
+}
+
+func TestReloadToken(t *testing.T) {
+	svr := newTestService(t)
+	newCfg := *svr.cfg.Load()
+	newCfg.Auth.Token = "new-secret"
+	if _, err := svr.Reload(&newCfg, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// the running verifier checks the new token
+	for token, wantOK := range map[string]bool{"secret": false, "new-secret": true} {
+		ping := &msg.Ping{}
+		if err := auth.NewTokenAuth(testAuthScopes, token).SetPing(ping); err != nil {
+			t.Fatal(err)
+		}
+		if err := svr.authVerifier.VerifyPing(ping); (err == nil) != wantOK {
+			t.Errorf("token %q: expected ok %v, got %v", token, wantOK, err)
+		}
+	}
+}
+
+func TestReloadInvalidPolicy(t *testing.T) {
+	svr := newTestService(t)
+	oldCfg := svr.cfg.Load()
+	newCfg := *oldCfg
+	newCfg.BindPort = 7001
+	newCfg.PolicyFile = "policy.yaml"
+	policy := &m.PolicyConfig{Rules: []m.PolicyRule{{
+		Action: m.PolicyActionDeny,
+		Match:  m.PolicyMatch{SourceCIDRs: []string{"10.0.0.0/33"}},
+	}}}
+
+	_, err := svr.Reload(&newCfg, nil, policy)
+	if err == nil || !strings.Contains(err.Error(), "invalid policy file policy.yaml") {
+		t.Fatalf("expected error containing %q, got %v", "invalid policy file policy.yaml", err)
+	}
+	// nothing is applied
+	if svr.cfg.Load() != oldCfg || svr.policyCfg != nil {
+		t.Fatal("expected the running config to be kept")
+	}
+}
@@ -2,11 +2,15 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"net"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gk7790/gk-zap/pkg/auth"
@@ -14,11 +18,16 @@ import (
 	hook "github.com/gk7790/gk-zap/pkg/hook/server"
 	"github.com/gk7790/gk-zap/pkg/msg"
 	pkgNet "github.com/gk7790/gk-zap/pkg/net"
+	"github.com/gk7790/gk-zap/pkg/transport"
 	"github.com/gk7790/gk-zap/pkg/utils/log"
 	"github.com/gk7790/gk-zap/pkg/utils/util"
 	"github.com/gk7790/gk-zap/pkg/utils/version"
+	"github.com/gk7790/gk-zap/pkg/utils/web"
 	"github.com/gk7790/gk-zap/pkg/utils/xlog"
 	"github.com/gk7790/gk-zap/server/controller"
+	"github.com/gk7790/gk-zap/server/visitor"
+	fmux "github.com/hashicorp/yamux"
+	"github.com/samber/lo"
 	cmux "github.com/soheilhy/cmux"
 )
 
@@ -34,8 +43,18 @@ type Service struct {
 	// TCP 主监听器  主端口
 	listener net.Listener
 
-	// 服务端配置
-	cfg *m.ServerConfig
+	// 服务端配置，热加载时整体替换
+	cfg atomic.Pointer[m.ServerConfig]
+
+	// 配置文件路径，为空表示配置来自环境变量和命令行参数，此时不支持热加载
+	configFilePath string
+	// 配置文件是否以严格模式加载，/api/reload 未指定 strictConfig 时沿用
+	strictConfig bool
+	// 串行化配置热加载
+	reloadMu sync.Mutex
+
+	// 管理 API, 未配置 WebServer.Port 时为 nil
+	webServer *web.Server
 
 	hookManager *hook.Manager
 
@@ -45,37 +64,124 @@ type Service struct {
 	// 身份认证
 	authVerifier auth.Verifier
 
+	// 用户文件, 未配置 UsersFile 时为 nil
+	users atomic.Pointer[userDB]
+	// 每个用户的代理数量
+	proxyCounter *proxyCounter
+	// 当前的策略文件内容, 未配置 PolicyFile 时为 nil
+	policyCfg *m.PolicyConfig
+
 	// 管理全部 控制连接
 	ctlManager *ControlManager
 
+	// vhost 端口按域名把用户连接路由到 http, https 和 tcpmux 代理
+	routers *vhostRouters
+	// vhost 端口的监听器
+	vhostListeners []net.Listener
+
+	// 客户端连接使用的 TLS 配置
+	tlsConfig *tls.Config
+
 	// 最顶层的“根上下文”
 	ctx context.Context
 	// 会让所有监听 ctxWithCancel.Done() 的协程退出
 	cancel context.CancelFunc
 }
 
-func NewService(cfg *m.ServerConfig) (*Service, error) {
+func NewService(cfg *m.ServerConfig, configFilePath string, strictConfig bool) (*Service, error) {
+	tlsConfig, err := transport.NewServerTLSConfig(
+		cfg.Transport.TLS.CertFile,
+		cfg.Transport.TLS.KeyFile,
+		cfg.Transport.TLS.TrustedCaFile)
+	if err != nil {
+		return nil, err
+	}
 
-	// TODO 这里可以加webserver,
+	authVerifier, err := auth.NewAuthVerifier(cfg.Auth)
+	if err != nil {
+		return nil, err
+	}
 
 	svr := &Service{
-		cfg:         cfg,
-		ctlManager:  NewControlManager(),
-		hookManager: hook.NewManager(),
-		ctx:         context.Background(),
+		configFilePath: configFilePath,
+		strictConfig:   strictConfig,
+		ctlManager:     NewControlManager(),
+		hookManager:    hook.NewManager(),
+		resource: &controller.ResourceController{
+			VisitorManager: visitor.NewManager(),
+		},
+		authVerifier: authVerifier,
+		proxyCounter: newProxyCounter(),
+		routers:      &vhostRouters{},
+		tlsConfig:    tlsConfig,
+		ctx:          context.Background(),
+	}
+	svr.cfg.Store(cfg)
+	if cfg.UsersFile != "" {
+		users, err := loadUsersFile(cfg.UsersFile, false)
+		if err != nil {
+			return nil, err
+		}
+		svr.users.Store(newUserDB(users))
+	}
+	if cfg.PolicyFile != "" {
+		policy, err := loadPolicyFile(cfg.PolicyFile, false)
+		if err != nil {
+			return nil, err
+		}
+		compiled, err := hook.NewPolicy(policy)
+		if err != nil {
+			return nil, err
+		}
+		svr.hookManager.SetPolicy(compiled)
+		svr.policyCfg = policy
+	}
+	svr.hookManager.Replace(newPlugins(cfg))
+
+	if cfg.WebServer.Port > 0 {
+		ws, err := web.NewServer(cfg.WebServer)
+		if err != nil {
+			return nil, fmt.Errorf("create web server error: %v", err)
+		}
+		svr.webServer = ws
+		svr.registerRouteHandlers(ws)
+	}
+
+	// 用户连接 http, https 和 tcpmux 代理的端口
+	vhostPorts := []struct {
+		port   int
+		router **vhostRouter
+		route  func(net.Conn, *vhostRouter) (string, net.Conn, error)
+	}{
+		{cfg.VhostHTTPPort, &svr.routers.http, routeHTTP},
+		{cfg.VhostHTTPSPort, &svr.routers.https, routeHTTPS},
+		{cfg.TCPMuxHTTPConnectPort, &svr.routers.tcpmux, routeTCPMux(cfg.TCPMuxPassthrough)},
+	}
+	for _, p := range vhostPorts {
+		if p.port <= 0 {
+			continue
+		}
+		address := net.JoinHostPort(cfg.ProxyBindAddr, strconv.Itoa(p.port))
+		l, err := net.Listen("tcp", address)
+		if err != nil {
+			svr.closeVhostListeners()
+			return nil, fmt.Errorf("create vhost listener error, %v", err)
+		}
+		*p.router = newVhostRouter()
+		svr.vhostListeners = append(svr.vhostListeners, l)
+		go svr.serveVhost(l, *p.router, p.route)
+		log.Infof("vhost listen on %s", address)
 	}
 
 	// Listen for accepting connections from client.
 	address := net.JoinHostPort(cfg.BindAddr, strconv.Itoa(cfg.BindPort))
 	ln, err := net.Listen("tcp", address)
 	if err != nil {
+		svr.closeVhostListeners()
 		return nil, fmt.Errorf("create server listener error, %v", err)
 	}
 	svr.muxer = cmux.New(ln)
 
-	tcpListener := ln.(*net.TCPListener)
-	_ = tcpListener.SetDeadline(time.Now().Add(time.Duration(cfg.Transport.TCPKeepAlive) * time.Second))
-
 	// 匹配所有 TCP 流量
 	defaultListener := svr.muxer.Match(cmux.Any())
 
@@ -97,6 +203,20 @@ func (svr *Service) Run(ctx context.Context) {
 	svr.ctx = ctx
 	svr.cancel = cancel
 
+	if svr.webServer != nil {
+		go func() {
+			log.Infof("web server listen on %s, tls [%v]", svr.webServer.Address(), svr.webServer.TLS())
+			if err := svr.webServer.Run(); err != nil {
+				log.Warnf("web server exit with error: %v", err)
+			}
+		}()
+	}
+
+	// 定期刷新认证 token
+	if r, ok := svr.authVerifier.(auth.Refresher); ok {
+		go r.RunRefresh(svr.ctx)
+	}
+
 	svr.HandleListener(svr.listener, false)
 
 	<-svr.ctx.Done()
@@ -110,27 +230,89 @@ func (svr *Service) Close() error {
 	if svr.listener != nil {
 		svr.listener.Close()
 	}
+	if svr.webServer != nil {
+		_ = svr.webServer.Close()
+	}
+	svr.closeVhostListeners()
 	svr.muxer.Close()
+	svr.hookManager.Close()
 	return nil
 }
 
+func (svr *Service) closeVhostListeners() {
+	for _, l := range svr.vhostListeners {
+		l.Close()
+	}
+}
+
 // HandleListener 处理监听
 func (svr *Service) HandleListener(l net.Listener, internal bool) {
 	for {
 		c, err := l.Accept()
 		if err != nil {
 			log.Warnf("listener for incoming connections from client closed")
+			return
 		}
 		ctx := context.Background()
 
 		// 开启一个新的线程处理 connection
 		go func(ctx context.Context, frpConn net.Conn) {
-			// 判断是否支持 TCP的多路复用器, 并且不是内部
-			//if lo.FromPtr(svr.cfg.Transport.TCPMux) && !internal {
-			//
-			//} else {
-			//}
-			svr.handleConnection(ctx, frpConn, internal)
+			cfg := svr.cfg.Load()
+			if !internal {
+				// 根据首字节判断是否为 TLS 连接
+				var (
+					isTLS, custom bool
+					err           error
+				)
+				frpConn, isTLS, custom, err = pkgNet.CheckAndEnableTLSServerConnWithTimeout(
+					frpConn, svr.tlsConfig, cfg.Transport.TLS.Force, connReadTimeout)
+				if err != nil {
+					log.Warnf("CheckAndEnableTLSServerConnWithTimeout error: %v", err)
+					c.Close()
+					return
+				}
+				log.Debugf("accept connection from [%s], tls [%v], custom first byte [%v]", c.RemoteAddr(), isTLS, custom)
+
+				// 完成握手, 记录客户端证书供 mtls 认证使用
+				if tlsConn, ok := frpConn.(*tls.Conn); ok {
+					hsCtx, cancel := context.WithTimeout(ctx, connReadTimeout)
+					err = tlsConn.HandshakeContext(hsCtx)
+					cancel()
+					if err != nil {
+						log.Warnf("tls handshake with [%s] error: %v", c.RemoteAddr(), err)
+						c.Close()
+						return
+					}
+					state := tlsConn.ConnectionState()
+					ctx = pkgNet.NewContextWithTLSState(ctx, &state)
+				}
+			}
+
+			// 判断是否支持 TCP 的多路复用器, 并且不是内部
+			if lo.FromPtr(cfg.Transport.TCPMux) && !internal {
+				fmuxCfg := fmux.DefaultConfig()
+				fmuxCfg.KeepAliveInterval = time.Duration(cfg.Transport.TCPMuxKeepaliveInterval) * time.Second
+				fmuxCfg.LogOutput = io.Discard
+				fmuxCfg.MaxStreamWindowSize = 6 * 1024 * 1024
+				session, err := fmux.Server(frpConn, fmuxCfg)
+				if err != nil {
+					log.Warnf("failed to create mux connection: %v", err)
+					frpConn.Close()
+					return
+				}
+
+				for {
+					stream, err := session.AcceptStream()
+					if err != nil {
+						log.Debugf("accept new mux stream error: %v", err)
+						session.Close()
+						return
+					}
+					go svr.handleConnection(ctx, stream, internal)
+				}
+			} else {
+				svr.handleConnection(ctx, frpConn, internal)
+			}
 		}(ctx, c)
 	}
 }
@@ -152,33 +334,46 @@ func (svr *Service) handleConnection(ctx context.Context, conn net.Conn, interna
 		var netErr net.Error
 		switch {
 		case errors.Is(err, io.EOF):
-			log.Warnf("client closed connection", "remote_addr", conn.RemoteAddr())
+			log.Warnf("client closed connection, remote_addr: %v", conn.RemoteAddr())
 		case errors.As(err, &netErr) && netErr.Timeout():
-			log.Warnf("read timeout", "remote_addr", conn.RemoteAddr())
+			log.Warnf("read timeout, remote_addr: %v", conn.RemoteAddr())
 		default:
-			log.Warnf("failed to read message", "remote_addr", conn.RemoteAddr(), "error", err)
+			log.Warnf("failed to read message, remote_addr: %v, error: %v", conn.RemoteAddr(), err)
 		}
 		return
 	}
 
+	// 连接的上下文中带有 TLS 状态, 之后从连接中取回
+	conn = pkgNet.NewContextConn(ctx, conn)
+
 	switch m := rawMsg.(type) {
 	case *msg.Login:
-		// server plugin hook
-		content := &hook.LoginContent{
-			Login:         *m,
-			ClientAddress: conn.RemoteAddr().String(),
-		}
-		retContent, err := svr.hookManager.Login(content)
+		// 客户端的代理名称以它发送的 user 为前缀
+		clientUser := m.User
+		err = svr.identifyLogin(conn, m, internal)
 		if err == nil {
-			m = &retContent.Login
-			err = svr.RegisterControl(conn, m, internal)
+			// server plugin hook
+			content := &hook.LoginContent{
+				Login:         *m,
+				ClientAddress: conn.RemoteAddr().String(),
+			}
+			var retContent *hook.LoginContent
+			retContent, err = svr.hookManager.Login(content)
+			if err == nil {
+				m = &retContent.Login
+				err = svr.RegisterControl(conn, m, clientUser, internal)
+			}
 		}
 
-		// 如果失败, 发送失败响应
-		_ = msg.WriteMsg(conn, &msg.LoginResp{
-			Version: version.Full(),
-			Error:   "验证失败",
-		})
+		// 登录失败时在这里返回错误信息，成功的响应由 Control.Start 发送
+		if err != nil {
+			log.Warnf("register control error: %v", err)
+			_ = msg.WriteMsg(conn, &msg.LoginResp{
+				Version: version.Full(),
+				Error:   util.GenerateResponseErrorString("register control error", err, lo.FromPtr(svr.cfg.Load().DetailedErrorsToClient)),
+			})
+			conn.Close()
+		}
 	case *msg.NewWorkConn:
 		if err := svr.RegisterWorkConn(conn, m); err != nil {
 			conn.Close()
@@ -204,8 +399,43 @@ func (svr *Service) handleConnection(ctx context.Context, conn net.Conn, interna
 }
 
 // RegisterControl 负责注册控制连接的核心逻辑
-func (svr *Service) RegisterControl(ctlConn net.Conn, loginMsg *msg.Login, internal bool) error {
-	// 1. 生成唯一 RunID
+func (svr *Service) RegisterControl(ctlConn net.Conn, loginMsg *msg.Login, clientUser string, internal bool) error {
+	// 1. 校验认证, 只有内部监听的连接可以通过 ClientSpec 跳过认证
+	// 认证需要在分配 RunID 之前完成, 因为客户端签名的是它发送的 RunID
+	authVerifier := svr.authVerifier
+	if internal && loginMsg.ClientSpec.AlwaysAuthPass {
+		authVerifier = auth.AlwaysPassVerifier
+	}
+	// 配置了用户文件时, 只有其中的用户可以登录, 并使用用户自己的 token
+	if db := svr.users.Load(); db != nil && authVerifier != auth.AlwaysPassVerifier {
+		user, ok := db.get(loginMsg.User)
+		if !ok {
+			return fmt.Errorf("user [%s] is not allowed to log in", loginMsg.User)
+		}
+		if v, ok := authVerifier.(*auth.TokenAuthSetterVerifier); ok && user.Token != "" {
+			authVerifier = v.WithToken(user.Token)
+		}
+	}
+	// 工作连接使用客户端签名登录的 token 加密, 其它认证方式使用配置的 token
+	sessionKey := []byte(svr.cfg.Load().Auth.Token)
+	// OIDC 等需要把之后的消息和登录的身份绑定, 每个客户端使用自己的 verifier
+	if sv, ok := authVerifier.(auth.SessionVerifier); ok {
+		sessionVerifier, err := sv.VerifyLoginSession(loginMsg)
+		if err != nil {
+			return err
+		}
+		authVerifier = sessionVerifier
+	} else if kv, ok := authVerifier.(auth.SessionKeyVerifier); ok {
+		key, err := kv.VerifyLoginWithSessionKey(loginMsg)
+		if err != nil {
+			return err
+		}
+		sessionKey = key
+	} else if err := authVerifier.VerifyLogin(loginMsg); err != nil {
+		return err
+	}
+
+	// 2. 生成唯一 RunID
 	if loginMsg.RunID == "" {
 		id, err := util.RandID()
 		if err != nil {
@@ -222,31 +452,28 @@ func (svr *Service) RegisterControl(ctlConn net.Conn, loginMsg *msg.Login, inter
 	log.Infof("client login info: ip [%s] version [%s] hostname [%s] os [%s] arch [%s]",
 		ctlConn.RemoteAddr().String(), loginMsg.Version, loginMsg.Hostname, loginMsg.Os, loginMsg.Arch)
 
-	// 3. 校验认证
-	//authVerifier := svr.authVerifier
-	//if internal && loginMsg.ClientSpec.AlwaysAuthPass {
-	//	authVerifier = auth.AlwaysPassVerifier
-	//}
-	//if err := authVerifier.VerifyLogin(loginMsg); err != nil {
-	//	return err
-	//}
-
-	// 4. 创建新的控制器
-	ctl, err := NewControl(ctx, ctlConn, svr.hookManager, loginMsg, svr.cfg)
+	// 3. 创建新的控制器
+	ctl, err := NewControl(ctx, ctlConn, authVerifier, svr.hookManager, loginMsg, &svr.cfg)
 	if err != nil {
 		log.Warnf("create new controller error: %v", err)
 		return fmt.Errorf("unexpected error when creating new controller")
 	}
-
-	// 5. 替换旧控制器（同 RunID）
+	ctl.clientUser = clientUser
+	ctl.users = &svr.users
+	ctl.proxyCounter = svr.proxyCounter
+	ctl.ctlManager = svr.ctlManager
+	ctl.routers = svr.routers
+	ctl.sessionKey = sessionKey
+
+	// 4. 替换旧控制器（同 RunID）
 	if oldCtl := svr.ctlManager.Add(loginMsg.RunID, ctl); oldCtl != nil {
 		oldCtl.WaitClosed()
 	}
 
-	// 6. 启动控制器
+	// 5. 启动控制器
 	ctl.Start()
 
-	// 7. 异步清理关闭的控制器
+	// 6. 异步清理关闭的控制器
 	go func() {
 		// block until control closed
 		ctl.WaitClosed()
@@ -256,6 +483,46 @@ func (svr *Service) RegisterControl(ctlConn net.Conn, loginMsg *msg.Login, inter
 	return err
 }
 
+// identifyLogin 对通过连接认证的客户端 (mtls), 用连接得到的身份替换登录消息中的 user 和 metas
+func (svr *Service) identifyLogin(conn net.Conn, loginMsg *msg.Login, internal bool) error {
+	identifier, ok := svr.authVerifier.(auth.Identifier)
+	if !ok || (internal && loginMsg.ClientSpec.AlwaysAuthPass) {
+		return nil
+	}
+	identity, err := identifier.Identify(pkgNet.TLSStateFromContext(pkgNet.NewContextFromConn(conn)))
+	if err != nil {
+		return err
+	}
+	loginMsg.User = identity.User
+	if len(identity.Metas) > 0 {
+		metas := make(map[string]string, len(loginMsg.Metas)+len(identity.Metas))
+		maps.Copy(metas, loginMsg.Metas)
+		maps.Copy(metas, identity.Metas)
+		loginMsg.Metas = metas
+	}
+	return nil
+}
+
+// verifyWorkConnIdentity 检查工作连接和控制连接来自同一个身份
+func verifyWorkConnIdentity(ctl *Control, workConn net.Conn) error {
+	identifier, ok := ctl.authVerifier.(auth.Identifier)
+	if !ok {
+		return nil
+	}
+	workIdentity, err := identifier.Identify(pkgNet.TLSStateFromContext(pkgNet.NewContextFromConn(workConn)))
+	if err != nil {
+		return err
+	}
+	ctlIdentity, err := identifier.Identify(pkgNet.TLSStateFromContext(pkgNet.NewContextFromConn(ctl.conn)))
+	if err != nil {
+		return err
+	}
+	if workIdentity.User != ctlIdentity.User {
+		return fmt.Errorf("user [%s] of the work connection doesn't match the control connection", workIdentity.User)
+	}
+	return nil
+}
+
 // RegisterWorkConn 注册 Work Conn（工作连接）
 func (svr *Service) RegisterWorkConn(workConn net.Conn, newMsg *msg.NewWorkConn) error {
 	ctl, exist := svr.ctlManager.GetByID(newMsg.RunID)
@@ -265,11 +532,7 @@ func (svr *Service) RegisterWorkConn(workConn net.Conn, newMsg *msg.NewWorkConn)
 	}
 	// server plugin hook
 	content := &hook.NewWorkConnContent{
-		User: hook.UserInfo{
-			User:  ctl.loginMsg.User,
-			Metas: ctl.loginMsg.Metas,
-			RunID: ctl.loginMsg.RunID,
-		},
+		User:        ctl.userInfo(),
 		NewWorkConn: *newMsg,
 	}
 	retContent, err := svr.hookManager.NewWorkConn(content)
@@ -278,6 +541,9 @@ func (svr *Service) RegisterWorkConn(workConn net.Conn, newMsg *msg.NewWorkConn)
 		// Check auth.
 		err = ctl.authVerifier.VerifyNewWorkConn(newMsg)
 	}
+	if err == nil {
+		err = verifyWorkConnIdentity(ctl, workConn)
+	}
 	if err != nil {
 		log.Warnf("invalid NewWorkConn with run id [%s]", newMsg.RunID)
 		_ = msg.WriteMsg(workConn, &msg.StartWorkConn{
@@ -298,5 +564,11 @@ func (svr *Service) RegisterVisitorConn(visitorConn net.Conn, newMsg *msg.NewVis
 		}
 		visitorUser = ctl.loginMsg.User
 	}
+	// 访客连接是 stcp 等代理的用户连接, 交给插件检查
+	if owner, ok := svr.ctlManager.GetByProxy(newMsg.ProxyName); ok {
+		if err := owner.handleUserConn(newMsg.ProxyName, visitorConn, visitorUser); err != nil {
+			return err
+		}
+	}
 	return svr.resource.VisitorManager.NewConn(visitorConn, newMsg, visitorUser)
 }
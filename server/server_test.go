@@ -0,0 +1,259 @@
+package server
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gk7790/gk-zap/pkg/auth"
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+	hook "github.com/gk7790/gk-zap/pkg/hook/server"
+	"github.com/gk7790/gk-zap/pkg/msg"
+)
+
+var testAuthScopes = []m.AuthScope{m.AuthScopeHeartBeats, m.AuthScopeNewWorkConns}
+
+// newTestService returns a service which verifies the token "secret" for
+// the logins, pings and work connections.
+func newTestService(t *testing.T) *Service {
+	t.Helper()
+	cfg := &m.ServerConfig{}
+	cfg.Complete()
+	svr := &Service{
+		ctlManager:   NewControlManager(),
+		hookManager:  hook.NewManager(),
+		authVerifier: auth.NewTokenAuth(testAuthScopes, "secret"),
+		proxyCounter: newProxyCounter(),
+	}
+	svr.cfg.Store(cfg)
+	t.Cleanup(func() { _ = svr.ctlManager.Close() })
+	return svr
+}
+
+// testClient is the client end of a control connection, the messages of
+// the server are read in the background.
+type testClient struct {
+	conn  net.Conn
+	msgCh chan msg.Message
+}
+
+func newTestClient(t *testing.T) (*testClient, net.Conn) {
+	t.Helper()
+	serverConn, clientConn := net.Pipe()
+	c := &testClient{conn: clientConn, msgCh: make(chan msg.Message, 100)}
+	go func() {
+		defer close(c.msgCh)
+		for {
+			rawMsg, err := msg.ReadMsg(clientConn)
+			if err != nil {
+				return
+			}
+			c.msgCh <- rawMsg
+		}
+	}()
+	t.Cleanup(func() { clientConn.Close() })
+	return c, serverConn
+}
+
+// pong waits for the next Pong of the server, other messages are skipped.
+func (c *testClient) pong(t *testing.T) *msg.Pong {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case rawMsg, ok := <-c.msgCh:
+			if !ok {
+				t.Fatal("control connection closed")
+			}
+			if pong, ok := rawMsg.(*msg.Pong); ok {
+				return pong
+			}
+		case <-timeout:
+			t.Fatal("timeout waiting for pong")
+		}
+	}
+}
+
+func signedLogin(t *testing.T, token, runID string) *msg.Login {
+	t.Helper()
+	login := &msg.Login{User: "alice", RunID: runID, Timestamp: time.Now().Unix()}
+	if err := auth.NewTokenAuth(testAuthScopes, token).SetLogin(login); err != nil {
+		t.Fatal(err)
+	}
+	return login
+}
+
+func TestRegisterControlAuth(t *testing.T) {
+	tests := []struct {
+		name     string
+		login    func(t *testing.T) *msg.Login
+		internal bool
+		wantErr  string
+	}{
+		{name: "valid token", login: func(t *testing.T) *msg.Login { return signedLogin(t, "secret", "run") }},
+		{
+			name:    "wrong token",
+			login:   func(t *testing.T) *msg.Login { return signedLogin(t, "wrong", "run") },
+			wantErr: "token in login",
+		},
+		{
+			name: "run id changed after signing",
+			login: func(t *testing.T) *msg.Login {
+				login := signedLogin(t, "secret", "run")
+				login.RunID = "other"
+				return login
+			},
+			wantErr: "token in login",
+		},
+		{
+			// only the internal listener may skip the authentication
+			name: "always auth pass from outside",
+			login: func(*testing.T) *msg.Login {
+				return &msg.Login{User: "alice", RunID: "run", ClientSpec: msg.ClientSpec{AlwaysAuthPass: true}}
+			},
+			wantErr: "token in login",
+		},
+		{
+			name: "always auth pass internal",
+			login: func(*testing.T) *msg.Login {
+				return &msg.Login{User: "alice", RunID: "run", ClientSpec: msg.ClientSpec{AlwaysAuthPass: true}}
+			},
+			internal: true,
+		},
+		{
+			name:     "internal without always auth pass",
+			login:    func(t *testing.T) *msg.Login { return signedLogin(t, "wrong", "run") },
+			internal: true,
+			wantErr:  "token in login",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svr := newTestService(t)
+			_, serverConn := newTestClient(t)
+			err := svr.RegisterControl(serverConn, tt.login(t), "alice", tt.internal)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				if _, ok := svr.ctlManager.GetByID("run"); ok {
+					t.Fatal("expected no control to be registered")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			ctl, ok := svr.ctlManager.GetByID("run")
+			if !ok {
+				t.Fatal("expected the control to be registered")
+			}
+			if tt.internal && ctl.authVerifier != auth.AlwaysPassVerifier {
+				t.Fatal("expected the internal client to skip the authentication")
+			}
+		})
+	}
+}
+
+func TestControlPingAuth(t *testing.T) {
+	svr := newTestService(t)
+	client, serverConn := newTestClient(t)
+	if err := svr.RegisterControl(serverConn, signedLogin(t, "secret", "run"), "alice", false); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		runID   string
+		wantErr string
+	}{
+		{name: "valid", token: "secret", runID: "run"},
+		{name: "wrong token", token: "wrong", runID: "run", wantErr: "token in heartbeat"},
+		// a heartbeat signed for another client
+		{name: "other run id", token: "secret", runID: "other", wantErr: "run id [other] of heartbeat doesn't match"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ping := &msg.Ping{RunID: tt.runID}
+			if err := auth.NewTokenAuth(testAuthScopes, tt.token).SetPing(ping); err != nil {
+				t.Fatal(err)
+			}
+			if err := msg.WriteMsg(client.conn, ping); err != nil {
+				t.Fatal(err)
+			}
+			pong := client.pong(t)
+			if tt.wantErr == "" && pong.Error != "" {
+				t.Fatalf("unexpected error: %s", pong.Error)
+			}
+			if tt.wantErr != "" && !strings.Contains(pong.Error, tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %q", tt.wantErr, pong.Error)
+			}
+		})
+	}
+
+	// a replayed heartbeat is rejected
+	ping := &msg.Ping{RunID: "run"}
+	if err := auth.NewTokenAuth(testAuthScopes, "secret").SetPing(ping); err != nil {
+		t.Fatal(err)
+	}
+	for i, wantErr := range []bool{false, true} {
+		if err := msg.WriteMsg(client.conn, ping); err != nil {
+			t.Fatal(err)
+		}
+		if got := client.pong(t).Error != ""; got != wantErr {
+			t.Fatalf("ping %d: expected error %v, got %v", i, wantErr, got)
+		}
+	}
+}
+
+func TestRegisterWorkConnAuth(t *testing.T) {
+	svr := newTestService(t)
+	_, serverConn := newTestClient(t)
+	if err := svr.RegisterControl(serverConn, signedLogin(t, "secret", "run"), "alice", false); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		runID   string
+		wantErr string
+	}{
+		{name: "valid", token: "secret", runID: "run"},
+		{name: "wrong token", token: "wrong", runID: "run", wantErr: "invalid NewWorkConn"},
+		{name: "unknown run id", token: "secret", runID: "other", wantErr: "no client control found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newWorkConn := &msg.NewWorkConn{RunID: tt.runID}
+			if err := auth.NewTokenAuth(testAuthScopes, tt.token).SetNewWorkConn(newWorkConn); err != nil {
+				t.Fatal(err)
+			}
+			client, workConn := newTestClient(t)
+			err := svr.RegisterWorkConn(workConn, newWorkConn)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+			if tt.runID != "run" {
+				return
+			}
+			// the client is told why its work connection is refused
+			select {
+			case rawMsg := <-client.msgCh:
+				if start, ok := rawMsg.(*msg.StartWorkConn); !ok || start.Error == "" {
+					t.Fatalf("expected a StartWorkConn with an error, got %#v", rawMsg)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("timeout waiting for StartWorkConn")
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"sync"
+
+	"github.com/gk7790/gk-zap/pkg/config"
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+	"github.com/gk7790/gk-zap/pkg/config/types"
+	"github.com/gk7790/gk-zap/pkg/config/validation"
+	"github.com/gk7790/gk-zap/pkg/msg"
+)
+
+// userDB 用户文件, 配置热加载时整体替换
+type userDB struct {
+	cfg   *m.UsersConfig
+	users map[string]*m.UserConfig
+}
+
+// loadUsersFile loads and validates the users file at path.
+func loadUsersFile(path string, strict bool) (*m.UsersConfig, error) {
+	c, err := config.LoadUsersConfig(path, strict)
+	if err != nil {
+		return nil, fmt.Errorf("load users file error: %v", err)
+	}
+	if err := validation.ValidateUsersConfig(c); err != nil {
+		return nil, fmt.Errorf("invalid users file %s: %v", path, err)
+	}
+	return c, nil
+}
+
+func newUserDB(c *m.UsersConfig) *userDB {
+	db := &userDB{
+		cfg:   c,
+		users: make(map[string]*m.UserConfig, len(c.Users)),
+	}
+	for i := range c.Users {
+		db.users[c.Users[i].Name] = &c.Users[i]
+	}
+	return db
+}
+
+func (db *userDB) get(name string) (*m.UserConfig, bool) {
+	u, ok := db.users[name]
+	return u, ok
+}
+
+// checkUserProxy checks that the proxy is within the entitlements of u.
+func checkUserProxy(u *m.UserConfig, pxyMsg *msg.NewProxy) error {
+	if len(u.ProxyTypes) > 0 && !slices.Contains(u.ProxyTypes, m.ProxyType(pxyMsg.ProxyType)) {
+		return fmt.Errorf("proxy type [%s] is not allowed for user [%s]", pxyMsg.ProxyType, u.Name)
+	}
+	if pxyMsg.RemotePort > 0 && len(u.AllowPorts) > 0 && !portInRanges(u.AllowPorts, pxyMsg.RemotePort) {
+		return fmt.Errorf("port [%d] is not allowed for user [%s]", pxyMsg.RemotePort, u.Name)
+	}
+	for _, domain := range pxyMsg.CustomDomains {
+		if len(u.AllowDomains) > 0 && !matchAny(u.AllowDomains, domain) {
+			return fmt.Errorf("custom domain [%s] is not allowed for user [%s]", domain, u.Name)
+		}
+	}
+	if pxyMsg.SubDomain != "" && len(u.AllowSubdomains) > 0 && !matchAny(u.AllowSubdomains, pxyMsg.SubDomain) {
+		return fmt.Errorf("subdomain [%s] is not allowed for user [%s]", pxyMsg.SubDomain, u.Name)
+	}
+	return nil
+}
+
+func portInRanges(ranges []types.PortsRange, port int) bool {
+	return slices.ContainsFunc(ranges, func(pr types.PortsRange) bool {
+		if pr.Single > 0 {
+			return port == pr.Single
+		}
+		return port >= pr.Start && port <= pr.End
+	})
+}
+
+func matchAny(patterns []string, name string) bool {
+	return slices.ContainsFunc(patterns, func(pattern string) bool {
+		ok, _ := path.Match(pattern, name)
+		return ok
+	})
+}
+
+// proxyCounter 统计每个用户在所有客户端上的代理数量
+type proxyCounter struct {
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+func newProxyCounter() *proxyCounter {
+	return &proxyCounter{counts: make(map[string]int64)}
+}
+
+// acquire counts a new proxy of user, it returns false if user already has
+// limit proxies. A limit of 0 means no limit.
+func (c *proxyCounter) acquire(user string, limit int64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if limit > 0 && c.counts[user] >= limit {
+		return false
+	}
+	c.counts[user]++
+	return true
+}
+
+// release uncounts n proxies of user.
+func (c *proxyCounter) release(user string, n int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[user] -= n
+	if c.counts[user] <= 0 {
+		delete(c.counts, user)
+	}
+}
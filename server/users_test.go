@@ -0,0 +1,217 @@
+package server
+
+import (
+	"context"
+	"net"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	m "github.com/gk7790/gk-zap/pkg/config/model"
+	"github.com/gk7790/gk-zap/pkg/config/types"
+	hook "github.com/gk7790/gk-zap/pkg/hook/server"
+	"github.com/gk7790/gk-zap/pkg/msg"
+	"github.com/gk7790/gk-zap/pkg/utils/log"
+)
+
+func TestMain(tm *testing.M) {
+	log.Init(false, "", log.LevelError)
+	os.Exit(tm.Run())
+}
+
+func TestCheckUserProxy(t *testing.T) {
+	alice := &m.UserConfig{
+		Name:            "alice",
+		AllowPorts:      []types.PortsRange{{Single: 22}, {Start: 6000, End: 6010}},
+		AllowDomains:    []string{"*.example.com", "example.org"},
+		AllowSubdomains: []string{"alice-*"},
+		ProxyTypes:      []m.ProxyType{m.ProxyTypeTCP, m.ProxyTypeHTTP},
+	}
+	unlimited := &m.UserConfig{Name: "bob"}
+
+	tests := []struct {
+		name    string
+		user    *m.UserConfig
+		pxyMsg  msg.NewProxy
+		wantErr string
+	}{
+		{"single port", alice, msg.NewProxy{ProxyType: "tcp", RemotePort: 22}, ""},
+		{"port in range", alice, msg.NewProxy{ProxyType: "tcp", RemotePort: 6010}, ""},
+		{"random port", alice, msg.NewProxy{ProxyType: "tcp"}, ""},
+		{"port out of range", alice, msg.NewProxy{ProxyType: "tcp", RemotePort: 6011}, "port [6011] is not allowed"},
+		{"type not allowed", alice, msg.NewProxy{ProxyType: "udp", RemotePort: 22}, "proxy type [udp] is not allowed"},
+		{"domain pattern", alice, msg.NewProxy{ProxyType: "http", CustomDomains: []string{"a.example.com"}}, ""},
+		{"exact domain", alice, msg.NewProxy{ProxyType: "http", CustomDomains: []string{"example.org"}}, ""},
+		{
+			"one domain not allowed", alice,
+			msg.NewProxy{ProxyType: "http", CustomDomains: []string{"a.example.com", "example.net"}},
+			"custom domain [example.net] is not allowed",
+		},
+		{"pattern doesn't match the parent", alice, msg.NewProxy{ProxyType: "http", CustomDomains: []string{"example.com"}}, "is not allowed"},
+		{"subdomain", alice, msg.NewProxy{ProxyType: "http", SubDomain: "alice-web"}, ""},
+		{"subdomain not allowed", alice, msg.NewProxy{ProxyType: "http", SubDomain: "bob-web"}, "subdomain [bob-web] is not allowed"},
+		{
+			"no restrictions", unlimited,
+			msg.NewProxy{ProxyType: "udp", RemotePort: 7000, CustomDomains: []string{"x.net"}, SubDomain: "x"},
+			"",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkUserProxy(tt.user, &tt.pxyMsg)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestProxyCounter(t *testing.T) {
+	c := newProxyCounter()
+	steps := []struct {
+		acquire bool
+		user    string
+		limit   int64
+		release int64
+		want    bool
+	}{
+		{acquire: true, user: "alice", limit: 2, want: true},
+		{acquire: true, user: "alice", limit: 2, want: true},
+		{acquire: true, user: "alice", limit: 2, want: false},
+		// the limit is per user
+		{acquire: true, user: "bob", limit: 2, want: true},
+		// 0 means no limit
+		{acquire: true, user: "alice", limit: 0, want: true},
+		{user: "alice", release: 2},
+		{acquire: true, user: "alice", limit: 2, want: true},
+		{acquire: true, user: "alice", limit: 2, want: false},
+	}
+	for i, s := range steps {
+		if !s.acquire {
+			c.release(s.user, s.release)
+			continue
+		}
+		if got := c.acquire(s.user, s.limit); got != s.want {
+			t.Fatalf("step %d: acquire(%s, %d) = %v, want %v", i, s.user, s.limit, got, s.want)
+		}
+	}
+
+	// the users without proxies are removed
+	c.release("alice", 2)
+	c.release("bob", 1)
+	if len(c.counts) != 0 {
+		t.Fatalf("expected no counts left, got %v", c.counts)
+	}
+}
+
+// newTestControl returns a control of user whose client is the other end of
+// the returned connection.
+func newTestControl(t *testing.T, user string, users *atomic.Pointer[userDB], counter *proxyCounter,
+	ctlManager *ControlManager, serverCfg *m.ServerConfig,
+) (*Control, net.Conn) {
+	t.Helper()
+	var cfg atomic.Pointer[m.ServerConfig]
+	cfg.Store(serverCfg)
+	serverConn, clientConn := net.Pipe()
+	ctl, err := NewControl(context.Background(), serverConn, nil, hook.NewManager(),
+		&msg.Login{User: user, RunID: user + "-run"}, &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctl.users = users
+	ctl.proxyCounter = counter
+	ctl.ctlManager = ctlManager
+	ctl.routers = &vhostRouters{http: newVhostRouter(), https: newVhostRouter(), tcpmux: newVhostRouter()}
+	t.Cleanup(func() { clientConn.Close() })
+	return ctl, clientConn
+}
+
+func TestControlProxyLimits(t *testing.T) {
+	var users atomic.Pointer[userDB]
+	users.Store(newUserDB(&m.UsersConfig{Users: []m.UserConfig{
+		{Name: "alice", MaxProxies: 2},
+		{Name: "bob"},
+	}}))
+	counter := newProxyCounter()
+	ctlManager := NewControlManager()
+	serverCfg := &m.ServerConfig{MaxPortsPerClient: 2}
+
+	ctl1, _ := newTestControl(t, "alice", &users, counter, ctlManager, serverCfg)
+	ctl2, client2 := newTestControl(t, "alice", &users, counter, ctlManager, serverCfg)
+
+	register := func(ctl *Control, name, pxyType string) error {
+		_, err := ctl.RegisterProxy(&msg.NewProxy{ProxyName: name, ProxyType: pxyType})
+		return err
+	}
+
+	// the limit of the user is shared by all its clients
+	if err := register(ctl1, "alice.a", "tcp"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := register(ctl1, "alice.a", "tcp"); err == nil || !strings.Contains(err.Error(), "already registered") {
+		t.Fatalf("expected duplicate error, got %v", err)
+	}
+	if err := register(ctl2, "alice.b", "http"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := register(ctl1, "alice.c", "tcp"); err == nil || !strings.Contains(err.Error(), "limit of 2 proxies") {
+		t.Fatalf("expected proxy limit error, got %v", err)
+	}
+
+	// closing a proxy releases it
+	if err := ctl1.CloseProxy(&msg.CloseProxy{ProxyName: "alice.a"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := ctl1.CloseProxy(&msg.CloseProxy{ProxyName: "alice.a"}); err == nil {
+		t.Fatal("expected error for a proxy which isn't registered")
+	}
+	if err := register(ctl1, "alice.c", "tcp"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the exit of a client releases all its proxies
+	go ctl2.worker()
+	client2.Close()
+	select {
+	case <-ctl2.doneCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("control didn't exit")
+	}
+	if err := register(ctl1, "alice.d", "tcp"); err != nil {
+		t.Fatalf("unexpected error after the other client exited: %v", err)
+	}
+
+	// maxPortsPerClient limits the tcp and udp proxies of a single client
+	if err := register(ctl1, "alice.e", "udp"); err == nil {
+		t.Fatal("expected an error")
+	}
+	ctl3, _ := newTestControl(t, "bob", &users, counter, ctlManager, serverCfg)
+	for _, name := range []string{"bob.a", "bob.b"} {
+		if err := register(ctl3, name, "udp"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := register(ctl3, "bob.web", "http"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := register(ctl3, "bob.c", "tcp"); err == nil || !strings.Contains(err.Error(), "limit of 2 ports") {
+		t.Fatalf("expected port limit error, got %v", err)
+	}
+	if counter.counts["bob"] != 3 {
+		t.Fatalf("expected the rejected proxy not to be counted, got %d", counter.counts["bob"])
+	}
+
+	// users removed from the users file can't register proxies anymore
+	users.Store(newUserDB(&m.UsersConfig{Users: []m.UserConfig{{Name: "alice"}}}))
+	if err := register(ctl3, "bob.d", "http"); err == nil || !strings.Contains(err.Error(), "not allowed anymore") {
+		t.Fatalf("expected removed user error, got %v", err)
+	}
+}
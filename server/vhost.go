@@ -0,0 +1,249 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gk7790/gk-zap/pkg/utils/log"
+)
+
+// vhostRouter routes the connections of a vhost port to the proxies by the
+// domain the user asked for.
+type vhostRouter struct {
+	mu sync.RWMutex
+	// routes maps the domains to the names of the proxies
+	routes map[string]string
+}
+
+func newVhostRouter() *vhostRouter {
+	return &vhostRouter{routes: make(map[string]string)}
+}
+
+// add routes the domains to the proxy name, nothing is added if one of them
+// is already taken by another proxy.
+func (r *vhostRouter) add(name string, domains []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, domain := range domains {
+		if owner, ok := r.routes[domain]; ok && owner != name {
+			return fmt.Errorf("domain [%s] is already used by another proxy", domain)
+		}
+	}
+	for _, domain := range domains {
+		r.routes[domain] = name
+	}
+	return nil
+}
+
+// del removes the domains of the proxy name.
+func (r *vhostRouter) del(name string, domains []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, domain := range domains {
+		if r.routes[domain] == name {
+			delete(r.routes, domain)
+		}
+	}
+}
+
+// get returns the proxy of host, a domain like "*.example.com" matches all
+// the subdomains of example.com which don't have a route of their own.
+func (r *vhostRouter) get(host string) (string, bool) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if name, ok := r.routes[host]; ok {
+		return name, true
+	}
+	for domain := host; ; {
+		i := strings.IndexByte(domain, '.')
+		if i < 0 {
+			return "", false
+		}
+		domain = domain[i+1:]
+		if name, ok := r.routes["*."+domain]; ok {
+			return name, true
+		}
+	}
+}
+
+// vhostRouters are the routers of the vhost ports, a router is nil if its
+// port isn't enabled.
+type vhostRouters struct {
+	http   *vhostRouter
+	https  *vhostRouter
+	tcpmux *vhostRouter
+}
+
+// router returns the router of the proxies of pxyType.
+func (rs *vhostRouters) router(pxyType string) (*vhostRouter, string) {
+	if rs == nil {
+		return nil, ""
+	}
+	switch pxyType {
+	case "http":
+		return rs.http, "vhostHTTPPort"
+	case "https":
+		return rs.https, "vhostHTTPSPort"
+	default:
+		return rs.tcpmux, "tcpmuxHTTPConnectPort"
+	}
+}
+
+// replayConn is a connection whose first bytes were read to route it, they
+// are read again from r.
+type replayConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func newReplayConn(c net.Conn, read []byte) *replayConn {
+	return &replayConn{Conn: c, r: io.MultiReader(bytes.NewReader(read), c)}
+}
+
+func (c *replayConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// readOnlyConn lets the TLS server read the ClientHello without answering.
+type readOnlyConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c readOnlyConn) Read(p []byte) (int, error) { return c.r.Read(p) }
+
+func (c readOnlyConn) Write([]byte) (int, error) { return 0, io.ErrClosedPipe }
+
+var errHelloRead = errors.New("client hello read")
+
+// readHTTPHost reads the head of the first request of c and returns its Host.
+func readHTTPHost(c net.Conn) (host string, read []byte, req *http.Request, err error) {
+	var buf bytes.Buffer
+	req, err = http.ReadRequest(bufio.NewReader(io.TeeReader(c, &buf)))
+	if err != nil {
+		return "", buf.Bytes(), nil, err
+	}
+	return req.Host, buf.Bytes(), req, nil
+}
+
+// readTLSServerName reads the ClientHello of c and returns its SNI.
+func readTLSServerName(c net.Conn) (host string, read []byte, err error) {
+	var buf bytes.Buffer
+	err = tls.Server(readOnlyConn{Conn: c, r: io.TeeReader(c, &buf)}, &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			host = hello.ServerName
+			return nil, errHelloRead
+		},
+	}).Handshake()
+	if !errors.Is(err, errHelloRead) {
+		return "", buf.Bytes(), fmt.Errorf("read tls client hello error: %v", err)
+	}
+	if host == "" {
+		return "", buf.Bytes(), fmt.Errorf("no server name in tls client hello")
+	}
+	return host, buf.Bytes(), nil
+}
+
+// serveVhost accepts the user connections of a vhost port, route reads the
+// domain of a connection and returns the connection to hand to the proxy.
+func (svr *Service) serveVhost(l net.Listener, router *vhostRouter, route func(net.Conn, *vhostRouter) (string, net.Conn, error)) {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			log.Debugf("vhost listener [%s] closed: %v", l.Addr(), err)
+			return
+		}
+		go func() {
+			_ = c.SetReadDeadline(time.Now().Add(connReadTimeout))
+			name, userConn, err := route(c, router)
+			_ = c.SetReadDeadline(time.Time{})
+			if err != nil {
+				log.Debugf("route vhost connection from [%s] error: %v", c.RemoteAddr(), err)
+				c.Close()
+				return
+			}
+			ctl, ok := svr.ctlManager.GetByProxy(name)
+			if !ok {
+				c.Close()
+				return
+			}
+			ctl.handleProxyConn(name, userConn)
+		}()
+	}
+}
+
+func routeHTTP(c net.Conn, router *vhostRouter) (string, net.Conn, error) {
+	host, read, _, err := readHTTPHost(c)
+	if err != nil {
+		return "", nil, err
+	}
+	name, ok := router.get(host)
+	if !ok {
+		_, _ = io.WriteString(c, "HTTP/1.1 404 Not Found\r\nContent-Length: 0\r\nConnection: close\r\n\r\n")
+		return "", nil, fmt.Errorf("no proxy for host [%s]", host)
+	}
+	return name, newReplayConn(c, read), nil
+}
+
+func routeHTTPS(c net.Conn, router *vhostRouter) (string, net.Conn, error) {
+	host, read, err := readTLSServerName(c)
+	if err != nil {
+		return "", nil, err
+	}
+	name, ok := router.get(host)
+	if !ok {
+		return "", nil, fmt.Errorf("no proxy for server name [%s]", host)
+	}
+	return name, newReplayConn(c, read), nil
+}
+
+// routeTCPMux returns the router of the tcpmux port, the users open a
+// tunnel with HTTP CONNECT. With passthrough the CONNECT request is sent to
+// the client instead of being answered by gks.
+func routeTCPMux(passthrough bool) func(net.Conn, *vhostRouter) (string, net.Conn, error) {
+	return func(c net.Conn, router *vhostRouter) (string, net.Conn, error) {
+		host, read, req, err := readHTTPHost(c)
+		if err != nil {
+			return "", nil, err
+		}
+		if req.Method != http.MethodConnect {
+			_, _ = io.WriteString(c, "HTTP/1.1 405 Method Not Allowed\r\nContent-Length: 0\r\nConnection: close\r\n\r\n")
+			return "", nil, fmt.Errorf("method [%s] is not CONNECT", req.Method)
+		}
+		name, ok := router.get(host)
+		if !ok {
+			_, _ = io.WriteString(c, "HTTP/1.1 404 Not Found\r\nContent-Length: 0\r\nConnection: close\r\n\r\n")
+			return "", nil, fmt.Errorf("no proxy for host [%s]", host)
+		}
+		if passthrough {
+			return name, newReplayConn(c, read), nil
+		}
+		if _, err := io.WriteString(c, "HTTP/1.1 200 OK\r\n\r\n"); err != nil {
+			return "", nil, err
+		}
+		// the bytes read after the CONNECT request belong to the tunnel
+		return name, newReplayConn(c, afterHead(read)), nil
+	}
+}
+
+// afterHead returns the bytes of read after the end of the request head.
+func afterHead(read []byte) []byte {
+	if _, rest, ok := bytes.Cut(read, []byte("\r\n\r\n")); ok {
+		return rest
+	}
+	return nil
+}
@@ -4,10 +4,12 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"slices"
 	"sync"
 
 	"github.com/gk7790/gk-zap/pkg/msg"
 	pkgNet "github.com/gk7790/gk-zap/pkg/net"
+	"github.com/gk7790/gk-zap/pkg/utils/util"
 )
 
 type listenerBundle struct {
@@ -53,24 +55,27 @@ func (mg *Manager) NewConn(conn net.Conn, newMsg *msg.NewVisitorConn, visitorUse
 
 	if l, ok := mg.listeners[name]; ok {
 		// 验证连接签名是否正确
-		//if util.GetAuthKey(l.sk, newMsg.Timestamp) != newMsg.SignKey {
-		//	err = fmt.Errorf("visitor connection of [%s] auth failed", name)
-		//	return
-		//}
+		if !util.ConstantTimeEqString(util.GetAuthKey(l.sk, newMsg.Timestamp), newMsg.SignKey) {
+			err = fmt.Errorf("visitor connection of [%s] auth failed", name)
+			return
+		}
 		// 检查访问权限
-		//if !slices.Contains(l.allowUsers, visitorUser) && !slices.Contains(l.allowUsers, "*") {
-		//	err = fmt.Errorf("visitor connection of [%s] user [%s] not allowed", name, visitorUser)
-		//	return
-		//}
+		if !slices.Contains(l.allowUsers, visitorUser) && !slices.Contains(l.allowUsers, "*") {
+			err = fmt.Errorf("visitor connection of [%s] user [%s] not allowed", name, visitorUser)
+			return
+		}
 
 		var rwc io.ReadWriteCloser = conn
 		// 如果启用了加密（`useEncryption=true`）
 		if newMsg.UseEncryption {
-			// TODO 加密处理
+			if rwc, err = pkgNet.WithEncryption(rwc, []byte(l.sk)); err != nil {
+				err = fmt.Errorf("create encryption connection failed: %v", err)
+				return
+			}
 		}
 		// 控制是否对传输的数据进行压缩
 		if newMsg.UseCompression {
-			// TODO 控制是否对传输的数据进行压缩
+			rwc = pkgNet.WithCompression(rwc)
 		}
 
 		err = l.l.PutConn(pkgNet.WrapReadWriteCloserToConn(rwc, conn))